@@ -2,12 +2,15 @@ package ast
 
 import (
 	"bytes"
+	"strings"
 	"turatti/token"
 )
 
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position
+	End() token.Position
 }
 
 type Statement interface {
@@ -22,6 +25,7 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+	Comments   []token.Token
 }
 
 func (p *Program) TokenLiteral() string {
@@ -40,40 +44,83 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Position{}
+}
+
 type Identifier struct {
 	Token token.Token
 	Value string
 }
 
 func (i *Identifier) expressionNode() {}
+func (i *Identifier) patternNode()    {}
 func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
 func (i *Identifier) String() string {
 	return i.Value
 }
+func (i *Identifier) Pos() token.Position { return i.Token.Pos() }
+func (i *Identifier) End() token.Position { return i.Token.End() }
 
 type DefStatement struct {
-	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Export token.Token // the export keyword, unset unless exported
+	Token  token.Token
+	// Name is the identifier the value is bound to, or an array or hash
+	// pattern destructuring it.
+	Name      Pattern
+	Type      *TypeExpression // nil without an annotation
+	Value     Expression
+	Semicolon token.Token
 }
 
 func (ds *DefStatement) statementNode()       {}
 func (ds *DefStatement) TokenLiteral() string { return ds.Token.Literal }
 func (ds *DefStatement) String() string {
 	var out bytes.Buffer
-	out.WriteString(ds.TokenLiteral() + " " + ds.Name.String() + " = ")
+	if ds.Exported() {
+		out.WriteString(ds.Export.Literal + " ")
+	}
+	out.WriteString(ds.TokenLiteral() + " " + ds.Name.String())
+	if ds.Type != nil {
+		out.WriteString(": " + ds.Type.String())
+	}
+	out.WriteString(" = ")
 	if ds.Value != nil {
 		out.WriteString(ds.Value.String())
 	}
 	out.WriteString(";")
 	return out.String()
 }
+func (ds *DefStatement) Pos() token.Position {
+	if ds.Exported() {
+		return ds.Export.Pos()
+	}
+	return ds.Token.Pos()
+}
+
+// Exported reports whether the definition is visible to the programs that
+// import the module it is in.
+func (ds *DefStatement) Exported() bool { return ds.Export.Type != "" }
+func (ds *DefStatement) End() token.Position {
+	return statementEnd(ds.Semicolon, ds.Value, ds.Name)
+}
 
 type ReturnStatement struct {
 	Token       token.Token
 	ReturnValue Expression
+	Semicolon   token.Token
 }
 
 func (rs *ReturnStatement) statementNode()       {}
@@ -87,10 +134,34 @@ func (rs *ReturnStatement) String() string {
 	out.WriteString(";")
 	return out.String()
 }
+func (rs *ReturnStatement) Pos() token.Position { return rs.Token.Pos() }
+func (rs *ReturnStatement) End() token.Position {
+	if rs.Semicolon.Type == "" && rs.ReturnValue == nil {
+		return rs.Token.End()
+	}
+	return statementEnd(rs.Semicolon, rs.ReturnValue, nil)
+}
+
+type ThrowStatement struct {
+	Token     token.Token
+	Value     Expression
+	Semicolon token.Token
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	return ts.TokenLiteral() + " " + ts.Value.String() + ";"
+}
+func (ts *ThrowStatement) Pos() token.Position { return ts.Token.Pos() }
+func (ts *ThrowStatement) End() token.Position {
+	return statementEnd(ts.Semicolon, ts.Value, nil)
+}
 
 type ExpressionStatement struct {
 	Token      token.Token
 	Expression Expression
+	Semicolon  token.Token
 }
 
 func (es *ExpressionStatement) statementNode()       {}
@@ -101,6 +172,38 @@ func (es *ExpressionStatement) String() string {
 	}
 	return ""
 }
+func (es *ExpressionStatement) Pos() token.Position {
+	if es.Expression != nil {
+		return es.Expression.Pos()
+	}
+	return es.Token.Pos()
+}
+func (es *ExpressionStatement) End() token.Position {
+	if es.Semicolon.Type == "" && es.Expression == nil {
+		return es.Token.End()
+	}
+	return statementEnd(es.Semicolon, es.Expression, nil)
+}
+
+type BlockStatement struct {
+	Token      token.Token
+	Statements []Statement
+	Rbrace     token.Token
+}
+
+func (bs *BlockStatement) statementNode()       {}
+func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("{")
+	for _, s := range bs.Statements {
+		out.WriteString(s.String())
+	}
+	out.WriteString("}")
+	return out.String()
+}
+func (bs *BlockStatement) Pos() token.Position { return bs.Token.Pos() }
+func (bs *BlockStatement) End() token.Position { return bs.Rbrace.End() }
 
 type PrefixExpression struct {
 	Token    token.Token
@@ -118,6 +221,13 @@ func (pe *PrefixExpression) String() string {
 	out.WriteString(")")
 	return out.String()
 }
+func (pe *PrefixExpression) Pos() token.Position { return pe.Token.Pos() }
+func (pe *PrefixExpression) End() token.Position {
+	if pe.Right == nil {
+		return pe.Token.End()
+	}
+	return pe.Right.End()
+}
 
 type InfixExpression struct {
 	Token    token.Token
@@ -137,6 +247,13 @@ func (ie *InfixExpression) String() string {
 	out.WriteString(")")
 	return out.String()
 }
+func (ie *InfixExpression) Pos() token.Position { return ie.Left.Pos() }
+func (ie *InfixExpression) End() token.Position {
+	if ie.Right == nil {
+		return ie.Token.End()
+	}
+	return ie.Right.End()
+}
 
 type IntegerLiteral struct {
 	Token token.Token
@@ -146,3 +263,492 @@ type IntegerLiteral struct {
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos() }
+func (il *IntegerLiteral) End() token.Position  { return il.Token.End() }
+
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos() }
+func (fl *FloatLiteral) End() token.Position  { return fl.Token.End() }
+
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode()      {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) String() string       { return "\"" + sl.Token.Literal + "\"" }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos() }
+func (sl *StringLiteral) End() token.Position  { return sl.Token.End() }
+
+type Boolean struct {
+	Token token.Token
+	Value bool
+}
+
+func (b *Boolean) expressionNode()      {}
+func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) String() string       { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position  { return b.Token.Pos() }
+func (b *Boolean) End() token.Position  { return b.Token.End() }
+
+type IfExpression struct {
+	Token       token.Token
+	Condition   Expression
+	Consequence *BlockStatement
+	Alternative *BlockStatement
+}
+
+func (ie *IfExpression) expressionNode()      {}
+func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("if ")
+	out.WriteString(ie.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ie.Consequence.String())
+	if ie.Alternative != nil {
+		out.WriteString(" else ")
+		out.WriteString(ie.Alternative.String())
+	}
+	return out.String()
+}
+func (ie *IfExpression) Pos() token.Position { return ie.Token.Pos() }
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	return ie.Consequence.End()
+}
+
+// TryExpression runs Block and, if it raises an error, Catch with the
+// error bound to Parameter. Finally runs in any case. Either Catch or
+// Finally may be nil, but not both.
+type TryExpression struct {
+	Token     token.Token
+	Block     *BlockStatement
+	Parameter *Identifier
+	Catch     *BlockStatement
+	Finally   *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+	if te.Catch != nil {
+		out.WriteString(" catch (" + te.Parameter.String() + ") ")
+		out.WriteString(te.Catch.String())
+	}
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+	return out.String()
+}
+func (te *TryExpression) Pos() token.Position { return te.Token.Pos() }
+func (te *TryExpression) End() token.Position {
+	if te.Finally != nil {
+		return te.Finally.End()
+	}
+	if te.Catch != nil {
+		return te.Catch.End()
+	}
+	return te.Block.End()
+}
+
+type FunctionLiteral struct {
+	Token token.Token
+	// Parameters are identifiers, or array and hash patterns destructuring
+	// their arguments.
+	Parameters []Pattern
+	// ParameterTypes is nil when no parameter is annotated, and otherwise
+	// holds the annotation of each parameter or nil.
+	ParameterTypes []*TypeExpression
+	ReturnType     *TypeExpression
+	Body           *BlockStatement
+}
+
+// ParameterType returns the annotation of the i-th parameter, or nil.
+func (fl *FunctionLiteral) ParameterType(i int) *TypeExpression {
+	if i < len(fl.ParameterTypes) {
+		return fl.ParameterTypes[i]
+	}
+	return nil
+}
+
+func (fl *FunctionLiteral) expressionNode()      {}
+func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) String() string {
+	params := []string{}
+	for i, p := range fl.Parameters {
+		if t := fl.ParameterType(i); t != nil {
+			params = append(params, p.String()+": "+t.String())
+		} else {
+			params = append(params, p.String())
+		}
+	}
+	var out bytes.Buffer
+	out.WriteString(fl.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(")")
+	if fl.ReturnType != nil {
+		out.WriteString(": " + fl.ReturnType.String())
+	}
+	out.WriteString(" ")
+	out.WriteString(fl.Body.String())
+	return out.String()
+}
+func (fl *FunctionLiteral) Pos() token.Position { return fl.Token.Pos() }
+func (fl *FunctionLiteral) End() token.Position { return fl.Body.End() }
+
+type CallExpression struct {
+	Token     token.Token
+	Function  Expression
+	Arguments []Expression
+	Rparen    token.Token
+}
+
+func (ce *CallExpression) expressionNode()      {}
+func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) String() string {
+	args := []string{}
+	for _, a := range ce.Arguments {
+		args = append(args, a.String())
+	}
+	var out bytes.Buffer
+	out.WriteString(ce.Function.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+	return out.String()
+}
+func (ce *CallExpression) Pos() token.Position { return ce.Function.Pos() }
+func (ce *CallExpression) End() token.Position { return ce.Rparen.End() }
+
+type ArrayLiteral struct {
+	Token    token.Token
+	Elements []Expression
+	Rbracket token.Token
+}
+
+func (al *ArrayLiteral) expressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) String() string {
+	elements := []string{}
+	for _, e := range al.Elements {
+		elements = append(elements, e.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+func (al *ArrayLiteral) Pos() token.Position { return al.Token.Pos() }
+func (al *ArrayLiteral) End() token.Position { return al.Rbracket.End() }
+
+// HashPair is a single key: value entry of a hash literal.
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+// HashLiteral keeps its pairs in source order, so printing and evaluating
+// it is deterministic.
+type HashLiteral struct {
+	Token  token.Token
+	Pairs  []HashPair
+	Rbrace token.Token
+}
+
+func (hl *HashLiteral) expressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) String() string {
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+func (hl *HashLiteral) Pos() token.Position { return hl.Token.Pos() }
+func (hl *HashLiteral) End() token.Position { return hl.Rbrace.End() }
+
+type IndexExpression struct {
+	Token    token.Token
+	Left     Expression
+	Index    Expression
+	Rbracket token.Token
+}
+
+func (ie *IndexExpression) expressionNode()      {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) String() string {
+	return "(" + ie.Left.String() + "[" + ie.Index.String() + "])"
+}
+func (ie *IndexExpression) Pos() token.Position { return ie.Left.Pos() }
+func (ie *IndexExpression) End() token.Position { return ie.Rbracket.End() }
+
+// ImportStatement binds Alias to the module loaded from Path.
+type ImportStatement struct {
+	Token     token.Token
+	Path      *StringLiteral
+	Alias     *Identifier
+	Semicolon token.Token
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	return is.TokenLiteral() + " " + is.Path.String() + " as " + is.Alias.String() + ";"
+}
+func (is *ImportStatement) Pos() token.Position { return is.Token.Pos() }
+func (is *ImportStatement) End() token.Position {
+	return statementEnd(is.Semicolon, is.Alias, is.Path)
+}
+
+// MemberExpression selects the export Member of the module Left evaluates
+// to, as in util.name.
+type MemberExpression struct {
+	Token  token.Token // the .
+	Left   Expression
+	Member *Identifier
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) String() string {
+	return "(" + me.Left.String() + "." + me.Member.String() + ")"
+}
+func (me *MemberExpression) Pos() token.Position { return me.Left.Pos() }
+func (me *MemberExpression) End() token.Position { return me.Member.End() }
+
+// PropagateExpression unwraps the ok result Value evaluates to, or returns
+// it from the enclosing function if it is an err, as in parse(s)?.
+type PropagateExpression struct {
+	Token token.Token // the ?
+	Value Expression
+}
+
+func (pe *PropagateExpression) expressionNode()      {}
+func (pe *PropagateExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PropagateExpression) String() string {
+	return "(" + pe.Value.String() + "?)"
+}
+func (pe *PropagateExpression) Pos() token.Position { return pe.Value.Pos() }
+func (pe *PropagateExpression) End() token.Position { return pe.Token.End() }
+
+// MatchExpression evaluates to the body of the first arm whose pattern
+// matches Value and whose guard, if any, holds, or to null if none does.
+type MatchExpression struct {
+	Token  token.Token // the match keyword
+	Value  Expression
+	Arms   []MatchArm
+	Rbrace token.Token
+}
+
+// MatchArm is a single pattern [if guard] => body arm of a match.
+type MatchArm struct {
+	Pattern Pattern
+	Guard   Expression // nil without a guard
+	Body    Expression
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) String() string {
+	arms := []string{}
+	for _, arm := range me.Arms {
+		s := arm.Pattern.String()
+		if arm.Guard != nil {
+			s += " if " + arm.Guard.String()
+		}
+		arms = append(arms, s+" => "+arm.Body.String())
+	}
+	return "match " + me.Value.String() + " {" + strings.Join(arms, ", ") + "}"
+}
+func (me *MatchExpression) Pos() token.Position { return me.Token.Pos() }
+func (me *MatchExpression) End() token.Position { return me.Rbrace.End() }
+
+// CatchesAll reports whether an arm matches any value: one without a guard
+// whose pattern is _ or a name.
+func (me *MatchExpression) CatchesAll() bool {
+	for _, arm := range me.Arms {
+		switch arm.Pattern.(type) {
+		case *WildcardPattern, *Identifier:
+			if arm.Guard == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Pattern is the shape a value is matched against. An *Identifier matches
+// anything and binds it to its name.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// WildcardPattern is _, which matches anything without binding it.
+type WildcardPattern struct {
+	Token token.Token
+}
+
+func (wp *WildcardPattern) patternNode()         {}
+func (wp *WildcardPattern) TokenLiteral() string { return wp.Token.Literal }
+func (wp *WildcardPattern) String() string       { return "_" }
+func (wp *WildcardPattern) Pos() token.Position  { return wp.Token.Pos() }
+func (wp *WildcardPattern) End() token.Position  { return wp.Token.End() }
+
+// LiteralPattern matches the values equal to Value, which is a literal or
+// a negated number.
+type LiteralPattern struct {
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode()         {}
+func (lp *LiteralPattern) TokenLiteral() string { return lp.Value.TokenLiteral() }
+func (lp *LiteralPattern) String() string       { return lp.Value.String() }
+func (lp *LiteralPattern) Pos() token.Position  { return lp.Value.Pos() }
+func (lp *LiteralPattern) End() token.Position  { return lp.Value.End() }
+
+// ArrayPattern matches arrays with one element for each of Elements, or
+// at least that many if it has a Rest, which matches an array of the
+// elements left over.
+type ArrayPattern struct {
+	Token    token.Token
+	Elements []Pattern
+	Rest     Pattern // the identifier or _ after ..., nil without one
+	Rbracket token.Token
+}
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, e := range ap.Elements {
+		elements = append(elements, e.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+func (ap *ArrayPattern) Pos() token.Position { return ap.Token.Pos() }
+func (ap *ArrayPattern) End() token.Position { return ap.Rbracket.End() }
+
+// HashPatternPair is a single key: pattern entry of a hash pattern.
+type HashPatternPair struct {
+	Key   Expression
+	Value Pattern
+}
+
+// Shorthand reports whether the pair was written as a lone name, which
+// is both the key, as a string, and the identifier bound to its value.
+func (p HashPatternPair) Shorthand() bool {
+	key, ok := p.Key.(*StringLiteral)
+	return ok && key.Token.Type == token.IDENT
+}
+
+// HashPattern matches hashes holding every key it lists, whatever other
+// keys they hold.
+type HashPattern struct {
+	Token  token.Token
+	Pairs  []HashPatternPair
+	Rbrace token.Token
+}
+
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) String() string {
+	pairs := []string{}
+	for _, pair := range hp.Pairs {
+		if pair.Shorthand() {
+			pairs = append(pairs, pair.Value.String())
+		} else {
+			pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+		}
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+func (hp *HashPattern) Pos() token.Position { return hp.Token.Pos() }
+func (hp *HashPattern) End() token.Position { return hp.Rbrace.End() }
+
+// Bindings returns the identifiers pattern binds, in source order.
+func Bindings(pattern Pattern) []*Identifier {
+	var names []*Identifier
+	Inspect(pattern, func(node Node) bool {
+		if identifier, ok := node.(*Identifier); ok {
+			names = append(names, identifier)
+		}
+		return true
+	})
+	return names
+}
+
+// statementEnd returns the end of a statement that may or may not be
+// terminated by a semicolon, falling back to its last sub-node.
+func statementEnd(semicolon token.Token, last Expression, fallback Node) token.Position {
+	if semicolon.Type != "" {
+		return semicolon.End()
+	}
+	if last != nil {
+		return last.End()
+	}
+	if fallback != nil {
+		return fallback.End()
+	}
+	return token.Position{}
+}
+
+// TypeExpression is a type annotation. It names a type such as int, or
+// builds one: [T] is an array of T, {K: V} a hash from K to V and
+// fun(A, B): R a function.
+type TypeExpression struct {
+	Token token.Token // the name, [, { or fun
+	Name  string      // empty unless the type is named
+	// Elements holds the element type of an array, the key and value types
+	// of a hash or the parameter types of a function.
+	Elements []*TypeExpression
+	Result   *TypeExpression // the result type of a function
+	EndToken token.Token     // the closing ] or }, unused otherwise
+}
+
+func (te *TypeExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TypeExpression) String() string {
+	elements := []string{}
+	for _, element := range te.Elements {
+		elements = append(elements, element.String())
+	}
+	switch te.Token.Type {
+	case token.LBRACKET:
+		return "[" + strings.Join(elements, "") + "]"
+	case token.LBRACE:
+		return "{" + strings.Join(elements, ": ") + "}"
+	case token.FUNCTION:
+		result := ""
+		if te.Result != nil {
+			result = te.Result.String()
+		}
+		return "fun(" + strings.Join(elements, ", ") + "): " + result
+	}
+	return te.Name
+}
+func (te *TypeExpression) Pos() token.Position { return te.Token.Pos() }
+func (te *TypeExpression) End() token.Position {
+	switch {
+	case te.Token.Type == token.FUNCTION && te.Result != nil:
+		return te.Result.End()
+	case te.EndToken.Type != "":
+		return te.EndToken.End()
+	}
+	return te.Token.End()
+}
@@ -0,0 +1,663 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"turatti/token"
+)
+
+// EncodeJSON serializes node and all of its children. Every node is an
+// object carrying its "kind", "token", "pos" and "end" next to its own
+// fields; DecodeJSON rebuilds the concrete node types from it.
+func EncodeJSON(node Node) ([]byte, error) {
+	return json.Marshal(encodeNode(node))
+}
+
+func EncodeJSONIndent(node Node, prefix, indent string) ([]byte, error) {
+	return json.MarshalIndent(encodeNode(node), prefix, indent)
+}
+
+func encodeNode(node Node) any {
+	if isNil(node) {
+		return nil
+	}
+
+	object := map[string]any{
+		"kind": kindOf(node),
+		"pos":  node.Pos(),
+		"end":  node.End(),
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		object["statements"] = encodeStatements(n.Statements)
+		if len(n.Comments) > 0 {
+			object["comments"] = n.Comments
+		}
+	case *Identifier:
+		object["token"] = n.Token
+		object["value"] = n.Value
+	case *DefStatement:
+		encodeOptionalToken(object, "export", n.Export)
+		object["token"] = n.Token
+		object["name"] = encodeNode(n.Name)
+		if n.Type != nil {
+			object["type"] = encodeNode(n.Type)
+		}
+		object["value"] = encodeNode(n.Value)
+		encodeOptionalToken(object, "semicolon", n.Semicolon)
+	case *ImportStatement:
+		object["token"] = n.Token
+		object["path"] = encodeNode(n.Path)
+		object["alias"] = encodeNode(n.Alias)
+		encodeOptionalToken(object, "semicolon", n.Semicolon)
+	case *ReturnStatement:
+		object["token"] = n.Token
+		object["returnValue"] = encodeNode(n.ReturnValue)
+		encodeOptionalToken(object, "semicolon", n.Semicolon)
+	case *ThrowStatement:
+		object["token"] = n.Token
+		object["value"] = encodeNode(n.Value)
+		encodeOptionalToken(object, "semicolon", n.Semicolon)
+	case *ExpressionStatement:
+		object["token"] = n.Token
+		object["expression"] = encodeNode(n.Expression)
+		encodeOptionalToken(object, "semicolon", n.Semicolon)
+	case *BlockStatement:
+		object["token"] = n.Token
+		object["statements"] = encodeStatements(n.Statements)
+		object["rbrace"] = n.Rbrace
+	case *PrefixExpression:
+		object["token"] = n.Token
+		object["operator"] = n.Operator
+		object["right"] = encodeNode(n.Right)
+	case *InfixExpression:
+		object["token"] = n.Token
+		object["operator"] = n.Operator
+		object["left"] = encodeNode(n.Left)
+		object["right"] = encodeNode(n.Right)
+	case *IntegerLiteral:
+		object["token"] = n.Token
+		object["value"] = n.Value
+	case *FloatLiteral:
+		object["token"] = n.Token
+		object["value"] = n.Value
+	case *StringLiteral:
+		object["token"] = n.Token
+		object["value"] = n.Value
+	case *Boolean:
+		object["token"] = n.Token
+		object["value"] = n.Value
+	case *IfExpression:
+		object["token"] = n.Token
+		object["condition"] = encodeNode(n.Condition)
+		object["consequence"] = encodeNode(n.Consequence)
+		object["alternative"] = encodeNode(n.Alternative)
+	case *TryExpression:
+		object["token"] = n.Token
+		object["block"] = encodeNode(n.Block)
+		object["parameter"] = encodeNode(n.Parameter)
+		object["catch"] = encodeNode(n.Catch)
+		object["finally"] = encodeNode(n.Finally)
+	case *FunctionLiteral:
+		params := []any{}
+		for _, p := range n.Parameters {
+			params = append(params, encodeNode(p))
+		}
+		object["token"] = n.Token
+		object["parameters"] = params
+		if n.ParameterTypes != nil {
+			types := []any{}
+			for _, t := range n.ParameterTypes {
+				types = append(types, encodeNode(t))
+			}
+			object["parameterTypes"] = types
+		}
+		if n.ReturnType != nil {
+			object["returnType"] = encodeNode(n.ReturnType)
+		}
+		object["body"] = encodeNode(n.Body)
+	case *CallExpression:
+		args := []any{}
+		for _, a := range n.Arguments {
+			args = append(args, encodeNode(a))
+		}
+		object["token"] = n.Token
+		object["function"] = encodeNode(n.Function)
+		object["arguments"] = args
+		object["rparen"] = n.Rparen
+	case *ArrayLiteral:
+		elements := []any{}
+		for _, e := range n.Elements {
+			elements = append(elements, encodeNode(e))
+		}
+		object["token"] = n.Token
+		object["elements"] = elements
+		object["rbracket"] = n.Rbracket
+	case *HashLiteral:
+		pairs := []any{}
+		for _, pair := range n.Pairs {
+			pairs = append(pairs, map[string]any{"key": encodeNode(pair.Key), "value": encodeNode(pair.Value)})
+		}
+		object["token"] = n.Token
+		object["pairs"] = pairs
+		object["rbrace"] = n.Rbrace
+	case *IndexExpression:
+		object["token"] = n.Token
+		object["left"] = encodeNode(n.Left)
+		object["index"] = encodeNode(n.Index)
+		object["rbracket"] = n.Rbracket
+	case *MemberExpression:
+		object["token"] = n.Token
+		object["left"] = encodeNode(n.Left)
+		object["member"] = encodeNode(n.Member)
+	case *PropagateExpression:
+		object["token"] = n.Token
+		object["value"] = encodeNode(n.Value)
+	case *MatchExpression:
+		arms := []any{}
+		for _, arm := range n.Arms {
+			encoded := map[string]any{"pattern": encodeNode(arm.Pattern), "body": encodeNode(arm.Body)}
+			if arm.Guard != nil {
+				encoded["guard"] = encodeNode(arm.Guard)
+			}
+			arms = append(arms, encoded)
+		}
+		object["token"] = n.Token
+		object["value"] = encodeNode(n.Value)
+		object["arms"] = arms
+		object["rbrace"] = n.Rbrace
+	case *WildcardPattern:
+		object["token"] = n.Token
+	case *LiteralPattern:
+		object["value"] = encodeNode(n.Value)
+	case *ArrayPattern:
+		elements := []any{}
+		for _, e := range n.Elements {
+			elements = append(elements, encodeNode(e))
+		}
+		object["token"] = n.Token
+		object["elements"] = elements
+		if n.Rest != nil {
+			object["rest"] = encodeNode(n.Rest)
+		}
+		object["rbracket"] = n.Rbracket
+	case *HashPattern:
+		pairs := []any{}
+		for _, pair := range n.Pairs {
+			pairs = append(pairs, map[string]any{"key": encodeNode(pair.Key), "value": encodeNode(pair.Value)})
+		}
+		object["token"] = n.Token
+		object["pairs"] = pairs
+		object["rbrace"] = n.Rbrace
+	case *TypeExpression:
+		elements := []any{}
+		for _, e := range n.Elements {
+			elements = append(elements, encodeNode(e))
+		}
+		object["token"] = n.Token
+		if n.Name != "" {
+			object["name"] = n.Name
+		}
+		if n.Elements != nil {
+			object["elements"] = elements
+		}
+		if n.Result != nil {
+			object["result"] = encodeNode(n.Result)
+		}
+		encodeOptionalToken(object, "endToken", n.EndToken)
+	default:
+		panic(fmt.Sprintf("ast.EncodeJSON: unexpected node type %T", n))
+	}
+
+	return object
+}
+
+func encodeStatements(statements []Statement) []any {
+	result := []any{}
+	for _, s := range statements {
+		result = append(result, encodeNode(s))
+	}
+	return result
+}
+
+func encodeOptionalToken(object map[string]any, key string, tok token.Token) {
+	if tok.Type != "" {
+		object[key] = tok
+	}
+}
+
+func kindOf(node Node) string {
+	switch node.(type) {
+	case *Program:
+		return "Program"
+	case *Identifier:
+		return "Identifier"
+	case *DefStatement:
+		return "DefStatement"
+	case *ImportStatement:
+		return "ImportStatement"
+	case *ReturnStatement:
+		return "ReturnStatement"
+	case *ThrowStatement:
+		return "ThrowStatement"
+	case *ExpressionStatement:
+		return "ExpressionStatement"
+	case *BlockStatement:
+		return "BlockStatement"
+	case *PrefixExpression:
+		return "PrefixExpression"
+	case *InfixExpression:
+		return "InfixExpression"
+	case *IntegerLiteral:
+		return "IntegerLiteral"
+	case *FloatLiteral:
+		return "FloatLiteral"
+	case *StringLiteral:
+		return "StringLiteral"
+	case *Boolean:
+		return "Boolean"
+	case *IfExpression:
+		return "IfExpression"
+	case *TryExpression:
+		return "TryExpression"
+	case *FunctionLiteral:
+		return "FunctionLiteral"
+	case *CallExpression:
+		return "CallExpression"
+	case *ArrayLiteral:
+		return "ArrayLiteral"
+	case *HashLiteral:
+		return "HashLiteral"
+	case *IndexExpression:
+		return "IndexExpression"
+	case *MemberExpression:
+		return "MemberExpression"
+	case *PropagateExpression:
+		return "PropagateExpression"
+	case *MatchExpression:
+		return "MatchExpression"
+	case *WildcardPattern:
+		return "WildcardPattern"
+	case *LiteralPattern:
+		return "LiteralPattern"
+	case *ArrayPattern:
+		return "ArrayPattern"
+	case *HashPattern:
+		return "HashPattern"
+	case *TypeExpression:
+		return "TypeExpression"
+	}
+	panic(fmt.Sprintf("ast: unexpected node type %T", node))
+}
+
+// DecodeJSON rebuilds a node previously serialized by EncodeJSON.
+func DecodeJSON(data []byte) (Node, error) {
+	d := &decoder{}
+	node := d.decode(data)
+	if d.err != nil {
+		return nil, d.err
+	}
+	return node, nil
+}
+
+type decoder struct {
+	err error
+}
+
+type jsonObject map[string]json.RawMessage
+
+func (d *decoder) fail(format string, args ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf("ast: "+format, args...)
+	}
+}
+
+func (d *decoder) decode(data json.RawMessage) Node {
+	if d.err != nil || len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+
+	object := jsonObject{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		d.fail("invalid node: %v", err)
+		return nil
+	}
+
+	var kind string
+	d.field(object, "kind", &kind)
+
+	switch kind {
+	case "Program":
+		n := &Program{Statements: d.statements(object, "statements")}
+		d.field(object, "comments", &n.Comments)
+		return n
+	case "Identifier":
+		n := &Identifier{Token: d.token(object, "token")}
+		d.field(object, "value", &n.Value)
+		return n
+	case "DefStatement":
+		return &DefStatement{
+			Export:    d.token(object, "export"),
+			Token:     d.token(object, "token"),
+			Name:      d.pattern(object, "name"),
+			Type:      d.typeExpression(object, "type"),
+			Value:     d.expression(object, "value"),
+			Semicolon: d.token(object, "semicolon"),
+		}
+	case "ImportStatement":
+		n := &ImportStatement{
+			Token:     d.token(object, "token"),
+			Alias:     d.identifier(object, "alias"),
+			Semicolon: d.token(object, "semicolon"),
+		}
+		if path := d.decode(object["path"]); path != nil {
+			var ok bool
+			if n.Path, ok = path.(*StringLiteral); !ok {
+				d.fail("%s is not a string literal", kindOf(path))
+			}
+		}
+		return n
+	case "ReturnStatement":
+		return &ReturnStatement{
+			Token:       d.token(object, "token"),
+			ReturnValue: d.expression(object, "returnValue"),
+			Semicolon:   d.token(object, "semicolon"),
+		}
+	case "ThrowStatement":
+		return &ThrowStatement{
+			Token:     d.token(object, "token"),
+			Value:     d.expression(object, "value"),
+			Semicolon: d.token(object, "semicolon"),
+		}
+	case "ExpressionStatement":
+		return &ExpressionStatement{
+			Token:      d.token(object, "token"),
+			Expression: d.expression(object, "expression"),
+			Semicolon:  d.token(object, "semicolon"),
+		}
+	case "BlockStatement":
+		return &BlockStatement{
+			Token:      d.token(object, "token"),
+			Statements: d.statements(object, "statements"),
+			Rbrace:     d.token(object, "rbrace"),
+		}
+	case "PrefixExpression":
+		n := &PrefixExpression{Token: d.token(object, "token"), Right: d.expression(object, "right")}
+		d.field(object, "operator", &n.Operator)
+		return n
+	case "InfixExpression":
+		n := &InfixExpression{
+			Token: d.token(object, "token"),
+			Left:  d.expression(object, "left"),
+			Right: d.expression(object, "right"),
+		}
+		d.field(object, "operator", &n.Operator)
+		return n
+	case "IntegerLiteral":
+		n := &IntegerLiteral{Token: d.token(object, "token")}
+		d.field(object, "value", &n.Value)
+		return n
+	case "FloatLiteral":
+		n := &FloatLiteral{Token: d.token(object, "token")}
+		d.field(object, "value", &n.Value)
+		return n
+	case "StringLiteral":
+		n := &StringLiteral{Token: d.token(object, "token")}
+		d.field(object, "value", &n.Value)
+		return n
+	case "Boolean":
+		n := &Boolean{Token: d.token(object, "token")}
+		d.field(object, "value", &n.Value)
+		return n
+	case "IfExpression":
+		return &IfExpression{
+			Token:       d.token(object, "token"),
+			Condition:   d.expression(object, "condition"),
+			Consequence: d.block(object, "consequence"),
+			Alternative: d.block(object, "alternative"),
+		}
+	case "TryExpression":
+		return &TryExpression{
+			Token:     d.token(object, "token"),
+			Block:     d.block(object, "block"),
+			Parameter: d.identifier(object, "parameter"),
+			Catch:     d.block(object, "catch"),
+			Finally:   d.block(object, "finally"),
+		}
+	case "FunctionLiteral":
+		n := &FunctionLiteral{Token: d.token(object, "token"), Parameters: []Pattern{}}
+		for _, raw := range d.list(object, "parameters") {
+			n.Parameters = append(n.Parameters, d.asPattern(d.decode(raw)))
+		}
+		if _, ok := object["parameterTypes"]; ok {
+			n.ParameterTypes = []*TypeExpression{}
+			for _, raw := range d.list(object, "parameterTypes") {
+				n.ParameterTypes = append(n.ParameterTypes, d.asTypeExpression(d.decode(raw)))
+			}
+		}
+		n.ReturnType = d.typeExpression(object, "returnType")
+		n.Body = d.block(object, "body")
+		return n
+	case "CallExpression":
+		n := &CallExpression{
+			Token:     d.token(object, "token"),
+			Function:  d.expression(object, "function"),
+			Arguments: []Expression{},
+			Rparen:    d.token(object, "rparen"),
+		}
+		for _, raw := range d.list(object, "arguments") {
+			n.Arguments = append(n.Arguments, d.asExpression(d.decode(raw)))
+		}
+		return n
+	case "ArrayLiteral":
+		n := &ArrayLiteral{Token: d.token(object, "token"), Elements: []Expression{}, Rbracket: d.token(object, "rbracket")}
+		for _, raw := range d.list(object, "elements") {
+			n.Elements = append(n.Elements, d.asExpression(d.decode(raw)))
+		}
+		return n
+	case "HashLiteral":
+		n := &HashLiteral{Token: d.token(object, "token"), Pairs: []HashPair{}, Rbrace: d.token(object, "rbrace")}
+		for _, raw := range d.list(object, "pairs") {
+			pair := jsonObject{}
+			if err := json.Unmarshal(raw, &pair); err != nil {
+				d.fail("invalid hash pair: %v", err)
+				return nil
+			}
+			n.Pairs = append(n.Pairs, HashPair{Key: d.expression(pair, "key"), Value: d.expression(pair, "value")})
+		}
+		return n
+	case "IndexExpression":
+		return &IndexExpression{
+			Token:    d.token(object, "token"),
+			Left:     d.expression(object, "left"),
+			Index:    d.expression(object, "index"),
+			Rbracket: d.token(object, "rbracket"),
+		}
+	case "MemberExpression":
+		return &MemberExpression{
+			Token:  d.token(object, "token"),
+			Left:   d.expression(object, "left"),
+			Member: d.identifier(object, "member"),
+		}
+	case "PropagateExpression":
+		return &PropagateExpression{
+			Token: d.token(object, "token"),
+			Value: d.expression(object, "value"),
+		}
+	case "MatchExpression":
+		n := &MatchExpression{
+			Token:  d.token(object, "token"),
+			Value:  d.expression(object, "value"),
+			Arms:   []MatchArm{},
+			Rbrace: d.token(object, "rbrace"),
+		}
+		for _, raw := range d.list(object, "arms") {
+			arm := jsonObject{}
+			if err := json.Unmarshal(raw, &arm); err != nil {
+				d.fail("invalid match arm: %v", err)
+				return nil
+			}
+			n.Arms = append(n.Arms, MatchArm{
+				Pattern: d.pattern(arm, "pattern"),
+				Guard:   d.expression(arm, "guard"),
+				Body:    d.expression(arm, "body"),
+			})
+		}
+		return n
+	case "WildcardPattern":
+		return &WildcardPattern{Token: d.token(object, "token")}
+	case "LiteralPattern":
+		return &LiteralPattern{Value: d.expression(object, "value")}
+	case "ArrayPattern":
+		n := &ArrayPattern{
+			Token:    d.token(object, "token"),
+			Elements: []Pattern{},
+			Rest:     d.pattern(object, "rest"),
+			Rbracket: d.token(object, "rbracket"),
+		}
+		for _, raw := range d.list(object, "elements") {
+			n.Elements = append(n.Elements, d.asPattern(d.decode(raw)))
+		}
+		return n
+	case "HashPattern":
+		n := &HashPattern{Token: d.token(object, "token"), Pairs: []HashPatternPair{}, Rbrace: d.token(object, "rbrace")}
+		for _, raw := range d.list(object, "pairs") {
+			pair := jsonObject{}
+			if err := json.Unmarshal(raw, &pair); err != nil {
+				d.fail("invalid hash pattern pair: %v", err)
+				return nil
+			}
+			n.Pairs = append(n.Pairs, HashPatternPair{Key: d.expression(pair, "key"), Value: d.pattern(pair, "value")})
+		}
+		return n
+	case "TypeExpression":
+		n := &TypeExpression{
+			Token:    d.token(object, "token"),
+			Result:   d.typeExpression(object, "result"),
+			EndToken: d.token(object, "endToken"),
+		}
+		d.field(object, "name", &n.Name)
+		if _, ok := object["elements"]; ok {
+			n.Elements = []*TypeExpression{}
+			for _, raw := range d.list(object, "elements") {
+				n.Elements = append(n.Elements, d.asTypeExpression(d.decode(raw)))
+			}
+		}
+		return n
+	default:
+		d.fail("unknown node kind %q", kind)
+		return nil
+	}
+}
+
+func (d *decoder) field(object jsonObject, key string, target any) {
+	raw, ok := object[key]
+	if !ok || d.err != nil {
+		return
+	}
+	if err := json.Unmarshal(raw, target); err != nil {
+		d.fail("invalid field %q: %v", key, err)
+	}
+}
+
+func (d *decoder) token(object jsonObject, key string) token.Token {
+	tok := token.Token{}
+	d.field(object, key, &tok)
+	return tok
+}
+
+func (d *decoder) list(object jsonObject, key string) []json.RawMessage {
+	list := []json.RawMessage{}
+	d.field(object, key, &list)
+	return list
+}
+
+func (d *decoder) statements(object jsonObject, key string) []Statement {
+	statements := []Statement{}
+	for _, raw := range d.list(object, key) {
+		node := d.decode(raw)
+		if node == nil {
+			continue
+		}
+		stmt, ok := node.(Statement)
+		if !ok {
+			d.fail("%s is not a statement", kindOf(node))
+			continue
+		}
+		statements = append(statements, stmt)
+	}
+	return statements
+}
+
+func (d *decoder) expression(object jsonObject, key string) Expression {
+	return d.asExpression(d.decode(object[key]))
+}
+
+func (d *decoder) identifier(object jsonObject, key string) *Identifier {
+	return d.asIdentifier(d.decode(object[key]))
+}
+
+func (d *decoder) block(object jsonObject, key string) *BlockStatement {
+	node := d.decode(object[key])
+	if node == nil {
+		return nil
+	}
+	block, ok := node.(*BlockStatement)
+	if !ok {
+		d.fail("%s is not a block statement", kindOf(node))
+	}
+	return block
+}
+
+func (d *decoder) asExpression(node Node) Expression {
+	if node == nil {
+		return nil
+	}
+	expression, ok := node.(Expression)
+	if !ok {
+		d.fail("%s is not an expression", kindOf(node))
+	}
+	return expression
+}
+
+func (d *decoder) asIdentifier(node Node) *Identifier {
+	if node == nil {
+		return nil
+	}
+	identifier, ok := node.(*Identifier)
+	if !ok {
+		d.fail("%s is not an identifier", kindOf(node))
+	}
+	return identifier
+}
+
+func (d *decoder) pattern(object jsonObject, key string) Pattern {
+	return d.asPattern(d.decode(object[key]))
+}
+
+func (d *decoder) asPattern(node Node) Pattern {
+	if node == nil {
+		return nil
+	}
+	pattern, ok := node.(Pattern)
+	if !ok {
+		d.fail("%s is not a pattern", kindOf(node))
+	}
+	return pattern
+}
+
+func (d *decoder) typeExpression(object jsonObject, key string) *TypeExpression {
+	return d.asTypeExpression(d.decode(object[key]))
+}
+
+func (d *decoder) asTypeExpression(node Node) *TypeExpression {
+	if node == nil {
+		return nil
+	}
+	te, ok := node.(*TypeExpression)
+	if !ok {
+		d.fail("%s is not a type", kindOf(node))
+	}
+	return te
+}
@@ -0,0 +1,122 @@
+package ast_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"turatti/ast"
+	"turatti/lexer"
+	"turatti/parser"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("../test_files/*.trt")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("couldn't list test files")
+	}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatalf("couldn't open %s", file)
+		}
+		l := lexer.FromFile(f)
+		f.Close()
+		p := parser.New(l)
+		program := p.Parse()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("%s: parser errors: %v", file, p.Errors())
+		}
+		roundTrip(t, file, program)
+	}
+
+	roundTrip(t, "walk", parse(t, walkInput))
+}
+
+func roundTrip(t *testing.T, name string, program *ast.Program) {
+	data, err := ast.EncodeJSON(program)
+	if err != nil {
+		t.Fatalf("%s: couldn't encode program: %v", name, err)
+	}
+
+	decoded, err := ast.DecodeJSON(data)
+	if err != nil {
+		t.Fatalf("%s: couldn't decode program: %v", name, err)
+	}
+
+	if !reflect.DeepEqual(program, decoded) {
+		t.Errorf("%s: decoded program differs from original.\nexpected %s\ngot      %s", name, program, decoded)
+	}
+
+	again, err := ast.EncodeJSON(decoded)
+	if err != nil {
+		t.Fatalf("%s: couldn't re-encode program: %v", name, err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("%s: encoding is not stable", name)
+	}
+}
+
+func TestJSONEncoding(t *testing.T) {
+	data, err := ast.EncodeJSON(parse(t, "def x = -1;"))
+	if err != nil {
+		t.Fatalf("couldn't encode program: %v", err)
+	}
+
+	var program struct {
+		Kind       string `json:"kind"`
+		Statements []struct {
+			Kind  string `json:"kind"`
+			Token struct {
+				Type    string `json:"type"`
+				Literal string `json:"literal"`
+			} `json:"token"`
+			End struct {
+				Line   int `json:"line"`
+				Column int `json:"column"`
+			} `json:"end"`
+			Value struct {
+				Kind     string `json:"kind"`
+				Operator string `json:"operator"`
+			} `json:"value"`
+		} `json:"statements"`
+	}
+	if err := json.Unmarshal(data, &program); err != nil {
+		t.Fatalf("couldn't unmarshal encoded program: %v", err)
+	}
+
+	if program.Kind != "Program" || len(program.Statements) != 1 {
+		t.Fatalf("unexpected program encoding %s", data)
+	}
+	stmt := program.Statements[0]
+	if stmt.Kind != "DefStatement" || stmt.Token.Type != "DEF" || stmt.Token.Literal != "def" {
+		t.Errorf("unexpected statement encoding %s", data)
+	}
+	if stmt.End.Line != 1 || stmt.End.Column != 12 {
+		t.Errorf("expected statement to end at 1:12, got %d:%d", stmt.End.Line, stmt.End.Column)
+	}
+	if stmt.Value.Kind != "PrefixExpression" || stmt.Value.Operator != "-" {
+		t.Errorf("unexpected value encoding %s", data)
+	}
+}
+
+func TestJSONDecodeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind": "Nope"}`, "unknown node kind"},
+		{`{"kind": "Program", "statements": [{"kind": "Identifier", "value": "x"}]}`, "is not a statement"},
+		{`{"kind": "DefStatement", "name": {"kind": "Boolean", "value": true}}`, "is not a pattern"},
+		{`[1, 2]`, "invalid node"},
+	}
+
+	for _, tt := range tests {
+		_, err := ast.DecodeJSON([]byte(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("decoding %s: expected error containing %q, got %v", tt.input, tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+	case *DefStatement:
+		walkIfPresent(v, n.Name)
+		walkIfPresent(v, n.Type)
+		walkIfPresent(v, n.Value)
+	case *ImportStatement:
+		walkIfPresent(v, n.Path)
+		walkIfPresent(v, n.Alias)
+	case *ReturnStatement:
+		walkIfPresent(v, n.ReturnValue)
+	case *ThrowStatement:
+		walkIfPresent(v, n.Value)
+	case *ExpressionStatement:
+		walkIfPresent(v, n.Expression)
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+	case *PrefixExpression:
+		walkIfPresent(v, n.Right)
+	case *InfixExpression:
+		walkIfPresent(v, n.Left)
+		walkIfPresent(v, n.Right)
+	case *IfExpression:
+		walkIfPresent(v, n.Condition)
+		walkIfPresent(v, n.Consequence)
+		walkIfPresent(v, n.Alternative)
+	case *TryExpression:
+		walkIfPresent(v, n.Block)
+		walkIfPresent(v, n.Parameter)
+		walkIfPresent(v, n.Catch)
+		walkIfPresent(v, n.Finally)
+	case *FunctionLiteral:
+		for i, param := range n.Parameters {
+			walkIfPresent(v, param)
+			walkIfPresent(v, n.ParameterType(i))
+		}
+		walkIfPresent(v, n.ReturnType)
+		walkIfPresent(v, n.Body)
+	case *CallExpression:
+		walkIfPresent(v, n.Function)
+		for _, arg := range n.Arguments {
+			walkIfPresent(v, arg)
+		}
+	case *ArrayLiteral:
+		for _, element := range n.Elements {
+			walkIfPresent(v, element)
+		}
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			walkIfPresent(v, pair.Key)
+			walkIfPresent(v, pair.Value)
+		}
+	case *IndexExpression:
+		walkIfPresent(v, n.Left)
+		walkIfPresent(v, n.Index)
+	case *MemberExpression:
+		walkIfPresent(v, n.Left)
+		walkIfPresent(v, n.Member)
+	case *PropagateExpression:
+		walkIfPresent(v, n.Value)
+	case *MatchExpression:
+		walkIfPresent(v, n.Value)
+		for _, arm := range n.Arms {
+			walkIfPresent(v, arm.Pattern)
+			walkIfPresent(v, arm.Guard)
+			walkIfPresent(v, arm.Body)
+		}
+	case *LiteralPattern:
+		walkIfPresent(v, n.Value)
+	case *ArrayPattern:
+		for _, element := range n.Elements {
+			walkIfPresent(v, element)
+		}
+		walkIfPresent(v, n.Rest)
+	case *HashPattern:
+		for _, pair := range n.Pairs {
+			walkIfPresent(v, pair.Key)
+			walkIfPresent(v, pair.Value)
+		}
+	case *TypeExpression:
+		for _, element := range n.Elements {
+			walkIfPresent(v, element)
+		}
+		walkIfPresent(v, n.Result)
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean, *WildcardPattern:
+		// leaves
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkStatements(v Visitor, statements []Statement) {
+	for _, stmt := range statements {
+		walkIfPresent(v, stmt)
+	}
+}
+
+// walkIfPresent skips both untyped nil interfaces and typed nil pointers,
+// which the parser leaves behind for optional children.
+func walkIfPresent(v Visitor, node Node) {
+	if isNil(node) {
+		return
+	}
+	Walk(v, node)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order, calling f(node) for each
+// node. If f returns true, Inspect continues into the children of node,
+// followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Rewrite traverses an AST in depth-first order and replaces every node
+// with the result of calling f on it after its children have been
+// rewritten. Returning nil for a statement removes it from its enclosing
+// list; returning a node of a type the parent cannot hold panics.
+func Rewrite(node Node, f func(Node) Node) Node {
+	if isNil(node) {
+		return node
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		n.Statements = rewriteStatements(n.Statements, f)
+	case *DefStatement:
+		n.Name = rewritePattern(n.Name, f)
+		n.Type = rewriteType(n.Type, f)
+		n.Value = rewriteExpression(n.Value, f)
+	case *ImportStatement:
+		n.Path = rewriteStringLiteral(n.Path, f)
+		n.Alias = rewriteIdentifier(n.Alias, f)
+	case *ReturnStatement:
+		n.ReturnValue = rewriteExpression(n.ReturnValue, f)
+	case *ThrowStatement:
+		n.Value = rewriteExpression(n.Value, f)
+	case *ExpressionStatement:
+		n.Expression = rewriteExpression(n.Expression, f)
+	case *BlockStatement:
+		n.Statements = rewriteStatements(n.Statements, f)
+	case *PrefixExpression:
+		n.Right = rewriteExpression(n.Right, f)
+	case *InfixExpression:
+		n.Left = rewriteExpression(n.Left, f)
+		n.Right = rewriteExpression(n.Right, f)
+	case *IfExpression:
+		n.Condition = rewriteExpression(n.Condition, f)
+		n.Consequence = rewriteBlock(n.Consequence, f)
+		n.Alternative = rewriteBlock(n.Alternative, f)
+	case *TryExpression:
+		n.Block = rewriteBlock(n.Block, f)
+		n.Parameter = rewriteIdentifier(n.Parameter, f)
+		n.Catch = rewriteBlock(n.Catch, f)
+		n.Finally = rewriteBlock(n.Finally, f)
+	case *FunctionLiteral:
+		for i, param := range n.Parameters {
+			n.Parameters[i] = rewritePattern(param, f)
+			if i < len(n.ParameterTypes) {
+				n.ParameterTypes[i] = rewriteType(n.ParameterTypes[i], f)
+			}
+		}
+		n.ReturnType = rewriteType(n.ReturnType, f)
+		n.Body = rewriteBlock(n.Body, f)
+	case *CallExpression:
+		n.Function = rewriteExpression(n.Function, f)
+		for i, arg := range n.Arguments {
+			n.Arguments[i] = rewriteExpression(arg, f)
+		}
+	case *ArrayLiteral:
+		for i, element := range n.Elements {
+			n.Elements[i] = rewriteExpression(element, f)
+		}
+	case *HashLiteral:
+		for i, pair := range n.Pairs {
+			n.Pairs[i] = HashPair{Key: rewriteExpression(pair.Key, f), Value: rewriteExpression(pair.Value, f)}
+		}
+	case *IndexExpression:
+		n.Left = rewriteExpression(n.Left, f)
+		n.Index = rewriteExpression(n.Index, f)
+	case *MemberExpression:
+		n.Left = rewriteExpression(n.Left, f)
+		n.Member = rewriteIdentifier(n.Member, f)
+	case *PropagateExpression:
+		n.Value = rewriteExpression(n.Value, f)
+	case *MatchExpression:
+		n.Value = rewriteExpression(n.Value, f)
+		for i, arm := range n.Arms {
+			n.Arms[i] = MatchArm{
+				Pattern: rewritePattern(arm.Pattern, f),
+				Guard:   rewriteExpression(arm.Guard, f),
+				Body:    rewriteExpression(arm.Body, f),
+			}
+		}
+	case *LiteralPattern:
+		n.Value = rewriteExpression(n.Value, f)
+	case *ArrayPattern:
+		for i, element := range n.Elements {
+			n.Elements[i] = rewritePattern(element, f)
+		}
+		n.Rest = rewritePattern(n.Rest, f)
+	case *HashPattern:
+		for i, pair := range n.Pairs {
+			n.Pairs[i] = HashPatternPair{Key: rewriteExpression(pair.Key, f), Value: rewritePattern(pair.Value, f)}
+		}
+	case *TypeExpression:
+		for i, element := range n.Elements {
+			n.Elements[i] = rewriteType(element, f)
+		}
+		n.Result = rewriteType(n.Result, f)
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean, *WildcardPattern:
+		// leaves
+	default:
+		panic(fmt.Sprintf("ast.Rewrite: unexpected node type %T", n))
+	}
+
+	return f(node)
+}
+
+func rewriteStatements(statements []Statement, f func(Node) Node) []Statement {
+	result := statements[:0]
+	for _, stmt := range statements {
+		if isNil(stmt) {
+			continue
+		}
+		replaced := Rewrite(stmt, f)
+		if isNil(replaced) {
+			continue
+		}
+		s, ok := replaced.(Statement)
+		if !ok {
+			panic(fmt.Sprintf("ast.Rewrite: %T is not a Statement", replaced))
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+func rewriteExpression(expression Expression, f func(Node) Node) Expression {
+	if isNil(expression) {
+		return expression
+	}
+	replaced := Rewrite(expression, f)
+	if isNil(replaced) {
+		return nil
+	}
+	e, ok := replaced.(Expression)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: %T is not an Expression", replaced))
+	}
+	return e
+}
+
+func rewriteIdentifier(identifier *Identifier, f func(Node) Node) *Identifier {
+	if identifier == nil {
+		return nil
+	}
+	replaced := Rewrite(identifier, f)
+	if isNil(replaced) {
+		return nil
+	}
+	i, ok := replaced.(*Identifier)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: %T is not an *Identifier", replaced))
+	}
+	return i
+}
+
+func rewriteStringLiteral(literal *StringLiteral, f func(Node) Node) *StringLiteral {
+	if literal == nil {
+		return nil
+	}
+	replaced := Rewrite(literal, f)
+	if isNil(replaced) {
+		return nil
+	}
+	s, ok := replaced.(*StringLiteral)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: %T is not a *StringLiteral", replaced))
+	}
+	return s
+}
+
+func rewritePattern(pattern Pattern, f func(Node) Node) Pattern {
+	if isNil(pattern) {
+		return pattern
+	}
+	replaced := Rewrite(pattern, f)
+	if isNil(replaced) {
+		return nil
+	}
+	p, ok := replaced.(Pattern)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: %T is not a Pattern", replaced))
+	}
+	return p
+}
+
+func rewriteBlock(block *BlockStatement, f func(Node) Node) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	replaced := Rewrite(block, f)
+	if isNil(replaced) {
+		return nil
+	}
+	b, ok := replaced.(*BlockStatement)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: %T is not a *BlockStatement", replaced))
+	}
+	return b
+}
+
+func rewriteType(te *TypeExpression, f func(Node) Node) *TypeExpression {
+	if te == nil {
+		return nil
+	}
+	replaced := Rewrite(te, f)
+	if isNil(replaced) {
+		return nil
+	}
+	t, ok := replaced.(*TypeExpression)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: %T is not a *TypeExpression", replaced))
+	}
+	return t
+}
+
+func isNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
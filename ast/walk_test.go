@@ -0,0 +1,240 @@
+package ast_test
+
+import (
+	"reflect"
+	"testing"
+	"turatti/ast"
+	"turatti/lexer"
+	"turatti/parser"
+	"turatti/token"
+)
+
+const walkInput = `
+import "util.trt" as util;
+export def five = util.five;
+def sum: fun(int, int): int = fun(x: int, y): int {
+    return x + y;
+};
+def greeting = "hello";
+def table = {"pi": 3.14, "digits": [1, 2, 3]};
+def parse = fun(s, [t, ...ts]) { ok(s)? };
+def [pi, {digits}] = [table["pi"], table];
+def size = match table { {"digits": [d, ...ds]} if d => len(ds), [_] => 1, -1 => 0, _ => 0 };
+table["digits"][0];
+if (!(five > sum(1, -2))) {
+    true;
+} else {
+    false;
+}
+try {
+    throw greeting;
+} catch (e) {
+    e;
+} finally {
+    five;
+}
+`
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.Parse()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+// collectNodes finds every node reachable from root through exported struct
+// fields, independently of Walk, so new node types cannot be silently skipped.
+func collectNodes(root ast.Node) map[ast.Node]bool {
+	nodeType := reflect.TypeOf((*ast.Node)(nil)).Elem()
+	found := map[ast.Node]bool{}
+
+	var visit func(v reflect.Value)
+	visit = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Interface:
+			if !v.IsNil() {
+				visit(v.Elem())
+			}
+		case reflect.Pointer:
+			if v.IsNil() {
+				return
+			}
+			if v.Type().Implements(nodeType) {
+				node := v.Interface().(ast.Node)
+				if found[node] {
+					return
+				}
+				found[node] = true
+			}
+			visit(v.Elem())
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				visit(v.Index(i))
+			}
+		case reflect.Struct:
+			if v.Type() == reflect.TypeOf(token.Token{}) {
+				return
+			}
+			for i := 0; i < v.NumField(); i++ {
+				if v.Type().Field(i).IsExported() {
+					visit(v.Field(i))
+				}
+			}
+		}
+	}
+	visit(reflect.ValueOf(root))
+	return found
+}
+
+func TestInspectVisitsEveryNode(t *testing.T) {
+	program := parse(t, walkInput)
+
+	visited := map[ast.Node]bool{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node != nil {
+			if visited[node] {
+				t.Errorf("node %T visited twice", node)
+			}
+			visited[node] = true
+		}
+		return true
+	})
+
+	expected := collectNodes(program)
+	if len(visited) != len(expected) {
+		t.Errorf("expected %d nodes to be visited, got %d", len(expected), len(visited))
+	}
+	for node := range expected {
+		if !visited[node] {
+			t.Errorf("node %T (%s) was never visited", node, node.String())
+		}
+	}
+
+	types := map[string]bool{}
+	for node := range visited {
+		types[reflect.TypeOf(node).Elem().Name()] = true
+	}
+	for _, name := range []string{
+		"Program", "DefStatement", "ReturnStatement", "ExpressionStatement", "BlockStatement",
+		"Identifier", "IntegerLiteral", "StringLiteral", "Boolean", "PrefixExpression",
+		"InfixExpression", "IfExpression", "FunctionLiteral", "CallExpression",
+		"FloatLiteral", "ArrayLiteral", "HashLiteral", "IndexExpression", "TypeExpression",
+		"ImportStatement", "MemberExpression", "ThrowStatement", "TryExpression",
+		"PropagateExpression", "MatchExpression", "HashPattern", "ArrayPattern", "WildcardPattern",
+		"LiteralPattern",
+	} {
+		if !types[name] {
+			t.Errorf("input did not exercise node type %s", name)
+		}
+	}
+}
+
+type depthVisitor struct {
+	depth    *int
+	maxDepth *int
+}
+
+func (v depthVisitor) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		*v.depth--
+		return nil
+	}
+	*v.depth++
+	if *v.depth > *v.maxDepth {
+		*v.maxDepth = *v.depth
+	}
+	return v
+}
+
+func TestWalkBalancesVisits(t *testing.T) {
+	program := parse(t, walkInput)
+	depth, maxDepth := 0, 0
+	ast.Walk(depthVisitor{&depth, &maxDepth}, program)
+
+	if depth != 0 {
+		t.Errorf("expected every Visit(node) to be paired with Visit(nil), depth ended at %d", depth)
+	}
+	if maxDepth < 5 {
+		t.Errorf("expected traversal to descend into nested nodes, max depth %d", maxDepth)
+	}
+}
+
+func TestInspectPrunesChildren(t *testing.T) {
+	program := parse(t, walkInput)
+	function := program.Statements[1].(*ast.DefStatement).Value
+
+	count := 0
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node == nil {
+			return false
+		}
+		count++
+		return node != function
+	})
+
+	expected := len(collectNodes(program)) - len(collectNodes(function)) + 1
+	if count != expected {
+		t.Errorf("expected function body to be skipped, visited %d nodes instead of %d", count, expected)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	program := parse(t, "def a = b + 1; c; def d = b * b;")
+
+	result := ast.Rewrite(program, func(node ast.Node) ast.Node {
+		switch n := node.(type) {
+		case *ast.Identifier:
+			if n.Value == "b" {
+				return &ast.Identifier{Token: n.Token, Value: "z"}
+			}
+		case *ast.InfixExpression:
+			if n.Operator == "*" {
+				return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "0"}, Value: 0}
+			}
+		case *ast.ExpressionStatement:
+			return nil
+		}
+		return node
+	})
+
+	if result.String() != "def a = (z + 1);def d = 0;" {
+		t.Errorf("unexpected rewrite result %q", result.String())
+	}
+}
+
+func TestRewriteImport(t *testing.T) {
+	program := parse(t, `import "util" as u;`)
+
+	result := ast.Rewrite(program, func(node ast.Node) ast.Node {
+		switch n := node.(type) {
+		case *ast.StringLiteral:
+			tok := n.Token
+			tok.Literal = "lib/" + n.Value
+			return &ast.StringLiteral{Token: tok, Value: tok.Literal}
+		case *ast.Identifier:
+			return &ast.Identifier{Token: n.Token, Value: "lib"}
+		}
+		return node
+	})
+
+	if result.String() != `import "lib/util" as lib;` {
+		t.Errorf("unexpected rewrite result %q", result.String())
+	}
+}
+
+func TestRewritePanicsOnInvalidReplacement(t *testing.T) {
+	program := parse(t, "def a = 1;")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected Rewrite to panic when replacing a def name with a literal")
+		}
+	}()
+	ast.Rewrite(program, func(node ast.Node) ast.Node {
+		if _, ok := node.(*ast.Identifier); ok {
+			return &ast.IntegerLiteral{}
+		}
+		return node
+	})
+}
@@ -0,0 +1,243 @@
+package turatti
+
+import (
+	"fmt"
+	"reflect"
+	"turatti/object"
+)
+
+// Object is a Turatti value, as handled by functions registered with
+// RegisterBuiltin.
+type Object = object.Object
+
+// BuiltinFunc receives the evaluated arguments of a call as they are and
+// checks their number and types itself.
+type BuiltinFunc func(args ...Object) (Object, error)
+
+var (
+	objectType  = reflect.TypeOf((*object.Object)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	builtinType = reflect.TypeOf(BuiltinFunc(nil))
+)
+
+// RegisterBuiltin binds name to fn, callable from scripts like any
+// function. Errors returned by fn, and panics, are raised at the call site.
+func (i *Interpreter) RegisterBuiltin(name string, fn BuiltinFunc) {
+	i.env.Set(name, &object.Builtin{Name: name, Fn: guard(name, object.BuiltinFunction(fn))})
+}
+
+// Register binds name to an ordinary Go function. Arguments are converted
+// to the function's parameter types, the opposite of ToObject, and calls
+// with the wrong number or types of arguments fail at the call site, as do
+// calls that panic. fn may return nothing, a value, an error, or a value and
+// an error.
+func (i *Interpreter) Register(name string, fn any) error {
+	builtin, err := newBuiltin(name, fn)
+	if err != nil {
+		return err
+	}
+	i.env.Set(name, builtin)
+	return nil
+}
+
+func newBuiltin(name string, fn any) (*object.Builtin, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("turatti: %s is not a function", name)
+	}
+	if v.Type().ConvertibleTo(builtinType) {
+		raw := v.Convert(builtinType).Interface().(BuiltinFunc)
+		return &object.Builtin{Name: name, Fn: guard(name, object.BuiltinFunction(raw))}, nil
+	}
+
+	fnType := v.Type()
+	for n := 0; n < fnType.NumIn(); n++ {
+		param := fnType.In(n)
+		if fnType.IsVariadic() && n == fnType.NumIn()-1 {
+			param = param.Elem()
+		}
+		if !convertible(param) {
+			return nil, fmt.Errorf("turatti: %s: unsupported parameter type %s", name, param)
+		}
+	}
+	switch {
+	case fnType.NumOut() > 2,
+		fnType.NumOut() == 2 && fnType.Out(1) != errorType:
+		return nil, fmt.Errorf("turatti: %s: results must be a value, an error, or a value and an error", name)
+	}
+
+	return &object.Builtin{Name: name, Fn: guard(name, func(args ...object.Object) (object.Object, error) {
+		in, err := convertArguments(name, fnType, args)
+		if err != nil {
+			return nil, err
+		}
+		return convertResults(v.Call(in))
+	})}, nil
+}
+
+// guard turns a panic in fn into an error, so that a failing host function
+// stops the script at the call site rather than the program embedding it.
+func guard(name string, fn object.BuiltinFunction) object.BuiltinFunction {
+	return func(args ...object.Object) (result object.Object, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				result, err = nil, object.Errorf(object.RuntimeError, "%s panicked: %v", name, r)
+			}
+		}()
+		return fn(args...)
+	}
+}
+
+func convertArguments(name string, fnType reflect.Type, args []object.Object) ([]reflect.Value, error) {
+	fixed := fnType.NumIn()
+	if fnType.IsVariadic() {
+		fixed--
+		if len(args) < fixed {
+			return nil, object.Errorf(object.ArgumentError, "wrong number of arguments to %s: expected at least %d, got %d", name, fixed, len(args))
+		}
+	} else if len(args) != fixed {
+		return nil, object.Errorf(object.ArgumentError, "wrong number of arguments to %s: expected %d, got %d", name, fixed, len(args))
+	}
+
+	in := make([]reflect.Value, 0, len(args))
+	for n, arg := range args {
+		var param reflect.Type
+		if n < fixed {
+			param = fnType.In(n)
+		} else {
+			param = fnType.In(fixed).Elem()
+		}
+		value, err := fromObjectAs(arg, param)
+		if err != nil {
+			return nil, object.Errorf(object.KindOf(err), "argument %d to %s: %s", n+1, name, err)
+		}
+		in = append(in, value)
+	}
+	return in, nil
+}
+
+func convertResults(out []reflect.Value) (object.Object, error) {
+	if len(out) > 0 && out[len(out)-1].Type() == errorType {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			return nil, err
+		}
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return ToObject(out[0].Interface())
+}
+
+func convertible(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return convertible(t.Elem())
+	case reflect.Map:
+		return convertible(t.Key()) && convertible(t.Elem())
+	case reflect.Interface:
+		return t.NumMethod() == 0 || t == objectType
+	}
+	return false
+}
+
+// fromObjectAs converts obj into a Go value of type t, failing with a
+// message naming the Turatti type t expects.
+func fromObjectAs(obj object.Object, t reflect.Type) (reflect.Value, error) {
+	switch t.Kind() {
+	case reflect.Interface:
+		if t == objectType {
+			return reflect.ValueOf(&obj).Elem(), nil
+		}
+		value := reflect.New(t).Elem()
+		if converted := FromObject(obj); converted != nil {
+			value.Set(reflect.ValueOf(converted))
+		}
+		return value, nil
+	case reflect.Bool:
+		if b, ok := obj.(*object.Boolean); ok {
+			return reflect.ValueOf(b.Value).Convert(t), nil
+		}
+		return reflect.Value{}, mismatch(object.BOOLEAN_OBJ, obj)
+	case reflect.String:
+		if s, ok := obj.(*object.String); ok {
+			return reflect.ValueOf(s.Value).Convert(t), nil
+		}
+		return reflect.Value{}, mismatch(object.STRING_OBJ, obj)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		integer, ok := obj.(*object.Integer)
+		if !ok {
+			return reflect.Value{}, mismatch(object.INTEGER_OBJ, obj)
+		}
+		value := reflect.New(t).Elem()
+		if value.OverflowInt(integer.Value) {
+			return reflect.Value{}, object.Errorf(object.ValueError, "%d overflows %s", integer.Value, t)
+		}
+		value.SetInt(integer.Value)
+		return value, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		integer, ok := obj.(*object.Integer)
+		if !ok {
+			return reflect.Value{}, mismatch(object.INTEGER_OBJ, obj)
+		}
+		value := reflect.New(t).Elem()
+		if integer.Value < 0 || value.OverflowUint(uint64(integer.Value)) {
+			return reflect.Value{}, object.Errorf(object.ValueError, "%d overflows %s", integer.Value, t)
+		}
+		value.SetUint(uint64(integer.Value))
+		return value, nil
+	case reflect.Float32, reflect.Float64:
+		value := reflect.New(t).Elem()
+		switch number := obj.(type) {
+		case *object.Float:
+			value.SetFloat(number.Value)
+		case *object.Integer:
+			value.SetFloat(float64(number.Value))
+		default:
+			return reflect.Value{}, mismatch(object.FLOAT_OBJ, obj)
+		}
+		return value, nil
+	case reflect.Slice:
+		array, ok := obj.(*object.Array)
+		if !ok {
+			return reflect.Value{}, mismatch(object.ARRAY_OBJ, obj)
+		}
+		slice := reflect.MakeSlice(t, 0, len(array.Elements))
+		for _, element := range array.Elements {
+			value, err := fromObjectAs(element, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			slice = reflect.Append(slice, value)
+		}
+		return slice, nil
+	case reflect.Map:
+		hash, ok := obj.(*object.Hash)
+		if !ok {
+			return reflect.Value{}, mismatch(object.HASH_OBJ, obj)
+		}
+		m := reflect.MakeMapWithSize(t, hash.Len())
+		for _, pair := range hash.Entries() {
+			key, err := fromObjectAs(pair.Key, t.Key())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			value, err := fromObjectAs(pair.Value, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			m.SetMapIndex(key, value)
+		}
+		return m, nil
+	}
+	return reflect.Value{}, fmt.Errorf("unsupported parameter type %s", t)
+}
+
+func mismatch(expected object.ObjectType, got object.Object) error {
+	return object.Errorf(object.TypeError, "expected %s, got %s", expected, got.Type())
+}
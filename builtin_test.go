@@ -0,0 +1,182 @@
+package turatti
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"turatti/object"
+)
+
+func TestRegister(t *testing.T) {
+	interp := newInterpreter(t, Options{})
+
+	register := map[string]any{
+		"add":   func(a, b int) int { return a + b },
+		"upper": strings.ToUpper,
+		"join":  func(sep string, parts ...string) string { return strings.Join(parts, sep) },
+		"sum": func(values []int64) (total int64) {
+			for _, v := range values {
+				total += v
+			}
+			return
+		},
+		"small": func(n int8) int8 { return n },
+		"check": func(ok bool) error {
+			if !ok {
+				return errors.New("check failed")
+			}
+			return nil
+		},
+		"split":   func(s string) ([]string, error) { return strings.Split(s, ","), nil },
+		"nothing": func() {},
+		"kind":    func(v any) string { return fmt.Sprintf("%T", v) },
+		"total": func(m map[string]int) (total int) {
+			for _, v := range m {
+				total += v
+			}
+			return
+		},
+		"invert": func(m map[string]int64) map[int64]string {
+			inverted := map[int64]string{}
+			for k, v := range m {
+				inverted[v] = k
+			}
+			return inverted
+		},
+	}
+	for name, fn := range register {
+		if err := interp.Register(name, fn); err != nil {
+			t.Fatalf("couldn't register %s: %v", name, err)
+		}
+	}
+	interp.RegisterBuiltin("count", func(args ...Object) (Object, error) {
+		return &object.Integer{Value: int64(len(args))}, nil
+	})
+
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"add(1, 2)", int64(3)},
+		{"upper(\"turatti\")", "TURATTI"},
+		{"join(\"-\", \"a\", \"b\", \"c\")", "a-b-c"},
+		{"join(\"-\")", ""},
+		{"split(\"a,b\")", []any{"a", "b"}},
+		{"small(127)", int64(127)},
+		{"check(true)", nil},
+		{"nothing()", nil},
+		{"kind(1)", "int64"},
+		{`total({"a": 1, "b": 2})`, int64(3)},
+		{`invert({"a": 1, "b": 2})`, map[any]any{int64(1): "a", int64(2): "b"}},
+		{"count(1, \"two\", true)", int64(3)},
+		{"def twice = fun(f, x) { f(f(x)) }; twice(upper, \"a\")", "A"},
+	}
+
+	for _, tt := range tests {
+		got, err := interp.Eval(context.Background(), tt.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q: expected %#v, got %#v", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestBuiltinErrorsReportCallSite(t *testing.T) {
+	interp := newInterpreter(t, Options{Globals: map[string]any{"args": []string{"x"}}})
+	interp.Register("add", func(a, b int) int { return a + b })
+	interp.Register("small", func(n int8) int8 { return n })
+	interp.Register("sum", func(values []int64) int64 { return int64(len(values)) })
+	interp.Register("join", func(sep string, parts ...string) string { return strings.Join(parts, sep) })
+	interp.Register("size", func(m map[string]int) int { return len(m) })
+	interp.Register("check", func(ok bool) error {
+		if !ok {
+			return errors.New("check failed")
+		}
+		return nil
+	})
+
+	tests := []struct {
+		input    string
+		expected string
+		kind     string
+	}{
+		{"add(1)", "1:1: runtime error: wrong number of arguments to add: expected 2, got 1", "ArgumentError"},
+		{"\n  add(1, \"2\")", "2:3: runtime error: argument 2 to add: expected INTEGER, got STRING", "TypeError"},
+		{"small(300)", "1:1: runtime error: argument 1 to small: 300 overflows int8", "ValueError"},
+		{"join()", "1:1: runtime error: wrong number of arguments to join: expected at least 1, got 0", "ArgumentError"},
+		{"join(\",\", 1)", "1:1: runtime error: argument 2 to join: expected STRING, got INTEGER", "TypeError"},
+		{"check(false)", "1:1: runtime error: check failed", "RuntimeError"},
+		{"sum(args)", "1:1: runtime error: argument 1 to sum: expected INTEGER, got STRING", "TypeError"},
+		{"size([1])", "1:1: runtime error: argument 1 to size: expected HASH, got ARRAY", "TypeError"},
+		{`size({1: 2})`, "1:1: runtime error: argument 1 to size: expected STRING, got INTEGER", "TypeError"},
+		{`size({"a": "b"})`, "1:1: runtime error: argument 1 to size: expected INTEGER, got STRING", "TypeError"},
+	}
+
+	for _, tt := range tests {
+		_, err := interp.Eval(context.Background(), tt.input)
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) || err.Error() != tt.expected || runtimeErr.Kind != tt.kind {
+			t.Errorf("%q: expected %s %q, got %v", tt.input, tt.kind, tt.expected, err)
+		}
+	}
+}
+
+func TestRegisteredPanicsRaiseErrors(t *testing.T) {
+	interp := newInterpreter(t, Options{})
+	interp.Register("boom", func(s string) string { panic("no " + s) })
+	interp.Register("index", func(xs []int, i int) int { return xs[i] })
+	interp.RegisterBuiltin("raw", func(args ...Object) (Object, error) { panic("raw") })
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"\n  boom(\"luck\")", "2:3: runtime error: boom panicked: no luck"},
+		{"def f = fun() { index([1], 3) }; f()", "1:17: runtime error: index panicked: runtime error: index out of range [3] with length 1"},
+		{"raw()", "1:1: runtime error: raw panicked: raw"},
+	}
+
+	for _, tt := range tests {
+		_, err := interp.Eval(context.Background(), tt.input)
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) || err.Error() != tt.expected || runtimeErr.Kind != "RuntimeError" {
+			t.Errorf("%q: expected RuntimeError %q, got %v", tt.input, tt.expected, err)
+		}
+	}
+
+	got, err := interp.Eval(context.Background(), `try { boom("x") } catch (e) { e["message"] }`)
+	if err != nil || got != "boom panicked: no x" {
+		t.Errorf("expected scripts to catch the panic, got %v (%v)", got, err)
+	}
+}
+
+func TestRegisterRejectsUnsupportedSignatures(t *testing.T) {
+	interp := newInterpreter(t, Options{})
+	for name, fn := range map[string]any{
+		"notAFunction": 5,
+		"channel":      func(c chan int) {},
+		"mapOfChannel": func(m map[string]chan int) {},
+		"tooMany":      func() (int, int, error) { return 0, 0, nil },
+		"secondNotErr": func() (int, int) { return 0, 0 },
+	} {
+		if err := interp.Register(name, fn); err == nil {
+			t.Errorf("expected %s to be rejected", name)
+		}
+	}
+}
+
+func TestSetFunction(t *testing.T) {
+	interp := newInterpreter(t, Options{Globals: map[string]any{
+		"double": func(n int) int { return n * 2 },
+	}})
+	got, err := interp.Eval(context.Background(), "double(21)")
+	if err != nil || got != int64(42) {
+		t.Errorf("expected 42, got %v (%v)", got, err)
+	}
+}
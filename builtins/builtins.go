@@ -0,0 +1,436 @@
+// Package builtins implements the standard library of functions that
+// every Turatti program can call without defining them.
+package builtins
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"turatti/object"
+)
+
+type definition struct {
+	name string
+	fn   func(out io.Writer) object.BuiltinFunction
+	doc  string
+}
+
+// definitions is append-only: compiled programs refer to builtins by their
+// index in it.
+var definitions = []definition{
+	{"len", pure(length), "len(value): the number of characters of a string, or of elements of an array or hash"},
+	{"print", writer(false, " "), "print(values...): write values separated by spaces"},
+	{"println", writer(true, " "), "println(values...): write values separated by spaces, then a newline"},
+	{"puts", writer(true, "\n"), "puts(values...): write each value on a line of its own"},
+	{"type", pure(typeOf), "type(value): the name of the type of value, such as INTEGER"},
+	{"str", pure(str), "str(value): value as a string"},
+	{"int", pure(toInt), "int(value): value converted to an integer"},
+	{"float", pure(toFloat), "float(value): value converted to a float"},
+	{"bool", pure(toBool), "bool(value): whether value is truthy"},
+	{"push", pure(push), "push(array, value): a copy of array with value appended"},
+	{"pop", pure(pop), "pop(array): a copy of array without its last element, which last(array) returns"},
+	{"first", pure(first), "first(array): the first element of array, or null if it is empty"},
+	{"rest", pure(rest), "rest(array): a copy of array without its first element, or null if it is empty"},
+	{"keys", pure(keys), "keys(hash): the keys of hash, in the order they were added"},
+	{"values", pure(values), "values(hash): the values of hash, in the order their keys were added"},
+	{"range", pure(rangeOf), "range([start,] end[, step]): the integers from start, or 0, up to but excluding end"},
+	{"min", pure(extreme("min", -1)), "min(numbers...): the smallest of the numbers, or of the elements of a single array"},
+	{"max", pure(extreme("max", 1)), "max(numbers...): the largest of the numbers, or of the elements of a single array"},
+	{"abs", pure(abs), "abs(number): the absolute value of number"},
+	{"assert", pure(assert), "assert(condition[, message]): raise an AssertionError unless condition is truthy"},
+	{"error", pure(raise), "error(value): raise a runtime error carrying value"},
+	{"ok", pure(result(true)), "ok(value): a successful result holding value"},
+	{"err", pure(result(false)), "err(value): a failed result holding value"},
+	{"last", pure(last), "last(array): the last element of array, or null if it is empty"},
+}
+
+// New returns the standard builtins in a fixed order, writing anything
+// they print to out, or to os.Stdout if out is nil.
+func New(out io.Writer) []*object.Builtin {
+	if out == nil {
+		out = os.Stdout
+	}
+	result := make([]*object.Builtin, len(definitions))
+	for i, d := range definitions {
+		result[i] = &object.Builtin{Name: d.name, Fn: d.fn(out)}
+	}
+	return result
+}
+
+// Doc returns the usage and description of the standard builtin name.
+func Doc(name string) (string, bool) {
+	for _, d := range definitions {
+		if d.name == name {
+			return d.doc, true
+		}
+	}
+	return "", false
+}
+
+// Names returns the names of the standard builtins in the order New
+// returns them.
+func Names() []string {
+	names := make([]string, len(definitions))
+	for i, d := range definitions {
+		names[i] = d.name
+	}
+	return names
+}
+
+func pure(fn object.BuiltinFunction) func(io.Writer) object.BuiltinFunction {
+	return func(io.Writer) object.BuiltinFunction { return fn }
+}
+
+// writer builds print, println and puts, which separate their arguments
+// with sep and return null.
+func writer(newline bool, sep string) func(io.Writer) object.BuiltinFunction {
+	return func(out io.Writer) object.BuiltinFunction {
+		return func(args ...object.Object) (object.Object, error) {
+			parts := make([]string, len(args))
+			for i, arg := range args {
+				parts[i] = arg.Inspect()
+			}
+			text := strings.Join(parts, sep)
+			if newline {
+				text += "\n"
+			}
+			if _, err := io.WriteString(out, text); err != nil {
+				return nil, err
+			}
+			return object.NULL, nil
+		}
+	}
+}
+
+func arity(name string, args []object.Object, expected int) error {
+	if len(args) != expected {
+		return object.Errorf(object.ArgumentError, "wrong number of arguments to %s: expected %d, got %d", name, expected, len(args))
+	}
+	return nil
+}
+
+func arrayArgument(name string, args []object.Object) (*object.Array, error) {
+	if err := arity(name, args, 1); err != nil {
+		return nil, err
+	}
+	array, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, object.Errorf(object.TypeError, "argument to %s must be ARRAY, got %s", name, args[0].Type())
+	}
+	return array, nil
+}
+
+func hashArgument(name string, args []object.Object) (*object.Hash, error) {
+	if err := arity(name, args, 1); err != nil {
+		return nil, err
+	}
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return nil, object.Errorf(object.TypeError, "argument to %s must be HASH, got %s", name, args[0].Type())
+	}
+	return hash, nil
+}
+
+func integerArgument(name string, arg object.Object) (int64, error) {
+	integer, ok := arg.(*object.Integer)
+	if !ok {
+		return 0, object.Errorf(object.TypeError, "argument to %s must be INTEGER, got %s", name, arg.Type())
+	}
+	return integer.Value, nil
+}
+
+func length(args ...object.Object) (object.Object, error) {
+	if err := arity("len", args, 1); err != nil {
+		return nil, err
+	}
+	switch arg := args[0].(type) {
+	case *object.String:
+		return &object.Integer{Value: int64(len([]rune(arg.Value)))}, nil
+	case *object.Array:
+		return &object.Integer{Value: int64(len(arg.Elements))}, nil
+	case *object.Hash:
+		return &object.Integer{Value: int64(arg.Len())}, nil
+	}
+	return nil, object.Errorf(object.TypeError, "argument to len not supported, got %s", args[0].Type())
+}
+
+func typeOf(args ...object.Object) (object.Object, error) {
+	if err := arity("type", args, 1); err != nil {
+		return nil, err
+	}
+	return &object.String{Value: string(args[0].Type())}, nil
+}
+
+func str(args ...object.Object) (object.Object, error) {
+	if err := arity("str", args, 1); err != nil {
+		return nil, err
+	}
+	if s, ok := args[0].(*object.String); ok {
+		return s, nil
+	}
+	return &object.String{Value: args[0].Inspect()}, nil
+}
+
+func toInt(args ...object.Object) (object.Object, error) {
+	if err := arity("int", args, 1); err != nil {
+		return nil, err
+	}
+	switch arg := args[0].(type) {
+	case *object.Integer:
+		return arg, nil
+	case *object.Float:
+		if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+			return nil, object.Errorf(object.TypeError, "cannot convert %s to INTEGER", arg.Inspect())
+		}
+		return &object.Integer{Value: int64(arg.Value)}, nil
+	case *object.Boolean:
+		if arg.Value {
+			return &object.Integer{Value: 1}, nil
+		}
+		return &object.Integer{Value: 0}, nil
+	case *object.String:
+		value, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 10, 64)
+		if err != nil {
+			return nil, object.Errorf(object.ValueError, "cannot convert %q to INTEGER", arg.Value)
+		}
+		return &object.Integer{Value: value}, nil
+	}
+	return nil, object.Errorf(object.TypeError, "cannot convert %s to INTEGER", args[0].Type())
+}
+
+func toFloat(args ...object.Object) (object.Object, error) {
+	if err := arity("float", args, 1); err != nil {
+		return nil, err
+	}
+	switch arg := args[0].(type) {
+	case *object.Float:
+		return arg, nil
+	case *object.Integer:
+		return &object.Float{Value: float64(arg.Value)}, nil
+	case *object.String:
+		value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+		if err != nil {
+			return nil, object.Errorf(object.ValueError, "cannot convert %q to FLOAT", arg.Value)
+		}
+		return &object.Float{Value: value}, nil
+	}
+	return nil, object.Errorf(object.TypeError, "cannot convert %s to FLOAT", args[0].Type())
+}
+
+func toBool(args ...object.Object) (object.Object, error) {
+	if err := arity("bool", args, 1); err != nil {
+		return nil, err
+	}
+	return object.NativeBool(object.IsTruthy(args[0])), nil
+}
+
+// Arrays are immutable: push and pop return a new array and leave their
+// argument untouched. pop drops the last element rather than returning it,
+// which is what last is for.
+func push(args ...object.Object) (object.Object, error) {
+	if err := arity("push", args, 2); err != nil {
+		return nil, err
+	}
+	array, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, object.Errorf(object.TypeError, "first argument to push must be ARRAY, got %s", args[0].Type())
+	}
+	elements := make([]object.Object, len(array.Elements), len(array.Elements)+1)
+	copy(elements, array.Elements)
+	return &object.Array{Elements: append(elements, args[1])}, nil
+}
+
+func pop(args ...object.Object) (object.Object, error) {
+	array, err := arrayArgument("pop", args)
+	if err != nil {
+		return nil, err
+	}
+	if len(array.Elements) == 0 {
+		return nil, object.Errorf(object.IndexError, "pop from empty array")
+	}
+	elements := make([]object.Object, len(array.Elements)-1)
+	copy(elements, array.Elements)
+	return &object.Array{Elements: elements}, nil
+}
+
+func first(args ...object.Object) (object.Object, error) {
+	array, err := arrayArgument("first", args)
+	if err != nil {
+		return nil, err
+	}
+	if len(array.Elements) == 0 {
+		return object.NULL, nil
+	}
+	return array.Elements[0], nil
+}
+
+func last(args ...object.Object) (object.Object, error) {
+	array, err := arrayArgument("last", args)
+	if err != nil {
+		return nil, err
+	}
+	if len(array.Elements) == 0 {
+		return object.NULL, nil
+	}
+	return array.Elements[len(array.Elements)-1], nil
+}
+
+func rest(args ...object.Object) (object.Object, error) {
+	array, err := arrayArgument("rest", args)
+	if err != nil {
+		return nil, err
+	}
+	if len(array.Elements) == 0 {
+		return object.NULL, nil
+	}
+	elements := make([]object.Object, len(array.Elements)-1)
+	copy(elements, array.Elements[1:])
+	return &object.Array{Elements: elements}, nil
+}
+
+func keys(args ...object.Object) (object.Object, error) {
+	hash, err := hashArgument("keys", args)
+	if err != nil {
+		return nil, err
+	}
+	elements := []object.Object{}
+	for _, pair := range hash.Entries() {
+		elements = append(elements, pair.Key)
+	}
+	return &object.Array{Elements: elements}, nil
+}
+
+func values(args ...object.Object) (object.Object, error) {
+	hash, err := hashArgument("values", args)
+	if err != nil {
+		return nil, err
+	}
+	elements := []object.Object{}
+	for _, pair := range hash.Entries() {
+		elements = append(elements, pair.Value)
+	}
+	return &object.Array{Elements: elements}, nil
+}
+
+// rangeOf accepts range(end), range(start, end) and range(start, end,
+// step), counting up to but excluding end.
+func rangeOf(args ...object.Object) (object.Object, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, object.Errorf(object.ArgumentError, "wrong number of arguments to range: expected 1 to 3, got %d", len(args))
+	}
+	bounds := []int64{0, 0, 1}
+	for i, arg := range args {
+		value, err := integerArgument("range", arg)
+		if err != nil {
+			return nil, err
+		}
+		bounds[i] = value
+	}
+	if len(args) == 1 {
+		bounds[0], bounds[1] = 0, bounds[0]
+	}
+	start, end, step := bounds[0], bounds[1], bounds[2]
+	if step == 0 {
+		return nil, object.Errorf(object.ValueError, "range step must not be zero")
+	}
+
+	elements := []object.Object{}
+	for i := start; (step > 0 && i < end) || (step < 0 && i > end); i += step {
+		elements = append(elements, &object.Integer{Value: i})
+	}
+	return &object.Array{Elements: elements}, nil
+}
+
+// extreme builds min and max, which take either numbers or a single array
+// of numbers and return the one whose comparison with the others has the
+// sign of want.
+func extreme(name string, want int) object.BuiltinFunction {
+	return func(args ...object.Object) (object.Object, error) {
+		candidates := args
+		if len(args) == 1 {
+			if array, ok := args[0].(*object.Array); ok {
+				candidates = array.Elements
+			}
+		}
+		if len(candidates) == 0 {
+			return nil, object.Errorf(object.ValueError, "%s of empty sequence", name)
+		}
+
+		var best object.Object
+		var bestValue float64
+		for _, candidate := range candidates {
+			value, ok := number(candidate)
+			if !ok {
+				return nil, object.Errorf(object.TypeError, "argument to %s must be a number, got %s", name, candidate.Type())
+			}
+			if best == nil || (want < 0 && value < bestValue) || (want > 0 && value > bestValue) {
+				best, bestValue = candidate, value
+			}
+		}
+		return best, nil
+	}
+}
+
+func number(obj object.Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value), true
+	case *object.Float:
+		return obj.Value, true
+	}
+	return 0, false
+}
+
+func abs(args ...object.Object) (object.Object, error) {
+	if err := arity("abs", args, 1); err != nil {
+		return nil, err
+	}
+	switch arg := args[0].(type) {
+	case *object.Integer:
+		if arg.Value < 0 {
+			return &object.Integer{Value: -arg.Value}, nil
+		}
+		return arg, nil
+	case *object.Float:
+		return &object.Float{Value: math.Abs(arg.Value)}, nil
+	}
+	return nil, object.Errorf(object.TypeError, "argument to abs must be a number, got %s", args[0].Type())
+}
+
+func assert(args ...object.Object) (object.Object, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, object.Errorf(object.ArgumentError, "wrong number of arguments to assert: expected 1 or 2, got %d", len(args))
+	}
+	if object.IsTruthy(args[0]) {
+		return object.NULL, nil
+	}
+	if len(args) == 2 {
+		return nil, object.Errorf(object.AssertionError, "assertion failed: %s", args[1].Inspect())
+	}
+	return nil, object.Errorf(object.AssertionError, "assertion failed")
+}
+
+// raise aborts the program with a runtime error carrying its argument.
+func raise(args ...object.Object) (object.Object, error) {
+	if err := arity("error", args, 1); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%s", args[0].Inspect())
+}
+
+// result builds ok and err, which wrap their argument in a result.
+func result(ok bool) object.BuiltinFunction {
+	name := "err"
+	if ok {
+		name = "ok"
+	}
+	return func(args ...object.Object) (object.Object, error) {
+		if err := arity(name, args, 1); err != nil {
+			return nil, err
+		}
+		return &object.Result{Ok: ok, Value: args[0]}, nil
+	}
+}
@@ -0,0 +1,170 @@
+package builtins_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"turatti/builtins"
+	"turatti/evaluator"
+	"turatti/lexer"
+	"turatti/object"
+	"turatti/parser"
+)
+
+func run(t *testing.T, input string) (object.Object, string) {
+	psr := parser.New(lexer.New(input))
+	program := psr.Parse()
+	if len(psr.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, psr.Errors())
+	}
+	var out bytes.Buffer
+	env := evaluator.NewGlobalEnvironment(evaluator.Options{Stdout: &out})
+	return evaluator.Eval(program, env), out.String()
+}
+
+func TestBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`len("")`, "0"},
+		{`len("héllo")`, "5"},
+		{`len([1, 2, 3])`, "3"},
+		{`len({"a": 1})`, "1"},
+		{`len(1)`, "1:1: runtime error: argument to len not supported, got INTEGER"},
+		{`len("a", "b")`, "1:1: runtime error: wrong number of arguments to len: expected 1, got 2"},
+
+		{`type(1)`, "INTEGER"},
+		{`type(1.5)`, "FLOAT"},
+		{`type("")`, "STRING"},
+		{`type([])`, "ARRAY"},
+		{`type({})`, "HASH"},
+		{`type(len)`, "BUILTIN"},
+		{`type(fun() {})`, "FUNCTION"},
+
+		{`str(12) + "!"`, "12!"},
+		{`str([1, "a"])`, "[1, a]"},
+		{`str(2.0)`, "2.0"},
+
+		{`int("42") + 1`, "43"},
+		{`int(3.9)`, "3"},
+		{`int(-3.9)`, "-3"},
+		{`int(true)`, "1"},
+		{`int("4x")`, `1:1: runtime error: cannot convert "4x" to INTEGER`},
+		{`int([])`, "1:1: runtime error: cannot convert ARRAY to INTEGER"},
+		{`float(2)`, "2.0"},
+		{`float("0.5")`, "0.5"},
+		{`float(true)`, "1:1: runtime error: cannot convert BOOLEAN to FLOAT"},
+		{`bool(0)`, "true"},
+		{`bool(false)`, "false"},
+		{`bool(if (false) { 1 })`, "false"},
+		{`bool("")`, "true"},
+
+		{`push([1], 2)`, "[1, 2]"},
+		{`def a = [1]; push(a, 2); a`, "[1]"},
+		{`push(1, 2)`, "1:1: runtime error: first argument to push must be ARRAY, got INTEGER"},
+		{`pop([1, 2, 3])`, "[1, 2]"},
+		{`pop([])`, "1:1: runtime error: pop from empty array"},
+		{`first([7, 8])`, "7"},
+		{`first([])`, "null"},
+		{`rest([7, 8, 9])`, "[8, 9]"},
+		{`rest([])`, "null"},
+		{`last([7, 8])`, "8"},
+		{`last([])`, "null"},
+		{`def a = [1, 2]; [pop(a), last(a), a]`, "[[1], 2, [1, 2]]"},
+		{`first("ab")`, "1:1: runtime error: argument to first must be ARRAY, got STRING"},
+
+		{`keys({"b": 1, "a": 2, 3: 4})`, "[b, a, 3]"},
+		{`values({"b": 1, "a": 2, 3: 4})`, "[1, 2, 4]"},
+		{`keys([])`, "1:1: runtime error: argument to keys must be HASH, got ARRAY"},
+
+		{`range(3)`, "[0, 1, 2]"},
+		{`range(2, 5)`, "[2, 3, 4]"},
+		{`range(5, 0, -2)`, "[5, 3, 1]"},
+		{`range(0)`, "[]"},
+		{`range(0, 5, 0)`, "1:1: runtime error: range step must not be zero"},
+		{`range("a")`, "1:1: runtime error: argument to range must be INTEGER, got STRING"},
+
+		{`min(3, 1, 2)`, "1"},
+		{`max(3, 1.5, 2)`, "3"},
+		{`min([4, -0.5])`, "-0.5"},
+		{`max([])`, "1:1: runtime error: max of empty sequence"},
+		{`min(1, "a")`, "1:1: runtime error: argument to min must be a number, got STRING"},
+		{`abs(-4)`, "4"},
+		{`abs(-4.5)`, "4.5"},
+		{`abs("a")`, "1:1: runtime error: argument to abs must be a number, got STRING"},
+
+		{`assert(1 < 2)`, "null"},
+		{`assert(1 > 2)`, "1:1: runtime error: assertion failed"},
+		{`assert(false, "sizes differ")`, "1:1: runtime error: assertion failed: sizes differ"},
+		{`error("boom"); 1`, "1:1: runtime error: boom"},
+		{`def f = fun() {
+    error("deep");
+};
+f()`, "2:5: runtime error: deep"},
+
+		{`ok([1])`, "ok([1])"},
+		{`err("bad")`, "err(bad)"},
+		{`ok()`, "1:1: runtime error: wrong number of arguments to ok: expected 1, got 0"},
+		{`[ok(1).is_ok(), ok(1).is_err(), err(1).is_err()]`, "[true, false, true]"},
+		{`ok(1).unwrap() + err(2).unwrap_err()`, "3"},
+		{`[ok(1).unwrap_or(0), err(1).unwrap_or(0)]`, "[1, 0]"},
+		{`err("bad").unwrap()`, "1:1: runtime error: unwrap called on err(bad)"},
+		{`ok(1).unwrap_err()`, "1:1: runtime error: unwrap_err called on ok(1)"},
+		{`ok(1).unwrap_or()`, "1:1: runtime error: wrong number of arguments to unwrap_or: expected 1, got 0"},
+		{`ok(1).value`, "1:7: runtime error: RESULT has no method value"},
+		{`[ok(1) == ok(1), ok(1) == err(1), err([1]) != err([1])]`, "[true, false, false]"},
+	}
+
+	for _, tt := range tests {
+		result, _ := run(t, tt.input)
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestPrinting(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`print("a", 1); print("b")`, "a 1b"},
+		{`println("a", [1, 2], 2.5); println()`, "a [1, 2] 2.5\n\n"},
+		{`puts("a", "b")`, "a\nb\n"},
+	}
+
+	for _, tt := range tests {
+		result, out := run(t, tt.input)
+		if result != evaluator.NULL {
+			t.Errorf("%s: expected null, got %s", tt.input, result.Inspect())
+		}
+		if out != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, out)
+		}
+	}
+}
+
+func TestNamesMatchNew(t *testing.T) {
+	names := builtins.Names()
+	created := builtins.New(nil)
+	if len(names) != len(created) {
+		t.Fatalf("expected %d builtins, got %d", len(names), len(created))
+	}
+	for i, builtin := range created {
+		if builtin.Name != names[i] {
+			t.Errorf("builtin %d: expected %s, got %s", i, names[i], builtin.Name)
+		}
+	}
+}
+
+func TestEveryBuiltinHasDoc(t *testing.T) {
+	for _, name := range builtins.Names() {
+		if doc, ok := builtins.Doc(name); !ok || !strings.HasPrefix(doc, name+"(") {
+			t.Errorf("expected the doc of %s to start with its usage, got %q", name, doc)
+		}
+	}
+	if _, ok := builtins.Doc("missing"); ok {
+		t.Errorf("expected no doc for an undefined builtin")
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"turatti/builtins"
+	"turatti/resolver"
+	"turatti/types"
+)
+
+// checkCommand reports resolution errors and, when names resolve, type
+// errors, without running the program.
+func checkCommand(args []string) int {
+	if len(args) != 1 {
+		return usageError("check")
+	}
+
+	program, ok := parseFile(args[0])
+	if !ok {
+		return exitSyntaxError
+	}
+
+	result := resolver.Resolve(program, append(builtins.Names(), "args")...)
+	for _, diagnostic := range result.Diagnostics {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", sourceName(args[0]), diagnostic)
+	}
+	if result.HasErrors() {
+		return exitSyntaxError
+	}
+
+	typeErrors := types.Check(program).Errors
+	for _, err := range typeErrors {
+		fmt.Fprintf(os.Stderr, "%s:%s: error: %s\n", sourceName(args[0]), err.Pos, err.Message)
+	}
+	if len(typeErrors) > 0 {
+		return exitSyntaxError
+	}
+	return exitOK
+}
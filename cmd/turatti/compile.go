@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"turatti/compiler"
+	"turatti/optimizer"
+)
+
+func compileCommand(args []string) int {
+	flags := flag.NewFlagSet("compile", flag.ContinueOnError)
+	output := flags.String("o", "", "write the bytecode to `file` instead of next to the source")
+	allowShadowing := flags.Bool("allow-shadowing", false, "let def statements redefine builtins")
+	var passes passesFlag
+	flags.Var(&passes, "O", passesUsage)
+	if err := flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if flags.NArg() != 1 || (flags.Arg(0) == "-" && *output == "") {
+		return usageError("compile")
+	}
+
+	path := flags.Arg(0)
+	bytecode, _, status := compileFile(path, *allowShadowing, optimizer.Pass(passes))
+	if status != exitOK {
+		return status
+	}
+
+	if *output == "" {
+		*output = strings.TrimSuffix(path, ".trt") + ".trtc"
+	}
+	var buf bytes.Buffer
+	if err := compiler.Encode(&buf, bytecode); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntimeError
+	}
+	if err := os.WriteFile(*output, buf.Bytes(), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntimeError
+	}
+	return exitOK
+}
+
+func disasmCommand(args []string) int {
+	if len(args) != 1 {
+		return usageError("disasm")
+	}
+
+	path := args[0]
+	var bytecode *compiler.Bytecode
+	var src string
+	if isBytecode(path) {
+		var ok bool
+		if bytecode, ok = loadBytecode(path); !ok {
+			return exitSyntaxError
+		}
+	} else {
+		var status int
+		if bytecode, src, status = compileFile(path, false, 0); status != exitOK {
+			return status
+		}
+	}
+
+	if err := compiler.Disassemble(os.Stdout, bytecode, src); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntimeError
+	}
+	return exitOK
+}
+
+func isBytecode(path string) bool {
+	return strings.HasSuffix(path, ".trtc")
+}
+
+// compileFile parses and compiles the program at path, reporting any error
+// on stderr. It also returns the source, for listings.
+func compileFile(path string, allowShadowing bool, passes optimizer.Pass) (*compiler.Bytecode, string, int) {
+	src, name, err := readSource(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, "", exitSyntaxError
+	}
+	program, ok := parseSource(name, src)
+	if !ok {
+		return nil, "", exitSyntaxError
+	}
+	if passes != 0 {
+		optimizer.Optimize(program, passes)
+	}
+	bytecode, err := compiler.Compile(program, compiler.Options{
+		Globals:        []string{"args"},
+		AllowShadowing: allowShadowing,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", name, err)
+		return nil, "", exitSyntaxError
+	}
+	return bytecode, src, exitOK
+}
+
+// loadBytecode reads a file written by the compile command, reporting any
+// error on stderr.
+func loadBytecode(path string) (*compiler.Bytecode, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, false
+	}
+	defer f.Close()
+
+	bytecode, err := compiler.Decode(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+		return nil, false
+	}
+	return bytecode, true
+}
+
+const passesUsage = "optimize the program with every pass, or with the comma-separated `passes` among fold, not, prune and unreachable"
+
+// passesFlag is the -O flag, which enables every optimizer pass when given
+// alone and the named ones when set to a list, as in -O=fold,prune.
+type passesFlag optimizer.Pass
+
+var passNames = []struct {
+	name string
+	pass optimizer.Pass
+}{
+	{"fold", optimizer.FoldConstants},
+	{"not", optimizer.SimplifyNot},
+	{"prune", optimizer.PruneBranches},
+	{"unreachable", optimizer.DropUnreachable},
+}
+
+func (p *passesFlag) String() string {
+	names := []string{}
+	for _, pn := range passNames {
+		if optimizer.Pass(*p)&pn.pass != 0 {
+			names = append(names, pn.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func (p *passesFlag) Set(value string) error {
+	switch value {
+	case "true":
+		*p = passesFlag(optimizer.All)
+		return nil
+	case "false":
+		*p = 0
+		return nil
+	}
+	*p = 0
+	for _, name := range strings.Split(value, ",") {
+		found := false
+		for _, pn := range passNames {
+			if pn.name == name {
+				*p |= passesFlag(pn.pass)
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown pass %q", name)
+		}
+	}
+	return nil
+}
+
+// IsBoolFlag lets -O be given without a value.
+func (p *passesFlag) IsBoolFlag() bool {
+	return true
+}
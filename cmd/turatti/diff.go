@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContext = 3
+
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// unifiedDiff renders the line differences between a and b in unified
+// diff format, using a longest common subsequence over their lines.
+func unifiedDiff(nameA, nameB, a, b string) string {
+	linesA := splitLines(a)
+	linesB := splitLines(b)
+
+	lcs := make([][]int, len(linesA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(linesB)+1)
+	}
+	for i := len(linesA) - 1; i >= 0; i-- {
+		for j := len(linesB) - 1; j >= 0; j-- {
+			if linesA[i] == linesB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] > lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := []diffLine{}
+	i, j := 0, 0
+	for i < len(linesA) || j < len(linesB) {
+		switch {
+		case i < len(linesA) && j < len(linesB) && linesA[i] == linesB[j]:
+			lines = append(lines, diffLine{' ', linesA[i]})
+			i++
+			j++
+		case i < len(linesA) && (j == len(linesB) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', linesA[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', linesB[j]})
+			j++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", nameA, nameB)
+
+	lineA, lineB := 1, 1
+	for start := 0; start < len(lines); {
+		if lines[start].kind == ' ' {
+			lineA++
+			lineB++
+			start++
+			continue
+		}
+
+		from := start - diffContext
+		if from < 0 {
+			from = 0
+		}
+		end := start
+		for k := start; k < len(lines) && k-end <= 2*diffContext; k++ {
+			if lines[k].kind != ' ' {
+				end = k + 1
+			}
+		}
+		to := end + diffContext
+		if to > len(lines) {
+			to = len(lines)
+		}
+
+		hunkA, hunkB := lineA-(start-from), lineB-(start-from)
+		countA, countB := 0, 0
+		for _, line := range lines[from:to] {
+			if line.kind != '+' {
+				countA++
+			}
+			if line.kind != '-' {
+				countB++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", hunkA, countA, hunkB, countB)
+		for _, line := range lines[from:to] {
+			out.WriteByte(line.kind)
+			out.WriteString(line.text)
+			out.WriteByte('\n')
+		}
+
+		for _, line := range lines[start:to] {
+			if line.kind != '+' {
+				lineA++
+			}
+			if line.kind != '-' {
+				lineB++
+			}
+		}
+		start = to
+	}
+	return out.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"turatti/ast"
+	"turatti/token"
+)
+
+func tokensCommand(args []string) int {
+	if len(args) != 1 {
+		return usageError("tokens")
+	}
+
+	src, name, err := readSource(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSyntaxError
+	}
+
+	status := exitOK
+	lex := newLexer(name, src)
+	for tok := lex.NextToken(); tok.Type != token.EOF; tok = lex.NextToken() {
+		fmt.Printf("%-8s %-10s %q\n", tok.Pos(), tok.Type, tok.Literal)
+		if tok.Type == token.ILLEGAL {
+			status = exitSyntaxError
+		}
+	}
+	return status
+}
+
+func astCommand(args []string) int {
+	if len(args) != 1 {
+		return usageError("ast")
+	}
+
+	program, ok := parseFile(args[0])
+	if !ok {
+		return exitSyntaxError
+	}
+
+	depth := 0
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node == nil {
+			depth--
+			return false
+		}
+		fmt.Printf("%s%s %s-%s%s\n", strings.Repeat("  ", depth), reflect.TypeOf(node).Elem().Name(),
+			node.Pos(), node.End(), nodeDetail(node))
+		depth++
+		return true
+	})
+	return exitOK
+}
+
+func nodeDetail(node ast.Node) string {
+	switch n := node.(type) {
+	case *ast.Identifier:
+		return " " + n.Value
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.Boolean:
+		return " " + n.TokenLiteral()
+	case *ast.StringLiteral:
+		return fmt.Sprintf(" %q", n.Value)
+	case *ast.PrefixExpression:
+		return " " + n.Operator
+	case *ast.InfixExpression:
+		return " " + n.Operator
+	case *ast.TypeExpression:
+		return " " + n.String()
+	}
+	return ""
+}
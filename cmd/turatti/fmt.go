@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"turatti/formatter"
+)
+
+func fmtCommand(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write result to the source file instead of stdout")
+	showDiff := flags.Bool("d", false, "display diffs instead of rewriting files")
+	if err := flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if flags.NArg() == 0 {
+		return usageError("fmt")
+	}
+
+	status := exitOK
+	for _, path := range flags.Args() {
+		src, name, err := readSource(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = exitSyntaxError
+			continue
+		}
+		program, ok := parseSource(name, src)
+		if !ok {
+			status = exitSyntaxError
+			continue
+		}
+		formatted := string(formatter.Format(program))
+
+		switch {
+		case *showDiff:
+			if src != formatted {
+				fmt.Print(unifiedDiff(name+".orig", name, src, formatted))
+			}
+		case *write && path != "-":
+			if src == formatted {
+				continue
+			}
+			if err := os.WriteFile(path, []byte(formatted), 0644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				status = exitRuntimeError
+			}
+		default:
+			fmt.Print(formatted)
+		}
+	}
+	return status
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"turatti/highlight"
+)
+
+func highlightCommand(args []string) int {
+	flags := flag.NewFlagSet("highlight", flag.ContinueOnError)
+	asHTML := flags.Bool("html", false, "print a standalone HTML page instead of colored text")
+	textMate := flags.Bool("textmate", false, "print the TextMate grammar for Turatti instead of a program")
+	if err := flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if *textMate {
+		if flags.NArg() != 0 || *asHTML {
+			return usageError("highlight")
+		}
+		os.Stdout.Write(highlight.TextMate())
+		return exitOK
+	}
+	if flags.NArg() != 1 {
+		return usageError("highlight")
+	}
+
+	src, name, err := readSource(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSyntaxError
+	}
+	if *asHTML {
+		fmt.Print(highlight.Page(name, src))
+	} else {
+		fmt.Print(highlight.ANSI(src))
+	}
+	return exitOK
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"turatti/lsp"
+)
+
+func lspCommand(args []string) int {
+	if len(args) > 0 {
+		return usageError("lsp")
+	}
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+		fmt.Fprintf(os.Stderr, "turatti lsp: %v\n", err)
+		return exitRuntimeError
+	}
+	return exitOK
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"turatti/repl"
+)
+
+const (
+	exitOK           = 0
+	exitRuntimeError = 1
+	exitSyntaxError  = 2
+)
+
+type command struct {
+	usage   string
+	summary string
+	run     func(args []string) int
+}
+
+var commands map[string]command
+
+// details holds what help shows about a command after its summary.
+var details = map[string]string{
+	"run":     vmModules,
+	"compile": vmModules,
+}
+
+const vmModules = `Modules only run on the evaluator: programs with import statements cannot be
+compiled to bytecode, so they cannot run with --vm either, and run rejects
+--path together with --vm or a .trtc file.`
+
+func init() {
+	commands = map[string]command{
+		"run":       {"run [--vm] [--trace] [-O[=passes]] [--allow-shadowing] [--path dirs] [file.trt | file.trtc | -] [args...]", "run a Turatti program", runCommand},
+		"compile":   {"compile [-o file.trtc] [-O[=passes]] [--allow-shadowing] [file.trt | -]", "compile a program to bytecode", compileCommand},
+		"disasm":    {"disasm [file.trt | file.trtc | -]", "print the bytecode of a program", disasmCommand},
+		"repl":      {"repl", "start an interactive session", replCommand},
+		"tokens":    {"tokens [file.trt | -]", "print the tokens of a program", tokensCommand},
+		"ast":       {"ast [file.trt | -]", "print the syntax tree of a program", astCommand},
+		"parse":     {"parse [--json] [file.trt | -]", "print a program as parsed, optionally as JSON", parseCommand},
+		"check":     {"check [file.trt | -]", "report name and type errors without running a program", checkCommand},
+		"fmt":       {"fmt [-w] [-d] files...", "format Turatti source files", fmtCommand},
+		"highlight": {"highlight [--html] [file.trt | -] | highlight --textmate", "print a program with syntax highlighting", highlightCommand},
+		"lsp":       {"lsp", "serve the Language Server Protocol over standard input and output", lspCommand},
+		"help":      {"help [command]", "show help for turatti or one of its commands", helpCommand},
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		os.Exit(replCommand(nil))
+	}
+
+	name := os.Args[1]
+	if name == "-h" || name == "--help" {
+		usage(os.Stdout)
+		os.Exit(exitOK)
+	}
+
+	command, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "turatti: unknown command %q\n", name)
+		usage(os.Stderr)
+		os.Exit(exitSyntaxError)
+	}
+	os.Exit(command.run(os.Args[2:]))
+}
+
+func usage(out io.Writer) {
+	fmt.Fprintf(out, "Turatti is a small scripting language.\n\n")
+	fmt.Fprintf(out, "Usage:\n\n\tturatti <command> [arguments]\n\n")
+	fmt.Fprintf(out, "Without a command, turatti starts the REPL. The commands are:\n\n")
+
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "\t%-10s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(out, "\nA file argument of \"-\" reads the program from standard input.\n")
+	fmt.Fprintf(out, "Use \"turatti help <command>\" for more information about a command.\n")
+}
+
+func helpCommand(args []string) int {
+	if len(args) == 0 {
+		usage(os.Stdout)
+		return exitOK
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "turatti help: unknown command %q\n", args[0])
+		return exitSyntaxError
+	}
+	fmt.Printf("usage: turatti %s\n\n%s.\n", command.usage, command.summary)
+	if details, ok := details[args[0]]; ok {
+		fmt.Printf("\n%s\n", details)
+	}
+	return exitOK
+}
+
+func replCommand(args []string) int {
+	if len(args) > 0 {
+		return usageError("repl")
+	}
+	fmt.Printf("Running Turatti lang REPL...\n")
+	repl.Start(os.Stdin, os.Stdout)
+	return exitOK
+}
+
+func usageError(name string) int {
+	fmt.Fprintf(os.Stderr, "usage: turatti %s\n", commands[name].usage)
+	return exitSyntaxError
+}
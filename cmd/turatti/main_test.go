@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"turatti/optimizer"
+)
+
+func TestRunExitCodes(t *testing.T) {
+	tests := []struct {
+		src      string
+		flags    []string
+		expected int
+	}{
+		{"1 + 1;", nil, exitOK},
+		{"1 + true;", nil, exitRuntimeError},
+		{"def = 1;", nil, exitSyntaxError},
+		{"def f = fun(n) { f(n + 1) };\nf(0);", nil, exitRuntimeError},
+		{"def f = fun(n) { f(n + 1) };\nf(0);", []string{"--vm"}, exitRuntimeError},
+		{"if (1 < 2) { 1 };", []string{"-O"}, exitOK},
+		{"if (true) { 1 / 0 };", []string{"--vm", "-O=fold,prune"}, exitRuntimeError},
+		{"1;", []string{"-O=fold,inline"}, exitSyntaxError},
+		{"1;", []string{"--vm", "--path", "lib"}, exitSyntaxError},
+		{"import \"util.trt\" as util;", []string{"--vm"}, exitSyntaxError},
+	}
+
+	// Tracebacks and syntax errors go to stderr, which the test discards.
+	stderr := os.Stderr
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stderr = devNull
+	defer func() {
+		os.Stderr = stderr
+		devNull.Close()
+	}()
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "main.trt")
+		if err := os.WriteFile(path, []byte(tt.src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := runCommand(append(tt.flags, path)); got != tt.expected {
+			t.Errorf("run %v %q: expected exit code %d, got %d", tt.flags, tt.src, tt.expected, got)
+		}
+	}
+}
+
+func TestPassesFlag(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected optimizer.Pass
+	}{
+		{"true", optimizer.All},
+		{"false", 0},
+		{"fold", optimizer.FoldConstants},
+		{"not,unreachable", optimizer.SimplifyNot | optimizer.DropUnreachable},
+	}
+
+	for _, tt := range tests {
+		var passes passesFlag
+		if err := passes.Set(tt.value); err != nil || optimizer.Pass(passes) != tt.expected {
+			t.Errorf("-O=%s: expected passes %b, got %b (%v)", tt.value, tt.expected, passes, err)
+		}
+	}
+	var passes passesFlag
+	if err := passes.Set("fold,"); err == nil {
+		t.Errorf("expected an error for an empty pass name")
+	}
+}
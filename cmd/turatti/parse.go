@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"turatti/ast"
+	"turatti/lexer"
+	"turatti/parser"
+)
+
+func parseCommand(args []string) int {
+	flags := flag.NewFlagSet("parse", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the AST as JSON")
+	if err := flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if flags.NArg() != 1 {
+		return usageError("parse")
+	}
+
+	program, ok := parseFile(flags.Arg(0))
+	if !ok {
+		return exitSyntaxError
+	}
+
+	if !*asJSON {
+		fmt.Println(program.String())
+		return exitOK
+	}
+
+	data, err := ast.EncodeJSONIndent(program, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntimeError
+	}
+	fmt.Println(string(data))
+	return exitOK
+}
+
+// readSource returns the contents of the file at path, or of standard
+// input when path is "-", along with the name to report it under.
+func readSource(path string) (string, string, error) {
+	if path == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		return string(data), sourceName(path), err
+	}
+	if !strings.HasSuffix(path, ".trt") {
+		return "", path, fmt.Errorf("%s: not a .trt file", path)
+	}
+	data, err := os.ReadFile(path)
+	return string(data), path, err
+}
+
+func sourceName(path string) string {
+	if path == "-" {
+		return "<stdin>"
+	}
+	return path
+}
+
+func newLexer(name, src string) *lexer.Lexer {
+	lex := lexer.New(src)
+	lex.FileName = name
+	return lex
+}
+
+// parseFile parses the program at path, reporting any error on stderr.
+func parseFile(path string) (*ast.Program, bool) {
+	src, name, err := readSource(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, false
+	}
+	return parseSource(name, src)
+}
+
+func parseSource(name, src string) (*ast.Program, bool) {
+	p := parser.New(newLexer(name, src))
+	program := p.Parse()
+	for _, msg := range p.Errors() {
+		fmt.Fprintln(os.Stderr, msg)
+	}
+	return program, len(p.Errors()) == 0
+}
+
+func flagError(err error) int {
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	return exitSyntaxError
+}
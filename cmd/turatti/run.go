@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"turatti/compiler"
+	"turatti/evaluator"
+	"turatti/modules"
+	"turatti/object"
+	"turatti/optimizer"
+	"turatti/vm"
+)
+
+func runCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	allowShadowing := flags.Bool("allow-shadowing", false, "let def statements redefine builtins")
+	useVM := flags.Bool("vm", false, "compile the program to bytecode and run it on the virtual machine, which cannot import modules")
+	trace := flags.Bool("trace", false, "show the arguments of every call in the traceback of a runtime error")
+	searchPath := flags.String("path", os.Getenv(modules.PathVariable), "directories searched for imported modules, separated like in PATH; not with --vm")
+	var passes passesFlag
+	flags.Var(&passes, "O", passesUsage)
+	if err := flags.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if flags.NArg() == 0 {
+		return usageError("run")
+	}
+	if *useVM || isBytecode(flags.Arg(0)) {
+		pathSet := false
+		flags.Visit(func(f *flag.Flag) { pathSet = pathSet || f.Name == "path" })
+		if pathSet {
+			fmt.Fprintln(os.Stderr, "turatti run: --path cannot be used with bytecode or --vm, as modules only run on the evaluator")
+			return exitSyntaxError
+		}
+	}
+
+	scriptArgs := &object.Array{Elements: []object.Object{}}
+	for _, arg := range flags.Args()[1:] {
+		scriptArgs.Elements = append(scriptArgs.Elements, &object.String{Value: arg})
+	}
+	var result object.Object
+	if *useVM || isBytecode(flags.Arg(0)) {
+		var bytecode *compiler.Bytecode
+		if isBytecode(flags.Arg(0)) {
+			var ok bool
+			if bytecode, ok = loadBytecode(flags.Arg(0)); !ok {
+				return exitSyntaxError
+			}
+		} else {
+			var status int
+			if bytecode, _, status = compileFile(flags.Arg(0), *allowShadowing, optimizer.Pass(passes)); status != exitOK {
+				return status
+			}
+		}
+		machine := vm.New(bytecode, vm.Options{File: sourceName(flags.Arg(0))})
+		machine.SetGlobal("args", scriptArgs)
+		result = machine.Run()
+	} else {
+		program, ok := parseFile(flags.Arg(0))
+		if !ok {
+			return exitSyntaxError
+		}
+		if passes != 0 {
+			optimizer.Optimize(program, optimizer.Pass(passes))
+		}
+		opts := evaluator.Options{AllowShadowing: *allowShadowing, File: sourceName(flags.Arg(0))}
+		opts.Importer = modules.NewLoader(modules.SearchPath(*searchPath), opts).Importer(flags.Arg(0))
+		env := evaluator.NewGlobalEnvironment(opts)
+		env.Set("args", scriptArgs)
+		result = evaluator.Eval(program, env)
+	}
+
+	if result, isError := result.(*object.Error); isError {
+		fmt.Fprint(os.Stderr, result.Traceback(*trace))
+		return exitRuntimeError
+	}
+	return exitOK
+}
@@ -0,0 +1,278 @@
+// Package code defines the bytecode instructions executed by the virtual
+// machine.
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"turatti/token"
+)
+
+type Instructions []byte
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+	OpNull
+	OpTrue
+	OpFalse
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpEqual
+	OpNotEqual
+	OpLessThan
+	OpGreaterThan
+	OpLessEqual
+	OpGreaterEqual
+	OpMinus
+	OpBang
+
+	OpJump
+	OpJumpNotTruthy
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetFree
+	OpGetBuiltin
+
+	OpArray
+	OpHash
+	OpIndex
+
+	OpClosure
+	OpCall
+	OpReturnValue
+
+	OpTry
+	OpEndTry
+	OpCaught
+	OpThrow
+	OpRethrow
+
+	OpMember
+	OpPropagate
+
+	OpDup
+	OpMatchArray
+	OpMatchHash
+	OpRest
+	OpDestructureArray
+	OpDestructureHash
+)
+
+// Definition describes an opcode: its name and the width in bytes of each
+// of its operands.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+	OpNull:     {"OpNull", []int{}},
+	OpTrue:     {"OpTrue", []int{}},
+	OpFalse:    {"OpFalse", []int{}},
+
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpMinus:        {"OpMinus", []int{}},
+	OpBang:         {"OpBang", []int{}},
+
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+
+	// Globals and locals are addressed by slot. Free variables are
+	// addressed by how many enclosing functions up their slot lives,
+	// followed by the slot.
+	OpGetGlobal:  {"OpGetGlobal", []int{2}},
+	OpSetGlobal:  {"OpSetGlobal", []int{2}},
+	OpGetLocal:   {"OpGetLocal", []int{2}},
+	OpSetLocal:   {"OpSetLocal", []int{2}},
+	OpGetFree:    {"OpGetFree", []int{1, 2}},
+	OpGetBuiltin: {"OpGetBuiltin", []int{1}},
+
+	// OpArray takes the number of elements and OpHash the number of keys
+	// and values together.
+	OpArray: {"OpArray", []int{2}},
+	OpHash:  {"OpHash", []int{2}},
+	OpIndex: {"OpIndex", []int{}},
+
+	OpClosure:     {"OpClosure", []int{2}},
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+
+	// OpTry installs a handler at the given offset, which runs with the
+	// stack as it was and the runtime error pushed on top of it when an
+	// instruction fails before the matching OpEndTry. OpCaught replaces
+	// that error with the value a catch clause binds, and OpRethrow raises
+	// it again.
+	OpTry:     {"OpTry", []int{2}},
+	OpEndTry:  {"OpEndTry", []int{}},
+	OpCaught:  {"OpCaught", []int{}},
+	OpThrow:   {"OpThrow", []int{}},
+	OpRethrow: {"OpRethrow", []int{}},
+
+	// OpMember takes the constant holding the name of the member.
+	// OpPropagate replaces an ok result with its value and jumps to its
+	// operand, and leaves an err result for the instructions that follow
+	// to return.
+	OpMember:    {"OpMember", []int{2}},
+	OpPropagate: {"OpPropagate", []int{2}},
+
+	// Match expressions keep their value on the stack while testing it,
+	// OpDup copying it for each test. OpMatchArray takes the number of
+	// elements an array pattern lists and whether it has a rest, and
+	// OpMatchHash the number of keys pushed above the value; both replace
+	// it with whether it has that shape. OpRest replaces an array with
+	// its elements from the given index on. OpDestructureArray and
+	// OpDestructureHash take the same operands, but pop the value and
+	// raise an error when it doesn't have the shape, as def statements and
+	// parameters destructure values instead of testing them.
+	OpDup:              {"OpDup", []int{}},
+	OpMatchArray:       {"OpMatchArray", []int{2, 1}},
+	OpMatchHash:        {"OpMatchHash", []int{2}},
+	OpRest:             {"OpRest", []int{2}},
+	OpDestructureArray: {"OpDestructureArray", []int{2, 1}},
+	OpDestructureHash:  {"OpDestructureHash", []int{2}},
+}
+
+// Operators maps the opcodes of binary operators to the operator they
+// implement.
+var Operators = map[Opcode]string{
+	OpAdd:          "+",
+	OpSub:          "-",
+	OpMul:          "*",
+	OpDiv:          "/",
+	OpEqual:        "==",
+	OpNotEqual:     "!=",
+	OpLessThan:     "<",
+	OpGreaterThan:  ">",
+	OpLessEqual:    "<=",
+	OpGreaterEqual: ">=",
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make encodes op and its operands into a single instruction. It returns
+// an empty instruction for unknown opcodes.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction described by def,
+// returning them and the number of bytes they took.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			return out.String()
+		}
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, fmtInstruction(def, operands))
+		i += 1 + read
+	}
+	return out.String()
+}
+
+func fmtInstruction(def *Definition, operands []int) string {
+	var out bytes.Buffer
+	out.WriteString(def.Name)
+	for _, operand := range operands {
+		fmt.Fprintf(&out, " %d", operand)
+	}
+	return out.String()
+}
+
+// SourcePos records that the instructions from Offset on were compiled from
+// the source at Pos.
+type SourcePos struct {
+	Offset int
+	Pos    token.Position
+}
+
+// SourceMap maps instruction offsets back to the source, sorted by offset.
+type SourceMap []SourcePos
+
+// Lookup returns the source position of the instruction at offset.
+func (m SourceMap) Lookup(offset int) token.Position {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}
+	}
+	return m[i-1].Pos
+}
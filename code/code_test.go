@@ -0,0 +1,105 @@
+package code
+
+import (
+	"testing"
+	"turatti/token"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetBuiltin, []int{255}, []byte{byte(OpGetBuiltin), 255}},
+		{OpGetFree, []int{2, 513}, []byte{byte(OpGetFree), 2, 2, 1}},
+		{OpTry, []int{258}, []byte{byte(OpTry), 1, 2}},
+		{OpMatchArray, []int{258, 1}, []byte{byte(OpMatchArray), 1, 2, 1}},
+		{OpDestructureHash, []int{3}, []byte{byte(OpDestructureHash), 0, 3}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+		if string(instruction) != string(tt.expected) {
+			t.Errorf("Make(%d, %v): expected %v, got %v", tt.op, tt.operands, tt.expected, instruction)
+		}
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpCall, []int{255}, 1},
+		{OpGetFree, []int{3, 300}, 3},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %v", err)
+		}
+		read, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Errorf("%s: expected %d bytes read, got %d", def.Name, tt.bytesRead, n)
+		}
+		for i, want := range tt.operands {
+			if read[i] != want {
+				t.Errorf("%s: operand %d: expected %d, got %d", def.Name, i, want, read[i])
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpGetFree, 1, 4),
+	}
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0004 OpConstant 2
+0007 OpConstant 65535
+0010 OpGetFree 1 4
+`
+	concatenated := Instructions{}
+	for _, ins := range instructions {
+		concatenated = append(concatenated, ins...)
+	}
+	if concatenated.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nexpected %q\ngot      %q", expected, concatenated.String())
+	}
+}
+
+func TestSourceMapLookup(t *testing.T) {
+	m := SourceMap{
+		{Offset: 0, Pos: token.Position{Line: 1, Column: 1}},
+		{Offset: 4, Pos: token.Position{Line: 2, Column: 3}},
+	}
+	tests := []struct {
+		offset   int
+		expected token.Position
+	}{
+		{0, token.Position{Line: 1, Column: 1}},
+		{3, token.Position{Line: 1, Column: 1}},
+		{4, token.Position{Line: 2, Column: 3}},
+		{40, token.Position{Line: 2, Column: 3}},
+	}
+	for _, tt := range tests {
+		if got := m.Lookup(tt.offset); got != tt.expected {
+			t.Errorf("Lookup(%d): expected %s, got %s", tt.offset, tt.expected, got)
+		}
+	}
+	if got := (SourceMap{}).Lookup(0); got.IsValid() {
+		t.Errorf("expected an empty source map to have no positions, got %s", got)
+	}
+}
@@ -0,0 +1,844 @@
+// Package compiler lowers syntax trees into bytecode for the virtual
+// machine.
+package compiler
+
+import (
+	"fmt"
+	"math"
+	"turatti/ast"
+	"turatti/builtins"
+	"turatti/code"
+	"turatti/object"
+	"turatti/token"
+)
+
+type Options struct {
+	// Globals are defined, in order, before any of the program's own
+	// definitions, so the host can bind them before running it.
+	Globals []string
+	// AllowShadowing lets def statements rebind the names of builtins.
+	AllowShadowing bool
+}
+
+// Bytecode is a compiled program. Main runs the top level statements and
+// returns the value of the last one, like the evaluator does.
+type Bytecode struct {
+	Main      *object.CompiledFunction
+	Constants []object.Object
+	// Globals names the global slots, including the predeclared ones.
+	Globals []string
+}
+
+type compilationScope struct {
+	instructions code.Instructions
+	sourceMap    code.SourceMap
+	// tries lists the try expressions being compiled, innermost last, so
+	// that return statements can leave them.
+	tries []tryRegion
+}
+
+// tryRegion is part of a try expression that a return statement leaves:
+// one where a handler is installed, and whose finally block runs on the
+// way out if it has one.
+type tryRegion struct {
+	finally *ast.BlockStatement
+}
+
+type Compiler struct {
+	opts      Options
+	constants []object.Object
+	globals   *SymbolTable
+	symbols   *SymbolTable
+	scopes    []compilationScope
+	protected map[string]bool
+}
+
+func New(opts Options) *Compiler {
+	globals := NewSymbolTable()
+	protected := map[string]bool{}
+	for i, name := range builtins.Names() {
+		globals.DefineBuiltin(i, name)
+		protected[name] = !opts.AllowShadowing
+	}
+	for _, name := range opts.Globals {
+		globals.Define(name)
+	}
+
+	return &Compiler{
+		opts:      opts,
+		constants: []object.Object{},
+		globals:   globals,
+		symbols:   globals,
+		scopes:    []compilationScope{{}},
+		protected: protected,
+	}
+}
+
+// Compile compiles program, reporting the first problem found.
+func Compile(program *ast.Program, opts Options) (*Bytecode, error) {
+	c := New(opts)
+	if err := c.Compile(program); err != nil {
+		return nil, err
+	}
+	return c.Bytecode(), nil
+}
+
+func (c *Compiler) Compile(program *ast.Program) error {
+	if err := c.hoist(program.Statements); err != nil {
+		return err
+	}
+	if err := c.compileBody(program.Statements, program.End()); err != nil {
+		return err
+	}
+	c.emit(program.End(), code.OpReturnValue)
+	return c.checkSize(program.Pos())
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	scope := c.scopes[len(c.scopes)-1]
+	return &Bytecode{
+		Main: &object.CompiledFunction{
+			Instructions: scope.instructions,
+			SourceMap:    scope.sourceMap,
+		},
+		Constants: c.constants,
+		Globals:   c.globals.Names(),
+	}
+}
+
+// hoist defines every name a list of statements binds, including the ones
+// inside blocks but not the ones of nested functions, before any of them
+// is compiled. Functions can then refer to definitions that follow
+// them, as they can in the evaluator.
+func (c *Compiler) hoist(statements []ast.Statement) error {
+	var err error
+	for _, stmt := range statements {
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.FunctionLiteral:
+				return false
+			case *ast.DefStatement:
+				for _, name := range ast.Bindings(node.Name) {
+					if err == nil && c.protected[name.Value] {
+						err = fmt.Errorf("%s: cannot redefine builtin %s", name.Pos(), name.Value)
+					}
+					c.symbols.Define(name.Value)
+				}
+			}
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileBody compiles a list of statements so that they leave the value
+// of the last one on the stack, or null if it has none.
+func (c *Compiler) compileBody(statements []ast.Statement, end token.Position) error {
+	if len(statements) == 0 {
+		c.emit(end, code.OpNull)
+		return nil
+	}
+	for i, stmt := range statements {
+		if err := c.compileStatement(stmt, i == len(statements)-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileStatement(stmt ast.Statement, keep bool) error {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		if err := c.compileExpression(stmt.Expression); err != nil {
+			return err
+		}
+		if !keep {
+			c.emit(stmt.Pos(), code.OpPop)
+		}
+	case *ast.DefStatement:
+		var err error
+		name, isName := stmt.Name.(*ast.Identifier)
+		if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok && isName {
+			err = c.compileFunction(fl, name.Value)
+		} else {
+			err = c.compileExpression(stmt.Value)
+		}
+		if err != nil {
+			return err
+		}
+		if isName {
+			c.emitSet(stmt.Pos(), name.Value)
+		} else if err := c.compileDestructure(stmt.Name); err != nil {
+			return err
+		}
+		if keep {
+			c.emit(stmt.Pos(), code.OpNull)
+		}
+	case *ast.ReturnStatement:
+		if stmt.ReturnValue == nil {
+			c.emit(stmt.Pos(), code.OpNull)
+		} else if err := c.compileExpression(stmt.ReturnValue); err != nil {
+			return err
+		}
+		if err := c.leaveTries(stmt.Pos()); err != nil {
+			return err
+		}
+		c.emit(stmt.Pos(), code.OpReturnValue)
+	case *ast.ThrowStatement:
+		if err := c.compileExpression(stmt.Value); err != nil {
+			return err
+		}
+		c.emit(stmt.Pos(), code.OpThrow)
+	case *ast.ImportStatement:
+		return fmt.Errorf("%s: cannot compile import statements, modules only run on the evaluator", stmt.Pos())
+	default:
+		return fmt.Errorf("%s: cannot compile %T", stmt.Pos(), stmt)
+	}
+	return nil
+}
+
+func (c *Compiler) compileExpression(e ast.Expression) error {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return c.emitConstant(e, &object.Integer{Value: e.Value})
+	case *ast.FloatLiteral:
+		return c.emitConstant(e, &object.Float{Value: e.Value})
+	case *ast.StringLiteral:
+		return c.emitConstant(e, &object.String{Value: e.Value})
+	case *ast.Boolean:
+		if e.Value {
+			c.emit(e.Pos(), code.OpTrue)
+		} else {
+			c.emit(e.Pos(), code.OpFalse)
+		}
+	case *ast.Identifier:
+		return c.compileIdentifier(e)
+	case *ast.PrefixExpression:
+		if err := c.compileExpression(e.Right); err != nil {
+			return err
+		}
+		switch e.Operator {
+		case "!":
+			c.emit(e.Pos(), code.OpBang)
+		case "-":
+			c.emit(e.Pos(), code.OpMinus)
+		default:
+			return fmt.Errorf("%s: unknown operator %s", e.Pos(), e.Operator)
+		}
+	case *ast.InfixExpression:
+		if err := c.compileExpression(e.Left); err != nil {
+			return err
+		}
+		if err := c.compileExpression(e.Right); err != nil {
+			return err
+		}
+		op, ok := infixOpcodes[e.Operator]
+		if !ok {
+			return fmt.Errorf("%s: unknown operator %s", e.Pos(), e.Operator)
+		}
+		c.emit(e.Pos(), op)
+	case *ast.IfExpression:
+		return c.compileIf(e)
+	case *ast.TryExpression:
+		return c.compileTry(e)
+	case *ast.MatchExpression:
+		return c.compileMatch(e)
+	case *ast.FunctionLiteral:
+		return c.compileFunction(e, "")
+	case *ast.CallExpression:
+		if err := c.compileExpression(e.Function); err != nil {
+			return err
+		}
+		for _, arg := range e.Arguments {
+			if err := c.compileExpression(arg); err != nil {
+				return err
+			}
+		}
+		if len(e.Arguments) > math.MaxUint8 {
+			return fmt.Errorf("%s: too many arguments in call", e.Pos())
+		}
+		c.emit(e.Pos(), code.OpCall, len(e.Arguments))
+	case *ast.ArrayLiteral:
+		for _, element := range e.Elements {
+			if err := c.compileExpression(element); err != nil {
+				return err
+			}
+		}
+		if len(e.Elements) > math.MaxUint16 {
+			return fmt.Errorf("%s: too many array elements", e.Pos())
+		}
+		c.emit(e.Pos(), code.OpArray, len(e.Elements))
+	case *ast.HashLiteral:
+		for _, pair := range e.Pairs {
+			if err := c.compileExpression(pair.Key); err != nil {
+				return err
+			}
+			if err := c.compileExpression(pair.Value); err != nil {
+				return err
+			}
+		}
+		if 2*len(e.Pairs) > math.MaxUint16 {
+			return fmt.Errorf("%s: too many hash entries", e.Pos())
+		}
+		c.emit(e.Pos(), code.OpHash, 2*len(e.Pairs))
+	case *ast.IndexExpression:
+		if err := c.compileExpression(e.Left); err != nil {
+			return err
+		}
+		if err := c.compileExpression(e.Index); err != nil {
+			return err
+		}
+		c.emit(e.Pos(), code.OpIndex)
+	case *ast.MemberExpression:
+		if err := c.compileExpression(e.Left); err != nil {
+			return err
+		}
+		index, err := c.addConstant(e.Member, &object.String{Value: e.Member.Value})
+		if err != nil {
+			return err
+		}
+		c.emit(e.Member.Pos(), code.OpMember, index)
+	case *ast.PropagateExpression:
+		return c.compilePropagate(e)
+	default:
+		return fmt.Errorf("%s: cannot compile %T", e.Pos(), e)
+	}
+	return nil
+}
+
+var infixOpcodes = map[string]code.Opcode{}
+
+func init() {
+	for op, operator := range code.Operators {
+		infixOpcodes[operator] = op
+	}
+}
+
+// compileIdentifier loads a name. Names defined nowhere become globals
+// that are never set, so using them fails at run time, not before: the
+// evaluator accepts programs that only mention them in dead code.
+func (c *Compiler) compileIdentifier(identifier *ast.Identifier) error {
+	symbol, depth, ok := c.symbols.Resolve(identifier.Value)
+	if !ok {
+		symbol = c.globals.Define(identifier.Value)
+	}
+
+	switch {
+	case symbol.Scope == GlobalScope:
+		c.emit(identifier.Pos(), code.OpGetGlobal, symbol.Index)
+	case symbol.Scope == BuiltinScope:
+		c.emit(identifier.Pos(), code.OpGetBuiltin, symbol.Index)
+	case depth == 0:
+		c.emit(identifier.Pos(), code.OpGetLocal, symbol.Index)
+	case depth <= math.MaxUint8:
+		c.emit(identifier.Pos(), code.OpGetFree, depth, symbol.Index)
+	default:
+		return fmt.Errorf("%s: functions nested too deeply", identifier.Pos())
+	}
+	return nil
+}
+
+func (c *Compiler) compileIf(e *ast.IfExpression) error {
+	if err := c.compileExpression(e.Condition); err != nil {
+		return err
+	}
+	jumpNotTruthy := c.emit(e.Pos(), code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBody(e.Consequence.Statements, e.Consequence.End()); err != nil {
+		return err
+	}
+	jump := c.emit(e.Pos(), code.OpJump, 9999)
+
+	c.changeOperand(jumpNotTruthy, len(c.currentInstructions()))
+	if e.Alternative == nil {
+		c.emit(e.Pos(), code.OpNull)
+	} else if err := c.compileBody(e.Alternative.Statements, e.Alternative.End()); err != nil {
+		return err
+	}
+	c.changeOperand(jump, len(c.currentInstructions()))
+	return nil
+}
+
+// compileTry compiles a try expression. Its catch and finally blocks are
+// handlers of the block before them; the finally block is also compiled
+// inline, for when no error reaches it.
+func (c *Compiler) compileTry(e *ast.TryExpression) error {
+	scope := &c.scopes[len(c.scopes)-1]
+	var finally int
+	if e.Finally != nil {
+		finally = c.emit(e.Pos(), code.OpTry, 9999)
+		scope.tries = append(scope.tries, tryRegion{finally: e.Finally})
+	}
+
+	if e.Catch == nil {
+		if err := c.compileBody(e.Block.Statements, e.Block.End()); err != nil {
+			return err
+		}
+	} else {
+		catch := c.emit(e.Pos(), code.OpTry, 9999)
+		scope.tries = append(scope.tries, tryRegion{})
+		if err := c.compileBody(e.Block.Statements, e.Block.End()); err != nil {
+			return err
+		}
+		scope = &c.scopes[len(c.scopes)-1]
+		scope.tries = scope.tries[:len(scope.tries)-1]
+		c.emit(e.Pos(), code.OpEndTry)
+		jump := c.emit(e.Pos(), code.OpJump, 9999)
+
+		c.changeOperand(catch, len(c.currentInstructions()))
+		if c.protected[e.Parameter.Value] {
+			return fmt.Errorf("%s: cannot redefine builtin %s", e.Parameter.Pos(), e.Parameter.Value)
+		}
+		// The caught value is only visible in the catch block.
+		_, restore := c.symbols.Shadow(e.Parameter.Value)
+		c.emit(e.Parameter.Pos(), code.OpCaught)
+		c.emitSet(e.Parameter.Pos(), e.Parameter.Value)
+		err := c.compileBody(e.Catch.Statements, e.Catch.End())
+		restore()
+		if err != nil {
+			return err
+		}
+		c.changeOperand(jump, len(c.currentInstructions()))
+	}
+
+	if e.Finally == nil {
+		return nil
+	}
+	scope = &c.scopes[len(c.scopes)-1]
+	scope.tries = scope.tries[:len(scope.tries)-1]
+	c.emit(e.Pos(), code.OpEndTry)
+	if err := c.compileFinally(e.Finally); err != nil {
+		return err
+	}
+	jump := c.emit(e.Pos(), code.OpJump, 9999)
+
+	c.changeOperand(finally, len(c.currentInstructions()))
+	if err := c.compileFinally(e.Finally); err != nil {
+		return err
+	}
+	c.emit(e.Finally.End(), code.OpRethrow)
+	c.changeOperand(jump, len(c.currentInstructions()))
+	return nil
+}
+
+// patternStep is how a nested pattern reaches its part of the value of a
+// match: by the key of a hash entry, or else by the index of an element.
+type patternStep struct {
+	key   ast.Expression
+	index int
+}
+
+// compileMatch compiles a match expression. Its value stays on the stack
+// until an arm is chosen: each arm tests the shape of the value before
+// reaching into it, and only then binds its names and checks its guard.
+func (c *Compiler) compileMatch(e *ast.MatchExpression) error {
+	if err := c.compileExpression(e.Value); err != nil {
+		return err
+	}
+	var ends []int
+	for _, arm := range e.Arms {
+		restore := c.shadowBindings(arm.Pattern)
+		next, err := c.compilePatternTests(arm.Pattern, nil)
+		if err != nil {
+			return err
+		}
+		if err := c.compilePatternBindings(arm.Pattern, nil); err != nil {
+			return err
+		}
+		if arm.Guard != nil {
+			if err := c.compileExpression(arm.Guard); err != nil {
+				return err
+			}
+			next = append(next, c.emit(arm.Guard.Pos(), code.OpJumpNotTruthy, 9999))
+		}
+		c.emit(arm.Body.Pos(), code.OpPop)
+		if err := c.compileExpression(arm.Body); err != nil {
+			return err
+		}
+		ends = append(ends, c.emit(e.Pos(), code.OpJump, 9999))
+		restore()
+		for _, jump := range next {
+			c.changeOperand(jump, len(c.currentInstructions()))
+		}
+	}
+	c.emit(e.End(), code.OpPop)
+	c.emit(e.End(), code.OpNull)
+	for _, jump := range ends {
+		c.changeOperand(jump, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// shadowBindings gives the names pattern binds new slots, which shadow
+// builtins and the names of enclosing scopes until restore is called.
+func (c *Compiler) shadowBindings(pattern ast.Pattern) (restore func()) {
+	var restores []func()
+	seen := map[string]bool{}
+	for _, name := range ast.Bindings(pattern) {
+		if seen[name.Value] {
+			continue
+		}
+		seen[name.Value] = true
+		_, restore := c.symbols.Shadow(name.Value)
+		restores = append(restores, restore)
+	}
+	return func() {
+		for i := len(restores) - 1; i >= 0; i-- {
+			restores[i]()
+		}
+	}
+}
+
+// compilePatternTests compiles the tests of pattern against the part of
+// the value found at path, returning the jumps taken when one fails.
+func (c *Compiler) compilePatternTests(pattern ast.Pattern, path []patternStep) ([]int, error) {
+	var jumps []int
+	switch pattern := pattern.(type) {
+	case *ast.LiteralPattern:
+		if err := c.loadPatternPath(pattern, path); err != nil {
+			return nil, err
+		}
+		if err := c.compileExpression(pattern.Value); err != nil {
+			return nil, err
+		}
+		c.emit(pattern.Pos(), code.OpEqual)
+		jumps = append(jumps, c.emit(pattern.Pos(), code.OpJumpNotTruthy, 9999))
+	case *ast.ArrayPattern:
+		if len(pattern.Elements) > math.MaxUint16 {
+			return nil, fmt.Errorf("%s: too many array pattern elements", pattern.Pos())
+		}
+		if err := c.loadPatternPath(pattern, path); err != nil {
+			return nil, err
+		}
+		rest := 0
+		if pattern.Rest != nil {
+			rest = 1
+		}
+		c.emit(pattern.Pos(), code.OpMatchArray, len(pattern.Elements), rest)
+		jumps = append(jumps, c.emit(pattern.Pos(), code.OpJumpNotTruthy, 9999))
+		for i, element := range pattern.Elements {
+			nested, err := c.compilePatternTests(element, append(path[:len(path):len(path)], patternStep{index: i}))
+			if err != nil {
+				return nil, err
+			}
+			jumps = append(jumps, nested...)
+		}
+	case *ast.HashPattern:
+		if len(pattern.Pairs) > math.MaxUint16 {
+			return nil, fmt.Errorf("%s: too many hash pattern entries", pattern.Pos())
+		}
+		if err := c.loadPatternPath(pattern, path); err != nil {
+			return nil, err
+		}
+		for _, pair := range pattern.Pairs {
+			if err := c.compileExpression(pair.Key); err != nil {
+				return nil, err
+			}
+		}
+		c.emit(pattern.Pos(), code.OpMatchHash, len(pattern.Pairs))
+		jumps = append(jumps, c.emit(pattern.Pos(), code.OpJumpNotTruthy, 9999))
+		for _, pair := range pattern.Pairs {
+			nested, err := c.compilePatternTests(pair.Value, append(path[:len(path):len(path)], patternStep{key: pair.Key}))
+			if err != nil {
+				return nil, err
+			}
+			jumps = append(jumps, nested...)
+		}
+	}
+	return jumps, nil
+}
+
+// compileDestructure sets the names pattern binds to the parts of the
+// value on top of the stack, which it pops, raising an error when the
+// value doesn't have the shape of the pattern.
+func (c *Compiler) compileDestructure(pattern ast.Pattern) error {
+	if err := c.compileDestructureTests(pattern, nil); err != nil {
+		return err
+	}
+	if err := c.compilePatternBindings(pattern, nil); err != nil {
+		return err
+	}
+	c.emit(pattern.Pos(), code.OpPop)
+	return nil
+}
+
+// compileDestructureTests is compilePatternTests for patterns that raise
+// an error instead of jumping when the value doesn't match.
+func (c *Compiler) compileDestructureTests(pattern ast.Pattern, path []patternStep) error {
+	switch pattern := pattern.(type) {
+	case *ast.LiteralPattern:
+		return fmt.Errorf("%s: literal patterns are only allowed in match arms", pattern.Pos())
+	case *ast.ArrayPattern:
+		if len(pattern.Elements) > math.MaxUint16 {
+			return fmt.Errorf("%s: too many array pattern elements", pattern.Pos())
+		}
+		if err := c.loadPatternPath(pattern, path); err != nil {
+			return err
+		}
+		rest := 0
+		if pattern.Rest != nil {
+			rest = 1
+		}
+		c.emit(pattern.Pos(), code.OpDestructureArray, len(pattern.Elements), rest)
+		for i, element := range pattern.Elements {
+			if err := c.compileDestructureTests(element, append(path[:len(path):len(path)], patternStep{index: i})); err != nil {
+				return err
+			}
+		}
+	case *ast.HashPattern:
+		if len(pattern.Pairs) > math.MaxUint16 {
+			return fmt.Errorf("%s: too many hash pattern entries", pattern.Pos())
+		}
+		if err := c.loadPatternPath(pattern, path); err != nil {
+			return err
+		}
+		for _, pair := range pattern.Pairs {
+			if err := c.compileExpression(pair.Key); err != nil {
+				return err
+			}
+		}
+		c.emit(pattern.Pos(), code.OpDestructureHash, len(pattern.Pairs))
+		for _, pair := range pattern.Pairs {
+			if err := c.compileDestructureTests(pair.Value, append(path[:len(path):len(path)], patternStep{key: pair.Key})); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compilePatternBindings sets the names pattern binds to the parts of the
+// value found at path, once its tests have passed.
+func (c *Compiler) compilePatternBindings(pattern ast.Pattern, path []patternStep) error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if err := c.loadPatternPath(pattern, path); err != nil {
+			return err
+		}
+		c.emitSet(pattern.Pos(), pattern.Value)
+	case *ast.ArrayPattern:
+		for i, element := range pattern.Elements {
+			if err := c.compilePatternBindings(element, append(path[:len(path):len(path)], patternStep{index: i})); err != nil {
+				return err
+			}
+		}
+		if rest, ok := pattern.Rest.(*ast.Identifier); ok {
+			if err := c.loadPatternPath(pattern, path); err != nil {
+				return err
+			}
+			c.emit(rest.Pos(), code.OpRest, len(pattern.Elements))
+			c.emitSet(rest.Pos(), rest.Value)
+		}
+	case *ast.HashPattern:
+		for _, pair := range pattern.Pairs {
+			if err := c.compilePatternBindings(pair.Value, append(path[:len(path):len(path)], patternStep{key: pair.Key})); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadPatternPath pushes the part of the value of a match, which is on
+// top of the stack, found at path.
+func (c *Compiler) loadPatternPath(pattern ast.Pattern, path []patternStep) error {
+	c.emit(pattern.Pos(), code.OpDup)
+	for _, step := range path {
+		var err error
+		if step.key != nil {
+			err = c.compileExpression(step.key)
+		} else {
+			err = c.emitConstant(pattern, &object.Integer{Value: int64(step.index)})
+		}
+		if err != nil {
+			return err
+		}
+		c.emit(pattern.Pos(), code.OpIndex)
+	}
+	return nil
+}
+
+// compilePropagate compiles the ? operator, which returns err results
+// from the function like a return statement does.
+func (c *Compiler) compilePropagate(e *ast.PropagateExpression) error {
+	if len(c.scopes) == 1 {
+		return fmt.Errorf("%s: ? is only allowed inside a function", e.Token.Pos())
+	}
+	if err := c.compileExpression(e.Value); err != nil {
+		return err
+	}
+	propagate := c.emit(e.Pos(), code.OpPropagate, 9999)
+	if err := c.leaveTries(e.Token.Pos()); err != nil {
+		return err
+	}
+	c.emit(e.Token.Pos(), code.OpReturnValue)
+	c.changeOperand(propagate, len(c.currentInstructions()))
+	return nil
+}
+
+// compileFinally compiles a finally block, whose value is discarded.
+func (c *Compiler) compileFinally(block *ast.BlockStatement) error {
+	if err := c.compileBody(block.Statements, block.End()); err != nil {
+		return err
+	}
+	c.emit(block.End(), code.OpPop)
+	return nil
+}
+
+// leaveTries removes the handlers of the try expressions a return
+// statement leaves and runs their finally blocks, innermost first.
+func (c *Compiler) leaveTries(pos token.Position) error {
+	tries := c.scopes[len(c.scopes)-1].tries
+	for i := len(tries) - 1; i >= 0; i-- {
+		c.emit(pos, code.OpEndTry)
+		if tries[i].finally == nil {
+			continue
+		}
+		// a return in the finally block only leaves the tries around it.
+		// Capping the slice keeps the tries compiled in the finally block
+		// from overwriting the ones still to leave.
+		c.scopes[len(c.scopes)-1].tries = tries[:i:i]
+		err := c.compileFinally(tries[i].finally)
+		c.scopes[len(c.scopes)-1].tries = tries
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emitSet stores the value on top of the stack in the slot of name, which
+// hoisting has defined in the current scope.
+func (c *Compiler) emitSet(pos token.Position, name string) {
+	symbol, _, _ := c.symbols.Resolve(name)
+	if symbol.Scope == GlobalScope {
+		c.emit(pos, code.OpSetGlobal, symbol.Index)
+	} else {
+		c.emit(pos, code.OpSetLocal, symbol.Index)
+	}
+}
+
+// compileFunction compiles fl, which is called name if it is defined by
+// a def.
+func (c *Compiler) compileFunction(fl *ast.FunctionLiteral, name string) error {
+	c.enterScope()
+	var patterns []ast.Pattern
+	for _, param := range fl.Parameters {
+		if name, ok := param.(*ast.Identifier); ok {
+			c.symbols.Define(name.Value)
+			continue
+		}
+		c.symbols.DefineSlot(param.String())
+		patterns = append(patterns, param)
+	}
+	for _, pattern := range patterns {
+		for _, name := range ast.Bindings(pattern) {
+			c.symbols.Define(name.Value)
+		}
+	}
+	if err := c.hoist(fl.Body.Statements); err != nil {
+		return err
+	}
+	for i, param := range fl.Parameters {
+		if _, ok := param.(*ast.Identifier); ok {
+			continue
+		}
+		c.emit(param.Pos(), code.OpGetLocal, i)
+		if err := c.compileDestructure(param); err != nil {
+			return err
+		}
+	}
+	if err := c.compileBody(fl.Body.Statements, fl.Body.End()); err != nil {
+		return err
+	}
+	c.emit(fl.Body.End(), code.OpReturnValue)
+	if err := c.checkSize(fl.Pos()); err != nil {
+		return err
+	}
+
+	locals := c.symbols.Names()
+	scope := c.leaveScope()
+	if len(locals) > math.MaxUint16 {
+		return fmt.Errorf("%s: too many local variables", fl.Pos())
+	}
+	fn := &object.CompiledFunction{
+		Instructions:  scope.instructions,
+		SourceMap:     scope.sourceMap,
+		NumParameters: len(fl.Parameters),
+		Locals:        locals,
+		Source:        fl.String(),
+		Name:          name,
+	}
+	index, err := c.addConstant(fl, fn)
+	if err != nil {
+		return err
+	}
+	c.emit(fl.Pos(), code.OpClosure, index)
+	return nil
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, compilationScope{})
+	c.symbols = NewEnclosedSymbolTable(c.symbols)
+}
+
+func (c *Compiler) leaveScope() compilationScope {
+	scope := c.scopes[len(c.scopes)-1]
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.symbols = c.symbols.Outer
+	return scope
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[len(c.scopes)-1].instructions
+}
+
+// checkSize makes sure every jump target of the current scope fits in its
+// operand, and that no global slot overflows its own.
+func (c *Compiler) checkSize(pos token.Position) error {
+	if len(c.currentInstructions()) > math.MaxUint16 {
+		return fmt.Errorf("%s: function too large", pos)
+	}
+	if len(c.globals.names) > math.MaxUint16+1 {
+		return fmt.Errorf("%s: too many global variables", pos)
+	}
+	return nil
+}
+
+func (c *Compiler) emitConstant(node ast.Node, obj object.Object) error {
+	index, err := c.addConstant(node, obj)
+	if err != nil {
+		return err
+	}
+	c.emit(node.Pos(), code.OpConstant, index)
+	return nil
+}
+
+func (c *Compiler) addConstant(node ast.Node, obj object.Object) (int, error) {
+	if len(c.constants) > math.MaxUint16 {
+		return 0, fmt.Errorf("%s: too many constants", node.Pos())
+	}
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1, nil
+}
+
+// emit appends an instruction compiled from the source at pos, returning
+// its offset.
+func (c *Compiler) emit(pos token.Position, op code.Opcode, operands ...int) int {
+	scope := &c.scopes[len(c.scopes)-1]
+	offset := len(scope.instructions)
+	if n := len(scope.sourceMap); n == 0 || scope.sourceMap[n-1].Pos != pos {
+		scope.sourceMap = append(scope.sourceMap, code.SourcePos{Offset: offset, Pos: pos})
+	}
+	scope.instructions = append(scope.instructions, code.Make(op, operands...)...)
+	return offset
+}
+
+func (c *Compiler) changeOperand(offset int, operand int) {
+	ins := c.currentInstructions()
+	op := code.Opcode(ins[offset])
+	copy(ins[offset:], code.Make(op, operand))
+}
@@ -0,0 +1,506 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"testing"
+	"turatti/ast"
+	"turatti/code"
+	"turatti/lexer"
+	"turatti/object"
+	"turatti/parser"
+	"turatti/token"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	psr := parser.New(lexer.New(input))
+	program := psr.Parse()
+	if len(psr.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, psr.Errors())
+	}
+	return program
+}
+
+func concat(instructions ...[]byte) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range instructions {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		input        string
+		constants    []string
+		instructions code.Instructions
+	}{
+		{
+			"",
+			[]string{},
+			concat(code.Make(code.OpNull), code.Make(code.OpReturnValue)),
+		},
+		{
+			"1 + 2.5; -3",
+			[]string{"1", "2.5", "3"},
+			concat(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpMinus),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			"def x = 1; x",
+			[]string{"1"},
+			concat(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			"def x = 1;",
+			[]string{"1"},
+			concat(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			"if (true) { 10 }; 3333;",
+			[]string{"10", "3333"},
+			concat(
+				code.Make(code.OpTrue),              // 0000
+				code.Make(code.OpJumpNotTruthy, 10), // 0001
+				code.Make(code.OpConstant, 0),       // 0004
+				code.Make(code.OpJump, 11),          // 0007
+				code.Make(code.OpNull),              // 0010
+				code.Make(code.OpPop),               // 0011
+				code.Make(code.OpConstant, 1),       // 0012
+				code.Make(code.OpReturnValue),       // 0015
+			),
+		},
+		{
+			`[1, 2][0] + len({"a": 1})`,
+			[]string{"1", "2", "0", "a", "1"},
+			concat(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpHash, 2),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpReturnValue),
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		bytecode, err := Compile(parse(t, tt.input), Options{})
+		if err != nil {
+			t.Fatalf("%q: compiler error: %v", tt.input, err)
+		}
+		if got := bytecode.Main.Instructions.String(); got != tt.instructions.String() {
+			t.Errorf("%q: wrong instructions.\nexpected:\n%s\ngot:\n%s", tt.input, tt.instructions, got)
+		}
+		constants := []string{}
+		for _, constant := range bytecode.Constants {
+			constants = append(constants, constant.Inspect())
+		}
+		if strings.Join(constants, ",") != strings.Join(tt.constants, ",") {
+			t.Errorf("%q: expected constants %v, got %v", tt.input, tt.constants, constants)
+		}
+	}
+}
+
+func TestCompileTry(t *testing.T) {
+	input := "try { 1 } catch (e) { e } finally { 2 }"
+	bytecode, err := Compile(parse(t, input), Options{})
+	if err != nil {
+		t.Fatalf("compiler error: %v", err)
+	}
+	expected := concat(
+		code.Make(code.OpTry, 28),
+		code.Make(code.OpTry, 13),
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpEndTry),
+		code.Make(code.OpJump, 20),
+		// catch (e)
+		code.Make(code.OpCaught),
+		code.Make(code.OpSetGlobal, 0),
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpEndTry),
+		// finally, when nothing was raised
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpPop),
+		code.Make(code.OpJump, 33),
+		// finally, then raising again
+		code.Make(code.OpConstant, 2),
+		code.Make(code.OpPop),
+		code.Make(code.OpRethrow),
+		code.Make(code.OpReturnValue),
+	)
+	if got := bytecode.Main.Instructions.String(); got != expected.String() {
+		t.Errorf("wrong instructions.\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestCompilePropagate(t *testing.T) {
+	bytecode, err := Compile(parse(t, "fun(r) { r?.unwrap() }"), Options{})
+	if err != nil {
+		t.Fatalf("compiler error: %v", err)
+	}
+	fn := bytecode.Constants[1].(*object.CompiledFunction)
+	expected := concat(
+		code.Make(code.OpGetLocal, 0),
+		code.Make(code.OpPropagate, 7),
+		code.Make(code.OpReturnValue),
+		code.Make(code.OpMember, 0),
+		code.Make(code.OpCall, 0),
+		code.Make(code.OpReturnValue),
+	)
+	if fn.Instructions.String() != expected.String() {
+		t.Errorf("wrong instructions.\nexpected:\n%s\ngot:\n%s", expected, fn.Instructions)
+	}
+
+	// the parser rejects ? outside of functions, but syntax trees can be
+	// built without it.
+	program := &ast.Program{Statements: []ast.Statement{&ast.ExpressionStatement{
+		Expression: &ast.PropagateExpression{Token: token.Token{Type: token.QUESTION, Literal: "?", Line: 1, Column: 2}, Value: &ast.Identifier{Value: "r"}},
+	}}}
+	if _, err := Compile(program, Options{}); err == nil || err.Error() != "1:2: ? is only allowed inside a function" {
+		t.Errorf("expected ? to be rejected at the top level, got %v", err)
+	}
+}
+
+func TestCompileMatch(t *testing.T) {
+	bytecode, err := Compile(parse(t, "match x { [a] if a => a, _ => 0 }"), Options{})
+	if err != nil {
+		t.Fatalf("compiler error: %v", err)
+	}
+	expected := concat(
+		code.Make(code.OpGetGlobal, 0),
+		// [a] if a
+		code.Make(code.OpDup),
+		code.Make(code.OpMatchArray, 1, 0),
+		code.Make(code.OpJumpNotTruthy, 32),
+		code.Make(code.OpDup),
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpIndex),
+		code.Make(code.OpSetGlobal, 1),
+		code.Make(code.OpGetGlobal, 1),
+		code.Make(code.OpJumpNotTruthy, 32),
+		code.Make(code.OpPop),
+		code.Make(code.OpGetGlobal, 1),
+		code.Make(code.OpJump, 41),
+		// _
+		code.Make(code.OpPop),
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpJump, 41),
+		// no arm matched
+		code.Make(code.OpPop),
+		code.Make(code.OpNull),
+		code.Make(code.OpReturnValue),
+	)
+	if got := bytecode.Main.Instructions.String(); got != expected.String() {
+		t.Errorf("wrong instructions.\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestCompileDestructuring(t *testing.T) {
+	bytecode, err := Compile(parse(t, "def f = fun([a], b) { a };"), Options{})
+	if err != nil {
+		t.Fatalf("compiler error: %v", err)
+	}
+
+	fn := bytecode.Constants[1].(*object.CompiledFunction)
+	if strings.Join(fn.Locals, ",") != "[a],b,a" || fn.NumParameters != 2 {
+		t.Errorf("expected f to have parameters [a], b and local a; got %v (%d parameters)", fn.Locals, fn.NumParameters)
+	}
+	expected := concat(
+		code.Make(code.OpGetLocal, 0),
+		code.Make(code.OpDup),
+		code.Make(code.OpDestructureArray, 1, 0),
+		code.Make(code.OpDup),
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpIndex),
+		code.Make(code.OpSetLocal, 2),
+		code.Make(code.OpPop),
+		code.Make(code.OpGetLocal, 2),
+		code.Make(code.OpReturnValue),
+	)
+	if fn.Instructions.String() != expected.String() {
+		t.Errorf("wrong instructions.\nexpected:\n%s\ngot:\n%s", expected, fn.Instructions)
+	}
+}
+
+func TestCompileFunctions(t *testing.T) {
+	input := `def outer = fun(a) {
+    def inner = fun() { a + later };
+    def later = 2;
+    inner
+};`
+	bytecode, err := Compile(parse(t, input), Options{})
+	if err != nil {
+		t.Fatalf("compiler error: %v", err)
+	}
+
+	inner := bytecode.Constants[0].(*object.CompiledFunction)
+	expectedInner := concat(
+		code.Make(code.OpGetFree, 1, 0),
+		code.Make(code.OpGetFree, 1, 2),
+		code.Make(code.OpAdd),
+		code.Make(code.OpReturnValue),
+	)
+	if inner.Instructions.String() != expectedInner.String() {
+		t.Errorf("wrong inner instructions.\nexpected:\n%s\ngot:\n%s", expectedInner, inner.Instructions)
+	}
+
+	outer := bytecode.Constants[2].(*object.CompiledFunction)
+	if strings.Join(outer.Locals, ",") != "a,inner,later" || outer.NumParameters != 1 {
+		t.Errorf("expected outer to have parameter a and locals inner, later; got %v (%d parameters)",
+			outer.Locals, outer.NumParameters)
+	}
+	expectedOuter := concat(
+		code.Make(code.OpClosure, 0),
+		code.Make(code.OpSetLocal, 1),
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpSetLocal, 2),
+		code.Make(code.OpGetLocal, 1),
+		code.Make(code.OpReturnValue),
+	)
+	if outer.Instructions.String() != expectedOuter.String() {
+		t.Errorf("wrong outer instructions.\nexpected:\n%s\ngot:\n%s", expectedOuter, outer.Instructions)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"def len = 1;", "1:5: cannot redefine builtin len"},
+		{"def f = fun() {\n    def print = 1;\n};", "2:9: cannot redefine builtin print"},
+		{"try { 1 } catch (len) { 2 }", "1:18: cannot redefine builtin len"},
+		{`def {"k": [len]} = h;`, "1:12: cannot redefine builtin len"},
+	}
+
+	for _, tt := range tests {
+		_, err := Compile(parse(t, tt.input), Options{})
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expected, err)
+		}
+	}
+
+	if _, err := Compile(parse(t, "def len = 1;"), Options{AllowShadowing: true}); err != nil {
+		t.Errorf("expected shadowing to be allowed, got %v", err)
+	}
+	if _, err := Compile(parse(t, "match 1 { [first, ...rest] => rest }"), Options{}); err != nil {
+		t.Errorf("expected match bindings to shadow builtins, got %v", err)
+	}
+}
+
+func TestSymbolTable(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	a := global.Define("a")
+	local := NewEnclosedSymbolTable(global)
+	b := local.Define("b")
+	nested := NewEnclosedSymbolTable(local)
+	c := nested.Define("c")
+
+	if a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("unexpected global symbol %+v", a)
+	}
+	if b != (Symbol{Name: "b", Scope: LocalScope, Index: 0}) || c.Index != 0 {
+		t.Errorf("expected locals to start at slot 0, got %+v and %+v", b, c)
+	}
+	if again := local.Define("b"); again != b {
+		t.Errorf("expected redefinition to reuse slot %d, got %d", b.Index, again.Index)
+	}
+
+	tests := []struct {
+		name   string
+		scope  SymbolScope
+		depth  int
+		global bool
+	}{
+		{"c", LocalScope, 0, false},
+		{"b", LocalScope, 1, false},
+		{"a", GlobalScope, 2, true},
+		{"len", BuiltinScope, 2, true},
+	}
+	for _, tt := range tests {
+		symbol, depth, ok := nested.Resolve(tt.name)
+		if !ok || symbol.Scope != tt.scope || (!tt.global && depth != tt.depth) {
+			t.Errorf("Resolve(%s): expected %s at depth %d, got %+v at depth %d", tt.name, tt.scope, tt.depth, symbol, depth)
+		}
+	}
+	if _, _, ok := nested.Resolve("missing"); ok {
+		t.Errorf("expected missing names not to resolve")
+	}
+
+	first, second := local.DefineSlot("[x]"), local.DefineSlot("[x]")
+	if first.Index != 1 || second.Index != 2 {
+		t.Errorf("expected every slot to be new, got %+v and %+v", first, second)
+	}
+	if _, _, ok := local.Resolve("[x]"); ok {
+		t.Errorf("expected slots not to resolve")
+	}
+
+	if shadow := global.Define("len"); shadow.Scope != GlobalScope || shadow.Index != 1 {
+		t.Errorf("expected defining a builtin name to create a global, got %+v", shadow)
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	input := `def f = fun(a) {
+    fun() { a + len("x") }
+};
+f(1)()`
+	expected := `== main ==
+; line 1: def f = fun(a) {
+0000 OpClosure 2            ; fun(a) {fun() {(a + len("x"))}}
+0003 OpSetGlobal 0          ; f
+; line 4: f(1)()
+0006 OpGetGlobal 0          ; f
+0009 OpConstant 3           ; 1
+0012 OpCall 1
+0014 OpCall 0
+0016 OpReturnValue
+
+== constant 1 ==
+; fun() {(a + len("x"))}
+; line 2: fun() { a + len("x") }
+0000 OpGetFree 1 0          ; a
+0004 OpGetBuiltin 0         ; len
+0006 OpConstant 0           ; "x"
+0009 OpCall 1
+0011 OpAdd                  ; +
+0012 OpReturnValue
+
+== constant 2 ==
+; fun(a) {fun() {(a + len("x"))}}
+; line 2: fun() { a + len("x") }
+0000 OpClosure 1            ; fun() {(a + len("x"))}
+; line 3: };
+0003 OpReturnValue
+`
+	bytecode, err := Compile(parse(t, input), Options{})
+	if err != nil {
+		t.Fatalf("compiler error: %v", err)
+	}
+	var out strings.Builder
+	if err := Disassemble(&out, bytecode, input); err != nil {
+		t.Fatalf("disassembly failed: %v", err)
+	}
+	if out.String() != expected {
+		t.Errorf("wrong listing.\nexpected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	input := `def scale = 2.5;
+def greet = fun(name) { fun() { "hi " + name + str(scale) } };
+if (-1 < 0) { greet("you")() }`
+	bytecode, err := Compile(parse(t, input), Options{Globals: []string{"args"}})
+	if err != nil {
+		t.Fatalf("compiler error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, bytecode); err != nil {
+		t.Fatalf("encoding failed: %v", err)
+	}
+	decoded, err := Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("decoding failed: %v", err)
+	}
+
+	var before, after strings.Builder
+	Disassemble(&before, bytecode, "")
+	Disassemble(&after, decoded, "")
+	if before.String() != after.String() {
+		t.Errorf("bytecode changed by encoding.\nbefore:\n%s\nafter:\n%s", before.String(), after.String())
+	}
+	if strings.Join(decoded.Globals, ",") != strings.Join(bytecode.Globals, ",") {
+		t.Errorf("expected globals %v, got %v", bytecode.Globals, decoded.Globals)
+	}
+	for i, constant := range bytecode.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			if !object.Equal(constant, decoded.Constants[i]) {
+				t.Errorf("constant %d: expected %s, got %s", i, constant.Inspect(), decoded.Constants[i].Inspect())
+			}
+			continue
+		}
+		got := decoded.Constants[i].(*object.CompiledFunction)
+		if got.Source != fn.Source || got.NumParameters != fn.NumParameters ||
+			fmt.Sprint(got.SourceMap) != fmt.Sprint(fn.SourceMap) {
+			t.Errorf("constant %d: expected %+v, got %+v", i, fn, got)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	bytecode, err := Compile(parse(t, "def f = fun(x) { x * 2 }; f(21)"), Options{})
+	if err != nil {
+		t.Fatalf("compiler error: %v", err)
+	}
+	var buf bytes.Buffer
+	Encode(&buf, bytecode)
+	valid := buf.Bytes()
+
+	// resign recomputes the checksum so corruption reaches the decoder.
+	resign := func(data []byte) []byte {
+		body := data[:len(data)-4]
+		return binary.BigEndian.AppendUint32(append([]byte(nil), body...), crc32.ChecksumIEEE(body))
+	}
+	modified := func(change func([]byte) []byte) []byte {
+		return change(append([]byte(nil), valid...))
+	}
+	// The header is followed by the global "f" and the constant count.
+	firstTag := len(Magic) + 2 + 3 + 1
+	mainEnd := bytes.LastIndex(valid, bytecode.Main.Instructions) + len(bytecode.Main.Instructions) - 1
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"empty", []byte{}, "corrupt bytecode: not a compiled Turatti file"},
+		{"source", []byte("def x = 1;"), "corrupt bytecode: not a compiled Turatti file"},
+		{"version", modified(func(d []byte) []byte { d[5] = 3; return d }),
+			"bytecode format version 3 is not supported (expected 2), recompile the program"},
+		{"checksum", modified(func(d []byte) []byte { d[len(d)-1]++; return d }), "corrupt bytecode: checksum mismatch"},
+		{"truncated", resign(append(valid[:mainEnd:mainEnd], 0, 0, 0, 0)), "corrupt bytecode: unexpected end of data at byte"},
+		{"trailing", resign(append(append([]byte(nil), valid[:len(valid)-4]...), 0, 0, 0, 0, 0)),
+			"corrupt bytecode: 1 unexpected bytes after the main function"},
+		{"tag", modified(func(d []byte) []byte { d[firstTag] = 'z'; return resign(d) }), `corrupt bytecode: unknown constant tag 'z'`},
+		{"opcode", modified(func(d []byte) []byte { d[mainEnd] = 255; return resign(d) }),
+			"corrupt bytecode: offset"},
+		{"constant", modified(func(d []byte) []byte { d[mainEnd-5] = 9; return resign(d) }),
+			"refers to a missing constant"},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(bytes.NewReader(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"turatti/builtins"
+	"turatti/code"
+	"turatti/object"
+)
+
+// Disassemble writes a listing of the main function of bytecode followed
+// by every function in its constant pool. Operands that refer to
+// constants or variables are followed by what they refer to, and each
+// instruction that starts a new source line is preceded by that line of
+// source, or just its number when source is empty.
+func Disassemble(w io.Writer, bytecode *Bytecode, source string) error {
+	d := &disassembler{
+		bytecode: bytecode,
+		lines:    strings.Split(source, "\n"),
+		parents:  parents(bytecode),
+		builtins: builtins.Names(),
+	}
+	if source == "" {
+		d.lines = nil
+	}
+
+	d.function("main", bytecode.Main)
+	for i, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			d.out.WriteString("\n")
+			d.function(fmt.Sprintf("constant %d", i), fn)
+		}
+	}
+	_, err := io.WriteString(w, d.out.String())
+	return err
+}
+
+type disassembler struct {
+	bytecode *Bytecode
+	lines    []string
+	parents  map[*object.CompiledFunction]*object.CompiledFunction
+	builtins []string
+	out      strings.Builder
+}
+
+func (d *disassembler) function(name string, fn *object.CompiledFunction) {
+	fmt.Fprintf(&d.out, "== %s ==\n", name)
+	if fn != d.bytecode.Main {
+		fmt.Fprintf(&d.out, "; %s\n", summary(fn.Source))
+	}
+
+	line := 0
+	ins := fn.Instructions
+	for i := 0; i < len(ins); {
+		if pos := fn.SourceMap.Lookup(i); pos.IsValid() && pos.Line != line {
+			line = pos.Line
+			if line <= len(d.lines) {
+				fmt.Fprintf(&d.out, "; line %d: %s\n", line, strings.TrimSpace(d.lines[line-1]))
+			} else {
+				fmt.Fprintf(&d.out, "; line %d\n", line)
+			}
+		}
+
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&d.out, "%04d ERROR: %s\n", i, err)
+			return
+		}
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		text := def.Name
+		for _, operand := range operands {
+			text += " " + strconv.Itoa(operand)
+		}
+		if note := d.describe(fn, code.Opcode(ins[i]), operands); note != "" {
+			fmt.Fprintf(&d.out, "%04d %-22s ; %s\n", i, text, note)
+		} else {
+			fmt.Fprintf(&d.out, "%04d %s\n", i, text)
+		}
+		i += 1 + read
+	}
+}
+
+// describe names what the operands of an instruction refer to.
+func (d *disassembler) describe(fn *object.CompiledFunction, op code.Opcode, operands []int) string {
+	name := func(names []string, i int) string {
+		if i < len(names) {
+			return names[i]
+		}
+		return "?"
+	}
+
+	switch op {
+	case code.OpConstant, code.OpClosure, code.OpMember:
+		if operands[0] >= len(d.bytecode.Constants) {
+			return "?"
+		}
+		switch constant := d.bytecode.Constants[operands[0]].(type) {
+		case *object.CompiledFunction:
+			return summary(constant.Source)
+		case *object.String:
+			return strconv.Quote(constant.Value)
+		default:
+			return constant.Inspect()
+		}
+	case code.OpGetGlobal, code.OpSetGlobal:
+		return name(d.bytecode.Globals, operands[0])
+	case code.OpGetLocal, code.OpSetLocal:
+		return name(fn.Locals, operands[0])
+	case code.OpGetFree:
+		outer := fn
+		for depth := 0; depth < operands[0] && outer != nil; depth++ {
+			outer = d.parents[outer]
+		}
+		if outer == nil {
+			return "?"
+		}
+		return name(outer.Locals, operands[1])
+	case code.OpGetBuiltin:
+		return name(d.builtins, operands[0])
+	case code.OpJump, code.OpJumpNotTruthy, code.OpPropagate:
+		return fmt.Sprintf("to %04d", operands[0])
+	case code.OpTry:
+		return fmt.Sprintf("handler at %04d", operands[0])
+	}
+	if operator, ok := code.Operators[op]; ok {
+		return operator
+	}
+	return ""
+}
+
+// parents maps each function in bytecode to the function that creates
+// it, which is the function it was compiled inside of.
+func parents(bytecode *Bytecode) map[*object.CompiledFunction]*object.CompiledFunction {
+	parents := map[*object.CompiledFunction]*object.CompiledFunction{}
+	functions := []*object.CompiledFunction{bytecode.Main}
+	for _, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			functions = append(functions, fn)
+		}
+	}
+	for _, fn := range functions {
+		ins := fn.Instructions
+		for i := 0; i < len(ins); {
+			def, err := code.Lookup(ins[i])
+			if err != nil {
+				break
+			}
+			operands, read := code.ReadOperands(def, ins[i+1:])
+			if code.Opcode(ins[i]) == code.OpClosure && operands[0] < len(bytecode.Constants) {
+				if child, ok := bytecode.Constants[operands[0]].(*object.CompiledFunction); ok {
+					parents[child] = fn
+				}
+			}
+			i += 1 + read
+		}
+	}
+	return parents
+}
+
+// summary shortens the source of a function to fit on one line.
+func summary(source string) string {
+	runes := []rune(strings.Join(strings.Fields(source), " "))
+	if len(runes) > 40 {
+		return string(runes[:37]) + "..."
+	}
+	return string(runes)
+}
@@ -0,0 +1,383 @@
+package compiler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"turatti/builtins"
+	"turatti/code"
+	"turatti/object"
+	"turatti/token"
+)
+
+// A compiled file (.trtc) starts with Magic and a big endian uint16
+// FormatVersion, followed by the global names, the constant pool and the
+// main function, and ends with a big endian CRC-32 of everything before
+// it. Counts, lengths and positions are unsigned varints, integers signed
+// varints and floats their IEEE 754 bits.
+const (
+	Magic         = "TRTC"
+	FormatVersion = 2
+)
+
+const (
+	tagInteger  byte = 'i'
+	tagFloat    byte = 'f'
+	tagString   byte = 's'
+	tagFunction byte = 'c'
+)
+
+// ErrCorrupt is wrapped by every error Decode reports for a file that is
+// damaged or was not produced by Encode.
+var ErrCorrupt = errors.New("corrupt bytecode")
+
+// VersionError reports a compiled file written by a different version of
+// the format.
+type VersionError struct {
+	Version int
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("bytecode format version %d is not supported (expected %d), recompile the program",
+		e.Version, FormatVersion)
+}
+
+// Encode writes bytecode to w in the compiled file format.
+func Encode(w io.Writer, bytecode *Bytecode) error {
+	e := &encoder{}
+	e.buf.WriteString(Magic)
+	binary.Write(&e.buf, binary.BigEndian, uint16(FormatVersion))
+	e.strings(bytecode.Globals)
+	e.uvarint(len(bytecode.Constants))
+	for _, constant := range bytecode.Constants {
+		if err := e.constant(constant); err != nil {
+			return err
+		}
+	}
+	e.function(bytecode.Main)
+	binary.Write(&e.buf, binary.BigEndian, crc32.ChecksumIEEE(e.buf.Bytes()))
+
+	_, err := w.Write(e.buf.Bytes())
+	return err
+}
+
+type encoder struct {
+	buf     bytes.Buffer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (e *encoder) uvarint(v int) {
+	n := binary.PutUvarint(e.scratch[:], uint64(v))
+	e.buf.Write(e.scratch[:n])
+}
+
+func (e *encoder) varint(v int64) {
+	n := binary.PutVarint(e.scratch[:], v)
+	e.buf.Write(e.scratch[:n])
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uvarint(len(b))
+	e.buf.Write(b)
+}
+
+func (e *encoder) strings(list []string) {
+	e.uvarint(len(list))
+	for _, s := range list {
+		e.bytes([]byte(s))
+	}
+}
+
+func (e *encoder) constant(obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		e.buf.WriteByte(tagInteger)
+		e.varint(obj.Value)
+	case *object.Float:
+		e.buf.WriteByte(tagFloat)
+		binary.Write(&e.buf, binary.BigEndian, math.Float64bits(obj.Value))
+	case *object.String:
+		e.buf.WriteByte(tagString)
+		e.bytes([]byte(obj.Value))
+	case *object.CompiledFunction:
+		e.buf.WriteByte(tagFunction)
+		e.function(obj)
+	default:
+		return fmt.Errorf("cannot encode constant of type %s", obj.Type())
+	}
+	return nil
+}
+
+func (e *encoder) function(fn *object.CompiledFunction) {
+	e.bytes(fn.Instructions)
+	e.uvarint(len(fn.SourceMap))
+	for _, entry := range fn.SourceMap {
+		e.uvarint(entry.Offset)
+		e.uvarint(entry.Pos.Line)
+		e.uvarint(entry.Pos.Column)
+	}
+	e.uvarint(fn.NumParameters)
+	e.strings(fn.Locals)
+	e.bytes([]byte(fn.Source))
+	e.bytes([]byte(fn.Name))
+}
+
+// Decode reads bytecode written by Encode, checking that it is intact and
+// that every instruction refers to constants, variables and jump targets
+// that exist, so the virtual machine can run it safely.
+func Decode(r io.Reader) (*Bytecode, error) {
+	data, err := io.ReadAll(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < len(Magic) || string(data[:len(Magic)]) != Magic {
+		return nil, fmt.Errorf("%w: not a compiled Turatti file", ErrCorrupt)
+	}
+	if len(data) < len(Magic)+2 {
+		return nil, fmt.Errorf("%w: unexpected end of data", ErrCorrupt)
+	}
+	if version := binary.BigEndian.Uint16(data[len(Magic):]); version != FormatVersion {
+		return nil, &VersionError{Version: int(version)}
+	}
+	if len(data) < len(Magic)+2+4 {
+		return nil, fmt.Errorf("%w: unexpected end of data", ErrCorrupt)
+	}
+	body, checksum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != checksum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorrupt)
+	}
+
+	d := &decoder{data: body, offset: len(Magic) + 2}
+	bytecode := &Bytecode{Globals: d.strings()}
+	count := d.uvarint()
+	for i := 0; i < count && d.err == nil; i++ {
+		bytecode.Constants = append(bytecode.Constants, d.constant())
+	}
+	bytecode.Main = d.function()
+	if d.err == nil && d.offset != len(d.data) {
+		d.fail("%d unexpected bytes after the main function", len(d.data)-d.offset)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if err := verify(bytecode); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return bytecode, nil
+}
+
+type decoder struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (d *decoder) fail(format string, args ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s at byte %d", ErrCorrupt, fmt.Sprintf(format, args...), d.offset)
+	}
+}
+
+func (d *decoder) uvarint() int {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data[d.offset:])
+	if n <= 0 || v > math.MaxInt32 {
+		d.fail("invalid length")
+		return 0
+	}
+	d.offset += n
+	return int(v)
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data[d.offset:])
+	if n <= 0 {
+		d.fail("invalid integer")
+		return 0
+	}
+	d.offset += n
+	return v
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.data)-d.offset {
+		d.fail("unexpected end of data")
+		return nil
+	}
+	b := d.data[d.offset : d.offset+n]
+	d.offset += n
+	return b
+}
+
+func (d *decoder) bytes() []byte {
+	return append([]byte(nil), d.next(d.uvarint())...)
+}
+
+func (d *decoder) strings() []string {
+	count := d.uvarint()
+	list := []string{}
+	for i := 0; i < count && d.err == nil; i++ {
+		list = append(list, string(d.bytes()))
+	}
+	return list
+}
+
+func (d *decoder) constant() object.Object {
+	tag := d.next(1)
+	if d.err != nil {
+		return nil
+	}
+	switch tag[0] {
+	case tagInteger:
+		return &object.Integer{Value: d.varint()}
+	case tagFloat:
+		bits := d.next(8)
+		if d.err != nil {
+			return nil
+		}
+		return &object.Float{Value: math.Float64frombits(binary.BigEndian.Uint64(bits))}
+	case tagString:
+		return &object.String{Value: string(d.bytes())}
+	case tagFunction:
+		return d.function()
+	}
+	d.fail("unknown constant tag %q", tag[0])
+	return nil
+}
+
+func (d *decoder) function() *object.CompiledFunction {
+	fn := &object.CompiledFunction{Instructions: d.bytes()}
+	entries := d.uvarint()
+	for i := 0; i < entries && d.err == nil; i++ {
+		entry := code.SourcePos{Offset: d.uvarint()}
+		entry.Pos = token.Position{Line: d.uvarint(), Column: d.uvarint()}
+		fn.SourceMap = append(fn.SourceMap, entry)
+	}
+	fn.NumParameters = d.uvarint()
+	fn.Locals = d.strings()
+	fn.Source = string(d.bytes())
+	fn.Name = string(d.bytes())
+	return fn
+}
+
+// verify checks the instructions of every function against the rest of
+// bytecode. Functions are only ever created by the function they were
+// compiled inside of, which tells how many scopes enclose them.
+func verify(bytecode *Bytecode) error {
+	parents := map[*object.CompiledFunction]*object.CompiledFunction{}
+	queue := []*object.CompiledFunction{bytecode.Main}
+	for len(queue) > 0 {
+		fn := queue[0]
+		queue = queue[1:]
+		if fn.NumParameters > len(fn.Locals) {
+			return fmt.Errorf("function has %d parameters but %d locals", fn.NumParameters, len(fn.Locals))
+		}
+		children, err := verifyFunction(bytecode, fn, parents)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if _, seen := parents[child]; seen || child == bytecode.Main {
+				return fmt.Errorf("function created by more than one function")
+			}
+			parents[child] = fn
+			queue = append(queue, child)
+		}
+	}
+	return nil
+}
+
+func verifyFunction(bytecode *Bytecode, fn *object.CompiledFunction, parents map[*object.CompiledFunction]*object.CompiledFunction) ([]*object.CompiledFunction, error) {
+	var children []*object.CompiledFunction
+	ins := fn.Instructions
+	starts := map[int]bool{}
+	jumps := []int{}
+
+	for i := 0; i < len(ins); {
+		starts[i] = true
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return nil, fmt.Errorf("offset %d: %v", i, err)
+		}
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			return nil, fmt.Errorf("offset %d: truncated %s", i, def.Name)
+		}
+		operands, _ := code.ReadOperands(def, ins[i+1:])
+
+		invalid := func(what string) error {
+			return fmt.Errorf("offset %d: %s refers to a missing %s", i, def.Name, what)
+		}
+		switch code.Opcode(ins[i]) {
+		case code.OpConstant:
+			if operands[0] >= len(bytecode.Constants) {
+				return nil, invalid("constant")
+			}
+		case code.OpMember:
+			if operands[0] >= len(bytecode.Constants) {
+				return nil, invalid("constant")
+			}
+			if _, ok := bytecode.Constants[operands[0]].(*object.String); !ok {
+				return nil, invalid("member name")
+			}
+		case code.OpClosure:
+			if operands[0] >= len(bytecode.Constants) {
+				return nil, invalid("constant")
+			}
+			child, ok := bytecode.Constants[operands[0]].(*object.CompiledFunction)
+			if !ok {
+				return nil, invalid("function")
+			}
+			children = append(children, child)
+		case code.OpGetGlobal, code.OpSetGlobal:
+			if operands[0] >= len(bytecode.Globals) {
+				return nil, invalid("global")
+			}
+		case code.OpGetLocal, code.OpSetLocal:
+			if fn == bytecode.Main || operands[0] >= len(fn.Locals) {
+				return nil, invalid("local")
+			}
+		case code.OpGetFree:
+			outer := fn
+			for depth := 0; depth < operands[0] && outer != nil; depth++ {
+				outer = parents[outer]
+			}
+			if operands[0] == 0 || outer == nil || outer == bytecode.Main || operands[1] >= len(outer.Locals) {
+				return nil, invalid("free variable")
+			}
+		case code.OpGetBuiltin:
+			if operands[0] >= len(builtins.Names()) {
+				return nil, invalid("builtin")
+			}
+		case code.OpJump, code.OpJumpNotTruthy, code.OpTry, code.OpPropagate:
+			jumps = append(jumps, operands[0])
+		}
+		i += 1 + width
+	}
+
+	for _, target := range jumps {
+		if target != len(ins) && !starts[target] {
+			return nil, fmt.Errorf("jump to offset %d, which is not an instruction", target)
+		}
+	}
+	if len(ins) == 0 || code.Opcode(ins[len(ins)-1]) != code.OpReturnValue {
+		return nil, fmt.Errorf("function does not end with %s", "OpReturnValue")
+	}
+	return children, nil
+}
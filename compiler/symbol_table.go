@@ -0,0 +1,100 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	BuiltinScope SymbolScope = "BUILTIN"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable maps the names of one scope to slots. The outermost table
+// holds the globals and builtins; every function gets a table enclosed by
+// the one of the function it is defined in.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store map[string]Symbol
+	names []string
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define gives name a slot in s, reusing the one it already has if it was
+// defined in s before.
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && symbol.Scope != BuiltinScope {
+		return symbol
+	}
+	symbol := Symbol{Name: name, Scope: LocalScope, Index: len(s.names)}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	}
+	s.store[name] = symbol
+	s.names = append(s.names, name)
+	return symbol
+}
+
+// DefineSlot gives s a new slot that no name resolves to, such as the one
+// of a parameter destructured by a pattern. Names calls it name.
+func (s *SymbolTable) DefineSlot(name string) Symbol {
+	symbol := Symbol{Name: name, Scope: LocalScope, Index: len(s.names)}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	}
+	s.names = append(s.names, name)
+	return symbol
+}
+
+// Shadow gives name a new slot in s, hiding whatever name resolved to
+// until restore is called. Match arms and catch clauses bind their names
+// this way, so that they never outlive the arm or clause.
+func (s *SymbolTable) Shadow(name string) (symbol Symbol, restore func()) {
+	previous, shadows := s.store[name]
+	symbol = s.DefineSlot(name)
+	s.store[name] = symbol
+	return symbol, func() {
+		if shadows {
+			s.store[name] = previous
+		} else {
+			delete(s.store, name)
+		}
+	}
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Scope: BuiltinScope, Index: index}
+	s.store[name] = symbol
+	return symbol
+}
+
+// Resolve looks name up in s and its enclosing tables. For locals, depth
+// is how many functions up from s the name was defined.
+func (s *SymbolTable) Resolve(name string) (symbol Symbol, depth int, ok bool) {
+	for table := s; table != nil; table = table.Outer {
+		if symbol, ok := table.store[name]; ok {
+			return symbol, depth, true
+		}
+		depth++
+	}
+	return Symbol{}, 0, false
+}
+
+// Names returns the names of the slots of s, in slot order.
+func (s *SymbolTable) Names() []string {
+	return append([]string(nil), s.names...)
+}
@@ -0,0 +1,165 @@
+package turatti
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"turatti/evaluator"
+	"turatti/object"
+)
+
+// ToObject converts a Go value into a Turatti object. nil becomes null,
+// booleans, integers, floats and strings become their Turatti counterparts,
+// slices and arrays become arrays, converting each element, maps become
+// hashes, ordered by key, and functions become builtins as described in
+// Interpreter.Register. Objects are returned as they are.
+func ToObject(value any) (object.Object, error) {
+	if value == nil {
+		return evaluator.NULL, nil
+	}
+	if obj, ok := value.(object.Object); ok {
+		return obj, nil
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > 1<<63-1 {
+			return nil, fmt.Errorf("turatti: %d overflows an integer", v.Uint())
+		}
+		return &object.Integer{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		array := &object.Array{Elements: make([]object.Object, 0, v.Len())}
+		for i := 0; i < v.Len(); i++ {
+			element, err := ToObject(v.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			array.Elements = append(array.Elements, element)
+		}
+		return array, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		pairs := make([]object.HashPair, 0, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			key, err := ToObject(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := key.(object.Hashable); !ok {
+				return nil, fmt.Errorf("turatti: unusable as hash key: %s", key.Type())
+			}
+			value, err := ToObject(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, object.HashPair{Key: key, Value: value})
+		}
+		// Go maps have no order, and hashes keep the one keys come in.
+		sort.Slice(pairs, func(i, j int) bool {
+			return keyLess(pairs[i].Key, pairs[j].Key)
+		})
+		hash := object.NewHash()
+		for _, pair := range pairs {
+			hash.Set(pair.Key, pair.Value)
+		}
+		return hash, nil
+	case reflect.Func:
+		return newBuiltin("func", value)
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return ToObject(v.Elem().Interface())
+	}
+	return nil, fmt.Errorf("turatti: cannot convert %T to a Turatti value", value)
+}
+
+// keyLess orders hash keys: booleans, false first, then numbers by value,
+// then strings lexically.
+func keyLess(a, b object.Object) bool {
+	if ra, rb := keyRank(a), keyRank(b); ra != rb {
+		return ra < rb
+	}
+	switch a := a.(type) {
+	case *object.Boolean:
+		return !a.Value && b.(*object.Boolean).Value
+	case *object.String:
+		return a.Value < b.(*object.String).Value
+	case *object.Integer:
+		if b, ok := b.(*object.Integer); ok {
+			return a.Value < b.Value
+		}
+	}
+	x, y := keyNumber(a), keyNumber(b)
+	if x != y {
+		return x < y
+	}
+	// 1 and 1.0 are different keys; the integer goes first.
+	return a.Type() == object.INTEGER_OBJ && b.Type() == object.FLOAT_OBJ
+}
+
+func keyRank(key object.Object) int {
+	switch key.(type) {
+	case *object.Boolean:
+		return 0
+	case *object.Integer, *object.Float:
+		return 1
+	}
+	return 2
+}
+
+func keyNumber(key object.Object) float64 {
+	if i, ok := key.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+	return key.(*object.Float).Value
+}
+
+// FromObject converts a Turatti object into a Go value: integers become
+// int64, floats float64, booleans bool, strings string, null nil, arrays
+// []any and hashes map[any]any. Other objects, such as functions, are
+// returned as they are.
+func FromObject(obj object.Object) any {
+	switch obj := obj.(type) {
+	case nil, *object.Null:
+		return nil
+	case *object.Integer:
+		return obj.Value
+	case *object.Float:
+		return obj.Value
+	case *object.Boolean:
+		return obj.Value
+	case *object.String:
+		return obj.Value
+	case *object.Array:
+		elements := make([]any, 0, len(obj.Elements))
+		for _, e := range obj.Elements {
+			elements = append(elements, FromObject(e))
+		}
+		return elements
+	case *object.Hash:
+		entries := make(map[any]any, obj.Len())
+		for _, pair := range obj.Entries() {
+			entries[FromObject(pair.Key)] = FromObject(pair.Value)
+		}
+		return entries
+	}
+	return obj
+}
@@ -0,0 +1,599 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"turatti/ast"
+	"turatti/builtins"
+	"turatti/object"
+)
+
+var (
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+)
+
+// Options configure the global environment of a program.
+type Options struct {
+	// Stdout receives the output of print, println and puts; nil means
+	// os.Stdout.
+	Stdout io.Writer
+	// AllowShadowing lets def statements rebind the names of builtins.
+	AllowShadowing bool
+	// Importer loads the modules the program imports; without one, import
+	// statements fail.
+	Importer object.Importer
+	// File names the program in the frames of runtime errors.
+	File string
+}
+
+// NewGlobalEnvironment returns an environment for running a program,
+// enclosed by one that holds the standard builtins.
+func NewGlobalEnvironment(opts Options) *object.Environment {
+	universe := object.NewEnvironment()
+	for _, builtin := range builtins.New(opts.Stdout) {
+		universe.Set(builtin.Name, builtin)
+		if !opts.AllowShadowing {
+			universe.Protect(builtin.Name)
+		}
+	}
+	env := object.NewEnclosedEnvironment(universe)
+	env.SetImporter(opts.Importer)
+	env.SetFile(opts.File)
+	return env
+}
+
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	return EvalContext(context.Background(), node, env)
+}
+
+// EvalContext evaluates node like Eval, aborting with an error once ctx is
+// done.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	return eval(withCalls(ctx), node, env)
+}
+
+// ApplyFunction calls fn with args as if from a call expression without a
+// position in the source.
+func ApplyFunction(ctx context.Context, fn object.Object, args []object.Object) object.Object {
+	return applyFunction(withCalls(ctx), nil, fn, args)
+}
+
+type callsKey struct{}
+
+// withCalls gives ctx a count of the function calls in progress, unless
+// it has one already because the evaluation calling back into Go does.
+func withCalls(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(callsKey{}).(*int); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, callsKey{}, new(int))
+}
+
+func eval(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	case *ast.Program:
+		return evalProgram(ctx, node, env)
+	case *ast.ExpressionStatement:
+		return eval(ctx, node.Expression, env)
+	case *ast.BlockStatement:
+		return evalBlockStatement(ctx, node, env)
+	case *ast.ReturnStatement:
+		if node.ReturnValue == nil {
+			return &object.ReturnValue{Value: NULL}
+		}
+		value := eval(ctx, node.ReturnValue, env)
+		if interrupts(value) {
+			return value
+		}
+		return &object.ReturnValue{Value: value}
+	case *ast.ThrowStatement:
+		value := eval(ctx, node.Value, env)
+		if interrupts(value) {
+			return value
+		}
+		err := object.Throw(value)
+		err.Pos = node.Pos()
+		return err
+	case *ast.DefStatement:
+		return evalDefStatement(ctx, node, env)
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+	case *ast.PrefixExpression:
+		right := eval(ctx, node.Right, env)
+		if interrupts(right) {
+			return right
+		}
+		return evalPrefixExpression(node, right)
+	case *ast.InfixExpression:
+		left := eval(ctx, node.Left, env)
+		if interrupts(left) {
+			return left
+		}
+		right := eval(ctx, node.Right, env)
+		if interrupts(right) {
+			return right
+		}
+		return evalInfixExpression(node, left, right)
+	case *ast.IfExpression:
+		return evalIfExpression(ctx, node, env)
+	case *ast.TryExpression:
+		return evalTryExpression(ctx, node, env)
+	case *ast.MatchExpression:
+		return evalMatchExpression(ctx, node, env)
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
+	case *ast.FunctionLiteral:
+		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env}
+	case *ast.CallExpression:
+		function := eval(ctx, node.Function, env)
+		if interrupts(function) {
+			return function
+		}
+		args := evalExpressions(ctx, node.Arguments, env)
+		if len(args) == 1 && interrupts(args[0]) {
+			return args[0]
+		}
+		return applyFunction(ctx, node, function, args)
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(ctx, node.Elements, env)
+		if len(elements) == 1 && interrupts(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+	case *ast.HashLiteral:
+		return evalHashLiteral(ctx, node, env)
+	case *ast.IndexExpression:
+		left := eval(ctx, node.Left, env)
+		if interrupts(left) {
+			return left
+		}
+		index := eval(ctx, node.Index, env)
+		if interrupts(index) {
+			return index
+		}
+		return evalIndexExpression(node, left, index)
+	case *ast.PropagateExpression:
+		value := eval(ctx, node.Value, env)
+		if interrupts(value) {
+			return value
+		}
+		unwrapped, ok, err := object.Propagate(value)
+		if err != nil {
+			return wrapError(node, err)
+		}
+		if !ok {
+			return &object.ReturnValue{Value: value}
+		}
+		return unwrapped
+	case *ast.MemberExpression:
+		left := eval(ctx, node.Left, env)
+		if interrupts(left) {
+			return left
+		}
+		result, err := object.Member(left, node.Member.Value)
+		if err != nil {
+			return wrapError(node.Member, err)
+		}
+		return result
+	}
+	return NULL
+}
+
+func evalProgram(ctx context.Context, program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object = NULL
+	for _, stmt := range program.Statements {
+		if err := ctx.Err(); err != nil {
+			result = wrapError(stmt, err)
+		} else {
+			result = eval(ctx, stmt, env)
+		}
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			result.AddFrame(object.Frame{Function: object.MainFunction, File: env.File()})
+			return result
+		}
+	}
+	return result
+}
+
+func evalBlockStatement(ctx context.Context, block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object = NULL
+	for _, stmt := range block.Statements {
+		if err := ctx.Err(); err != nil {
+			return wrapError(stmt, err)
+		}
+		result = eval(ctx, stmt, env)
+		if result != nil {
+			if rt := result.Type(); rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+	return result
+}
+
+func evalDefStatement(ctx context.Context, node *ast.DefStatement, env *object.Environment) object.Object {
+	name, isName := node.Name.(*ast.Identifier)
+	if isName && env.IsProtected(name.Value) {
+		return newError(name, object.NameError, "cannot redefine builtin %s", name.Value)
+	}
+	value := eval(ctx, node.Value, env)
+	if interrupts(value) {
+		return value
+	}
+	if function, ok := value.(*object.Function); ok && isName && isFunctionLiteral(node.Value) {
+		function.Name = name.Value
+	}
+	if err := bindPattern(node.Name, value, env); err != nil {
+		return err
+	}
+	return NULL
+}
+
+func evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	if env.IsProtected(node.Alias.Value) {
+		return newError(node.Alias, object.NameError, "cannot redefine builtin %s", node.Alias.Value)
+	}
+	importer := env.Importer()
+	if importer == nil {
+		return newError(node, object.ImportError, "cannot import %s: modules are not available here", node.Path)
+	}
+	module, err := importer.Import(node.Path.Value)
+	// a module that failed while running carries its own frames, which
+	// continue here.
+	var failed *object.Error
+	if errors.As(err, &failed) {
+		failed.CalledFrom(node.Pos())
+		return failed
+	}
+	if err != nil {
+		return wrapError(node, err)
+	}
+	env.Set(node.Alias.Value, module)
+	return NULL
+}
+
+func evalPrefixExpression(node *ast.PrefixExpression, right object.Object) object.Object {
+	result, err := object.Prefix(node.Operator, right)
+	if err != nil {
+		return wrapError(node, err)
+	}
+	return result
+}
+
+func evalInfixExpression(node *ast.InfixExpression, left, right object.Object) object.Object {
+	result, err := object.Infix(node.Operator, left, right)
+	if err != nil {
+		return wrapError(node, err)
+	}
+	return result
+}
+
+func evalIfExpression(ctx context.Context, node *ast.IfExpression, env *object.Environment) object.Object {
+	condition := eval(ctx, node.Condition, env)
+	if interrupts(condition) {
+		return condition
+	}
+	if object.IsTruthy(condition) {
+		return eval(ctx, node.Consequence, env)
+	} else if node.Alternative != nil {
+		return eval(ctx, node.Alternative, env)
+	}
+	return NULL
+}
+
+// evalTryExpression catches the errors of the try block, except the one
+// that aborts a program once its context is done, and runs the finally
+// block however the others ended. An error or return in the finally block
+// takes the place of their result.
+func evalTryExpression(ctx context.Context, node *ast.TryExpression, env *object.Environment) object.Object {
+	result := eval(ctx, node.Block, env)
+	if err, ok := result.(*object.Error); ok && node.Catch != nil && ctx.Err() == nil {
+		if env.IsProtected(node.Parameter.Value) {
+			return newError(node.Parameter, object.NameError, "cannot redefine builtin %s", node.Parameter.Value)
+		}
+		// The caught value is only visible in the catch block.
+		scope := object.NewScopedEnvironment(env)
+		scope.Declare(node.Parameter.Value, err.Caught())
+		result = eval(ctx, node.Catch, scope)
+	}
+	// A cancelled program stops without running finally blocks, as it
+	// does on the virtual machine.
+	if node.Finally != nil && (!isError(result) || ctx.Err() == nil) {
+		final := eval(ctx, node.Finally, env)
+		if rt := final.Type(); rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			return final
+		}
+	}
+	return result
+}
+
+// binding is a name a pattern binds, with the value it binds it to.
+type binding struct {
+	name  *ast.Identifier
+	value object.Object
+}
+
+// evalMatchExpression evaluates the body of the first arm whose pattern
+// matches and whose guard holds, or yields null if there is none. The
+// names a pattern binds are only set once it matches.
+func evalMatchExpression(ctx context.Context, node *ast.MatchExpression, env *object.Environment) object.Object {
+	value := eval(ctx, node.Value, env)
+	if interrupts(value) {
+		return value
+	}
+	for _, arm := range node.Arms {
+		bindings, err := matchPattern(arm.Pattern, value, nil)
+		if err != nil {
+			continue
+		}
+		// Like parameters, the names an arm binds shadow builtins, and
+		// they are dropped with the arm when its guard fails.
+		scope := object.NewScopedEnvironment(env)
+		for _, b := range bindings {
+			scope.Declare(b.name.Value, b.value)
+		}
+		if arm.Guard != nil {
+			guard := eval(ctx, arm.Guard, scope)
+			if interrupts(guard) {
+				return guard
+			}
+			if !object.IsTruthy(guard) {
+				continue
+			}
+		}
+		return eval(ctx, arm.Body, scope)
+	}
+	return NULL
+}
+
+// bindPattern destructures value as a def statement or parameter does,
+// failing at the part of pattern that value does not fit.
+func bindPattern(pattern ast.Pattern, value object.Object, env *object.Environment) *object.Error {
+	bindings, err := matchPattern(pattern, value, nil)
+	if err != nil {
+		return err
+	}
+	return bind(bindings, env)
+}
+
+// bind sets the names a pattern matched.
+func bind(bindings []binding, env *object.Environment) *object.Error {
+	for _, b := range bindings {
+		if env.IsProtected(b.name.Value) {
+			return newError(b.name, object.NameError, "cannot redefine builtin %s", b.name.Value)
+		}
+		env.Set(b.name.Value, b.value)
+	}
+	return nil
+}
+
+// matchPattern matches value against pattern, appending the names it
+// binds to bindings, or reports why value does not match.
+func matchPattern(pattern ast.Pattern, value object.Object, bindings []binding) ([]binding, *object.Error) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		return append(bindings, binding{pattern, value}), nil
+	case *ast.LiteralPattern:
+		if expected := literalValue(pattern.Value); !object.Equal(expected, value) {
+			return nil, newError(pattern, object.ValueError, "expected %s, got %s", expected.Inspect(), value.Inspect())
+		}
+	case *ast.ArrayPattern:
+		if err := object.MatchArray(value, len(pattern.Elements), pattern.Rest != nil); err != nil {
+			return nil, wrapError(pattern, err)
+		}
+		elements := value.(*object.Array).Elements
+		for i, element := range pattern.Elements {
+			var err *object.Error
+			if bindings, err = matchPattern(element, elements[i], bindings); err != nil {
+				return nil, err
+			}
+		}
+		if pattern.Rest != nil {
+			return matchPattern(pattern.Rest, object.Rest(value, len(pattern.Elements)), bindings)
+		}
+	case *ast.HashPattern:
+		keys := make([]object.Object, len(pattern.Pairs))
+		for i, pair := range pattern.Pairs {
+			keys[i] = literalValue(pair.Key)
+		}
+		if err := object.MatchHash(value, keys); err != nil {
+			return nil, wrapError(pattern, err)
+		}
+		for i, pair := range pattern.Pairs {
+			element, _ := object.Index(value, keys[i])
+			var err *object.Error
+			if bindings, err = matchPattern(pair.Value, element, bindings); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return bindings, nil
+}
+
+// literalValue returns the value of the literal of a pattern, which may
+// be a negated number.
+func literalValue(e ast.Expression) object.Object {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: e.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: e.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: e.Value}
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(e.Value)
+	case *ast.PrefixExpression:
+		value, _ := object.Prefix(e.Operator, literalValue(e.Right))
+		return value
+	}
+	return NULL
+}
+
+func evalHashLiteral(ctx context.Context, node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+	for _, pair := range node.Pairs {
+		key := eval(ctx, pair.Key, env)
+		if interrupts(key) {
+			return key
+		}
+		value := eval(ctx, pair.Value, env)
+		if interrupts(value) {
+			return value
+		}
+		if !hash.Set(key, value) {
+			return newError(node, object.TypeError, "unusable as hash key: %s", key.Type())
+		}
+	}
+	return hash
+}
+
+func evalIndexExpression(node *ast.IndexExpression, left, index object.Object) object.Object {
+	result, err := object.Index(left, index)
+	if err != nil {
+		return wrapError(node, err)
+	}
+	return result
+}
+
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if value, ok := env.Get(node.Value); ok {
+		return value
+	}
+	return newError(node, object.NameError, "identifier not found: %s", node.Value)
+}
+
+func evalExpressions(ctx context.Context, expressions []ast.Expression, env *object.Environment) []object.Object {
+	result := []object.Object{}
+	for _, e := range expressions {
+		evaluated := eval(ctx, e, env)
+		if interrupts(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+	return result
+}
+
+func applyFunction(ctx context.Context, call *ast.CallExpression, fn object.Object, args []object.Object) object.Object {
+	if builtin, ok := fn.(*object.Builtin); ok {
+		result, err := builtin.Fn(args...)
+		if err != nil {
+			return wrapError(call, err)
+		}
+		if result == nil {
+			return NULL
+		}
+		return result
+	}
+
+	function, ok := fn.(*object.Function)
+	if !ok {
+		return newError(call, object.TypeError, "not a function: %s", fn.Type())
+	}
+	if len(args) != len(function.Parameters) {
+		return newError(call, object.ArgumentError, "wrong number of arguments: expected %d, got %d", len(function.Parameters), len(args))
+	}
+
+	// The program itself takes a frame, as it does on the VM.
+	if calls, ok := ctx.Value(callsKey{}).(*int); ok {
+		if *calls >= object.MaxFrames-1 {
+			return newError(call, object.RuntimeError, "stack overflow")
+		}
+		*calls++
+		defer func() { *calls-- }()
+	}
+
+	var evaluated object.Object
+	env := object.NewEnclosedEnvironment(function.Env)
+	for i, param := range function.Parameters {
+		// parameters shadow builtins instead of redefining them.
+		bindings, err := matchPattern(param, args[i], nil)
+		if err != nil {
+			evaluated = err
+			break
+		}
+		for _, b := range bindings {
+			env.Set(b.name.Value, b.value)
+		}
+	}
+
+	if evaluated == nil {
+		evaluated = eval(ctx, function.Body, env)
+	}
+	switch evaluated := evaluated.(type) {
+	case *object.ReturnValue:
+		return evaluated.Value
+	case *object.Error:
+		evaluated.AddFrame(frameOf(function, args))
+		if call != nil {
+			evaluated.CalledFrom(call.Pos())
+		}
+	}
+	return evaluated
+}
+
+// frameOf describes a call of function with args for runtime errors.
+func frameOf(function *object.Function, args []object.Object) object.Frame {
+	frame := object.Frame{Function: function.Name, File: function.Env.File(), Args: args}
+	if frame.Function == "" {
+		frame.Function = object.AnonymousFunction
+	}
+	for _, param := range function.Parameters {
+		frame.Parameters = append(frame.Parameters, param.String())
+	}
+	return frame
+}
+
+// isFunctionLiteral reports whether e is a function literal, whose
+// function takes the name of the def it appears in.
+func isFunctionLiteral(e ast.Expression) bool {
+	_, ok := e.(*ast.FunctionLiteral)
+	return ok
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	return object.NativeBool(input)
+}
+
+func newError(node ast.Node, kind object.ErrorKind, format string, args ...any) *object.Error {
+	err := &object.Error{Message: fmt.Sprintf(format, args...), Kind: kind}
+	if node != nil && !reflect.ValueOf(node).IsNil() {
+		err.Pos = node.Pos()
+	}
+	return err
+}
+
+// wrapError raises err, as returned by an operator or builtin, at node.
+func wrapError(node ast.Node, err error) *object.Error {
+	return newError(node, object.KindOf(err), "%s", err)
+}
+
+func isError(obj object.Object) bool {
+	return obj != nil && obj.Type() == object.ERROR_OBJ
+}
+
+// interrupts reports whether obj, the value of an operand, ends the
+// expression using it early: it is an error, or the return a ? makes.
+func interrupts(obj object.Object) bool {
+	if obj == nil {
+		return false
+	}
+	rt := obj.Type()
+	return rt == object.ERROR_OBJ || rt == object.RETURN_VALUE_OBJ
+}
@@ -0,0 +1,251 @@
+package evaluator
+
+import (
+	"fmt"
+	"testing"
+	"turatti/lexer"
+	"turatti/object"
+	"turatti/parser"
+)
+
+func testEval(t *testing.T, input string) object.Object {
+	psr := parser.New(lexer.New(input))
+	program := psr.Parse()
+	if len(psr.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, psr.Errors())
+	}
+	return Eval(program, object.NewEnvironment())
+}
+
+func TestEvalExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"5", int64(5)},
+		{"-5 + 10 * 2", int64(15)},
+		{"(5 + 10) / 3", int64(5)},
+		{"\"hello\" + \" \" + \"world\"", "hello world"},
+		{"true", true},
+		{"!true", false},
+		{"!!5", true},
+		{"1 < 2 == true", true},
+		{"3 >= 4", false},
+		{"\"a\" != \"b\"", true},
+		{"if (1 > 2) { 10 } else { 20 }", int64(20)},
+		{"if (false) { 10 }", nil},
+		{"def a = 5; def b = a * 2; b;", int64(10)},
+		{"9; return 2 * 5; 9;", int64(10)},
+		{"if (true) { if (true) { return 10; } return 1; }", int64(10)},
+		{"def sum = fun(x, y) { x + y; }; sum(5, 10);", int64(15)},
+		{"def add = fun(x) { fun(y) { x + y } }; add(2)(3);", int64(5)},
+		{"def fib = fun(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2); }; fib(15);", int64(610)},
+		{"1.5 * 2", 3.0},
+		{"-2.5 + 1", -1.5},
+		{"1 / 4.0", 0.25},
+		{"2.0 == 2", true},
+		{"[1, 2 * 3][1]", int64(6)},
+		{"def id = fun(x) { x }; [id][0](4)", int64(4)},
+		{`"héllo"[1]`, "é"},
+		{`{"a": 1, true: 2, 3: 4}[true]`, int64(2)},
+		{`{"a": 1}["b"]`, nil},
+		{"[1, [2, 3]] == [1, [2, 3]]", true},
+		{`{"a": [1]} != {"a": [1]}`, false},
+		{`1 == "1"`, false},
+		{"try { 1 } catch (e) { 2 }", int64(1)},
+		{"try { throw 5; } catch (e) { e + 1 }", int64(6)},
+		{`try { 1 / 0 } catch (e) { e["kind"] }`, "ZeroDivisionError"},
+		{`try { [][1] } catch (e) { e["message"] }`, "index out of range: 1 with length 0"},
+		{"def f = fun() { try { return 1; } finally { return 2; } }; f()", int64(2)},
+		{"try { throw 1; } catch (e) { 2 } finally { 3 }", int64(2)},
+		{"try { try { throw 1; } finally { 2 } } catch (e) { e }", int64(1)},
+		{"match 2 { 1 => 10, 2 => 20, _ => 30 }", int64(20)},
+		{"match 2.0 { 2 => true, _ => false }", true},
+		{"match -1 { -1 => \"neg\", _ => \"other\" }", "neg"},
+		{"match [1, 2, 3] { [] => 0, [a, ...tail] => a + tail[1] }", int64(4)},
+		{"match [1, 2] { [a] => a, [a, b, c] => c, [_, b] => b }", int64(2)},
+		{`match {"k": [4], "x": 1} { {"k": [v]} => v, _ => 0 }`, int64(4)},
+		{`match {"k": 1} { {"k": 1, "j": _} => 1, {} => 2 }`, int64(2)},
+		{"match 5 { {} => 1, [..._] => 2 }", nil},
+		{"match 5 { n if n > 9 => 1, n if n > 4 => 2, _ => 3 }", int64(2)},
+		{"match [1, 2] { [a, b] if a > b => 1, [a, b] => b }", int64(2)},
+		{"match 1 { n => if (n) { def y = n + 1; } }; y", int64(2)},
+		{"def n = 5; match 1 { n => n }; n", int64(5)},
+		{"def [a, b] = [1, 2]; a + b", int64(3)},
+		{"def [a, ...t] = [1, 2, 3]; t[1]", int64(3)},
+		{`def {name, "age": years} = {"name": "ada", "age": 36}; name`, "ada"},
+		{`def [_, {"k": [v]}] = [0, {"k": [7]}]; v`, int64(7)},
+		{"def f = fun([x, y], {z}) { x * y + z }; f([2, 3], {\"z\": 4})", int64(10)},
+		{"fun([_], [_]) { 1 }([0], [0])", int64(1)},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int64:
+			integer, ok := evaluated.(*object.Integer)
+			if !ok || integer.Value != expected {
+				t.Errorf("%q: expected %d, got %s", tt.input, expected, evaluated.Inspect())
+			}
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%q: expected %q, got %s", tt.input, expected, evaluated.Inspect())
+			}
+		case bool:
+			boolean, ok := evaluated.(*object.Boolean)
+			if !ok || boolean.Value != expected {
+				t.Errorf("%q: expected %t, got %s", tt.input, expected, evaluated.Inspect())
+			}
+		case float64:
+			float, ok := evaluated.(*object.Float)
+			if !ok || float.Value != expected {
+				t.Errorf("%q: expected %g, got %s", tt.input, expected, evaluated.Inspect())
+			}
+		case nil:
+			if evaluated != NULL {
+				t.Errorf("%q: expected null, got %s", tt.input, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true;", "1:1: runtime error: type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "1:1: runtime error: unknown operator: -BOOLEAN"},
+		{"true + false; 5", "1:1: runtime error: unknown operator: BOOLEAN + BOOLEAN"},
+		{"\"a\" - \"b\"", "1:1: runtime error: unknown operator: STRING - STRING"},
+		{"if (true) {\n  foobar;\n}", "2:3: runtime error: identifier not found: foobar"},
+		{"10 / (5 - 5)", "1:1: runtime error: division by zero"},
+		{"def f = fun(x) { x }; f(1, 2)", "1:23: runtime error: wrong number of arguments: expected 1, got 2"},
+		{"5(1)", "1:1: runtime error: not a function: INTEGER"},
+		{"1.5 / 0", "1:1: runtime error: division by zero"},
+		{"[1, 2][2]", "1:1: runtime error: index out of range: 2 with length 2"},
+		{"[1][\"a\"]", "1:1: runtime error: array index must be INTEGER, got STRING"},
+		{"{[1]: 2}", "1:1: runtime error: unusable as hash key: ARRAY"},
+		{"5[0]", "1:1: runtime error: index operator not supported: INTEGER"},
+		{"def a = [1];\na.length", "2:3: runtime error: member access not supported: ARRAY"},
+		{`import "u.trt" as u;`, "1:1: runtime error: cannot import \"u.trt\": modules are not available here"},
+		{`throw "boom";`, "1:1: runtime error: boom"},
+		{"try {\n  missing\n} finally { 1 }", "2:3: runtime error: identifier not found: missing"},
+		{"try { throw 1; } catch (e) {\n  throw [e];\n}", "2:3: runtime error: [1]"},
+		{"try { 1 } finally { throw 2; }", "1:21: runtime error: 2"},
+		{"match [1] { [x] if x > 5 => 0, _ => x }", "1:37: runtime error: identifier not found: x"},
+		{"def [a, b] = 5;", "1:5: runtime error: cannot destructure INTEGER as ARRAY"},
+		{"def [a, b] = [1];", "1:5: runtime error: cannot destructure ARRAY of length 1 into 2 elements"},
+		{"def [a, [b, ...c]] = [1, []];", "1:9: runtime error: cannot destructure ARRAY of length 0 into at least 1 elements"},
+		{"def {name} = [];", "1:5: runtime error: cannot destructure ARRAY as HASH"},
+		{`def {name} = {"age": 1};`, "1:5: runtime error: cannot destructure HASH without key name"},
+		{"def f = fun([x]) { x };\nf(1)", "1:13: runtime error: cannot destructure INTEGER as ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: expected an error, got %T (%s)", tt.input, evaluated, evaluated.Inspect())
+			continue
+		}
+		if err.Inspect() != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, err.Inspect())
+		}
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected object.ErrorKind
+	}{
+		{"1 + true", object.TypeError},
+		{"missing", object.NameError},
+		{"[1][5]", object.IndexError},
+		{"1 / 0", object.ZeroDivisionError},
+		{"fun(x) { x }()", object.ArgumentError},
+		{`int("x")`, object.ValueError},
+		{"assert(false)", object.AssertionError},
+		{`error("custom")`, object.RuntimeError},
+		{"throw 1;", object.Exception},
+		{`throw {"kind": "ValueError", "message": "bad"};`, object.ValueError},
+		{`try { 1 + true } catch (e) { throw e; }`, object.TypeError},
+		{"match [1] { [x] if x > 5 => 0, _ => x }", object.NameError},
+		{"def [a] = 1;", object.TypeError},
+		{"def [a] = [];", object.ValueError},
+		{"def {a} = {};", object.ValueError},
+		{"def [a, len] = [1, 2];", object.NameError},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).Parse()
+		err, ok := Eval(program, NewGlobalEnvironment(Options{})).(*object.Error)
+		if !ok || err.Kind != tt.expected {
+			t.Errorf("%q: expected a %s, got %v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestErrorFrames(t *testing.T) {
+	input := `def outer = fun(n) {
+    inner(n, "x")
+};
+def inner = fun(a, b) { a + b };
+outer(1);`
+	err, ok := testEval(t, input).(*object.Error)
+	if !ok {
+		t.Fatalf("expected an error")
+	}
+	expected := []struct {
+		function string
+		pos      string
+		args     string
+	}{
+		{"inner", "4:25", "[1 x]"},
+		{"outer", "2:5", "[1]"},
+		{object.MainFunction, "5:1", "[]"},
+	}
+	if len(err.Frames) != len(expected) {
+		t.Fatalf("expected %d frames, got %+v", len(expected), err.Frames)
+	}
+	for i, frame := range err.Frames {
+		args := []string{}
+		for _, arg := range frame.Args {
+			args = append(args, arg.Inspect())
+		}
+		if frame.Function != expected[i].function || frame.Pos.String() != expected[i].pos || fmt.Sprint(args) != expected[i].args {
+			t.Errorf("frames[%d]: expected %+v, got %s at %s with %v", i, expected[i], frame.Function, frame.Pos, args)
+		}
+	}
+}
+
+func TestBuiltinsAreProtected(t *testing.T) {
+	tests := []struct {
+		input          string
+		allowShadowing bool
+		expected       string
+	}{
+		{"def len = 1; len", false, "1:5: runtime error: cannot redefine builtin len"},
+		{"def f = fun() { def len = 1; len }; f()", false, "1:21: runtime error: cannot redefine builtin len"},
+		{"def f = fun(len) { len }; f(2)", false, "2"},
+		{"def [a, len] = [1, 2];", false, "1:9: runtime error: cannot redefine builtin len"},
+		{"def f = fun([len]) { len }; f([2])", false, "2"},
+		{`match [1, 2] { [first, ...rest] => rest, _ => "other" }`, false, "[2]"},
+		{"def f = fun(v) { match v { [len] => len, _ => len(v) } }; [f([3]), f(\"ab\")]", false, "[3, 2]"},
+		{"def len = 1; len", true, "1"},
+	}
+
+	for _, tt := range tests {
+		psr := parser.New(lexer.New(tt.input))
+		program := psr.Parse()
+		if len(psr.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, psr.Errors())
+		}
+		env := NewGlobalEnvironment(Options{AllowShadowing: tt.allowShadowing})
+		if got := Eval(program, env).Inspect(); got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
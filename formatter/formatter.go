@@ -0,0 +1,346 @@
+package formatter
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"turatti/ast"
+	"turatti/lexer"
+	"turatti/parser"
+	"turatti/token"
+)
+
+const indentation = "    "
+
+// atomic is the precedence of expressions that never need parentheses.
+const atomic = parser.INDEX + 1
+
+type printer struct {
+	out      bytes.Buffer
+	indent   int
+	comments []token.Token
+}
+
+// Format prints program as canonical Turatti source: one statement per
+// line, blocks indented by four spaces, at most one blank line between
+// statements and only the parentheses operator precedence requires.
+func Format(program *ast.Program) []byte {
+	p := &printer{comments: program.Comments}
+	p.statementList(program.Statements, token.Position{Line: math.MaxInt})
+	return p.out.Bytes()
+}
+
+// Source parses src and returns it formatted.
+func Source(src []byte) ([]byte, error) {
+	psr := parser.New(lexer.New(string(src)))
+	program := psr.Parse()
+	if len(psr.Errors()) > 0 {
+		return nil, errors.New(strings.Join(psr.Errors(), "\n"))
+	}
+	return Format(program), nil
+}
+
+func (p *printer) write(s string) {
+	p.out.WriteString(s)
+}
+
+func (p *printer) writeIndent() {
+	p.write(strings.Repeat(indentation, p.indent))
+}
+
+func (p *printer) statementList(statements []ast.Statement, end token.Position) {
+	lastLine := 0
+	for _, stmt := range statements {
+		lastLine = p.commentsBefore(stmt.Pos(), lastLine)
+		p.blankLineIfNeeded(lastLine, stmt.Pos().Line)
+
+		p.writeIndent()
+		p.statement(stmt)
+		lastLine = stmt.End().Line
+		p.trailingComment(stmt.End())
+		p.write("\n")
+	}
+	p.commentsBefore(end, lastLine)
+}
+
+func (p *printer) blankLineIfNeeded(lastLine, nextLine int) {
+	if lastLine > 0 && nextLine > lastLine+1 {
+		p.write("\n")
+	}
+}
+
+func (p *printer) commentsBefore(pos token.Position, lastLine int) int {
+	for len(p.comments) > 0 && p.comments[0].Pos().Before(pos) {
+		comment := p.comments[0]
+		p.comments = p.comments[1:]
+
+		p.blankLineIfNeeded(lastLine, comment.Line)
+		p.writeIndent()
+		p.write(strings.TrimRight(comment.Literal, " \t\r"))
+		p.write("\n")
+		lastLine = comment.Line
+	}
+	return lastLine
+}
+
+func (p *printer) trailingComment(end token.Position) {
+	if len(p.comments) == 0 {
+		return
+	}
+	comment := p.comments[0]
+	if comment.Line == end.Line && !comment.Pos().Before(end) {
+		p.comments = p.comments[1:]
+		p.write(" ")
+		p.write(strings.TrimRight(comment.Literal, " \t\r"))
+	}
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.DefStatement:
+		if s.Exported() {
+			p.write("export ")
+		}
+		p.write("def ")
+		p.pattern(s.Name)
+		if s.Type != nil {
+			p.write(": " + s.Type.String())
+		}
+		p.write(" = ")
+		p.expression(s.Value, parser.LOWEST)
+		p.write(";")
+	case *ast.ImportStatement:
+		p.write("import ")
+		p.expression(s.Path, parser.LOWEST)
+		p.write(" as " + s.Alias.Value + ";")
+	case *ast.ReturnStatement:
+		p.write("return")
+		if s.ReturnValue != nil {
+			p.write(" ")
+			p.expression(s.ReturnValue, parser.LOWEST)
+		}
+		p.write(";")
+	case *ast.ThrowStatement:
+		p.write("throw ")
+		p.expression(s.Value, parser.LOWEST)
+		p.write(";")
+	case *ast.ExpressionStatement:
+		p.expression(s.Expression, parser.LOWEST)
+		if !endsWithBlock(s.Expression) || s.Semicolon.Type != "" {
+			p.write(";")
+		}
+	case *ast.BlockStatement:
+		p.block(s)
+	}
+}
+
+// endsWithBlock reports whether e is a statement of its own that needs no
+// semicolon after its closing brace.
+func endsWithBlock(e ast.Expression) bool {
+	switch e.(type) {
+	case *ast.IfExpression, *ast.TryExpression, *ast.MatchExpression:
+		return true
+	}
+	return false
+}
+
+func (p *printer) block(block *ast.BlockStatement) {
+	if len(block.Statements) == 0 && (len(p.comments) == 0 || !p.comments[0].Pos().Before(block.Rbrace.Pos())) {
+		p.write("{}")
+		return
+	}
+
+	p.write("{\n")
+	p.indent++
+	p.statementList(block.Statements, block.Rbrace.Pos())
+	p.indent--
+	p.writeIndent()
+	p.write("}")
+}
+
+// expression prints e, wrapping it in parentheses when its own precedence
+// is lower than the one required by its context.
+func (p *printer) expression(e ast.Expression, required int) {
+	if precedence(e) < required {
+		p.write("(")
+		defer p.write(")")
+	}
+
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.write(e.Value)
+	case *ast.IntegerLiteral, *ast.FloatLiteral:
+		p.write(e.TokenLiteral())
+	case *ast.StringLiteral:
+		p.write("\"" + e.Value + "\"")
+	case *ast.Boolean:
+		p.write(e.Token.Literal)
+	case *ast.PrefixExpression:
+		p.write(e.Operator)
+		if right, ok := e.Right.(*ast.PrefixExpression); ok && right.Operator == e.Operator {
+			p.expression(e.Right, atomic)
+		} else {
+			p.expression(e.Right, parser.PREFIX)
+		}
+	case *ast.InfixExpression:
+		own := precedence(e)
+		p.expression(e.Left, own)
+		p.write(" " + e.Operator + " ")
+		p.expression(e.Right, own+1)
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(e.Condition, parser.LOWEST)
+		p.write(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.write(" else ")
+			p.block(e.Alternative)
+		}
+	case *ast.TryExpression:
+		p.write("try ")
+		p.block(e.Block)
+		if e.Catch != nil {
+			p.write(" catch (" + e.Parameter.Value + ") ")
+			p.block(e.Catch)
+		}
+		if e.Finally != nil {
+			p.write(" finally ")
+			p.block(e.Finally)
+		}
+	case *ast.MatchExpression:
+		p.write("match ")
+		p.expression(e.Value, parser.LOWEST)
+		if len(e.Arms) == 0 {
+			p.write(" {}")
+			return
+		}
+		p.write(" {\n")
+		p.indent++
+		for _, arm := range e.Arms {
+			p.writeIndent()
+			p.pattern(arm.Pattern)
+			if arm.Guard != nil {
+				p.write(" if ")
+				p.expression(arm.Guard, parser.LOWEST)
+			}
+			p.write(" => ")
+			p.expression(arm.Body, parser.LOWEST)
+			p.write(",\n")
+		}
+		p.indent--
+		p.writeIndent()
+		p.write("}")
+	case *ast.FunctionLiteral:
+		p.write("fun(")
+		for i, param := range e.Parameters {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.pattern(param)
+			if t := e.ParameterType(i); t != nil {
+				p.write(": " + t.String())
+			}
+		}
+		p.write(")")
+		if e.ReturnType != nil {
+			p.write(": " + e.ReturnType.String())
+		}
+		p.write(" ")
+		p.block(e.Body)
+	case *ast.CallExpression:
+		p.expression(e.Function, parser.CALL)
+		p.write("(")
+		for i, arg := range e.Arguments {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(arg, parser.LOWEST)
+		}
+		p.write(")")
+	case *ast.ArrayLiteral:
+		p.write("[")
+		for i, element := range e.Elements {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(element, parser.LOWEST)
+		}
+		p.write("]")
+	case *ast.HashLiteral:
+		p.write("{")
+		for i, pair := range e.Pairs {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(pair.Key, parser.LOWEST)
+			p.write(": ")
+			p.expression(pair.Value, parser.LOWEST)
+		}
+		p.write("}")
+	case *ast.IndexExpression:
+		// calls and indexes chain left to right, so either may be the
+		// operand of the other without parentheses.
+		p.expression(e.Left, parser.CALL)
+		p.write("[")
+		p.expression(e.Index, parser.LOWEST)
+		p.write("]")
+	case *ast.MemberExpression:
+		p.expression(e.Left, parser.CALL)
+		p.write("." + e.Member.Value)
+	case *ast.PropagateExpression:
+		p.expression(e.Value, parser.CALL)
+		p.write("?")
+	}
+}
+
+func (p *printer) pattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.LiteralPattern:
+		p.expression(pattern.Value, parser.LOWEST)
+	case *ast.ArrayPattern:
+		p.write("[")
+		for i, element := range pattern.Elements {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.pattern(element)
+		}
+		if pattern.Rest != nil {
+			if len(pattern.Elements) > 0 {
+				p.write(", ")
+			}
+			p.write("..." + pattern.Rest.String())
+		}
+		p.write("]")
+	case *ast.HashPattern:
+		p.write("{")
+		for i, pair := range pattern.Pairs {
+			if i > 0 {
+				p.write(", ")
+			}
+			if pair.Shorthand() {
+				p.pattern(pair.Value)
+				continue
+			}
+			p.expression(pair.Key, parser.LOWEST)
+			p.write(": ")
+			p.pattern(pair.Value)
+		}
+		p.write("}")
+	default:
+		p.write(pattern.String())
+	}
+}
+
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(e.Token.Type)
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.CallExpression, *ast.IndexExpression, *ast.MemberExpression, *ast.PropagateExpression:
+		return parser.CALL
+	}
+	return atomic
+}
@@ -0,0 +1,118 @@
+package formatter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"turatti/lexer"
+	"turatti/parser"
+)
+
+func TestFormatIsIdempotent(t *testing.T) {
+	files, err := filepath.Glob("../test_files/*.trt")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("couldn't list test files")
+	}
+
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("couldn't read %s", file)
+		}
+
+		once, err := Source(src)
+		if err != nil {
+			t.Fatalf("%s: couldn't format: %v", file, err)
+		}
+		twice, err := Source(once)
+		if err != nil {
+			t.Fatalf("%s: couldn't format formatted output: %v\n%s", file, err, once)
+		}
+		if string(once) != string(twice) {
+			t.Errorf("%s: formatting is not idempotent.\nfirst pass:\n%s\nsecond pass:\n%s", file, once, twice)
+		}
+
+		original, _ := parseString(string(src))
+		formatted, _ := parseString(string(once))
+		if original != formatted {
+			t.Errorf("%s: formatting changed the program.\nexpected %s\ngot      %s", file, original, formatted)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"def z = 2*y;", "def z = 2 * y;\n"},
+		{"def v = (10 / 4) > 6;", "def v = 10 / 4 > 6;\n"},
+		{"a - (b - c);", "a - (b - c);\n"},
+		{"(a - b) - c;", "a - b - c;\n"},
+		{"(a + b) * c;", "(a + b) * c;\n"},
+		{"-(a + b);", "-(a + b);\n"},
+		{"-(-a);", "-(-a);\n"},
+		{"!-a;", "!-a;\n"},
+		{"(fun(x) { x; })(1)", "fun(x) {\n    x;\n}(1);\n"},
+		{"return;", "return;\n"},
+		{"def t = {\"a\":[1,2.5],\"b\" : {}};", "def t = {\"a\": [1, 2.5], \"b\": {}};\n"},
+		{"(t[\"a\"])[0] + (f(1))[2];", "t[\"a\"][0] + f(1)[2];\n"},
+		{"(-a)[0];", "(-a)[0];\n"},
+		{"def f = fun() {};", "def f = fun() {};\n"},
+		{"def x:int=5;", "def x: int = 5;\n"},
+		{"def f = fun(a:int,b){a}; ", "def f = fun(a: int, b) {\n    a;\n};\n"},
+		{"def g = fun( ) :{string:[int]} {};", "def g = fun(): {string: [int]} {};\n"},
+		{`import  "u.trt"  as  u ;`, "import \"u.trt\" as u;\n"},
+		{"export  def x=u . f(1).y;", "export def x = u.f(1).y;\n"},
+		{"(-a).b;", "(-a).b;\n"},
+		{"throw  {\"kind\":k} ;", "throw {\"kind\": k};\n"},
+		{
+			"def x = try{f()}catch(e){0}finally{g()}",
+			"def x = try {\n    f();\n} catch (e) {\n    0;\n} finally {\n    g();\n};\n",
+		},
+		{"try { f() } finally { g() }", "try {\n    f();\n} finally {\n    g();\n}\n"},
+		{
+			"def y = match x{-1=>a,[h,...t] if h>0=>fun(){h},{\"k\":[_]}=>b}",
+			"def y = match x {\n    -1 => a,\n    [h, ...t] if h > 0 => fun() {\n        h;\n    },\n    {\"k\": [_]} => b,\n};\n",
+		},
+		{"match  x { [ ..._ ] => 1 , }", "match x {\n    [..._] => 1,\n}\n"},
+		{"def [ a,b , ...c ]=xs;", "def [a, b, ...c] = xs;\n"},
+		{"def {name , \"age\" : years}:{string:int} = p;", "def {name, \"age\": years}: {string: int} = p;\n"},
+		{"fun([x,y],{z}:{string:int}){x}", "fun([x, y], {z}: {string: int}) {\n    x;\n};\n"},
+		{"fun(){ (-a)? + b ? [0] . c? }", "fun() {\n    (-a)? + b?[0].c?;\n};\n"},
+		{
+			"if (a) { return 1; } else { return 2; }",
+			"if (a) {\n    return 1;\n} else {\n    return 2;\n}\n",
+		},
+		{
+			"def a = 1;\n\n\n\ndef b = 2;",
+			"def a = 1;\n\ndef b = 2;\n",
+		},
+		{
+			"// leading\ndef a = 1;   // trailing   \ndef f = fun() {\n// inner\n};\n// last",
+			"// leading\ndef a = 1; // trailing\ndef f = fun() {\n    // inner\n};\n// last\n",
+		},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Fatalf("couldn't format %q: %v", tt.input, err)
+		}
+		if string(formatted) != tt.expected {
+			t.Errorf("formatting %q.\nexpected %q\ngot      %q", tt.input, tt.expected, formatted)
+		}
+	}
+}
+
+func TestSourceReportsSyntaxErrors(t *testing.T) {
+	if _, err := Source([]byte("def = 5;")); err == nil {
+		t.Errorf("expected an error for invalid source")
+	}
+}
+
+func parseString(input string) (string, []string) {
+	psr := parser.New(lexer.New(input))
+	program := psr.Parse()
+	return program.String(), psr.Errors()
+}
@@ -0,0 +1,208 @@
+// Package highlight classifies the tokens of Turatti source into
+// categories and renders the source with colors, for terminals or as
+// HTML. It also generates a TextMate grammar from the same tables, for
+// editors to color programs like the lexer reads them.
+package highlight
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"turatti/lexer"
+	"turatti/token"
+)
+
+type Category int
+
+const (
+	// Plain is the text between tokens, which is whitespace in valid
+	// programs.
+	Plain Category = iota
+	Keyword
+	Identifier
+	Number
+	String
+	Operator
+	Punctuation
+	Comment
+	// Illegal is text the lexer does not accept.
+	Illegal
+)
+
+var categoryNames = [...]string{
+	Plain:       "plain",
+	Keyword:     "keyword",
+	Identifier:  "identifier",
+	Number:      "number",
+	String:      "string",
+	Operator:    "operator",
+	Punctuation: "punctuation",
+	Comment:     "comment",
+	Illegal:     "illegal",
+}
+
+func (c Category) String() string {
+	if c < 0 || int(c) >= len(categoryNames) {
+		return fmt.Sprintf("Category(%d)", int(c))
+	}
+	return categoryNames[c]
+}
+
+var operators = []token.TokenType{
+	token.ASSIGN, token.PLUS, token.MINUS, token.BANG, token.ASTERISK, token.SLASH,
+	token.EQ, token.NOT_EQ, token.LESSTHAN, token.GREATERTHAN, token.LESSEQTHAN, token.GREATEREQTHAN,
+	token.PLUS_EQ, token.MINUS_EQ, token.ASTERISK_EQ, token.SLASH_EQ, token.INCREMENT, token.DECREMENT,
+	token.QUESTION, token.ARROW, token.ELLIPSIS,
+}
+
+var punctuation = []token.TokenType{
+	token.COMMA, token.SEMICOLON, token.COLON, token.DOT,
+	token.LPAREN, token.RPAREN, token.LBRACE, token.RBRACE, token.LBRACKET, token.RBRACKET,
+}
+
+// Classify returns the category of tok.
+func Classify(tok token.Token) Category {
+	switch tok.Type {
+	case token.IDENT:
+		return Identifier
+	case token.INT, token.FLOAT:
+		return Number
+	case token.STRING:
+		return String
+	case token.COMMENT:
+		return Comment
+	case token.ILLEGAL, token.EOF:
+		return Illegal
+	}
+	if token.FindKeywordOrIdent(tok.Literal) == tok.Type {
+		return Keyword
+	}
+	for _, t := range punctuation {
+		if tok.Type == t {
+			return Punctuation
+		}
+	}
+	for _, t := range operators {
+		if tok.Type == t {
+			return Operator
+		}
+	}
+	return Illegal
+}
+
+// Span is a piece of source text in a single category.
+type Span struct {
+	Category Category
+	Text     string
+}
+
+// Spans splits src into one span per token and one per stretch of text
+// between tokens. The spans hold all of src, in order.
+func Spans(src string) []Span {
+	runes := []rune(src)
+	lineStarts := []int{0}
+	for i, r := range runes {
+		if r == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	offset := func(pos token.Position) int {
+		if pos.Line < 1 || pos.Line > len(lineStarts) {
+			return len(runes)
+		}
+		offset := lineStarts[pos.Line-1] + pos.Column - 1
+		if offset > len(runes) {
+			return len(runes)
+		}
+		return offset
+	}
+
+	spans := []Span{}
+	add := func(category Category, from, to int) {
+		if from < to {
+			spans = append(spans, Span{Category: category, Text: string(runes[from:to])})
+		}
+	}
+	done := 0
+	lex := lexer.New(src)
+	for tok := lex.NextToken(); tok.Type != token.EOF; tok = lex.NextToken() {
+		start, end := offset(tok.Pos()), offset(tok.End())
+		if start < done {
+			start = done
+		}
+		add(Plain, done, start)
+		add(Classify(tok), start, end)
+		if end > done {
+			done = end
+		}
+	}
+	add(Plain, done, len(runes))
+	return spans
+}
+
+var ansiColors = map[Category]string{
+	Keyword:  "\x1b[35m",
+	Number:   "\x1b[36m",
+	String:   "\x1b[32m",
+	Operator: "\x1b[33m",
+	Comment:  "\x1b[90m",
+	Illegal:  "\x1b[31;4m",
+}
+
+// ANSI returns src colored with terminal escape sequences.
+func ANSI(src string) string {
+	var out strings.Builder
+	for _, span := range Spans(src) {
+		color, ok := ansiColors[span.Category]
+		if !ok {
+			out.WriteString(span.Text)
+			continue
+		}
+		out.WriteString(color + span.Text + "\x1b[0m")
+	}
+	return out.String()
+}
+
+// HTML returns src as a pre element, with each token in a span whose class
+// is its category prefixed by "tr-".
+func HTML(src string) string {
+	var out strings.Builder
+	out.WriteString(`<pre class="turatti">`)
+	for _, span := range Spans(src) {
+		text := html.EscapeString(span.Text)
+		if span.Category == Plain {
+			out.WriteString(text)
+			continue
+		}
+		fmt.Fprintf(&out, `<span class="tr-%s">%s</span>`, span.Category, text)
+	}
+	out.WriteString("</pre>\n")
+	return out.String()
+}
+
+const stylesheet = `body { margin: 0; background: #fafafa; }
+pre.turatti { margin: 0; padding: 1em 1.5em; font: 14px/1.5 monospace; color: #24292e; }
+.tr-keyword { color: #8250df; font-weight: bold; }
+.tr-number { color: #0550ae; }
+.tr-string { color: #0a3069; }
+.tr-operator { color: #953800; }
+.tr-punctuation { color: #57606a; }
+.tr-comment { color: #6e7781; font-style: italic; }
+.tr-illegal { color: #cf222e; text-decoration: underline wavy; }
+`
+
+// Page returns a standalone HTML document showing src under title.
+func Page(title, src string) string {
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+%s</style>
+</head>
+<body>
+%s</body>
+</html>
+`, html.EscapeString(title), stylesheet, HTML(src))
+}
@@ -0,0 +1,156 @@
+package highlight
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"turatti/lexer"
+	"turatti/token"
+)
+
+func TestClassify(t *testing.T) {
+	input := `def f = fun(x) { if (x >= 1.5) { return "s"; } else { !true } }; // done
+f[0] @`
+	expected := []Category{
+		Keyword, Identifier, Operator, Keyword, Punctuation, Identifier, Punctuation, Punctuation,
+		Keyword, Punctuation, Identifier, Operator, Number, Punctuation, Punctuation,
+		Keyword, String, Punctuation, Punctuation, Keyword, Punctuation, Operator, Keyword, Punctuation,
+		Punctuation, Punctuation, Comment,
+		Identifier, Punctuation, Number, Punctuation, Illegal,
+	}
+
+	lex := lexer.New(input)
+	i := 0
+	for tok := lex.NextToken(); tok.Type != token.EOF; tok = lex.NextToken() {
+		if i >= len(expected) {
+			t.Fatalf("unexpected token %q", tok.Literal)
+		}
+		if got := Classify(tok); got != expected[i] {
+			t.Errorf("token %d %q: expected %s, got %s", i, tok.Literal, expected[i], got)
+		}
+		i++
+	}
+	if i != len(expected) {
+		t.Errorf("expected %d tokens, got %d", len(expected), i)
+	}
+
+	for _, keyword := range token.Keywords() {
+		tok := token.Token{Type: token.FindKeywordOrIdent(keyword), Literal: keyword}
+		if Classify(tok) != Keyword {
+			t.Errorf("expected %s to be a keyword", keyword)
+		}
+	}
+}
+
+func TestSpansCoverSource(t *testing.T) {
+	inputs := []string{
+		"",
+		"def x = 1;\n\n\tx\n",
+		"def é = \"héllo\nwörld\"; é",
+		"x + \"unterminated\n",
+		"a\r\nb",
+		"// only a comment",
+		"1.5.2 ... 3",
+		"x\x00y",
+	}
+	for _, input := range inputs {
+		text := ""
+		for _, span := range Spans(input) {
+			text += span.Text
+		}
+		if text != input {
+			t.Errorf("spans of %q add up to %q", input, text)
+		}
+	}
+
+	spans := Spans("if (x) {\n  \"a\nb\" // c\n}")
+	expected := []Span{
+		{Keyword, "if"}, {Plain, " "}, {Punctuation, "("}, {Identifier, "x"}, {Punctuation, ")"},
+		{Plain, " "}, {Punctuation, "{"}, {Plain, "\n  "}, {String, "\"a\nb\""}, {Plain, " "},
+		{Comment, "// c"}, {Plain, "\n"}, {Punctuation, "}"},
+	}
+	if len(spans) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, spans)
+	}
+	for i := range spans {
+		if spans[i] != expected[i] {
+			t.Errorf("span %d: expected %v, got %v", i, expected[i], spans[i])
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	src := `def s = "<b>" + 1; // & more`
+
+	expectedANSI := "\x1b[35mdef\x1b[0m s \x1b[33m=\x1b[0m \x1b[32m\"<b>\"\x1b[0m \x1b[33m+\x1b[0m \x1b[36m1\x1b[0m; \x1b[90m// & more\x1b[0m"
+	if got := ANSI(src); got != expectedANSI {
+		t.Errorf("expected ANSI %q, got %q", expectedANSI, got)
+	}
+
+	expectedHTML := `<pre class="turatti"><span class="tr-keyword">def</span> <span class="tr-identifier">s</span> ` +
+		`<span class="tr-operator">=</span> <span class="tr-string">&#34;&lt;b&gt;&#34;</span> ` +
+		`<span class="tr-operator">+</span> <span class="tr-number">1</span><span class="tr-punctuation">;</span> ` +
+		`<span class="tr-comment">// &amp; more</span></pre>` + "\n"
+	if got := HTML(src); got != expectedHTML {
+		t.Errorf("expected HTML\n%s\ngot\n%s", expectedHTML, got)
+	}
+
+	page := Page("a<b>.trt", src)
+	for _, part := range []string{"<!DOCTYPE html>", `<meta charset="utf-8">`, "<title>a&lt;b&gt;.trt</title>", ".tr-keyword {", expectedHTML} {
+		if !strings.Contains(page, part) {
+			t.Errorf("expected the page to contain %q", part)
+		}
+	}
+}
+
+// TestTextMateGrammar checks the generated grammar against the lexer and
+// the copy editors use. After changing the lexer, regenerate it with
+//
+//	turatti highlight --textmate > highlight/turatti.tmLanguage.json
+func TestTextMateGrammar(t *testing.T) {
+	var g grammar
+	if err := json.Unmarshal(TextMate(), &g); err != nil {
+		t.Fatalf("invalid grammar: %v", err)
+	}
+
+	// Go regexps have no lookarounds, so whole-word keyword matches are
+	// checked through their alternatives.
+	scopes := map[string]*regexp.Regexp{}
+	for _, rule := range g.Patterns {
+		if rule.Match != "" {
+			pattern := strings.NewReplacer("(?<![A-Za-z_])", "", "(?![A-Za-z_])", "").Replace(rule.Match)
+			scopes[rule.Name] = regexp.MustCompile("^(" + pattern + ")$")
+		}
+	}
+	expected := map[Category]string{
+		Keyword:     "keyword.other.turatti",
+		Identifier:  "variable.other.turatti",
+		Number:      "constant.numeric.turatti",
+		Operator:    "keyword.operator.turatti",
+		Punctuation: "punctuation.turatti",
+		Comment:     "comment.line.double-slash.turatti",
+	}
+	lex := lexer.New(`def f = fun(a, b) { if (a <= b) { return [a, 1.5]; } else { a += {"k": b}; !false != true } } // x`)
+	for tok := lex.NextToken(); tok.Type != token.EOF; tok = lex.NextToken() {
+		scope := expected[Classify(tok)]
+		if tok.Type == token.TRUE || tok.Type == token.FALSE {
+			scope = "constant.language.boolean.turatti"
+		}
+		if scope == "" {
+			continue
+		}
+		if re, ok := scopes[scope]; !ok || !re.MatchString(tok.Literal) {
+			t.Errorf("expected %s to match %q", scope, tok.Literal)
+		}
+	}
+
+	checkedIn, err := os.ReadFile("turatti.tmLanguage.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(checkedIn) != string(TextMate()) {
+		t.Errorf("turatti.tmLanguage.json is out of date")
+	}
+}
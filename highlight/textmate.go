@@ -0,0 +1,85 @@
+package highlight
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"turatti/token"
+)
+
+type grammarRule struct {
+	Name  string `json:"name"`
+	Match string `json:"match,omitempty"`
+	Begin string `json:"begin,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+type grammar struct {
+	Name      string        `json:"name"`
+	ScopeName string        `json:"scopeName"`
+	FileTypes []string      `json:"fileTypes"`
+	Patterns  []grammarRule `json:"patterns"`
+}
+
+// TextMate returns a TextMate grammar for Turatti in JSON. Keywords,
+// operators and punctuation come from the tables the lexer and Classify
+// use, so the grammar must be regenerated whenever those change.
+func TextMate() []byte {
+	var keywords, constants []string
+	for _, keyword := range token.Keywords() {
+		switch token.FindKeywordOrIdent(keyword) {
+		case token.TRUE, token.FALSE:
+			constants = append(constants, keyword)
+		default:
+			keywords = append(keywords, keyword)
+		}
+	}
+
+	g := grammar{
+		Name:      "Turatti",
+		ScopeName: "source.turatti",
+		FileTypes: []string{"trt"},
+		Patterns: []grammarRule{
+			{Name: "comment.line.double-slash.turatti", Match: `//.*$`},
+			{Name: "string.quoted.double.turatti", Begin: `"`, End: `"`},
+			{Name: "constant.numeric.turatti", Match: `[0-9]+(\.[0-9]+)?`},
+			{Name: "constant.language.boolean.turatti", Match: words(constants)},
+			{Name: "keyword.other.turatti", Match: words(keywords)},
+			{Name: "variable.other.turatti", Match: `[A-Za-z_]+`},
+			{Name: "keyword.operator.turatti", Match: alternatives(operators)},
+			{Name: "punctuation.turatti", Match: alternatives(punctuation)},
+		},
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(g); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// words matches any of list as a whole word. Digits do not continue words
+// in Turatti, so \b will not do.
+func words(list []string) string {
+	return `(?<![A-Za-z_])(` + strings.Join(list, "|") + `)(?![A-Za-z_])`
+}
+
+// alternatives matches any of types, longest first so that == is not
+// read as two =.
+func alternatives(types []token.TokenType) string {
+	literals := []string{}
+	for _, t := range types {
+		literals = append(literals, string(t))
+	}
+	sort.SliceStable(literals, func(i, j int) bool {
+		return len(literals[i]) > len(literals[j])
+	})
+	for i, literal := range literals {
+		literals[i] = regexp.QuoteMeta(literal)
+	}
+	return strings.Join(literals, "|")
+}
@@ -0,0 +1,211 @@
+// Package turatti embeds the Turatti language in Go programs.
+//
+//	interp, err := turatti.NewInterpreter(turatti.Options{})
+//	...
+//	interp.Set("limit", 10)
+//	result, err := interp.Eval(ctx, "limit * 2")
+package turatti
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"turatti/ast"
+	"turatti/evaluator"
+	"turatti/lexer"
+	"turatti/modules"
+	"turatti/object"
+	"turatti/parser"
+)
+
+type Options struct {
+	// Globals are converted with the same rules as Set and bound before
+	// any script runs.
+	Globals map[string]any
+	// Stdout receives the output of the print builtins; nil means
+	// os.Stdout.
+	Stdout io.Writer
+	// AllowShadowing lets scripts rebind builtin names with def.
+	AllowShadowing bool
+	// SearchPath lists the directories searched for imported modules not
+	// found next to the importing script.
+	SearchPath []string
+}
+
+// Interpreter runs Turatti programs against a global environment that
+// persists across calls. It is not safe for concurrent use.
+type Interpreter struct {
+	env     *object.Environment
+	modules *modules.Loader
+}
+
+func NewInterpreter(opts Options) (*Interpreter, error) {
+	evalOpts := evaluator.Options{
+		Stdout:         opts.Stdout,
+		AllowShadowing: opts.AllowShadowing,
+	}
+	interp := &Interpreter{
+		env:     evaluator.NewGlobalEnvironment(evalOpts),
+		modules: modules.NewLoader(opts.SearchPath, evalOpts),
+	}
+	for name, value := range opts.Globals {
+		if err := interp.Set(name, value); err != nil {
+			return nil, fmt.Errorf("turatti: global %s: %w", name, err)
+		}
+	}
+	return interp, nil
+}
+
+// SyntaxError lists every problem the parser found in a program.
+type SyntaxError struct {
+	Errors []string
+}
+
+func (e *SyntaxError) Error() string {
+	return strings.Join(e.Errors, "\n")
+}
+
+// RuntimeError is an error raised while a program was running.
+type RuntimeError struct {
+	Message string
+	// Kind classifies the error, such as TypeError or IndexError.
+	Kind   string
+	Line   int
+	Column int
+	// Frames lists the calls the error propagated out of, innermost first.
+	Frames []Frame
+
+	err *object.Error
+}
+
+// Frame is a call in progress when a runtime error was raised.
+type Frame struct {
+	Function string
+	File     string
+	Line     int
+	Column   int
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%d:%d: runtime error: %s", e.Line, e.Column, e.Message)
+	}
+	return "runtime error: " + e.Message
+}
+
+// Traceback formats the error like Python does, optionally with the
+// arguments of every call.
+func (e *RuntimeError) Traceback(args bool) string {
+	return e.err.Traceback(args)
+}
+
+// Eval runs src and returns the value of its last statement converted to
+// Go, as described in FromObject.
+func (i *Interpreter) Eval(ctx context.Context, src string) (any, error) {
+	return i.run(ctx, "eval", "-", src)
+}
+
+// RunFile runs the .trt file at path.
+func (i *Interpreter) RunFile(path string) (any, error) {
+	if !strings.HasSuffix(path, ".trt") {
+		return nil, fmt.Errorf("turatti: %s is not a .trt file", path)
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return i.run(context.Background(), path, path, string(src))
+}
+
+// run runs src, resolving its imports from file.
+func (i *Interpreter) run(ctx context.Context, name, file, src string) (any, error) {
+	program, err := parse(name, src)
+	if err != nil {
+		return nil, err
+	}
+	i.env.SetImporter(i.modules.Importer(file))
+	i.env.SetFile(name)
+	return i.result(evaluator.EvalContext(ctx, program, i.env))
+}
+
+func parse(name, src string) (*ast.Program, error) {
+	lex := lexer.New(src)
+	lex.FileName = name
+	p := parser.New(lex)
+	program := p.Parse()
+	if len(p.Errors()) > 0 {
+		return nil, &SyntaxError{Errors: p.Errors()}
+	}
+	return program, nil
+}
+
+// Set binds name in the global environment to value converted with
+// ToObject.
+func (i *Interpreter) Set(name string, value any) error {
+	if value != nil && reflect.TypeOf(value).Kind() == reflect.Func {
+		return i.Register(name, value)
+	}
+	obj, err := ToObject(value)
+	if err != nil {
+		return err
+	}
+	i.env.Set(name, obj)
+	return nil
+}
+
+// Get returns the global bound to name converted with FromObject.
+func (i *Interpreter) Get(name string) (any, bool) {
+	obj, ok := i.env.Get(name)
+	if !ok {
+		return nil, false
+	}
+	return FromObject(obj), true
+}
+
+// Call calls the global function named fnName with args converted with
+// ToObject.
+func (i *Interpreter) Call(fnName string, args ...any) (any, error) {
+	return i.CallContext(context.Background(), fnName, args...)
+}
+
+func (i *Interpreter) CallContext(ctx context.Context, fnName string, args ...any) (any, error) {
+	fn, ok := i.env.Get(fnName)
+	if !ok {
+		return nil, fmt.Errorf("turatti: %s is not defined", fnName)
+	}
+
+	objects := make([]object.Object, 0, len(args))
+	for n, arg := range args {
+		obj, err := ToObject(arg)
+		if err != nil {
+			return nil, fmt.Errorf("turatti: argument %d of %s: %w", n, fnName, err)
+		}
+		objects = append(objects, obj)
+	}
+	return i.result(evaluator.ApplyFunction(ctx, fn, objects))
+}
+
+func (i *Interpreter) result(obj object.Object) (any, error) {
+	if err, ok := obj.(*object.Error); ok {
+		runtimeErr := &RuntimeError{
+			Message: err.Message,
+			Kind:    string(object.KindOf(err)),
+			Line:    err.Pos.Line,
+			Column:  err.Pos.Column,
+			err:     err,
+		}
+		for _, frame := range err.Frames {
+			runtimeErr.Frames = append(runtimeErr.Frames, Frame{
+				Function: frame.Function,
+				File:     frame.File,
+				Line:     frame.Pos.Line,
+				Column:   frame.Pos.Column,
+			})
+		}
+		return nil, runtimeErr
+	}
+	return FromObject(obj), nil
+}
@@ -0,0 +1,186 @@
+package turatti
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+	"turatti/object"
+)
+
+func newInterpreter(t *testing.T, opts Options) *Interpreter {
+	interp, err := NewInterpreter(opts)
+	if err != nil {
+		t.Fatalf("couldn't create interpreter: %v", err)
+	}
+	return interp
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"1 + 2", int64(3)},
+		{"\"a\" + \"b\"", "ab"},
+		{"1 < 2", true},
+		{"if (false) { 1 }", nil},
+		{"limit * 2", int64(20)},
+		{"names", []any{"ana", "bia"}},
+		{`cfg["port"] + len(cfg["hosts"])`, int64(82)},
+	}
+
+	interp := newInterpreter(t, Options{Globals: map[string]any{
+		"limit": 10,
+		"names": []string{"ana", "bia"},
+		"cfg":   map[string]any{"port": 80, "hosts": []string{"a", "b"}},
+	}})
+	for _, tt := range tests {
+		got, err := interp.Eval(context.Background(), tt.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q: expected %#v, got %#v", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestEnvironmentPersists(t *testing.T) {
+	interp := newInterpreter(t, Options{})
+	if _, err := interp.Eval(context.Background(), "def double = fun(x) { x * 2 }; def seven = 7;"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if value, ok := interp.Get("seven"); !ok || value != int64(7) {
+		t.Errorf("expected seven to be 7, got %v (%t)", value, ok)
+	}
+	if _, ok := interp.Get("missing"); ok {
+		t.Errorf("expected missing to be undefined")
+	}
+
+	got, err := interp.Call("double", 21)
+	if err != nil || got != int64(42) {
+		t.Errorf("expected double(21) to be 42, got %v (%v)", got, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	interp := newInterpreter(t, Options{})
+
+	_, err := interp.Eval(context.Background(), "def = 1;")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) || len(syntaxErr.Errors) != 1 {
+		t.Errorf("expected a syntax error, got %v", err)
+	}
+
+	_, err = interp.Eval(context.Background(), "\n  1 + true")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected a runtime error, got %v", err)
+	}
+	if runtimeErr.Line != 2 || runtimeErr.Column != 3 || runtimeErr.Message != "type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("unexpected runtime error %+v", runtimeErr)
+	}
+
+	_, err = interp.Eval(context.Background(), "def f = fun(xs) { xs[2] };\nf([1]);")
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected a runtime error, got %v", err)
+	}
+	expected := []Frame{{"f", "eval", 1, 19}, {"<main>", "eval", 2, 1}}
+	if runtimeErr.Kind != "IndexError" || !reflect.DeepEqual(runtimeErr.Frames, expected) {
+		t.Errorf("expected an IndexError in frames %v, got %s in %v", expected, runtimeErr.Kind, runtimeErr.Frames)
+	}
+
+	_, err = interp.Eval(context.Background(), "def forever = fun(n) { forever(n + 1) };\nforever(0);")
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected a runtime error, got %v", err)
+	}
+	if runtimeErr.Kind != "RuntimeError" || runtimeErr.Message != "stack overflow" || len(runtimeErr.Frames) != object.MaxFrames {
+		t.Errorf("expected a stack overflow %d frames deep, got %s: %s in %d frames",
+			object.MaxFrames, runtimeErr.Kind, runtimeErr.Message, len(runtimeErr.Frames))
+	}
+
+	if _, err := interp.Call("nope"); err == nil {
+		t.Errorf("expected calling an undefined function to fail")
+	}
+	if _, err := interp.Eval(context.Background(), "def x = 1;"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := interp.Call("x"); err == nil || err.Error() != "runtime error: not a function: INTEGER" {
+		t.Errorf("expected calling an integer to fail, got %v", err)
+	}
+	if err := interp.Set("ch", make(chan int)); err == nil {
+		t.Errorf("expected channels to be rejected")
+	}
+	if _, err := NewInterpreter(Options{Globals: map[string]any{"s": struct{}{}}}); err == nil {
+		t.Errorf("expected unsupported globals to be rejected")
+	}
+}
+
+func TestEvalHonoursContext(t *testing.T) {
+	interp := newInterpreter(t, Options{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := interp.Eval(ctx, "def fib = fun(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(40);")
+	if err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Fatalf("expected evaluation to stop at the deadline, got %v", err)
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.trt")
+	if err := os.WriteFile(path, []byte("def greeting = \"hi\";\ngreeting + \"!\";\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	interp := newInterpreter(t, Options{})
+	got, err := interp.RunFile(path)
+	if err != nil || got != "hi!" {
+		t.Errorf("expected hi!, got %v (%v)", got, err)
+	}
+	if _, err := interp.RunFile("script.txt"); err == nil {
+		t.Errorf("expected non .trt files to be rejected")
+	}
+}
+
+func TestConversions(t *testing.T) {
+	tests := []any{nil, true, false, int64(-3), "text", []any{int64(1), "two", []any{true}},
+		map[any]any{"a": int64(1), int64(2): []any{true}, false: map[any]any{}}}
+	for _, value := range tests {
+		obj, err := ToObject(value)
+		if err != nil {
+			t.Errorf("%#v: unexpected error %v", value, err)
+			continue
+		}
+		if back := FromObject(obj); !reflect.DeepEqual(back, value) {
+			t.Errorf("expected %#v to round trip, got %#v", value, back)
+		}
+	}
+
+	if obj, err := ToObject(uint8(200)); err != nil || FromObject(obj) != int64(200) {
+		t.Errorf("expected uint8 to convert to an integer, got %v (%v)", obj, err)
+	}
+	if _, err := ToObject(uint64(1 << 63)); err == nil {
+		t.Errorf("expected overflowing unsigned integers to be rejected")
+	}
+	if obj, err := ToObject(map[string]int{"b": 2, "a": 1}); err != nil || obj.Inspect() != "{a: 1, b: 2}" {
+		t.Errorf("expected maps to convert to hashes ordered by key, got %v (%v)", obj, err)
+	}
+	if obj, err := ToObject(map[int]int{9: 1, 10: 2, -1: 3, 1<<53 + 1: 4, 1 << 53: 5}); err != nil ||
+		obj.Inspect() != "{-1: 3, 9: 1, 10: 2, 9007199254740992: 5, 9007199254740993: 4}" {
+		t.Errorf("expected integer keys to be ordered numerically, got %v (%v)", obj, err)
+	}
+	mixed := map[any]int{"b": 1, "a": 2, int64(10): 3, 2.5: 4, int64(2): 5, true: 6, false: 7}
+	if obj, err := ToObject(mixed); err != nil || obj.Inspect() != "{false: 7, true: 6, 2: 5, 2.5: 4, 10: 3, a: 2, b: 1}" {
+		t.Errorf("expected keys to be grouped by type, got %v (%v)", obj, err)
+	}
+	if _, err := ToObject(map[[1]int]int{{1}: 1}); err == nil || err.Error() != "turatti: unusable as hash key: ARRAY" {
+		t.Errorf("expected unhashable keys to be rejected, got %v", err)
+	}
+}
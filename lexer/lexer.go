@@ -13,14 +13,14 @@ type Lexer struct {
 	CurrentLine   int
 	CurrentColumn int
 	currentRune   rune
-	input         string
+	input         []rune
 	FileName      string
 	fileBased     bool
 }
 
 func New(input string) *Lexer {
 	lexer := &Lexer{
-		input:         input,
+		input:         []rune(input),
 		fileBased:     false,
 		FileName:      "repl",
 		CurrentColumn: 0,
@@ -36,7 +36,7 @@ func FromFile(file *os.File) *Lexer {
 	}
 	if result, err := io.ReadAll(file); err == nil {
 		lexer := &Lexer{
-			input:         string(result),
+			input:         []rune(string(result)),
 			FileName:      file.Name(),
 			position:      -1,
 			readPosition:  0,
@@ -54,14 +54,14 @@ func (lexer *Lexer) getRuneAt(pos int) rune {
 	if pos >= int(len(lexer.input)) {
 		return 0
 	}
-	return []rune(lexer.input)[pos]
+	return lexer.input[pos]
 }
 
 func (lexer *Lexer) readRune() {
 	if lexer.readPosition >= len(lexer.input) {
 		lexer.currentRune = 0
 	} else {
-		lexer.currentRune = []rune(lexer.input)[lexer.readPosition]
+		lexer.currentRune = lexer.input[lexer.readPosition]
 	}
 	lexer.position = lexer.readPosition
 	lexer.readPosition++
@@ -72,110 +72,142 @@ func (lexer *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	lexer.eatWhitespace()
+	line, column := lexer.CurrentLine, lexer.CurrentColumn
 
 	switch lexer.currentRune {
 	case '=':
 		if lexer.peekChar() == '=' {
 			current := lexer.currentRune
 			lexer.readRune()
-			tok = token.NewComposableToken(token.EQ, current, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+			tok = token.NewComposableToken(token.EQ, current, lexer.currentRune, line, column)
+		} else if lexer.peekChar() == '>' {
+			current := lexer.currentRune
+			lexer.readRune()
+			tok = token.NewComposableToken(token.ARROW, current, lexer.currentRune, line, column)
 		} else {
-			tok = token.NewToken(token.ASSIGN, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+			tok = token.NewToken(token.ASSIGN, lexer.currentRune, line, column)
 		}
 	case ';':
-		tok = token.NewToken(token.SEMICOLON, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+		tok = token.NewToken(token.SEMICOLON, lexer.currentRune, line, column)
 	case '(':
-		tok = token.NewToken(token.LPAREN, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+		tok = token.NewToken(token.LPAREN, lexer.currentRune, line, column)
 	case ')':
-		tok = token.NewToken(token.RPAREN, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+		tok = token.NewToken(token.RPAREN, lexer.currentRune, line, column)
 	case ',':
-		tok = token.NewToken(token.COMMA, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+		tok = token.NewToken(token.COMMA, lexer.currentRune, line, column)
 	case '+':
 		if lexer.peekChar() == '=' {
 			current := lexer.currentRune
 			lexer.readRune()
-			tok = token.NewComposableToken(token.PLUS_EQ, current, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+			tok = token.NewComposableToken(token.PLUS_EQ, current, lexer.currentRune, line, column)
 		} else {
-			tok = token.NewToken(token.PLUS, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+			tok = token.NewToken(token.PLUS, lexer.currentRune, line, column)
 		}
 	case '"':
-		tok.Literal = lexer.readString()
-		tok.Type = token.STRING
-		tok.Column = lexer.CurrentColumn
-		tok.Line = lexer.CurrentLine
+		literal, terminated := lexer.readString()
+		if terminated {
+			tok.Literal = literal
+			tok.Type = token.STRING
+		} else {
+			tok.Literal = "\"" + literal
+			tok.Type = token.ILLEGAL
+		}
+		tok.Column = column
+		tok.Line = line
 		return tok
+	case ':':
+		tok = token.NewToken(token.COLON, lexer.currentRune, line, column)
+	case '.':
+		if lexer.peekChar() == '.' && lexer.getRuneAt(lexer.readPosition+1) == '.' {
+			lexer.readRune()
+			lexer.readRune()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "...", Line: line, Column: column}
+		} else {
+			tok = token.NewToken(token.DOT, lexer.currentRune, line, column)
+		}
+	case '?':
+		tok = token.NewToken(token.QUESTION, lexer.currentRune, line, column)
+	case '[':
+		tok = token.NewToken(token.LBRACKET, lexer.currentRune, line, column)
+	case ']':
+		tok = token.NewToken(token.RBRACKET, lexer.currentRune, line, column)
 	case '{':
-		tok = token.NewToken(token.LBRACE, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+		tok = token.NewToken(token.LBRACE, lexer.currentRune, line, column)
 	case '}':
-		tok = token.NewToken(token.RBRACE, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+		tok = token.NewToken(token.RBRACE, lexer.currentRune, line, column)
 	case '*':
 		if lexer.peekChar() == '=' {
 			current := lexer.currentRune
 			lexer.readRune()
-			tok = token.NewComposableToken(token.ASTERISK_EQ, current, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+			tok = token.NewComposableToken(token.ASTERISK_EQ, current, lexer.currentRune, line, column)
 		} else {
-			tok = token.NewToken(token.ASTERISK, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+			tok = token.NewToken(token.ASTERISK, lexer.currentRune, line, column)
 		}
 	case '<':
 		if lexer.peekChar() == '=' {
 			current := lexer.currentRune
 			lexer.readRune()
-			tok = token.NewComposableToken(token.LESSEQTHAN, current, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+			tok = token.NewComposableToken(token.LESSEQTHAN, current, lexer.currentRune, line, column)
 		} else {
-			tok = token.NewToken(token.LESSTHAN, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+			tok = token.NewToken(token.LESSTHAN, lexer.currentRune, line, column)
 		}
 	case '>':
 		if lexer.peekChar() == '=' {
 			current := lexer.currentRune
 			lexer.readRune()
-			tok = token.NewComposableToken(token.GREATEREQTHAN, current, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+			tok = token.NewComposableToken(token.GREATEREQTHAN, current, lexer.currentRune, line, column)
 		} else {
-			tok = token.NewToken(token.GREATERTHAN, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+			tok = token.NewToken(token.GREATERTHAN, lexer.currentRune, line, column)
 		}
 	case '-':
 		if lexer.peekChar() == '=' {
 			current := lexer.currentRune
 			lexer.readRune()
-			tok = token.NewComposableToken(token.MINUS_EQ, current, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+			tok = token.NewComposableToken(token.MINUS_EQ, current, lexer.currentRune, line, column)
 		} else {
-			tok = token.NewToken(token.MINUS, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+			tok = token.NewToken(token.MINUS, lexer.currentRune, line, column)
 		}
 	case '/':
-		if lexer.peekChar() == '=' {
+		if lexer.peekChar() == '/' {
+			tok.Literal = lexer.readComment()
+			tok.Type = token.COMMENT
+			tok.Column = column
+			tok.Line = line
+			return tok
+		} else if lexer.peekChar() == '=' {
 			current := lexer.currentRune
 			lexer.readRune()
-			tok = token.NewComposableToken(token.SLASH_EQ, current, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+			tok = token.NewComposableToken(token.SLASH_EQ, current, lexer.currentRune, line, column)
 		} else {
-			tok = token.NewToken(token.SLASH, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+			tok = token.NewToken(token.SLASH, lexer.currentRune, line, column)
 		}
 	case '!':
 		if lexer.peekChar() == '=' {
 			current := lexer.currentRune
 			lexer.readRune()
-			tok = token.NewComposableToken(token.NOT_EQ, current, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+			tok = token.NewComposableToken(token.NOT_EQ, current, lexer.currentRune, line, column)
 		} else {
-			tok = token.NewToken(token.BANG, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+			tok = token.NewToken(token.BANG, lexer.currentRune, line, column)
 		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
-		tok.Column = lexer.CurrentColumn
-		tok.Line = lexer.CurrentLine
+		tok.Column = column
+		tok.Line = line
 	default:
 		if isLetter(lexer.currentRune) {
-			tok.Column = lexer.CurrentColumn
-			tok.Line = lexer.CurrentLine
+			tok.Column = column
+			tok.Line = line
 			tok.Literal = lexer.readIdentifier()
 			tok.Type = token.FindKeywordOrIdent(tok.Literal)
 			return tok
 		} else if isDigit(lexer.currentRune) {
-			tok.Column = lexer.CurrentColumn
-			tok.Line = lexer.CurrentLine
-			tok.Literal = lexer.readNumber()
-			tok.Type = token.INT
+			tok.Column = column
+			tok.Line = line
+			tok.Literal, tok.Type = lexer.readNumber()
 			return tok
 		} else {
-			tok = token.NewToken(token.ILLEGAL, lexer.currentRune, lexer.CurrentLine, lexer.CurrentColumn)
+			tok = token.NewToken(token.ILLEGAL, lexer.currentRune, line, column)
 		}
 	}
 
@@ -191,18 +223,32 @@ func (lexer *Lexer) peekChar() rune {
 	}
 }
 
-func (lexer *Lexer) readString() string {
-	if lexer.peekChar() == '"' || lexer.peekChar() == 0 {
-		return ""
-	}
+// readString consumes a string literal, reporting whether the input had
+// its closing quote before ending.
+func (lexer *Lexer) readString() (string, bool) {
 	lexer.readRune()
 	pos := lexer.position
 	for lexer.currentRune != '"' {
+		if lexer.currentRune == 0 {
+			return string(lexer.input[pos:lexer.position]), false
+		}
+		if lexer.currentRune == '\n' {
+			lexer.CurrentLine++
+			lexer.CurrentColumn = 0
+		}
 		lexer.readRune()
 	}
 	finalPos := lexer.position
 	lexer.readRune()
-	return lexer.input[pos:finalPos]
+	return string(lexer.input[pos:finalPos]), true
+}
+
+func (lexer *Lexer) readComment() string {
+	pos := lexer.position
+	for lexer.currentRune != '\n' && lexer.currentRune != 0 {
+		lexer.readRune()
+	}
+	return string(lexer.input[pos:lexer.position])
 }
 
 func (lexer *Lexer) readIdentifier() string {
@@ -210,15 +256,23 @@ func (lexer *Lexer) readIdentifier() string {
 	for isLetter(lexer.currentRune) {
 		lexer.readRune()
 	}
-	return lexer.input[currentPosition:lexer.position]
+	return string(lexer.input[currentPosition:lexer.position])
 }
 
-func (lexer *Lexer) readNumber() string {
+func (lexer *Lexer) readNumber() (string, token.TokenType) {
 	currentPosition := lexer.position
+	tokenType := token.TokenType(token.INT)
 	for isDigit(lexer.currentRune) {
 		lexer.readRune()
 	}
-	return lexer.input[currentPosition:lexer.position]
+	if lexer.currentRune == '.' && isDigit(lexer.peekChar()) {
+		tokenType = token.FLOAT
+		lexer.readRune()
+		for isDigit(lexer.currentRune) {
+			lexer.readRune()
+		}
+	}
+	return string(lexer.input[currentPosition:lexer.position]), tokenType
 }
 
 func isLetter(ch rune) bool {
@@ -115,3 +115,162 @@ func TestNextToken(t *testing.T) {
 	}
 
 }
+
+func TestTokenPositions(t *testing.T) {
+	tests := []struct {
+		expectedType  token.TokenType
+		expectedStart token.Position
+		expectedEnd   token.Position
+	}{
+		{token.DEF, token.Position{Line: 1, Column: 1}, token.Position{Line: 1, Column: 4}},
+		{token.IDENT, token.Position{Line: 1, Column: 5}, token.Position{Line: 1, Column: 8}},
+		{token.ASSIGN, token.Position{Line: 1, Column: 9}, token.Position{Line: 1, Column: 10}},
+		{token.STRING, token.Position{Line: 1, Column: 11}, token.Position{Line: 1, Column: 18}},
+		{token.SEMICOLON, token.Position{Line: 1, Column: 18}, token.Position{Line: 1, Column: 19}},
+		{token.IDENT, token.Position{Line: 2, Column: 1}, token.Position{Line: 2, Column: 2}},
+		{token.NOT_EQ, token.Position{Line: 2, Column: 3}, token.Position{Line: 2, Column: 5}},
+		{token.INT, token.Position{Line: 2, Column: 6}, token.Position{Line: 2, Column: 8}},
+	}
+
+	lexer := New("def str = \"hello\";\na != 10")
+
+	for i, tt := range tests {
+		tok := lexer.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Pos() != tt.expectedStart {
+			t.Errorf("tests[%d] - start wrong. expected=%s, got=%s", i, tt.expectedStart, tok.Pos())
+		}
+		if tok.End() != tt.expectedEnd {
+			t.Errorf("tests[%d] - end wrong. expected=%s, got=%s", i, tt.expectedEnd, tok.End())
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.COMMENT, "// leading"},
+		{token.DEF, "def"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "4"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.COMMENT, "// trailing"},
+		{token.EOF, ""},
+	}
+
+	lexer := New("// leading\ndef x = 4 / 2; // trailing")
+
+	for i, tt := range tests {
+		tok := lexer.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedEnd     token.Position
+	}{
+		{`""`, token.STRING, "", token.Position{Line: 1, Column: 3}},
+		{`"a b"`, token.STRING, "a b", token.Position{Line: 1, Column: 6}},
+		{"\"one\ntwo\"", token.STRING, "one\ntwo", token.Position{Line: 2, Column: 5}},
+		{`"open`, token.ILLEGAL, `"open;`, token.Position{Line: 1, Column: 7}},
+	}
+
+	for _, tt := range tests {
+		lexer := New(tt.input + ";")
+		tok := lexer.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Errorf("%q: expected %s %q, got %s %q", tt.input, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if tok.End() != tt.expectedEnd {
+			t.Errorf("%q: expected end %s, got %s", tt.input, tt.expectedEnd, tok.End())
+		}
+		if tt.expectedType == token.STRING {
+			if next := lexer.NextToken(); next.Type != token.SEMICOLON || next.Pos() != tt.expectedEnd {
+				t.Errorf("%q: expected semicolon at %s after the string, got %s at %s", tt.input, tt.expectedEnd, next.Type, next.Pos())
+			}
+		}
+	}
+}
+
+func TestNumbersAndBrackets(t *testing.T) {
+	input := `[3.14, 10]{"a": 1.}`
+	expected := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LBRACKET, "["},
+		{token.FLOAT, "3.14"},
+		{token.COMMA, ","},
+		{token.INT, "10"},
+		{token.RBRACKET, "]"},
+		{token.LBRACE, "{"},
+		{token.STRING, "a"},
+		{token.COLON, ":"},
+		{token.INT, "1"},
+		{token.DOT, "."},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+	for i, tt := range expected {
+		tok := lexer.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("token %d: expected %s %q, got %s %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestMatchTokens(t *testing.T) {
+	input := `match xs { [a, ...rest] if a => r?, _ => .. }`
+	expected := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.MATCH, "match"},
+		{token.IDENT, "xs"},
+		{token.LBRACE, "{"},
+		{token.LBRACKET, "["},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.RBRACKET, "]"},
+		{token.IF, "if"},
+		{token.IDENT, "a"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "r"},
+		{token.QUESTION, "?"},
+		{token.COMMA, ","},
+		{token.IDENT, "_"},
+		{token.ARROW, "=>"},
+		{token.DOT, "."},
+		{token.DOT, "."},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+	for i, tt := range expected {
+		tok := lexer.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("token %d: expected %s %q, got %s %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
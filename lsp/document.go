@@ -0,0 +1,183 @@
+package lsp
+
+import (
+	"sort"
+	"strings"
+	"turatti/ast"
+	"turatti/builtins"
+	"turatti/lexer"
+	"turatti/parser"
+	"turatti/resolver"
+	"turatti/token"
+	"unicode/utf16"
+)
+
+// document is an open text document along with what is known about the
+// program in it. The program is resolved even when it has syntax errors,
+// so that navigation keeps working in the parts that parsed.
+type document struct {
+	uri     string
+	version int
+	text    string
+	lines   []string
+
+	program  *ast.Program
+	errors   []parser.SyntaxError
+	resolved *resolver.Result
+}
+
+func newDocument(uri string, version int, text string) *document {
+	d := &document{uri: uri, version: version, text: text, lines: strings.Split(text, "\n")}
+	p := parser.New(lexer.New(text))
+	d.program = p.Parse()
+	d.errors = p.SyntaxErrors()
+	d.resolved = resolver.Resolve(d.program, append(builtins.Names(), "args")...)
+	return d
+}
+
+// diagnostics reports syntax errors or, once there are none, the
+// problems the resolver found.
+func (d *document) diagnostics() []Diagnostic {
+	diagnostics := []Diagnostic{}
+	for _, err := range d.errors {
+		diagnostics = append(diagnostics, d.diagnostic(err.Pos, SeverityError, err.Message))
+	}
+	if len(d.errors) > 0 {
+		return diagnostics
+	}
+	for _, diagnostic := range d.resolved.Diagnostics {
+		severity := SeverityError
+		if diagnostic.Severity == resolver.Warning {
+			severity = SeverityWarning
+		}
+		diagnostics = append(diagnostics, d.diagnostic(diagnostic.Pos, severity, diagnostic.Message))
+	}
+	return diagnostics
+}
+
+// diagnostic covers the identifier at pos, or else the character there.
+func (d *document) diagnostic(pos token.Position, severity int, message string) Diagnostic {
+	r := Range{Start: d.position(pos)}
+	if identifier := d.identifierAt(pos); identifier != nil && identifier.Pos() == pos {
+		r.End = d.position(identifier.End())
+	} else {
+		r.End = d.position(token.Position{Line: pos.Line, Column: pos.Column + 1})
+	}
+	return Diagnostic{Range: r, Severity: severity, Source: "turatti", Message: message}
+}
+
+// position converts a position in the source to the protocol's, which
+// counts lines from 0 and characters in UTF-16 code units.
+func (d *document) position(pos token.Position) Position {
+	if pos.Line < 1 || pos.Line > len(d.lines) {
+		return Position{Line: pos.Line - 1}
+	}
+	line := []rune(d.lines[pos.Line-1])
+	column := pos.Column - 1
+	if column > len(line) {
+		column = len(line)
+	}
+	if column < 0 {
+		column = 0
+	}
+	return Position{Line: pos.Line - 1, Character: len(utf16.Encode(line[:column]))}
+}
+
+// sourcePosition is the inverse of position.
+func (d *document) sourcePosition(pos Position) token.Position {
+	if pos.Line < 0 || pos.Line >= len(d.lines) {
+		return token.Position{Line: pos.Line + 1, Column: 1}
+	}
+	units := 0
+	column := 1
+	for _, r := range d.lines[pos.Line] {
+		if units >= pos.Character {
+			break
+		}
+		units += len(utf16.Encode([]rune{r}))
+		column++
+	}
+	return token.Position{Line: pos.Line + 1, Column: column}
+}
+
+// offset returns the byte offset of pos in the text.
+func (d *document) offset(pos Position) int {
+	offset := 0
+	for i := 0; i < pos.Line && i < len(d.lines); i++ {
+		offset += len(d.lines[i]) + 1
+	}
+	if pos.Line >= len(d.lines) {
+		return len(d.text)
+	}
+	column := d.sourcePosition(pos).Column - 1
+	return offset + len(string([]rune(d.lines[pos.Line])[:column]))
+}
+
+// end is the position just past the last character of the text.
+func (d *document) end() Position {
+	last := len(d.lines) - 1
+	return Position{Line: last, Character: len(utf16.Encode([]rune(d.lines[last])))}
+}
+
+func (d *document) span(node ast.Node) Range {
+	return Range{Start: d.position(node.Pos()), End: d.position(node.End())}
+}
+
+// identifierAt returns the identifier that pos is in or just after.
+func (d *document) identifierAt(pos token.Position) *ast.Identifier {
+	var found *ast.Identifier
+	ast.Inspect(d.program, func(node ast.Node) bool {
+		if found != nil {
+			return false
+		}
+		if identifier, ok := node.(*ast.Identifier); ok {
+			start, end := identifier.Pos(), identifier.End()
+			if pos.Line == start.Line && start.Column <= pos.Column && pos.Column <= end.Column {
+				found = identifier
+			}
+		}
+		return true
+	})
+	return found
+}
+
+// bindingAt returns the binding that the identifier at pos declares or
+// refers to.
+func (d *document) bindingAt(pos token.Position) (*ast.Identifier, *resolver.Binding) {
+	identifier := d.identifierAt(pos)
+	if identifier == nil {
+		return nil, nil
+	}
+	if binding, ok := d.resolved.Bindings[identifier]; ok {
+		return identifier, binding
+	}
+	return identifier, d.resolved.Declarations[identifier]
+}
+
+// declaration returns the identifier that introduced binding, or nil for
+// predeclared names.
+func declaration(binding *resolver.Binding) *ast.Identifier {
+	switch binding.Node.(type) {
+	case *ast.DefStatement, *ast.Identifier:
+		return binding.Declaration()
+	}
+	return nil
+}
+
+// references returns the uses of binding in source order, preceded by its
+// declaration if asked to.
+func (d *document) references(binding *resolver.Binding, includeDeclaration bool) []Location {
+	identifiers := append([]*ast.Identifier{}, binding.Uses...)
+	sort.Slice(identifiers, func(i, j int) bool {
+		return identifiers[i].Pos().Before(identifiers[j].Pos())
+	})
+	if decl := declaration(binding); decl != nil && includeDeclaration {
+		identifiers = append([]*ast.Identifier{decl}, identifiers...)
+	}
+
+	locations := []Location{}
+	for _, identifier := range identifiers {
+		locations = append(locations, Location{URI: d.uri, Range: d.span(identifier)})
+	}
+	return locations
+}
@@ -0,0 +1,121 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// JSON-RPC error codes used by the server.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// Message is a JSON-RPC 2.0 request, notification or response. Requests
+// and responses have an ID, notifications do not.
+type Message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *Error           `json:"error,omitempty"`
+}
+
+// Error is the error of a JSON-RPC response.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// Conn reads and writes messages framed by Content-Length headers, as the
+// protocol sends them over standard input and output.
+type Conn struct {
+	in  *textproto.Reader
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func NewConn(in io.Reader, out io.Writer) *Conn {
+	return &Conn{in: textproto.NewReader(bufio.NewReader(in)), out: out}
+}
+
+// Read returns the next message, or io.EOF once the input is closed
+// between messages.
+func (c *Conn) Read() (*Message, error) {
+	header, err := c.in.ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("reading message header: %w", err)
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.in.R, body); err != nil {
+		return nil, fmt.Errorf("reading message body: %w", err)
+	}
+	msg := &Message{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, &Error{Code: codeParseError, Message: err.Error()}
+	}
+	return msg, nil
+}
+
+// Write sends msg. It is safe to call from several goroutines.
+func (c *Conn) Write(msg *Message) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = fmt.Fprintf(c.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+// Call sends a request or, with a nil id, a notification.
+func (c *Conn) Call(id *json.RawMessage, method string, params any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return c.Write(&Message{ID: id, Method: method, Params: data})
+}
+
+// Reply sends the response to the request with the given id.
+func (c *Conn) Reply(id *json.RawMessage, result any, replyErr error) error {
+	msg := &Message{ID: id}
+	if replyErr != nil {
+		rpcErr, ok := replyErr.(*Error)
+		if !ok {
+			rpcErr = &Error{Code: codeInternalError, Message: replyErr.Error()}
+		}
+		msg.Error = rpcErr
+		return c.Write(msg)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	msg.Result = data
+	return c.Write(msg)
+}
@@ -0,0 +1,301 @@
+// Package lsp implements a Language Server Protocol server for Turatti.
+// It reports syntax and resolution errors as diagnostics, navigates
+// between def statements and the identifiers that use them, shows what a
+// name refers to on hover and formats documents.
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"turatti/ast"
+	"turatti/formatter"
+	"turatti/resolver"
+)
+
+// ErrNoShutdown is returned by Serve when the client exits without asking
+// the server to shut down first.
+var ErrNoShutdown = errors.New("exit without shutdown")
+
+type handler func(s *Server, params json.RawMessage) (any, error)
+
+var handlers = map[string]handler{
+	"initialize":              (*Server).initialize,
+	"initialized":             nil,
+	"shutdown":                (*Server).shutdown,
+	"textDocument/didOpen":    (*Server).didOpen,
+	"textDocument/didChange":  (*Server).didChange,
+	"textDocument/didClose":   (*Server).didClose,
+	"textDocument/didSave":    nil,
+	"textDocument/definition": (*Server).definition,
+	"textDocument/references": (*Server).references,
+	"textDocument/hover":      (*Server).hover,
+	"textDocument/formatting": (*Server).formatting,
+}
+
+// Server serves a single client over a connection. It handles one message
+// at a time, in the order they arrive.
+type Server struct {
+	conn         *Conn
+	documents    map[string]*document
+	shuttingDown bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{conn: NewConn(in, out), documents: map[string]*document{}}
+}
+
+// Serve handles messages until the client sends exit or closes the
+// connection.
+func (s *Server) Serve() error {
+	for {
+		msg, err := s.conn.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var rpcErr *Error
+			if errors.As(err, &rpcErr) {
+				s.conn.Reply(nil, nil, rpcErr)
+				continue
+			}
+			return err
+		}
+
+		if msg.Method == "exit" {
+			if !s.shuttingDown {
+				return ErrNoShutdown
+			}
+			return nil
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg *Message) error {
+	h, known := handlers[msg.Method]
+	if msg.ID == nil {
+		// Notifications get no response, not even when they fail.
+		if h != nil {
+			h(s, msg.Params)
+		}
+		return nil
+	}
+
+	switch {
+	case !known || h == nil:
+		return s.conn.Reply(msg.ID, nil, &Error{Code: codeMethodNotFound, Message: "method not found: " + msg.Method})
+	case s.shuttingDown:
+		return s.conn.Reply(msg.ID, nil, &Error{Code: codeInvalidRequest, Message: "server is shutting down"})
+	}
+	result, err := h(s, msg.Params)
+	return s.conn.Reply(msg.ID, result, err)
+}
+
+func decode(params json.RawMessage, v any) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &Error{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) document(uri string) (*document, error) {
+	if d, ok := s.documents[uri]; ok {
+		return d, nil
+	}
+	return nil, &Error{Code: codeInvalidParams, Message: "unknown document " + uri}
+}
+
+func (s *Server) initialize(json.RawMessage) (any, error) {
+	return InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync:           syncFull,
+			DefinitionProvider:         true,
+			ReferencesProvider:         true,
+			HoverProvider:              true,
+			DocumentFormattingProvider: true,
+		},
+		ServerInfo: ServerInfo{Name: "turatti"},
+	}, nil
+}
+
+func (s *Server) shutdown(json.RawMessage) (any, error) {
+	s.shuttingDown = true
+	return nil, nil
+}
+
+func (s *Server) didOpen(params json.RawMessage) (any, error) {
+	var p DidOpenTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	s.update(newDocument(p.TextDocument.URI, p.TextDocument.Version, p.TextDocument.Text))
+	return nil, nil
+}
+
+func (s *Server) didChange(params json.RawMessage) (any, error) {
+	var p DidChangeTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range p.ContentChanges {
+		text := change.Text
+		if change.Range != nil {
+			text = d.text[:d.offset(change.Range.Start)] + change.Text + d.text[d.offset(change.Range.End):]
+		}
+		d = newDocument(d.uri, p.TextDocument.Version, text)
+	}
+	s.update(d)
+	return nil, nil
+}
+
+func (s *Server) didClose(params json.RawMessage) (any, error) {
+	var p DidCloseTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	delete(s.documents, p.TextDocument.URI)
+	return nil, s.conn.Call(nil, "textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         p.TextDocument.URI,
+		Diagnostics: []Diagnostic{},
+	})
+}
+
+// update replaces a document and publishes its diagnostics.
+func (s *Server) update(d *document) {
+	s.documents[d.uri] = d
+	s.conn.Call(nil, "textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         d.uri,
+		Version:     d.version,
+		Diagnostics: d.diagnostics(),
+	})
+}
+
+func (s *Server) definition(params json.RawMessage) (any, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	_, binding := d.bindingAt(d.sourcePosition(p.Position))
+	if binding == nil || declaration(binding) == nil {
+		return nil, nil
+	}
+	return Location{URI: d.uri, Range: d.span(declaration(binding))}, nil
+}
+
+func (s *Server) references(params json.RawMessage) (any, error) {
+	var p ReferenceParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	_, binding := d.bindingAt(d.sourcePosition(p.Position))
+	if binding == nil {
+		return nil, nil
+	}
+	return d.references(binding, p.Context.IncludeDeclaration), nil
+}
+
+func (s *Server) hover(params json.RawMessage) (any, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	identifier, binding := d.bindingAt(d.sourcePosition(p.Position))
+	if binding == nil {
+		return nil, nil
+	}
+
+	var signature string
+	switch binding.Kind {
+	case resolver.Def:
+		def := binding.Node.(*ast.DefStatement)
+		signature = "def " + def.Name.String() + " = " + summary(def.Value)
+	case resolver.Parameter:
+		signature = "(parameter) " + binding.Name
+	case resolver.Predeclared:
+		signature = "(builtin) " + binding.Name
+	case resolver.Import:
+		signature = binding.Node.(*ast.ImportStatement).String()
+	case resolver.Catch:
+		signature = "(catch) " + binding.Name
+	case resolver.Match:
+		signature = "(match) " + binding.Name
+	}
+	value := fmt.Sprintf("```turatti\n%s\n```", signature)
+	if decl := declaration(binding); decl != nil {
+		uses := len(binding.Uses)
+		value += fmt.Sprintf("\n\nDeclared on line %d, used %d time%s.", decl.Pos().Line, uses, plural(uses))
+	}
+	return Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: value},
+		Range:    d.span(identifier),
+	}, nil
+}
+
+// summary shortens the value of a def statement to one line, keeping only
+// the parameters of functions.
+func summary(value ast.Expression) string {
+	if value == nil {
+		return "..."
+	}
+	if fn, ok := value.(*ast.FunctionLiteral); ok {
+		params := []string{}
+		for _, param := range fn.Parameters {
+			params = append(params, param.String())
+		}
+		return "fun(" + strings.Join(params, ", ") + ")"
+	}
+	text := []rune(value.String())
+	if len(text) > 60 {
+		return string(text[:57]) + "..."
+	}
+	return string(text)
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// formatting replaces the whole document with its formatted text. A
+// document with syntax errors is left alone.
+func (s *Server) formatting(params json.RawMessage) (any, error) {
+	var p DocumentFormattingParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.errors) > 0 {
+		return nil, nil
+	}
+	formatted := string(formatter.Format(d.program))
+	if formatted == d.text {
+		return []TextEdit{}, nil
+	}
+	return []TextEdit{{Range: Range{End: d.end()}, NewText: formatted}}, nil
+}
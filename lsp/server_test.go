@@ -0,0 +1,397 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// client talks to a server running in the same process, collecting the
+// notifications it sends while waiting for responses.
+type client struct {
+	t             *testing.T
+	conn          *Conn
+	nextID        int
+	messages      chan *Message
+	notifications []*Message
+	done          chan error
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{
+		t:        t,
+		conn:     NewConn(clientIn, clientOut),
+		messages: make(chan *Message, 100),
+		done:     make(chan error, 1),
+	}
+	go func() {
+		err := NewServer(serverIn, serverOut).Serve()
+		serverOut.Close()
+		c.done <- err
+	}()
+	// The pipes do not buffer, so messages are read as soon as they come
+	// for the server never to block on them.
+	go func() {
+		defer close(c.messages)
+		for {
+			msg, err := c.conn.Read()
+			if err != nil {
+				return
+			}
+			c.messages <- msg
+		}
+	}()
+	t.Cleanup(func() { clientOut.Close() })
+	return c
+}
+
+func (c *client) call(method string, params any, result any) *Error {
+	c.t.Helper()
+	c.nextID++
+	id := json.RawMessage(strconv.Itoa(c.nextID))
+	if err := c.conn.Call(&id, method, params); err != nil {
+		c.t.Fatalf("%s: %v", method, err)
+	}
+	for msg := range c.messages {
+		if msg.ID == nil {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+		if string(*msg.ID) != string(id) {
+			c.t.Fatalf("%s: expected response %s, got %s", method, id, *msg.ID)
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if err := json.Unmarshal(msg.Result, result); err != nil {
+			c.t.Fatalf("%s: decoding %s: %v", method, msg.Result, err)
+		}
+		return nil
+	}
+	c.t.Fatalf("%s: connection closed", method)
+	return nil
+}
+
+func (c *client) notify(method string, params any) {
+	c.t.Helper()
+	if err := c.conn.Call(nil, method, params); err != nil {
+		c.t.Fatalf("%s: %v", method, err)
+	}
+}
+
+// diagnostics waits for the next diagnostics published for uri.
+func (c *client) diagnostics(uri string) []Diagnostic {
+	c.t.Helper()
+	for {
+		var msg *Message
+		if len(c.notifications) > 0 {
+			msg, c.notifications = c.notifications[0], c.notifications[1:]
+		} else if msg = <-c.messages; msg == nil {
+			c.t.Fatalf("connection closed while waiting for diagnostics")
+		}
+		if msg.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		var params PublishDiagnosticsParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			c.t.Fatalf("decoding diagnostics: %v", err)
+		}
+		if params.URI == uri {
+			return params.Diagnostics
+		}
+	}
+}
+
+func (c *client) open(uri, text string) {
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, LanguageID: "turatti", Version: 1, Text: text},
+	})
+}
+
+func at(uri string, line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Position:     Position{Line: line, Character: character},
+	}
+}
+
+func span(line, start, end int) Range {
+	return Range{Start: Position{Line: line, Character: start}, End: Position{Line: line, Character: end}}
+}
+
+const uri = "file:///test.trt"
+
+const program = `def add = fun(x, y) {
+    x + y
+};
+def total = add(1, 2);
+add(total, "é" + total)`
+
+func TestInitializeAndShutdown(t *testing.T) {
+	c := newClient(t)
+	var result InitializeResult
+	if err := c.call("initialize", map[string]any{"processId": nil}, &result); err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+	if result.Capabilities.TextDocumentSync != syncFull || !result.Capabilities.DefinitionProvider ||
+		!result.Capabilities.HoverProvider || !result.Capabilities.DocumentFormattingProvider {
+		t.Errorf("unexpected capabilities %+v", result.Capabilities)
+	}
+	c.notify("initialized", map[string]any{})
+
+	var ignored any
+	if err := c.call("workspace/symbol", map[string]any{}, &ignored); err == nil || err.Code != codeMethodNotFound {
+		t.Errorf("expected unknown methods to be rejected, got %v", err)
+	}
+	if err := c.call("shutdown", nil, &ignored); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	if err := c.call("textDocument/hover", at(uri, 0, 0), &ignored); err == nil || err.Code != codeInvalidRequest {
+		t.Errorf("expected requests after shutdown to be rejected, got %v", err)
+	}
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("expected a clean exit, got %v", err)
+	}
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	c := newClient(t)
+	c.notify("exit", nil)
+	if err := <-c.done; err != ErrNoShutdown {
+		t.Errorf("expected %v, got %v", ErrNoShutdown, err)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := newClient(t)
+	c.open(uri, program)
+	if diagnostics := c.diagnostics(uri); len(diagnostics) != 0 {
+		t.Errorf("expected no diagnostics, got %+v", diagnostics)
+	}
+
+	tests := []struct {
+		text     string
+		expected []Diagnostic
+	}{
+		{"def = 5;", []Diagnostic{
+			{Range: span(0, 4, 5), Severity: SeverityError, Source: "turatti", Message: "unexpected token =, expected IDENT"},
+		}},
+		{"\"é\" + @", []Diagnostic{
+			{Range: span(0, 6, 7), Severity: SeverityError, Source: "turatti", Message: `illegal token "@"`},
+		}},
+		{"def x = 1;\nmissing + x", []Diagnostic{
+			{Range: span(1, 0, 7), Severity: SeverityError, Source: "turatti", Message: "undefined: missing"},
+		}},
+		{"def len = 1;", []Diagnostic{
+			{Range: span(0, 4, 7), Severity: SeverityWarning, Source: "turatti", Message: "len redefines a predeclared name"},
+			{Range: span(0, 4, 7), Severity: SeverityWarning, Source: "turatti", Message: "len declared and not used"},
+		}},
+		{"def on = 1; on", []Diagnostic{}},
+	}
+
+	for i, tt := range tests {
+		c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+			TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: i + 2},
+			ContentChanges: []TextDocumentContentChangeEvent{{Text: tt.text}},
+		})
+		got := c.diagnostics(uri)
+		gotJSON, _ := json.Marshal(got)
+		expectedJSON, _ := json.Marshal(tt.expected)
+		if string(gotJSON) != string(expectedJSON) {
+			t.Errorf("%q: expected diagnostics %s, got %s", tt.text, expectedJSON, gotJSON)
+		}
+	}
+
+	// Ranged changes edit the current text in place.
+	r := span(0, 4, 6)
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: 10},
+		ContentChanges: []TextDocumentContentChangeEvent{{Range: &r, Text: ""}},
+	})
+	if diagnostics := c.diagnostics(uri); len(diagnostics) != 1 || diagnostics[0].Message != "unexpected token =, expected IDENT" {
+		t.Errorf("expected the edit to remove the name, got %+v", diagnostics)
+	}
+
+	c.notify("textDocument/didClose", DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}})
+	if diagnostics := c.diagnostics(uri); len(diagnostics) != 0 {
+		t.Errorf("expected closing to clear diagnostics, got %+v", diagnostics)
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	c := newClient(t)
+	c.open(uri, program)
+
+	definitions := []struct {
+		line, character int
+		expected        *Location
+	}{
+		{3, 13, &Location{URI: uri, Range: span(0, 4, 7)}},  // add in add(1, 2)
+		{3, 15, &Location{URI: uri, Range: span(0, 4, 7)}},  // just after it
+		{1, 8, &Location{URI: uri, Range: span(0, 17, 18)}}, // y in x + y
+		{4, 18, &Location{URI: uri, Range: span(3, 4, 9)}},  // total after "é"
+		{0, 5, &Location{URI: uri, Range: span(0, 4, 7)}},   // the declaration itself
+		{0, 9, nil}, // not an identifier
+	}
+	for _, tt := range definitions {
+		var got *Location
+		if err := c.call("textDocument/definition", at(uri, tt.line, tt.character), &got); err != nil {
+			t.Fatalf("definition failed: %v", err)
+		}
+		if (got == nil) != (tt.expected == nil) || (got != nil && *got != *tt.expected) {
+			t.Errorf("definition at %d:%d: expected %+v, got %+v", tt.line, tt.character, tt.expected, got)
+		}
+	}
+
+	var refs []Location
+	params := ReferenceParams{TextDocumentPositionParams: at(uri, 4, 0)}
+	params.Context.IncludeDeclaration = true
+	if err := c.call("textDocument/references", params, &refs); err != nil {
+		t.Fatalf("references failed: %v", err)
+	}
+	expected := []Range{span(0, 4, 7), span(3, 12, 15), span(4, 0, 3)}
+	if len(refs) != len(expected) {
+		t.Fatalf("expected %d references, got %+v", len(expected), refs)
+	}
+	for i, ref := range refs {
+		if ref.Range != expected[i] || ref.URI != uri {
+			t.Errorf("reference %d: expected %+v, got %+v", i, expected[i], ref)
+		}
+	}
+
+	params.Context.IncludeDeclaration = false
+	params.Position = Position{Line: 3, Character: 6}
+	if err := c.call("textDocument/references", params, &refs); err != nil {
+		t.Fatalf("references failed: %v", err)
+	}
+	if len(refs) != 2 || refs[0].Range != span(4, 4, 9) || refs[1].Range != span(4, 17, 22) {
+		t.Errorf("expected the two uses of total, got %+v", refs)
+	}
+
+	var ignored any
+	if err := c.call("textDocument/definition", at("file:///other.trt", 0, 0), &ignored); err == nil || err.Code != codeInvalidParams {
+		t.Errorf("expected unknown documents to be rejected, got %v", err)
+	}
+}
+
+func TestHover(t *testing.T) {
+	c := newClient(t)
+	c.open(uri, program)
+
+	tests := []struct {
+		line, character int
+		expected        string
+	}{
+		{4, 1, "```turatti\ndef add = fun(x, y)\n```\n\nDeclared on line 1, used 2 times."},
+		{3, 5, "```turatti\ndef total = add(1, 2)\n```\n\nDeclared on line 4, used 2 times."},
+		{1, 4, "```turatti\n(parameter) x\n```\n\nDeclared on line 1, used 1 time."},
+		{0, 1, ""},
+	}
+	for _, tt := range tests {
+		var got *Hover
+		if err := c.call("textDocument/hover", at(uri, tt.line, tt.character), &got); err != nil {
+			t.Fatalf("hover failed: %v", err)
+		}
+		if tt.expected == "" {
+			if got != nil {
+				t.Errorf("hover at %d:%d: expected nothing, got %+v", tt.line, tt.character, got)
+			}
+			continue
+		}
+		if got == nil || got.Contents.Value != tt.expected || got.Contents.Kind != "markdown" {
+			t.Errorf("hover at %d:%d: expected %q, got %+v", tt.line, tt.character, tt.expected, got)
+		}
+	}
+
+	c.open("file:///builtin.trt", "len([1])")
+	var got *Hover
+	if err := c.call("textDocument/hover", at("file:///builtin.trt", 0, 1), &got); err != nil {
+		t.Fatalf("hover failed: %v", err)
+	}
+	if got == nil || got.Contents.Value != "```turatti\n(builtin) len\n```" || got.Range != span(0, 0, 3) {
+		t.Errorf("expected builtin hover, got %+v", got)
+	}
+
+	c.open("file:///catch.trt", "try { 1 } catch (e) { e }")
+	if err := c.call("textDocument/hover", at("file:///catch.trt", 0, 22), &got); err != nil {
+		t.Fatalf("hover failed: %v", err)
+	}
+	if got == nil || got.Contents.Value != "```turatti\n(catch) e\n```\n\nDeclared on line 1, used 1 time." {
+		t.Errorf("expected catch hover, got %+v", got)
+	}
+
+	c.open("file:///match.trt", "match [1] { [n] => n, _ => 0 }")
+	if err := c.call("textDocument/hover", at("file:///match.trt", 0, 19), &got); err != nil {
+		t.Fatalf("hover failed: %v", err)
+	}
+	if got == nil || got.Contents.Value != "```turatti\n(match) n\n```\n\nDeclared on line 1, used 1 time." {
+		t.Errorf("expected match hover, got %+v", got)
+	}
+
+	c.open("file:///destructure.trt", "def [a, b] = [1, 2];\nb + fun([x]) { x }([a])")
+	if err := c.call("textDocument/hover", at("file:///destructure.trt", 1, 0), &got); err != nil {
+		t.Fatalf("hover failed: %v", err)
+	}
+	if got == nil || got.Contents.Value != "```turatti\ndef [a, b] = [1, 2]\n```\n\nDeclared on line 1, used 1 time." {
+		t.Errorf("expected destructuring hover, got %+v", got)
+	}
+	var definition *Location
+	if err := c.call("textDocument/definition", at("file:///destructure.trt", 1, 0), &definition); err != nil {
+		t.Fatalf("definition failed: %v", err)
+	}
+	if definition == nil || definition.Range != span(0, 8, 9) {
+		t.Errorf("expected b to be defined in the pattern, got %+v", definition)
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	c := newClient(t)
+	c.open(uri, "def   x=1;\nx  +  \"é\"")
+
+	var edits []TextEdit
+	params := DocumentFormattingParams{TextDocument: TextDocumentIdentifier{URI: uri}}
+	if err := c.call("textDocument/formatting", params, &edits); err != nil {
+		t.Fatalf("formatting failed: %v", err)
+	}
+	expected := TextEdit{Range: Range{End: Position{Line: 1, Character: 9}}, NewText: "def x = 1;\nx + \"é\";\n"}
+	if len(edits) != 1 || edits[0] != expected {
+		t.Fatalf("expected %+v, got %+v", expected, edits)
+	}
+
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: 2},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: expected.NewText}},
+	})
+	if err := c.call("textDocument/formatting", params, &edits); err != nil || len(edits) != 0 {
+		t.Errorf("expected formatted text to need no edits, got %+v (%v)", edits, err)
+	}
+
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: 3},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "def = ;"}},
+	})
+	edits = []TextEdit{{NewText: "sentinel"}}
+	if err := c.call("textDocument/formatting", params, &edits); err != nil || edits != nil {
+		t.Errorf("expected no edits for a broken document, got %+v (%v)", edits, err)
+	}
+}
+
+func TestConnRejectsBadFraming(t *testing.T) {
+	conn := NewConn(strings.NewReader("Content-Length: x\r\n\r\n{}"), io.Discard)
+	if _, err := conn.Read(); err == nil || !strings.Contains(err.Error(), "invalid Content-Length") {
+		t.Errorf("expected a framing error, got %v", err)
+	}
+	conn = NewConn(strings.NewReader("Content-Length: 5\r\n\r\n{}"), io.Discard)
+	if _, err := conn.Read(); err == nil || !strings.Contains(err.Error(), "reading message body") {
+		t.Errorf("expected a truncation error, got %v", err)
+	}
+	conn = NewConn(strings.NewReader("Content-Length: 2\r\n\r\n{]"), io.Discard)
+	if _, err := conn.Read(); err == nil || err.(*Error).Code != codeParseError {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+// Package modules loads the Turatti programs that import statements refer
+// to. A module is run once, the first time any program imports it, and
+// every later import shares the definitions it exports.
+package modules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"turatti/ast"
+	"turatti/evaluator"
+	"turatti/lexer"
+	"turatti/object"
+	"turatti/parser"
+)
+
+// PathVariable names the environment variable that holds the default
+// search path, a list of directories separated like in PATH.
+const PathVariable = "TURATTIPATH"
+
+// SearchPath splits a list of directories separated like in PATH.
+func SearchPath(list string) []string {
+	return filepath.SplitList(list)
+}
+
+// Loader loads modules for the programs of one run and caches them by
+// file.
+type Loader struct {
+	// SearchPath lists the directories searched, in order, for modules not
+	// found next to the program importing them.
+	SearchPath []string
+	// Options configure the environment each module runs in. Their
+	// Importer is replaced by one resolving imports from the module.
+	Options evaluator.Options
+
+	modules map[string]*object.Module
+	root    string
+}
+
+func NewLoader(searchPath []string, opts evaluator.Options) *Loader {
+	return &Loader{SearchPath: searchPath, Options: opts, modules: map[string]*object.Module{}}
+}
+
+// Importer returns the importer for the program at path, which is the
+// entry point of the run; "-" stands for standard input and resolves
+// imports from the working directory. Paths in messages are shown
+// relative to the directory of the entry point.
+func (l *Loader) Importer(path string) object.Importer {
+	if path == "-" || path == "" {
+		path = "<stdin>"
+	}
+	file, err := filepath.Abs(path)
+	if err != nil {
+		file = path
+	}
+	if l.root == "" {
+		l.root = filepath.Dir(file)
+	}
+	return &importer{loader: l, file: file}
+}
+
+// importer imports on behalf of the program in file, which parent
+// imported.
+type importer struct {
+	loader *Loader
+	file   string
+	parent *importer
+}
+
+func (i *importer) Import(path string) (*object.Module, error) {
+	l := i.loader
+	file, err := l.resolve(path, filepath.Dir(i.file))
+	if err != nil {
+		return nil, err
+	}
+	if module, ok := l.modules[file]; ok {
+		return module, nil
+	}
+
+	// The modules still loading are the ones up the chain of importers.
+	trace := []string{l.name(file)}
+	for in := i; in != nil; in = in.parent {
+		trace = append(trace, l.name(in.file))
+		if in.file == file {
+			for left, right := 0, len(trace)-1; left < right; left, right = left+1, right-1 {
+				trace[left], trace[right] = trace[right], trace[left]
+			}
+			return nil, object.Errorf(object.ImportError, "import cycle: %s", strings.Join(trace, " -> "))
+		}
+	}
+
+	module, err := l.load(file, &importer{loader: l, file: file, parent: i})
+	if err != nil {
+		return nil, err
+	}
+	l.modules[file] = module
+	return module, nil
+}
+
+// resolve finds the file path refers to, first in dir and then in the
+// search path.
+func (l *Loader) resolve(path, dir string) (string, error) {
+	if !strings.HasSuffix(path, ".trt") {
+		return "", object.Errorf(object.ImportError, "cannot import %q: modules are .trt files", path)
+	}
+	if filepath.IsAbs(path) {
+		if !isFile(path) {
+			return "", object.Errorf(object.ImportError, "cannot find module %q", path)
+		}
+		return filepath.Clean(path), nil
+	}
+
+	dirs := append([]string{dir}, l.SearchPath...)
+	for _, dir := range dirs {
+		candidate, err := filepath.Abs(filepath.Join(dir, path))
+		if err == nil && isFile(candidate) {
+			return candidate, nil
+		}
+	}
+	searched := make([]string, len(dirs))
+	for i, dir := range dirs {
+		searched[i] = l.name(dir)
+	}
+	return "", object.Errorf(object.ImportError, "cannot find module %q in %s", path, strings.Join(searched, ", "))
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// load runs the module in file and collects its exports.
+func (l *Loader) load(file string, imports *importer) (*object.Module, error) {
+	name := l.name(file)
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, object.Errorf(object.ImportError, "cannot import %s: %v", name, err)
+	}
+	lex := lexer.FromFile(f)
+	f.Close()
+
+	p := parser.New(lex)
+	program := p.Parse()
+	if errors := p.SyntaxErrors(); len(errors) > 0 {
+		more := ""
+		if len(errors) > 1 {
+			more = fmt.Sprintf(" (and %d more errors)", len(errors)-1)
+		}
+		return nil, object.Errorf(object.ImportError, "%s:%s%s", name, errors[0], more)
+	}
+
+	opts := l.Options
+	opts.Importer = imports
+	opts.File = name
+	env := evaluator.NewGlobalEnvironment(opts)
+	if result, ok := evaluator.Eval(program, env).(*object.Error); ok {
+		return nil, result
+	}
+
+	module := &object.Module{Name: name, Exports: map[string]object.Object{}}
+	for _, stmt := range program.Statements {
+		def, ok := stmt.(*ast.DefStatement)
+		if !ok || !def.Exported() {
+			continue
+		}
+		for _, name := range ast.Bindings(def.Name) {
+			if value, ok := env.Get(name.Value); ok {
+				module.Exports[name.Value] = value
+			}
+		}
+	}
+	return module, nil
+}
+
+// name shortens path for messages, relative to the directory of the entry
+// point when it is inside it.
+func (l *Loader) name(path string) string {
+	if rel, err := filepath.Rel(l.root, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
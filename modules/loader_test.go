@@ -0,0 +1,152 @@
+package modules
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"turatti/evaluator"
+	"turatti/lexer"
+	"turatti/object"
+	"turatti/parser"
+)
+
+// write creates the files of a module tree under a temporary directory and
+// returns the directory.
+func write(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// run runs the entry point main.trt of dir and returns its result and
+// everything the modules printed.
+func run(t *testing.T, dir string, searchPath ...string) (object.Object, string) {
+	t.Helper()
+	path := filepath.Join(dir, "main.trt")
+	src, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := parser.New(lexer.New(string(src)))
+	program := p.Parse()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	var out bytes.Buffer
+	opts := evaluator.Options{Stdout: &out, File: "main.trt"}
+	opts.Importer = NewLoader(searchPath, opts).Importer(path)
+	return evaluator.Eval(program, evaluator.NewGlobalEnvironment(opts)), out.String()
+}
+
+func TestImport(t *testing.T) {
+	dir := write(t, map[string]string{
+		"main.trt": `
+import "lib/math.trt" as math;
+import "lib/stats.trt" as stats;
+math.square(stats.total([1, 2])) + math.offset + math.low * math.high;
+`,
+		"lib/math.trt": `
+puts("loading math");
+def helper = 1;
+export def offset = helper * 10;
+export def square = fun(x) { x * x };
+export def [low, {high}] = [2, {"high": 3}];
+`,
+		"lib/stats.trt": `
+import "math.trt" as m;
+export def total = fun(xs) { m.offset - 10 + xs[0] + xs[1] };
+`,
+	})
+
+	result, out := run(t, dir)
+	if i, ok := result.(*object.Integer); !ok || i.Value != 25 {
+		t.Fatalf("expected 25, got %s", result.Inspect())
+	}
+	if out != "loading math\n" {
+		t.Errorf("expected math to load once, got output %q", out)
+	}
+}
+
+func TestSearchPath(t *testing.T) {
+	dir := write(t, map[string]string{
+		"app/main.trt":     `import "greet.trt" as greet; greet.hello;`,
+		"shared/greet.trt": `export def hello = "hi";`,
+	})
+
+	result, _ := run(t, filepath.Join(dir, "app"), filepath.Join(dir, "shared"))
+	if s, ok := result.(*object.String); !ok || s.Value != "hi" {
+		t.Fatalf("expected \"hi\", got %s", result.Inspect())
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	main := "Traceback (most recent call last):\n  File \"main.trt\", line 1, column 1, in <main>\n"
+	tests := []struct {
+		files    map[string]string
+		expected string
+	}{
+		{
+			map[string]string{"main.trt": `import "missing.trt" as m;`},
+			main + `ImportError: cannot find module "missing.trt" in .` + "\n",
+		},
+		{
+			map[string]string{"main.trt": `import "util" as m;`},
+			main + `ImportError: cannot import "util": modules are .trt files` + "\n",
+		},
+		{
+			map[string]string{
+				"main.trt": "def x = 1;\n" + `import "u.trt" as u;` + "\nu.hidden;",
+				"u.trt":    "def hidden = 1;",
+			},
+			"Traceback (most recent call last):\n  File \"main.trt\", line 3, column 3, in <main>\n" +
+				"ImportError: module u.trt does not export hidden\n",
+		},
+		{
+			map[string]string{
+				"main.trt": `import "a.trt" as a;`,
+				"a.trt":    `import "b.trt" as b;`,
+				"b.trt":    `import "a.trt" as a;`,
+			},
+			main + "  File \"a.trt\", line 1, column 1, in <main>\n  File \"b.trt\", line 1, column 1, in <main>\n" +
+				"ImportError: import cycle: a.trt -> b.trt -> a.trt\n",
+		},
+		{
+			map[string]string{
+				"main.trt": `import "bad.trt" as bad;`,
+				"bad.trt":  "def = 1;\ndef = 2;",
+			},
+			main + "ImportError: bad.trt:1:5: unexpected token =, expected IDENT (and 1 more errors)\n",
+		},
+		{
+			map[string]string{
+				"main.trt":  `import "fails.trt" as f;`,
+				"fails.trt": "def check = fun(x) { x + true };\ncheck(1);",
+			},
+			main + "  File \"fails.trt\", line 2, column 1, in <main>\n" +
+				"  File \"fails.trt\", line 1, column 22, in check\nTypeError: type mismatch: INTEGER + BOOLEAN\n",
+		},
+	}
+
+	for _, tt := range tests {
+		result, _ := run(t, write(t, tt.files))
+		err, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("expected an error, got %s", result.Inspect())
+			continue
+		}
+		if got := err.Traceback(false); got != tt.expected {
+			t.Errorf("expected traceback\n%s\ngot\n%s", tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package object
+
+import "sort"
+
+type Environment struct {
+	store     map[string]Object
+	protected map[string]bool
+	importer  Importer
+	file      string
+	outer     *Environment
+	// scoped environments only hold the names declared in them, and set
+	// every other name in outer.
+	scoped bool
+}
+
+func NewEnvironment() *Environment {
+	return &Environment{store: make(map[string]Object)}
+}
+
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+// NewScopedEnvironment returns an environment enclosed by outer for a
+// match arm. The names Declare binds in it shadow those of outer, while
+// defs in the arm set theirs in outer, where they stay after the match.
+func NewScopedEnvironment(outer *Environment) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.scoped = true
+	return env
+}
+
+func (e *Environment) Get(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	if !ok && e.outer != nil {
+		return e.outer.Get(name)
+	}
+	return obj, ok
+}
+
+func (e *Environment) Set(name string, value Object) Object {
+	if _, ok := e.store[name]; e.scoped && !ok {
+		return e.outer.Set(name, value)
+	}
+	e.store[name] = value
+	return value
+}
+
+// Declare binds name in e itself, even when e is scoped.
+func (e *Environment) Declare(name string, value Object) {
+	e.store[name] = value
+}
+
+// Protect marks name as one that programs may not redefine, in e and
+// every environment enclosed by it.
+func (e *Environment) Protect(name string) {
+	if e.protected == nil {
+		e.protected = make(map[string]bool)
+	}
+	e.protected[name] = true
+}
+
+// IsProtected reports whether name was protected in e or one of its
+// enclosing environments.
+func (e *Environment) IsProtected(name string) bool {
+	for env := e; env != nil; env = env.outer {
+		if env.protected[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// SetImporter makes importer load the modules imported by programs run
+// in e and every environment enclosed by it.
+func (e *Environment) SetImporter(importer Importer) {
+	e.importer = importer
+}
+
+// Importer returns the importer of e or of the nearest enclosing
+// environment that has one, or nil.
+func (e *Environment) Importer() Importer {
+	for env := e; env != nil; env = env.outer {
+		if env.importer != nil {
+			return env.importer
+		}
+	}
+	return nil
+}
+
+// SetFile names the file of the programs run in e and every environment
+// enclosed by it, for the frames of runtime errors.
+func (e *Environment) SetFile(file string) {
+	e.file = file
+}
+
+// File returns the file of e or of the nearest enclosing environment that
+// has one.
+func (e *Environment) File() string {
+	for env := e; env != nil; env = env.outer {
+		if env.file != "" {
+			return env.file
+		}
+	}
+	return ""
+}
+
+// Names returns every name visible from e, including the ones of its
+// enclosing environments, in alphabetical order.
+func (e *Environment) Names() []string {
+	seen := map[string]bool{}
+	for env := e; env != nil; env = env.outer {
+		for name := range env.store {
+			seen[name] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,212 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"turatti/token"
+)
+
+// ErrorKind classifies runtime errors, so that they can be told apart
+// without parsing their messages.
+type ErrorKind string
+
+const (
+	RuntimeError      ErrorKind = "RuntimeError"
+	TypeError         ErrorKind = "TypeError"
+	NameError         ErrorKind = "NameError"
+	IndexError        ErrorKind = "IndexError"
+	ValueError        ErrorKind = "ValueError"
+	ArgumentError     ErrorKind = "ArgumentError"
+	ZeroDivisionError ErrorKind = "ZeroDivisionError"
+	ImportError       ErrorKind = "ImportError"
+	AssertionError    ErrorKind = "AssertionError"
+	// Exception is the kind of the values programs throw.
+	Exception ErrorKind = "Exception"
+)
+
+// MaxFrames bounds the depth of nested calls, counting the frame of the
+// program itself.
+const MaxFrames = 1 << 16
+
+// The names frames use for code outside of named functions.
+const (
+	MainFunction      = "<main>"
+	AnonymousFunction = "<anonymous>"
+)
+
+// Error is a runtime error. Pos is where it was raised, and Frames lists
+// the calls it propagated out of, innermost first, ending with the frame
+// of the program itself.
+type Error struct {
+	Message string
+	Kind    ErrorKind
+	Pos     token.Position
+	Frames  []Frame
+	// Value is the value a throw statement raised, or nil.
+	Value Object
+
+	// caller is where the outermost frame so far was called from.
+	caller token.Position
+}
+
+// Frame is one call on the stack of a runtime error. Pos is where the
+// call was when the error left it: where the error was raised for the
+// innermost frame, and where it called the next inner frame otherwise.
+type Frame struct {
+	Function string
+	File     string
+	Pos      token.Position
+	// Parameters and Args are the parameters of the function and the
+	// values they were bound to.
+	Parameters []string
+	Args       []Object
+}
+
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return fmt.Sprintf("%s: runtime error: %s", e.Pos, e.Message)
+	}
+	return "runtime error: " + e.Message
+}
+
+// Error lets runtime errors pass through Go code as errors.
+func (e *Error) Error() string {
+	return e.Inspect()
+}
+
+// Throw returns the error that throwing value raises. A hash with a
+// string kind and message, as Caught describes errors, raises an error of
+// that kind, so that rethrowing a caught error keeps its kind.
+func Throw(value Object) *Error {
+	e := &Error{Message: value.Inspect(), Kind: Exception, Value: value}
+	if s, ok := value.(*String); ok {
+		e.Message = s.Value
+	}
+	if hash, ok := value.(*Hash); ok {
+		kind, hasKind := hash.Get(&String{Value: "kind"})
+		message, hasMessage := hash.Get(&String{Value: "message"})
+		if hasKind && hasMessage && kind.Type() == STRING_OBJ && message.Type() == STRING_OBJ {
+			e.Kind = ErrorKind(kind.(*String).Value)
+			e.Message = message.(*String).Value
+		}
+	}
+	return e
+}
+
+// Caught returns the value a catch clause binds for e: the value thrown,
+// or a hash holding the kind and message of a runtime error.
+func (e *Error) Caught() Object {
+	if e.Value != nil {
+		return e.Value
+	}
+	hash := NewHash()
+	hash.Set(&String{Value: "kind"}, &String{Value: string(KindOf(e))})
+	hash.Set(&String{Value: "message"}, &String{Value: e.Message})
+	return hash
+}
+
+// AddFrame records that e propagated out of frame, positioning it where e
+// was raised or where it called the frame added before.
+func (e *Error) AddFrame(frame Frame) {
+	frame.Pos = e.Pos
+	if len(e.Frames) > 0 {
+		frame.Pos = e.caller
+	}
+	e.Frames = append(e.Frames, frame)
+	e.caller = token.Position{}
+}
+
+// CalledFrom records where the outermost frame so far was called from,
+// which is where the frame added next is positioned.
+func (e *Error) CalledFrom(pos token.Position) {
+	e.caller = pos
+}
+
+// Traceback formats e like Python does, from the outermost frame to the
+// innermost one followed by the kind and message of e. With args, every
+// frame also lists the arguments of its call.
+func (e *Error) Traceback(args bool) string {
+	var out strings.Builder
+	if len(e.Frames) > 0 {
+		out.WriteString("Traceback (most recent call last):\n")
+	} else if e.Pos.IsValid() {
+		fmt.Fprintf(&out, "%s: ", e.Pos)
+	}
+	// runs of identical frames, as deep recursion leaves, are cut short.
+	previous, repeated := "", 0
+	skipped := func() {
+		if repeated >= maxRepeatedFrames {
+			fmt.Fprintf(&out, "  [Previous frame repeated %d more times]\n", repeated-maxRepeatedFrames+1)
+		}
+	}
+	for i := len(e.Frames) - 1; i >= 0; i-- {
+		entry := e.Frames[i].format(args)
+		if entry == previous {
+			repeated++
+			if repeated < maxRepeatedFrames {
+				out.WriteString(entry)
+			}
+			continue
+		}
+		skipped()
+		out.WriteString(entry)
+		previous, repeated = entry, 0
+	}
+	skipped()
+	fmt.Fprintf(&out, "%s: %s\n", KindOf(e), e.Message)
+	return out.String()
+}
+
+// maxRepeatedFrames is how many times in a row Traceback prints the same
+// frame.
+const maxRepeatedFrames = 3
+
+func (f Frame) format(args bool) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "  File %q", f.File)
+	if f.Pos.IsValid() {
+		fmt.Fprintf(&out, ", line %d, column %d", f.Pos.Line, f.Pos.Column)
+	}
+	fmt.Fprintf(&out, ", in %s\n", f.Function)
+	if args {
+		for i, arg := range f.Args {
+			// strings are quoted so that "1" can't be taken for 1.
+			value := arg.Inspect()
+			if s, ok := arg.(*String); ok {
+				value = fmt.Sprintf("%q", s.Value)
+			}
+			fmt.Fprintf(&out, "    %s = %s\n", f.Parameters[i], value)
+		}
+	}
+	return out.String()
+}
+
+// kindError is an error raised in Go that knows its kind.
+type kindError struct {
+	kind    ErrorKind
+	message string
+}
+
+func (e *kindError) Error() string { return e.message }
+
+// Errorf formats an error of the given kind, for operators and builtins
+// to report.
+func Errorf(kind ErrorKind, format string, args ...any) error {
+	return &kindError{kind: kind, message: fmt.Sprintf(format, args...)}
+}
+
+// KindOf reports the kind of err, which is RuntimeError unless it was
+// made with Errorf or is a runtime error of some other kind.
+func KindOf(err error) ErrorKind {
+	var kinded *kindError
+	if errors.As(err, &kinded) {
+		return kinded.kind
+	}
+	var runtime *Error
+	if errors.As(err, &runtime) && runtime.Kind != "" {
+		return runtime.Kind
+	}
+	return RuntimeError
+}
@@ -0,0 +1,382 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+	"turatti/ast"
+	"turatti/code"
+)
+
+const (
+	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
+	BOOLEAN_OBJ      = "BOOLEAN"
+	STRING_OBJ       = "STRING"
+	NULL_OBJ         = "NULL"
+	ARRAY_OBJ        = "ARRAY"
+	HASH_OBJ         = "HASH"
+	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	ERROR_OBJ        = "ERROR"
+	FUNCTION_OBJ     = "FUNCTION"
+	BUILTIN_OBJ      = "BUILTIN"
+	MODULE_OBJ       = "MODULE"
+	RESULT_OBJ       = "RESULT"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+)
+
+type ObjectType string
+
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+type Object interface {
+	Type() ObjectType
+	Inspect() string
+}
+
+type Integer struct {
+	Value int64
+}
+
+func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// Inspect always shows a decimal point or exponent, so floats with an
+// integral value can still be told apart from integers.
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if strings.ContainsAny(s, ".eIN") {
+		return s
+	}
+	return s + ".0"
+}
+func (f *Float) HashKey() HashKey {
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
+type Boolean struct {
+	Value bool
+}
+
+func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
+func (b *Boolean) HashKey() HashKey {
+	if b.Value {
+		return HashKey{Type: b.Type(), Value: 1}
+	}
+	return HashKey{Type: b.Type(), Value: 0}
+}
+
+// NativeBool returns the shared TRUE or FALSE object for value.
+func NativeBool(value bool) *Boolean {
+	if value {
+		return TRUE
+	}
+	return FALSE
+}
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+type Null struct{}
+
+func (n *Null) Type() ObjectType { return NULL_OBJ }
+func (n *Null) Inspect() string  { return "null" }
+
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashKey identifies a hashable object by type and value, so equal
+// strings map to the same hash entry regardless of their identity.
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Hashable is implemented by the objects that can be used as hash keys.
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash maps hashable keys to values, remembering the order in which keys
+// were first inserted.
+type Hash struct {
+	pairs map[HashKey]HashPair
+	order []HashKey
+}
+
+func NewHash() *Hash {
+	return &Hash{pairs: make(map[HashKey]HashPair)}
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	pairs := []string{}
+	for _, pair := range h.Entries() {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// Set stores value under key, reporting false if key is not hashable.
+func (h *Hash) Set(key, value Object) bool {
+	hashable, ok := key.(Hashable)
+	if !ok {
+		return false
+	}
+	hashKey := hashable.HashKey()
+	if _, exists := h.pairs[hashKey]; !exists {
+		h.order = append(h.order, hashKey)
+	}
+	h.pairs[hashKey] = HashPair{Key: key, Value: value}
+	return true
+}
+
+// Get returns the value stored under key, if any.
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	pair, ok := h.pairs[key.HashKey()]
+	if !ok {
+		return nil, false
+	}
+	return pair.Value, true
+}
+
+func (h *Hash) Len() int { return len(h.pairs) }
+
+// Entries returns the pairs of h in insertion order.
+func (h *Hash) Entries() []HashPair {
+	entries := make([]HashPair, 0, len(h.order))
+	for _, key := range h.order {
+		entries = append(entries, h.pairs[key])
+	}
+	return entries
+}
+
+type ReturnValue struct {
+	Value Object
+}
+
+func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
+
+type Function struct {
+	// Name is the name the function was defined with, if any.
+	Name       string
+	Parameters []ast.Pattern
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+	var out bytes.Buffer
+	out.WriteString("fun(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(f.Body.String())
+	return out.String()
+}
+
+// BuiltinFunction is a function implemented in Go. Returning an error
+// raises it as a runtime error at the call site.
+type BuiltinFunction func(args ...Object) (Object, error)
+
+type Builtin struct {
+	Name string
+	Fn   BuiltinFunction
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin " + b.Name }
+
+// Module is a program loaded by an import statement, seen through the
+// definitions it exports.
+type Module struct {
+	// Name is the path of the module as shown in messages.
+	Name    string
+	Exports map[string]Object
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return "module " + m.Name }
+
+// Result is the outcome of an operation that can fail, as made by the ok
+// and err builtins: the value it produced if Ok, or the error it failed
+// with otherwise.
+type Result struct {
+	Ok    bool
+	Value Object
+}
+
+func (r *Result) Type() ObjectType { return RESULT_OBJ }
+func (r *Result) Inspect() string {
+	if r.Ok {
+		return "ok(" + r.Value.Inspect() + ")"
+	}
+	return "err(" + r.Value.Inspect() + ")"
+}
+
+// Importer loads the modules that a program imports.
+type Importer interface {
+	// Import returns the module at path, which is relative to the program
+	// doing the import unless it is absolute.
+	Import(path string) (*Module, error)
+}
+
+// IsTruthy reports whether obj counts as true in a condition: everything
+// but null and false does.
+func IsTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Null:
+		return false
+	case *Boolean:
+		return obj.Value
+	}
+	return true
+}
+
+// Equal compares two objects by value. Numbers of different types are
+// compared numerically, arrays and hashes element by element, and
+// functions by identity.
+func Equal(a, b Object) bool {
+	switch a := a.(type) {
+	case *Integer:
+		switch b := b.(type) {
+		case *Integer:
+			return a.Value == b.Value
+		case *Float:
+			return float64(a.Value) == b.Value
+		}
+	case *Float:
+		switch b := b.(type) {
+		case *Integer:
+			return a.Value == float64(b.Value)
+		case *Float:
+			return a.Value == b.Value
+		}
+	case *String:
+		if b, ok := b.(*String); ok {
+			return a.Value == b.Value
+		}
+	case *Boolean:
+		if b, ok := b.(*Boolean); ok {
+			return a.Value == b.Value
+		}
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	case *Result:
+		b, ok := b.(*Result)
+		return ok && a.Ok == b.Ok && Equal(a.Value, b.Value)
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !Equal(a.Elements[i], b.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		b, ok := b.(*Hash)
+		if !ok || len(a.pairs) != len(b.pairs) {
+			return false
+		}
+		for key, pair := range a.pairs {
+			other, ok := b.pairs[key]
+			if !ok || !Equal(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// CompiledFunction is the bytecode of a function literal, produced by the
+// compiler and kept in the constant pool.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	SourceMap     code.SourceMap
+	NumParameters int
+	// Locals names the local slots of the function, starting with its
+	// parameters.
+	Locals []string
+	// Source is the function literal as written, for Inspect.
+	Source string
+	// Name is the name the function was defined with, if any.
+	Name string
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Scope holds the local variables of one call of a compiled function.
+// Closures created during the call keep it alive, so they see later
+// definitions in it just like the evaluator's environments do.
+type Scope struct {
+	Fn     *CompiledFunction
+	Locals []Object
+	Outer  *Scope
+}
+
+// Closure is a compiled function together with the scope it was created
+// in. Programs cannot tell it apart from a Function.
+type Closure struct {
+	Fn    *CompiledFunction
+	Scope *Scope
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string  { return c.Fn.Source }
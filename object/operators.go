@@ -0,0 +1,273 @@
+package object
+
+// The operator semantics live here so that every engine running Turatti
+// programs agrees on them, down to the error messages.
+
+// Prefix applies a unary operator to right.
+func Prefix(operator string, right Object) (Object, error) {
+	switch operator {
+	case "!":
+		return NativeBool(!IsTruthy(right)), nil
+	case "-":
+		switch right := right.(type) {
+		case *Integer:
+			return &Integer{Value: -right.Value}, nil
+		case *Float:
+			return &Float{Value: -right.Value}, nil
+		}
+		return nil, Errorf(TypeError, "unknown operator: -%s", right.Type())
+	}
+	return nil, Errorf(TypeError, "unknown operator: %s%s", operator, right.Type())
+}
+
+// Infix applies a binary operator to left and right. Integers combine
+// into integers, and mixing an integer with a float promotes it.
+func Infix(operator string, left, right Object) (Object, error) {
+	switch {
+	case left.Type() == INTEGER_OBJ && right.Type() == INTEGER_OBJ:
+		return integerInfix(operator, left.(*Integer).Value, right.(*Integer).Value)
+	case isNumber(left) && isNumber(right):
+		return floatInfix(operator, toFloat(left), toFloat(right))
+	case left.Type() == STRING_OBJ && right.Type() == STRING_OBJ:
+		return stringInfix(operator, left.(*String).Value, right.(*String).Value)
+	case operator == "==":
+		return NativeBool(Equal(left, right)), nil
+	case operator == "!=":
+		return NativeBool(!Equal(left, right)), nil
+	case left.Type() != right.Type():
+		return nil, Errorf(TypeError, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	}
+	return nil, Errorf(TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+func integerInfix(operator string, left, right int64) (Object, error) {
+	switch operator {
+	case "+":
+		return &Integer{Value: left + right}, nil
+	case "-":
+		return &Integer{Value: left - right}, nil
+	case "*":
+		return &Integer{Value: left * right}, nil
+	case "/":
+		if right == 0 {
+			return nil, Errorf(ZeroDivisionError, "division by zero")
+		}
+		return &Integer{Value: left / right}, nil
+	}
+	if result, ok := compare(operator, left < right, left == right, left > right); ok {
+		return result, nil
+	}
+	return nil, Errorf(TypeError, "unknown operator: INTEGER %s INTEGER", operator)
+}
+
+func floatInfix(operator string, left, right float64) (Object, error) {
+	switch operator {
+	case "+":
+		return &Float{Value: left + right}, nil
+	case "-":
+		return &Float{Value: left - right}, nil
+	case "*":
+		return &Float{Value: left * right}, nil
+	case "/":
+		if right == 0 {
+			return nil, Errorf(ZeroDivisionError, "division by zero")
+		}
+		return &Float{Value: left / right}, nil
+	}
+	if result, ok := compare(operator, left < right, left == right, left > right); ok {
+		return result, nil
+	}
+	return nil, Errorf(TypeError, "unknown operator: FLOAT %s FLOAT", operator)
+}
+
+func stringInfix(operator string, left, right string) (Object, error) {
+	switch operator {
+	case "+":
+		return &String{Value: left + right}, nil
+	case "==":
+		return NativeBool(left == right), nil
+	case "!=":
+		return NativeBool(left != right), nil
+	}
+	return nil, Errorf(TypeError, "unknown operator: STRING %s STRING", operator)
+}
+
+// compare evaluates a comparison operator given how its operands relate,
+// reporting false if operator is not one.
+func compare(operator string, less, equal, greater bool) (Object, bool) {
+	switch operator {
+	case "<":
+		return NativeBool(less), true
+	case ">":
+		return NativeBool(greater), true
+	case "<=":
+		return NativeBool(less || equal), true
+	case ">=":
+		return NativeBool(greater || equal), true
+	case "==":
+		return NativeBool(equal), true
+	case "!=":
+		return NativeBool(!equal), true
+	}
+	return nil, false
+}
+
+func isNumber(obj Object) bool {
+	t := obj.Type()
+	return t == INTEGER_OBJ || t == FLOAT_OBJ
+}
+
+func toFloat(obj Object) float64 {
+	if integer, ok := obj.(*Integer); ok {
+		return float64(integer.Value)
+	}
+	return obj.(*Float).Value
+}
+
+// Index looks up index in an array, string or hash. Arrays and strings
+// fail on out of range indexes, while hashes yield null for missing keys.
+func Index(left, index Object) (Object, error) {
+	switch left := left.(type) {
+	case *Array:
+		i, ok := index.(*Integer)
+		if !ok {
+			return nil, Errorf(TypeError, "array index must be INTEGER, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return nil, Errorf(IndexError, "index out of range: %d with length %d", i.Value, len(left.Elements))
+		}
+		return left.Elements[i.Value], nil
+	case *String:
+		i, ok := index.(*Integer)
+		if !ok {
+			return nil, Errorf(TypeError, "string index must be INTEGER, got %s", index.Type())
+		}
+		runes := []rune(left.Value)
+		if i.Value < 0 || i.Value >= int64(len(runes)) {
+			return nil, Errorf(IndexError, "index out of range: %d with length %d", i.Value, len(runes))
+		}
+		return &String{Value: string(runes[i.Value])}, nil
+	case *Hash:
+		key, ok := index.(Hashable)
+		if !ok {
+			return nil, Errorf(TypeError, "unusable as hash key: %s", index.Type())
+		}
+		if value, ok := left.Get(key); ok {
+			return value, nil
+		}
+		return NULL, nil
+	}
+	return nil, Errorf(TypeError, "index operator not supported: %s", left.Type())
+}
+
+// Member returns the export called name of the module left.
+func Member(left Object, name string) (Object, error) {
+	if result, ok := left.(*Result); ok {
+		return resultMethod(result, name)
+	}
+	module, ok := left.(*Module)
+	if !ok {
+		return nil, Errorf(TypeError, "member access not supported: %s", left.Type())
+	}
+	value, ok := module.Exports[name]
+	if !ok {
+		return nil, Errorf(ImportError, "module %s does not export %s", module.Name, name)
+	}
+	return value, nil
+}
+
+// resultMethod returns the method called name of result, bound to it.
+func resultMethod(result *Result, name string) (Object, error) {
+	method := func(arity int, fn func(args []Object) (Object, error)) (Object, error) {
+		return &Builtin{Name: name, Fn: func(args ...Object) (Object, error) {
+			if len(args) != arity {
+				return nil, Errorf(ArgumentError, "wrong number of arguments to %s: expected %d, got %d", name, arity, len(args))
+			}
+			return fn(args)
+		}}, nil
+	}
+	switch name {
+	case "is_ok":
+		return method(0, func([]Object) (Object, error) { return NativeBool(result.Ok), nil })
+	case "is_err":
+		return method(0, func([]Object) (Object, error) { return NativeBool(!result.Ok), nil })
+	case "unwrap":
+		return method(0, func([]Object) (Object, error) {
+			if !result.Ok {
+				return nil, Errorf(ValueError, "unwrap called on %s", result.Inspect())
+			}
+			return result.Value, nil
+		})
+	case "unwrap_err":
+		return method(0, func([]Object) (Object, error) {
+			if result.Ok {
+				return nil, Errorf(ValueError, "unwrap_err called on %s", result.Inspect())
+			}
+			return result.Value, nil
+		})
+	case "unwrap_or":
+		return method(1, func(args []Object) (Object, error) {
+			if !result.Ok {
+				return args[0], nil
+			}
+			return result.Value, nil
+		})
+	}
+	return nil, Errorf(TypeError, "RESULT has no method %s", name)
+}
+
+// Propagate implements the ? operator: it returns the value of an ok
+// result, and reports false for an err, which the enclosing function
+// returns.
+func Propagate(value Object) (Object, bool, error) {
+	result, ok := value.(*Result)
+	if !ok {
+		return nil, false, Errorf(TypeError, "? operator not supported: %s", value.Type())
+	}
+	if !result.Ok {
+		return nil, false, nil
+	}
+	return result.Value, true, nil
+}
+
+// MatchArray checks that value has the shape of an array pattern: an
+// array of length elements, or of at least length with a rest pattern.
+func MatchArray(value Object, length int, rest bool) error {
+	array, ok := value.(*Array)
+	if !ok {
+		return Errorf(TypeError, "cannot destructure %s as ARRAY", value.Type())
+	}
+	if n := len(array.Elements); n < length || n > length && !rest {
+		if rest {
+			return Errorf(ValueError, "cannot destructure ARRAY of length %d into at least %d elements", n, length)
+		}
+		return Errorf(ValueError, "cannot destructure ARRAY of length %d into %d elements", n, length)
+	}
+	return nil
+}
+
+// MatchHash checks that value has the shape of a hash pattern: a hash
+// holding each of keys.
+func MatchHash(value Object, keys []Object) error {
+	hash, ok := value.(*Hash)
+	if !ok {
+		return Errorf(TypeError, "cannot destructure %s as HASH", value.Type())
+	}
+	for _, key := range keys {
+		hashable, ok := key.(Hashable)
+		if !ok {
+			return Errorf(TypeError, "unusable as hash key: %s", key.Type())
+		}
+		if _, ok := hash.Get(hashable); !ok {
+			return Errorf(ValueError, "cannot destructure HASH without key %s", key.Inspect())
+		}
+	}
+	return nil
+}
+
+// Rest returns a new array with the elements of array from index from on,
+// which the rest of an array pattern binds.
+func Rest(array Object, from int) Object {
+	elements := array.(*Array).Elements[from:]
+	return &Array{Elements: append([]Object{}, elements...)}
+}
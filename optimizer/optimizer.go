@@ -0,0 +1,295 @@
+// Package optimizer rewrites Turatti programs into simpler programs that
+// produce the same results, printing the same output and failing with the
+// same errors at the same positions.
+package optimizer
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"turatti/ast"
+	"turatti/object"
+	"turatti/token"
+)
+
+// Pass selects rewrites for Optimize. Passes combine with |.
+type Pass uint
+
+const (
+	// FoldConstants replaces arithmetic, comparisons and negation of
+	// literals with their result, unless evaluating them fails.
+	FoldConstants Pass = 1 << iota
+	// SimplifyNot replaces ! of a literal with a boolean, !!!x with !x and
+	// a negated equality test with the opposite test.
+	SimplifyNot
+	// PruneBranches removes the branch of an if expression whose condition
+	// is a literal that does not run, inlining the other where possible.
+	PruneBranches
+	// DropUnreachable removes the statements following a return or throw
+	// statement in the same block.
+	DropUnreachable
+
+	All = FoldConstants | SimplifyNot | PruneBranches | DropUnreachable
+)
+
+// Optimize rewrites program in place with the given passes and returns
+// it.
+func Optimize(program *ast.Program, passes Pass) *ast.Program {
+	o := &optimizer{passes: passes, pinned: pinned(program)}
+	ast.Rewrite(program, o.rewrite)
+	return program
+}
+
+type optimizer struct {
+	passes Pass
+	pinned map[ast.Expression]bool
+}
+
+// pinned returns the expressions whose position is also the position of
+// the expression they are in, such as the left operand of an infix
+// expression. Errors of the outer expression are reported there, so the
+// inner one can only be replaced by an expression at the same position.
+func pinned(program *ast.Program) map[ast.Expression]bool {
+	pinned := map[ast.Expression]bool{}
+	parents := []ast.Node{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node == nil {
+			parents = parents[:len(parents)-1]
+			return false
+		}
+		if e, ok := node.(ast.Expression); ok && len(parents) > 0 {
+			if parent, ok := parents[len(parents)-1].(ast.Expression); ok && parent.Pos() == e.Pos() {
+				pinned[e] = true
+			}
+		}
+		parents = append(parents, node)
+		return true
+	})
+	return pinned
+}
+
+// movable reports whether n can be replaced by replacement.
+func (o *optimizer) movable(n, replacement ast.Expression) bool {
+	return !o.pinned[n] || n.Pos() == replacement.Pos()
+}
+
+func (o *optimizer) enabled(pass Pass) bool {
+	return o.passes&pass != 0
+}
+
+// rewrite is called on every node after its children have been
+// optimized, so the operands of an expression are already as simple as
+// they get.
+func (o *optimizer) rewrite(node ast.Node) ast.Node {
+	switch n := node.(type) {
+	case *ast.Program:
+		n.Statements = o.statements(n.Statements)
+	case *ast.BlockStatement:
+		n.Statements = o.statements(n.Statements)
+	case *ast.PrefixExpression:
+		return o.prefix(n)
+	case *ast.InfixExpression:
+		return o.infix(n)
+	case *ast.IfExpression:
+		if o.enabled(PruneBranches) {
+			return o.prune(n)
+		}
+	}
+	return node
+}
+
+func (o *optimizer) prefix(n *ast.PrefixExpression) ast.Expression {
+	if n.Operator == "!" && o.enabled(SimplifyNot) {
+		if right, ok := constant(n.Right); ok {
+			return literal(object.NativeBool(!object.IsTruthy(right)), n.Pos())
+		}
+		switch right := n.Right.(type) {
+		case *ast.PrefixExpression:
+			// !x is a boolean already, so negating it twice more is a no-op.
+			if inner, ok := right.Right.(*ast.PrefixExpression); ok && right.Operator == "!" && inner.Operator == "!" && o.movable(n, inner) {
+				return inner
+			}
+		case *ast.InfixExpression:
+			// Equality tests never fail, so they can trade places freely.
+			if !o.movable(n, right) {
+				break
+			}
+			switch right.Operator {
+			case "==":
+				right.Operator = "!="
+				return right
+			case "!=":
+				right.Operator = "=="
+				return right
+			}
+		}
+	}
+
+	if n.Operator == "-" && o.enabled(FoldConstants) {
+		if right, ok := constant(n.Right); ok {
+			if result, err := object.Prefix(n.Operator, right); err == nil {
+				if folded := literal(result, n.Pos()); folded != nil {
+					return folded
+				}
+			}
+		}
+	}
+	return n
+}
+
+func (o *optimizer) infix(n *ast.InfixExpression) ast.Expression {
+	if !o.enabled(FoldConstants) {
+		return n
+	}
+	left, ok := constant(n.Left)
+	if !ok {
+		return n
+	}
+	right, ok := constant(n.Right)
+	if !ok {
+		return n
+	}
+	// Failing operations stay, so that they fail when the program runs.
+	result, err := object.Infix(n.Operator, left, right)
+	if err != nil {
+		return n
+	}
+	if folded := literal(result, n.Pos()); folded != nil {
+		return folded
+	}
+	return n
+}
+
+// prune simplifies an if expression with a literal condition wherever it
+// appears. Whole statements are inlined into their block by statements.
+func (o *optimizer) prune(n *ast.IfExpression) ast.Expression {
+	condition, ok := constant(n.Condition)
+	if !ok {
+		return n
+	}
+	branch := n.Alternative
+	if object.IsTruthy(condition) {
+		branch = n.Consequence
+	}
+	if branch != nil && len(branch.Statements) == 1 {
+		if stmt, ok := branch.Statements[0].(*ast.ExpressionStatement); ok && o.movable(n, stmt.Expression) {
+			return stmt.Expression
+		}
+	}
+
+	if !object.IsTruthy(condition) {
+		if n.Alternative == nil {
+			n.Consequence.Statements = nil
+			return n
+		}
+		n.Condition = literal(object.TRUE, n.Condition.Pos())
+		n.Consequence = n.Alternative
+	}
+	n.Alternative = nil
+	return n
+}
+
+func (o *optimizer) statements(statements []ast.Statement) []ast.Statement {
+	out := []ast.Statement{}
+	add := func(stmt ast.Statement) bool {
+		out = append(out, stmt)
+		switch stmt.(type) {
+		case *ast.ReturnStatement, *ast.ThrowStatement:
+			return o.enabled(DropUnreachable)
+		}
+		return false
+	}
+
+	for i, stmt := range statements {
+		if branch, ok := o.inline(stmt, i == len(statements)-1); ok {
+			for _, inner := range branch {
+				if add(inner) {
+					return out
+				}
+			}
+			continue
+		}
+		if add(stmt) {
+			return out
+		}
+	}
+	return out
+}
+
+// inline returns the statements an if statement with a literal condition
+// runs, which can replace it since blocks do not open scopes. The last
+// statement of a block gives the block its value, so an if there that runs
+// nothing must stay to provide null.
+func (o *optimizer) inline(stmt ast.Statement, last bool) ([]ast.Statement, bool) {
+	if !o.enabled(PruneBranches) {
+		return nil, false
+	}
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return nil, false
+	}
+	ifExpr, ok := es.Expression.(*ast.IfExpression)
+	if !ok {
+		return nil, false
+	}
+	condition, ok := constant(ifExpr.Condition)
+	if !ok {
+		return nil, false
+	}
+
+	var branch []ast.Statement
+	if object.IsTruthy(condition) {
+		branch = ifExpr.Consequence.Statements
+	} else if ifExpr.Alternative != nil {
+		branch = ifExpr.Alternative.Statements
+	}
+	if last && len(branch) == 0 {
+		return nil, false
+	}
+	return branch, true
+}
+
+// constant returns the value of a literal.
+func constant(expr ast.Expression) (object.Object, bool) {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: expr.Value}, true
+	case *ast.FloatLiteral:
+		return &object.Float{Value: expr.Value}, true
+	case *ast.StringLiteral:
+		return &object.String{Value: expr.Value}, true
+	case *ast.Boolean:
+		return object.NativeBool(expr.Value), true
+	}
+	return nil, false
+}
+
+// literal returns a literal for obj at pos, or nil if obj cannot be
+// written as one.
+func literal(obj object.Object, pos token.Position) ast.Expression {
+	tok := token.Token{Line: pos.Line, Column: pos.Column}
+	switch obj := obj.(type) {
+	case *object.Integer:
+		tok.Type, tok.Literal = token.INT, strconv.FormatInt(obj.Value, 10)
+		return &ast.IntegerLiteral{Token: tok, Value: obj.Value}
+	case *object.Float:
+		if math.IsInf(obj.Value, 0) || math.IsNaN(obj.Value) {
+			return nil
+		}
+		tok.Type, tok.Literal = token.FLOAT, strconv.FormatFloat(obj.Value, 'f', -1, 64)
+		if !strings.Contains(tok.Literal, ".") {
+			tok.Literal += ".0"
+		}
+		return &ast.FloatLiteral{Token: tok, Value: obj.Value}
+	case *object.String:
+		tok.Type, tok.Literal = token.STRING, obj.Value
+		return &ast.StringLiteral{Token: tok, Value: obj.Value}
+	case *object.Boolean:
+		tok.Type, tok.Literal = token.FALSE, "false"
+		if obj.Value {
+			tok.Type, tok.Literal = token.TRUE, "true"
+		}
+		return &ast.Boolean{Token: tok, Value: obj.Value}
+	}
+	return nil
+}
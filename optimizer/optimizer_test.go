@@ -0,0 +1,141 @@
+package optimizer
+
+import (
+	"bytes"
+	"testing"
+	"turatti/ast"
+	"turatti/compiler"
+	"turatti/evaluator"
+	"turatti/formatter"
+	"turatti/lexer"
+	"turatti/object"
+	"turatti/parser"
+	"turatti/vm"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	psr := parser.New(lexer.New(input))
+	program := psr.Parse()
+	if len(psr.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, psr.Errors())
+	}
+	return program
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		passes   Pass
+		expected string
+	}{
+		{"def val = (10 / 4) > 6;", All, "def val = false;\n"},
+		{"-(2 * 3.5) + 1", All, "-6.0;\n"},
+		{`"a" + "b" == "ab"`, All, "true;\n"},
+		{"1 + 2 * x", All, "1 + 2 * x;\n"},
+		{"2 * 3 * x", All, "6 * x;\n"},
+		{"1 / 0; 1 + true; -false", All, "1 / 0;\n1 + true;\n-false;\n"},
+		{"def val = (10 / 4) > 6;", SimplifyNot | PruneBranches | DropUnreachable, "def val = 10 / 4 > 6;\n"},
+
+		{"!true; !5; !!x; !!!x; !(a == b); !(a != b)", All, "false;\nfalse;\n!(!x);\n!x;\na != b;\na == b;\n"},
+		{"!(1 < 2)", All, "false;\n"},
+		{"!(1 < 2)", FoldConstants, "!true;\n"},
+		{"!(1 < 2)", SimplifyNot, "!(1 < 2);\n"},
+		{"!(a < b)", All, "!(a < b);\n"},
+
+		{"if (true) { a; b } else { c }; d", All, "a;\nb;\nd;\n"},
+		{"if (false) { a } else { b; c }; d", All, "b;\nc;\nd;\n"},
+		{"if (false) { a }; d", All, "d;\n"},
+		{"if (false) { a }", All, "if (false) {}\n"},
+		{"def x = if (1 < 2) { 1 } else { 2 };", All, "def x = 1;\n"},
+		{"def x = if (false) { 1 } else { def y = 2; y };", All, "def x = if (true) {\n    def y = 2;\n    y;\n};\n"},
+		{"if (1 < 2) { a } else { b }", FoldConstants, "if (true) {\n    a;\n} else {\n    b;\n}\n"},
+		{"if (x) { a } else { b }", All, "if (x) {\n    a;\n} else {\n    b;\n}\n"},
+		{"(if (true) { a } else { b }) / c", All, "if (true) {\n    a;\n} / c;\n"},
+		{"(!!!x) + 1; !(a == b) + 1; 1 + !!!x", All, "!(!(!x)) + 1;\n!(a == b) + 1;\n1 + !x;\n"},
+
+		{"def f = fun() { a; return 1; b; c };", All, "def f = fun() {\n    a;\n    return 1;\n};\n"},
+		{"def f = fun() { if (true) { return 1; } b };", All, "def f = fun() {\n    return 1;\n};\n"},
+		{"def f = fun() { if (x) { return 1; } b };", All, "def f = fun() {\n    if (x) {\n        return 1;\n    }\n    b;\n};\n"},
+		{"return 1; b", PruneBranches, "return 1;\nb;\n"},
+		{"return 1; b", 0, "return 1;\nb;\n"},
+	}
+
+	for _, tt := range tests {
+		program := Optimize(parse(t, tt.input), tt.passes)
+		if got := string(formatter.Format(program)); got != tt.expected {
+			t.Errorf("%q: expected\n%s\ngot\n%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestPreservesSemantics runs every program before and after each pass on
+// both engines, which must agree on the result, the output and errors,
+// down to the position of every frame of their tracebacks.
+func TestPreservesSemantics(t *testing.T) {
+	programs := []string{
+		"def val = (10 / 4) > 6; val",
+		"-(2 * 3.5) + 1.25 * 4",
+		`"a" + "b" == "ab"`,
+		"9223372036854775807 + 1",
+		"0.1 + 0.2",
+		"1.0 / 0",
+		"-(1 - 1.0)",
+		"!!5 == true",
+		"def x = 1; !(x == 1)",
+		"def f = fun(x) { !!!x }; [f(1), f(false)]",
+		"def f = fun() { println(\"before\"); return 1; println(\"after\") }; f()",
+		"if (true) { def y = 2; }; y",
+		"if (false) { 1 }",
+		"if (false) { 1 } else {}",
+		"if (false) { 1 } else { 2 }",
+		"def f = fun(n) { if (true) { if (n > 1) { return 2; } } 3 }; [f(1), f(2)]",
+		"println(1); return 2; println(3)",
+		"def g = fun() { if (\"yes\") { 1 } else { missing } }; g()",
+		"1 + 2 * 3 > 6; 5 - true",
+		"if (1 < 2) {\n  -true\n}",
+		"def h = fun() { 10 / (5 - 5) }; h()",
+		"(if (true) { [] }) / [1]",
+		"def f = fun(x) { (if (x) { x } else { [] })[5] }; f(false)",
+		"def x = 1; (!!!x) + 1",
+		"def x = 1; !(x == 1) + 1",
+		"def f = fun() { [] }; (if (true) { f })()[0]",
+	}
+	passes := []Pass{FoldConstants, SimplifyNot, PruneBranches, DropUnreachable, All}
+
+	for _, input := range programs {
+		expected, expectedOut := evaluate(parse(t, input))
+		for _, pass := range passes {
+			program := Optimize(parse(t, input), pass)
+			if got, out := evaluate(program); got != expected || out != expectedOut {
+				t.Errorf("%q with passes %b: expected %q printing %q, evaluator got %q printing %q",
+					input, pass, expected, expectedOut, got, out)
+			}
+			if got, out := execute(t, program); got != expected || out != expectedOut {
+				t.Errorf("%q with passes %b: expected %q printing %q, vm got %q printing %q",
+					input, pass, expected, expectedOut, got, out)
+			}
+		}
+	}
+}
+
+func evaluate(program *ast.Program) (string, string) {
+	var out bytes.Buffer
+	env := evaluator.NewGlobalEnvironment(evaluator.Options{Stdout: &out})
+	return describe(evaluator.Eval(program, env)), out.String()
+}
+
+func execute(t *testing.T, program *ast.Program) (string, string) {
+	bytecode, err := compiler.Compile(program, compiler.Options{})
+	if err != nil {
+		t.Fatalf("compiler error: %v", err)
+	}
+	var out bytes.Buffer
+	return describe(vm.New(bytecode, vm.Options{Stdout: &out}).Run()), out.String()
+}
+
+func describe(result object.Object) string {
+	if err, ok := result.(*object.Error); ok {
+		return err.Traceback(false)
+	}
+	return result.Inspect()
+}
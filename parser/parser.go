@@ -16,9 +16,27 @@ const (
 	SUM
 	PRODUCT
 	PREFIX
-	CALL // highest precedence
+	CALL
+	INDEX // highest precedence
 )
 
+var precedences = map[token.TokenType]int{
+	token.EQ:            EQUALS,
+	token.NOT_EQ:        EQUALS,
+	token.LESSTHAN:      LESSGREATER,
+	token.GREATERTHAN:   LESSGREATER,
+	token.LESSEQTHAN:    LESSGREATER,
+	token.GREATEREQTHAN: LESSGREATER,
+	token.PLUS:          SUM,
+	token.MINUS:         SUM,
+	token.ASTERISK:      PRODUCT,
+	token.SLASH:         PRODUCT,
+	token.LPAREN:        CALL,
+	token.LBRACKET:      INDEX,
+	token.DOT:           INDEX,
+	token.QUESTION:      INDEX,
+}
+
 type (
 	prefixParser func() ast.Expression
 	infixParser  func(ast.Expression) ast.Expression
@@ -29,6 +47,13 @@ type Parser struct {
 	currentToken  token.Token
 	peekToken     token.Token
 	errors        []string
+	syntaxErrors  []SyntaxError
+	comments      []token.Token
+	blockDepth    int // how many blocks the current token is in
+	functionDepth int // how many function bodies the current token is in
+	// binding is set while parsing the pattern of a def statement or
+	// parameter, which cannot test values against literals.
+	binding       bool
 	prefixParsers map[token.TokenType]prefixParser
 	infixParsers  map[token.TokenType]infixParser
 }
@@ -45,9 +70,35 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// SyntaxError is a parser error with the position it refers to and a
+// message that leaves the file and the position out, as editors show it.
+type SyntaxError struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e SyntaxError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+// SyntaxErrors returns the errors reported by Errors in a structured form.
+func (p *Parser) SyntaxErrors() []SyntaxError {
+	return p.syntaxErrors
+}
+
+// report records an error at tok, with text as returned by Errors.
+func (p *Parser) report(tok token.Token, message, text string) {
+	p.errors = append(p.errors, text)
+	p.syntaxErrors = append(p.syntaxErrors, SyntaxError{Pos: tok.Pos(), Message: message})
+}
+
 func (p *Parser) nextToken() {
 	p.currentToken = p.peekToken
 	p.peekToken = p.lex.NextToken()
+	for p.peekToken.Type == token.COMMENT {
+		p.comments = append(p.comments, p.peekToken)
+		p.peekToken = p.lex.NextToken()
+	}
 }
 
 func New(lex *lexer.Lexer) *Parser {
@@ -63,8 +114,30 @@ func New(lex *lexer.Lexer) *Parser {
 
 	p.registerPrefixParser(token.IDENT, p.parseIdentifier)
 	p.registerPrefixParser(token.INT, p.parseIntegerLiteral)
+	p.registerPrefixParser(token.FLOAT, p.parseFloatLiteral)
+	p.registerPrefixParser(token.STRING, p.parseStringLiteral)
+	p.registerPrefixParser(token.TRUE, p.parseBoolean)
+	p.registerPrefixParser(token.FALSE, p.parseBoolean)
 	p.registerPrefixParser(token.BANG, p.parsePrefixExpression)
 	p.registerPrefixParser(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefixParser(token.LPAREN, p.parseGroupedExpression)
+	p.registerPrefixParser(token.IF, p.parseIfExpression)
+	p.registerPrefixParser(token.TRY, p.parseTryExpression)
+	p.registerPrefixParser(token.MATCH, p.parseMatchExpression)
+	p.registerPrefixParser(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefixParser(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefixParser(token.LBRACE, p.parseHashLiteral)
+
+	for _, tok := range []token.TokenType{
+		token.EQ, token.NOT_EQ, token.LESSTHAN, token.GREATERTHAN, token.LESSEQTHAN,
+		token.GREATEREQTHAN, token.PLUS, token.MINUS, token.ASTERISK, token.SLASH,
+	} {
+		p.registerInfixParser(tok, p.parseInfixExpression)
+	}
+	p.registerInfixParser(token.LPAREN, p.parseCallExpression)
+	p.registerInfixParser(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfixParser(token.DOT, p.parseMemberExpression)
+	p.registerInfixParser(token.QUESTION, p.parsePropagateExpression)
 	return p
 }
 
@@ -82,63 +155,715 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
+	expression := &ast.InfixExpression{
+		Token:    p.currentToken,
+		Operator: p.currentToken.Literal,
+		Left:     left,
+	}
+	precedence := p.currentPrecedence()
+	p.nextToken()
+	expression.Right = p.parseExpression(precedence)
+	return expression
+}
+
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	literal := &ast.IntegerLiteral{Token: p.currentToken}
 	value, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
 	if err != nil {
-		p.errors = append(p.errors, fmt.Sprintf("couldnt parse %q as integer", p.currentToken.Literal))
+		p.report(p.currentToken, fmt.Sprintf("couldnt parse %q as integer", p.currentToken.Literal),
+			fmt.Sprintf("%s: couldnt parse %q as integer at: line %d column %d.",
+				p.lex.FileName, p.currentToken.Literal, p.currentToken.Line, p.currentToken.Column))
+		return nil
+	}
+	literal.Value = value
+	return literal
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	literal := &ast.FloatLiteral{Token: p.currentToken}
+	value, err := strconv.ParseFloat(p.currentToken.Literal, 64)
+	if err != nil {
+		p.report(p.currentToken, fmt.Sprintf("couldnt parse %q as float", p.currentToken.Literal),
+			fmt.Sprintf("%s: couldnt parse %q as float at: line %d column %d.",
+				p.lex.FileName, p.currentToken.Literal, p.currentToken.Line, p.currentToken.Column))
 		return nil
 	}
 	literal.Value = value
 	return literal
 }
 
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
+}
+
+func (p *Parser) parseBoolean() ast.Expression {
+	return &ast.Boolean{Token: p.currentToken, Value: p.currentToken.Type == token.TRUE}
+}
+
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	p.nextToken()
+	expression := p.parseExpression(LOWEST)
+	if !p.expectToken(token.RPAREN) {
+		p.peekError(token.RPAREN, p.peekToken, p.lex.FileName)
+		return nil
+	}
+	return expression
+}
+
+func (p *Parser) parseIfExpression() ast.Expression {
+	expression := &ast.IfExpression{Token: p.currentToken}
+
+	if !p.expectToken(token.LPAREN) {
+		p.peekError(token.LPAREN, p.peekToken, p.lex.FileName)
+		return nil
+	}
+	p.nextToken()
+	expression.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectToken(token.RPAREN) {
+		p.peekError(token.RPAREN, p.peekToken, p.lex.FileName)
+		return nil
+	}
+	if !p.expectToken(token.LBRACE) {
+		p.peekError(token.LBRACE, p.peekToken, p.lex.FileName)
+		return nil
+	}
+	expression.Consequence = p.parseBlockStatement()
+
+	if p.peekToken.Type == token.ELSE {
+		p.nextToken()
+		if !p.expectToken(token.LBRACE) {
+			p.peekError(token.LBRACE, p.peekToken, p.lex.FileName)
+			return nil
+		}
+		expression.Alternative = p.parseBlockStatement()
+	}
+	return expression
+}
+
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.currentToken}
+
+	if !p.expectToken(token.LBRACE) {
+		p.peekError(token.LBRACE, p.peekToken, p.lex.FileName)
+		return nil
+	}
+	expression.Block = p.parseBlockStatement()
+
+	if p.peekToken.Type == token.CATCH {
+		p.nextToken()
+		if !p.expectToken(token.LPAREN) {
+			p.peekError(token.LPAREN, p.peekToken, p.lex.FileName)
+			return nil
+		}
+		if !p.expectToken(token.IDENT) {
+			p.peekError(token.IDENT, p.peekToken, p.lex.FileName)
+			return nil
+		}
+		expression.Parameter = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		if !p.expectToken(token.RPAREN) {
+			p.peekError(token.RPAREN, p.peekToken, p.lex.FileName)
+			return nil
+		}
+		if !p.expectToken(token.LBRACE) {
+			p.peekError(token.LBRACE, p.peekToken, p.lex.FileName)
+			return nil
+		}
+		expression.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekToken.Type == token.FINALLY {
+		p.nextToken()
+		if !p.expectToken(token.LBRACE) {
+			p.peekError(token.LBRACE, p.peekToken, p.lex.FileName)
+			return nil
+		}
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	if expression.Catch == nil && expression.Finally == nil {
+		tok := p.peekToken
+		p.report(tok, "expected catch or finally after try block",
+			fmt.Sprintf("%s: expected catch or finally after try block at: line %d column %d.",
+				p.lex.FileName, tok.Line, tok.Column))
+		return nil
+	}
+	return expression
+}
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.currentToken}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+	if expression.Value == nil {
+		return nil
+	}
+	if !p.expectToken(token.LBRACE) {
+		p.peekError(token.LBRACE, p.peekToken, p.lex.FileName)
+		return nil
+	}
+
+	for p.peekToken.Type != token.RBRACE {
+		p.nextToken()
+		arm := ast.MatchArm{Pattern: p.parsePattern()}
+		if arm.Pattern == nil {
+			return nil
+		}
+		if p.peekToken.Type == token.IF {
+			p.nextToken()
+			p.nextToken()
+			if arm.Guard = p.parseExpression(LOWEST); arm.Guard == nil {
+				return nil
+			}
+		}
+		if !p.expectToken(token.ARROW) {
+			p.peekError(token.ARROW, p.peekToken, p.lex.FileName)
+			return nil
+		}
+		p.nextToken()
+		if arm.Body = p.parseExpression(LOWEST); arm.Body == nil {
+			return nil
+		}
+		expression.Arms = append(expression.Arms, arm)
+
+		if p.peekToken.Type != token.RBRACE && !p.expectToken(token.COMMA) {
+			p.peekError(token.RBRACE, p.peekToken, p.lex.FileName)
+			return nil
+		}
+	}
+
+	p.nextToken()
+	expression.Rbrace = p.currentToken
+	return expression
+}
+
+// parsePattern parses the pattern starting at the current token.
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.currentToken.Type {
+	case token.IDENT:
+		if p.currentToken.Literal == "_" {
+			return &ast.WildcardPattern{Token: p.currentToken}
+		}
+		return &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	}
+	if p.binding {
+		p.report(p.currentToken, "literal patterns are only allowed in match arms",
+			fmt.Sprintf("%s: literal pattern at: line %d column %d is only allowed in match arms.",
+				p.lex.FileName, p.currentToken.Line, p.currentToken.Column))
+		return nil
+	}
+	if value := p.parseLiteralPattern(); value != nil {
+		return &ast.LiteralPattern{Value: value}
+	}
+	return nil
+}
+
+// parseLiteralPattern parses the literals a pattern can compare against:
+// numbers, optionally negated, strings and booleans.
+func (p *Parser) parseLiteralPattern() ast.Expression {
+	switch p.currentToken.Type {
+	case token.INT:
+		return p.parseIntegerLiteral()
+	case token.FLOAT:
+		return p.parseFloatLiteral()
+	case token.STRING:
+		return p.parseStringLiteral()
+	case token.TRUE, token.FALSE:
+		return p.parseBoolean()
+	case token.MINUS:
+		if p.peekToken.Type == token.INT || p.peekToken.Type == token.FLOAT {
+			return p.parsePrefixExpression()
+		}
+	}
+	p.report(p.currentToken, fmt.Sprintf("unexpected token %s, expected a pattern", p.currentToken.Type),
+		fmt.Sprintf("%s: unexpected token %s at: line %d column %d. expected a pattern instead.",
+			p.lex.FileName, p.currentToken.Type, p.currentToken.Line, p.currentToken.Column))
+	return nil
+}
+
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.currentToken}
+
+	for p.peekToken.Type != token.RBRACKET {
+		p.nextToken()
+		if p.currentToken.Type == token.ELLIPSIS {
+			if !p.expectToken(token.IDENT) {
+				p.peekError(token.IDENT, p.peekToken, p.lex.FileName)
+				return nil
+			}
+			pattern.Rest = p.parsePattern()
+			if !p.expectToken(token.RBRACKET) {
+				p.peekError(token.RBRACKET, p.peekToken, p.lex.FileName)
+				return nil
+			}
+			pattern.Rbracket = p.currentToken
+			return pattern
+		}
+		element := p.parsePattern()
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+
+		if p.peekToken.Type != token.RBRACKET && !p.expectToken(token.COMMA) {
+			p.peekError(token.RBRACKET, p.peekToken, p.lex.FileName)
+			return nil
+		}
+	}
+
+	p.nextToken()
+	pattern.Rbracket = p.currentToken
+	return pattern
+}
+
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pattern := &ast.HashPattern{Token: p.currentToken}
+
+	for p.peekToken.Type != token.RBRACE {
+		p.nextToken()
+		if p.currentToken.Type == token.IDENT && (p.peekToken.Type == token.COMMA || p.peekToken.Type == token.RBRACE) {
+			// {name} is short for {"name": name}.
+			key := &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
+			pattern.Pairs = append(pattern.Pairs, ast.HashPatternPair{Key: key, Value: p.parsePattern()})
+			if p.peekToken.Type == token.COMMA {
+				p.nextToken()
+			}
+			continue
+		}
+		key := p.parseLiteralPattern()
+		if key == nil {
+			return nil
+		}
+		if !p.expectToken(token.COLON) {
+			p.peekError(token.COLON, p.peekToken, p.lex.FileName)
+			return nil
+		}
+		p.nextToken()
+		value := p.parsePattern()
+		if value == nil {
+			return nil
+		}
+		pattern.Pairs = append(pattern.Pairs, ast.HashPatternPair{Key: key, Value: value})
+
+		if p.peekToken.Type != token.RBRACE && !p.expectToken(token.COMMA) {
+			p.peekError(token.RBRACE, p.peekToken, p.lex.FileName)
+			return nil
+		}
+	}
+
+	p.nextToken()
+	pattern.Rbrace = p.currentToken
+	return pattern
+}
+
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	literal := &ast.FunctionLiteral{Token: p.currentToken}
+
+	if !p.expectToken(token.LPAREN) {
+		p.peekError(token.LPAREN, p.peekToken, p.lex.FileName)
+		return nil
+	}
+	literal.Parameters, literal.ParameterTypes = p.parseFunctionParameters()
+	if literal.Parameters == nil {
+		return nil
+	}
+	if p.peekToken.Type == token.COLON {
+		p.nextToken()
+		if literal.ReturnType = p.parseTypeAnnotation(); literal.ReturnType == nil {
+			return nil
+		}
+	}
+
+	if !p.expectToken(token.LBRACE) {
+		p.peekError(token.LBRACE, p.peekToken, p.lex.FileName)
+		return nil
+	}
+	p.functionDepth++
+	literal.Body = p.parseBlockStatement()
+	p.functionDepth--
+	return literal
+}
+
+// parseFunctionParameters returns the parameters and, when any of them is
+// annotated, the type of each one.
+func (p *Parser) parseFunctionParameters() ([]ast.Pattern, []*ast.TypeExpression) {
+	params := []ast.Pattern{}
+	types := []*ast.TypeExpression{}
+	annotated := false
+
+	if p.peekToken.Type == token.RPAREN {
+		p.nextToken()
+		return params, nil
+	}
+
+	for {
+		param := p.parseBindingTarget()
+		if param == nil {
+			return nil, nil
+		}
+		params = append(params, param)
+
+		var t *ast.TypeExpression
+		if p.peekToken.Type == token.COLON {
+			p.nextToken()
+			if t = p.parseTypeAnnotation(); t == nil {
+				return nil, nil
+			}
+			annotated = true
+		}
+		types = append(types, t)
+
+		if p.peekToken.Type != token.COMMA {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectToken(token.RPAREN) {
+		p.peekError(token.RPAREN, p.peekToken, p.lex.FileName)
+		return nil, nil
+	}
+	if !annotated {
+		types = nil
+	}
+	return params, types
+}
+
+// parseBindingTarget parses what a def statement or parameter binds, after
+// the current token: an identifier, or an array or hash pattern.
+func (p *Parser) parseBindingTarget() ast.Pattern {
+	if p.peekToken.Type == token.LBRACKET || p.peekToken.Type == token.LBRACE {
+		p.nextToken()
+		p.binding = true
+		defer func() { p.binding = false }()
+		return p.parsePattern()
+	}
+	if !p.expectToken(token.IDENT) {
+		p.peekError(token.IDENT, p.peekToken, p.lex.FileName)
+		return nil
+	}
+	return &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+}
+
+// parseTypeAnnotation parses the type following the colon at the current
+// token.
+func (p *Parser) parseTypeAnnotation() *ast.TypeExpression {
+	p.nextToken()
+	return p.parseType()
+}
+
+func (p *Parser) parseType() *ast.TypeExpression {
+	t := &ast.TypeExpression{Token: p.currentToken}
+
+	switch p.currentToken.Type {
+	case token.IDENT:
+		t.Name = p.currentToken.Literal
+		return t
+	case token.LBRACKET:
+		p.nextToken()
+		element := p.parseType()
+		if element == nil {
+			return nil
+		}
+		t.Elements = []*ast.TypeExpression{element}
+		if !p.expectToken(token.RBRACKET) {
+			p.peekError(token.RBRACKET, p.peekToken, p.lex.FileName)
+			return nil
+		}
+	case token.LBRACE:
+		p.nextToken()
+		key := p.parseType()
+		if key == nil {
+			return nil
+		}
+		if !p.expectToken(token.COLON) {
+			p.peekError(token.COLON, p.peekToken, p.lex.FileName)
+			return nil
+		}
+		p.nextToken()
+		value := p.parseType()
+		if value == nil {
+			return nil
+		}
+		t.Elements = []*ast.TypeExpression{key, value}
+		if !p.expectToken(token.RBRACE) {
+			p.peekError(token.RBRACE, p.peekToken, p.lex.FileName)
+			return nil
+		}
+	case token.FUNCTION:
+		if !p.expectToken(token.LPAREN) {
+			p.peekError(token.LPAREN, p.peekToken, p.lex.FileName)
+			return nil
+		}
+		t.Elements = []*ast.TypeExpression{}
+		if p.peekToken.Type == token.RPAREN {
+			p.nextToken()
+		} else {
+			for {
+				p.nextToken()
+				element := p.parseType()
+				if element == nil {
+					return nil
+				}
+				t.Elements = append(t.Elements, element)
+				if p.peekToken.Type != token.COMMA {
+					break
+				}
+				p.nextToken()
+			}
+			if !p.expectToken(token.RPAREN) {
+				p.peekError(token.RPAREN, p.peekToken, p.lex.FileName)
+				return nil
+			}
+		}
+		if !p.expectToken(token.COLON) {
+			p.peekError(token.COLON, p.peekToken, p.lex.FileName)
+			return nil
+		}
+		if t.Result = p.parseTypeAnnotation(); t.Result == nil {
+			return nil
+		}
+		return t
+	default:
+		tok := p.currentToken
+		p.report(tok, fmt.Sprintf("unexpected token %s, expected a type", tok.Type),
+			fmt.Sprintf("%s: unexpected token %s at: line %d column %d. expected a type instead.",
+				p.lex.FileName, tok.Type, tok.Line, tok.Column))
+		return nil
+	}
+	t.EndToken = p.currentToken
+	return t
+}
+
+func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
+	expression := &ast.MemberExpression{Token: p.currentToken, Left: left}
+	if !p.expectToken(token.IDENT) {
+		p.peekError(token.IDENT, p.peekToken, p.lex.FileName)
+		return nil
+	}
+	expression.Member = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	return expression
+}
+
+// parsePropagateExpression parses the postfix ?, which returns from the
+// enclosing function and so is an error outside of one.
+func (p *Parser) parsePropagateExpression(value ast.Expression) ast.Expression {
+	tok := p.currentToken
+	if p.functionDepth == 0 {
+		p.report(tok, "? is only allowed inside a function",
+			fmt.Sprintf("%s: ? at: line %d column %d is only allowed inside a function.",
+				p.lex.FileName, tok.Line, tok.Column))
+		return nil
+	}
+	return &ast.PropagateExpression{Token: tok, Value: value}
+}
+
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	expression := &ast.CallExpression{Token: p.currentToken, Function: function}
+	expression.Arguments = p.parseCallArguments()
+	if expression.Arguments == nil {
+		return nil
+	}
+	expression.Rparen = p.currentToken
+	return expression
+}
+
+func (p *Parser) parseCallArguments() []ast.Expression {
+	return p.parseExpressionList(token.RPAREN)
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.currentToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if array.Elements == nil {
+		return nil
+	}
+	array.Rbracket = p.currentToken
+	return array
+}
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.currentToken, Pairs: []ast.HashPair{}}
+
+	for p.peekToken.Type != token.RBRACE {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+		if key == nil {
+			return nil
+		}
+		if !p.expectToken(token.COLON) {
+			p.peekError(token.COLON, p.peekToken, p.lex.FileName)
+			return nil
+		}
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		if value == nil {
+			return nil
+		}
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		if p.peekToken.Type != token.RBRACE && !p.expectToken(token.COMMA) {
+			p.peekError(token.RBRACE, p.peekToken, p.lex.FileName)
+			return nil
+		}
+	}
+
+	p.nextToken()
+	hash.Rbrace = p.currentToken
+	return hash
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	expression := &ast.IndexExpression{Token: p.currentToken, Left: left}
+	p.nextToken()
+	expression.Index = p.parseExpression(LOWEST)
+	if expression.Index == nil {
+		return nil
+	}
+	if !p.expectToken(token.RBRACKET) {
+		p.peekError(token.RBRACKET, p.peekToken, p.lex.FileName)
+		return nil
+	}
+	expression.Rbracket = p.currentToken
+	return expression
+}
+
+// parseExpressionList parses comma separated expressions up to and
+// including end, returning nil if any of them is malformed.
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	if p.peekToken.Type == end {
+		p.nextToken()
+		return list
+	}
+
+	p.nextToken()
+	first := p.parseExpression(LOWEST)
+	if first == nil {
+		return nil
+	}
+	list = append(list, first)
+
+	for p.peekToken.Type == token.COMMA {
+		p.nextToken()
+		p.nextToken()
+		next := p.parseExpression(LOWEST)
+		if next == nil {
+			return nil
+		}
+		list = append(list, next)
+	}
+
+	if !p.expectToken(end) {
+		p.peekError(end, p.peekToken, p.lex.FileName)
+		return nil
+	}
+	return list
+}
+
 func (p *Parser) Parse() *ast.Program {
 	program := &ast.Program{
 		Statements: []ast.Statement{},
 	}
 
 	for p.currentToken.Type != token.EOF {
+		errors := len(p.errors)
 		stmt := p.parseStatement()
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
+		} else if len(p.errors) > errors {
+			p.skipStatement()
 		}
 		p.nextToken()
 	}
 
+	program.Comments = p.comments
 	return program
 }
 
+// skipStatement discards the rest of a statement that failed to parse, so a
+// single mistake is not reported again for each of its remaining tokens.
+func (p *Parser) skipStatement() {
+	for p.currentToken.Type != token.SEMICOLON && p.currentToken.Type != token.EOF {
+		p.nextToken()
+	}
+}
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.currentToken.Type {
 	case token.DEF:
 		return p.parseDefStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
 	default:
-		return nil
+		return p.parseExpressionStatement()
 	}
 }
 
-func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+func (p *Parser) parseExpressionStatement() ast.Statement {
 	smt := &ast.ExpressionStatement{Token: p.currentToken}
 	smt.Expression = p.parseExpression(LOWEST)
+	if smt.Expression == nil {
+		return nil
+	}
 	if p.peekToken.Type == token.SEMICOLON {
 		p.nextToken()
+		smt.Semicolon = p.currentToken
 	}
 	return smt
 }
 
+func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.currentToken, Statements: []ast.Statement{}}
+	p.blockDepth++
+	defer func() { p.blockDepth-- }()
+
+	p.nextToken()
+
+	for p.currentToken.Type != token.RBRACE && p.currentToken.Type != token.EOF {
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+		p.nextToken()
+	}
+
+	if p.currentToken.Type != token.RBRACE {
+		p.report(block.Token, "unterminated block",
+			fmt.Sprintf("%s: unterminated block opened at: line %d column %d.",
+				p.lex.FileName, block.Token.Line, block.Token.Column))
+	}
+	block.Rbrace = p.currentToken
+	return block
+}
+
 func (p *Parser) parseDefStatement() ast.Statement {
 
 	stmt := &ast.DefStatement{Token: p.currentToken}
 
-	if !p.expectToken(token.IDENT) {
-		p.peekError(token.IDENT, p.peekToken, p.lex.FileName)
+	if stmt.Name = p.parseBindingTarget(); stmt.Name == nil {
 		return nil
 	}
 
-	stmt.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	if p.peekToken.Type == token.COLON {
+		p.nextToken()
+		if stmt.Type = p.parseTypeAnnotation(); stmt.Type == nil {
+			return nil
+		}
+	}
 
 	if !p.expectToken(token.ASSIGN) {
 		p.peekError(token.ASSIGN, p.peekToken, p.lex.FileName)
@@ -147,40 +872,155 @@ func (p *Parser) parseDefStatement() ast.Statement {
 
 	p.nextToken()
 
-	expression := []token.Token{}
+	stmt.Value = p.parseExpression(LOWEST)
+	if stmt.Value == nil {
+		return nil
+	}
 
-	for p.currentToken.Type != token.SEMICOLON {
-		expression = append(expression, p.currentToken)
+	if p.peekToken.Type == token.SEMICOLON {
 		p.nextToken()
+		stmt.Semicolon = p.currentToken
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseImportStatement() ast.Statement {
+	stmt := &ast.ImportStatement{Token: p.currentToken}
+	if !p.atTopLevel() {
+		return nil
+	}
+
+	if !p.expectToken(token.STRING) {
+		p.peekError(token.STRING, p.peekToken, p.lex.FileName)
+		return nil
+	}
+	stmt.Path = &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	if !p.expectToken(token.AS) {
+		p.peekError(token.AS, p.peekToken, p.lex.FileName)
+		return nil
+	}
+	if !p.expectToken(token.IDENT) {
+		p.peekError(token.IDENT, p.peekToken, p.lex.FileName)
+		return nil
 	}
+	stmt.Alias = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
 
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+		stmt.Semicolon = p.currentToken
+	}
 	return stmt
 }
 
+func (p *Parser) parseExportStatement() ast.Statement {
+	export := p.currentToken
+	if !p.atTopLevel() {
+		return nil
+	}
+	if !p.expectToken(token.DEF) {
+		p.peekError(token.DEF, p.peekToken, p.lex.FileName)
+		return nil
+	}
+	stmt, ok := p.parseDefStatement().(*ast.DefStatement)
+	if !ok {
+		return nil
+	}
+	stmt.Export = export
+	return stmt
+}
+
+// atTopLevel reports whether the current token is outside every block,
+// reporting an error if it is not.
+func (p *Parser) atTopLevel() bool {
+	if p.blockDepth == 0 {
+		return true
+	}
+	tok := p.currentToken
+	p.report(tok, fmt.Sprintf("%s is only allowed at the top level", tok.Literal),
+		fmt.Sprintf("%s: %s at: line %d column %d is only allowed at the top level.",
+			p.lex.FileName, tok.Literal, tok.Line, tok.Column))
+	return false
+}
+
 func (p *Parser) parseReturnStatement() ast.Statement {
-	stmt := &ast.DefStatement{Token: p.currentToken}
+	stmt := &ast.ReturnStatement{Token: p.currentToken}
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+		stmt.Semicolon = p.currentToken
+		return stmt
+	}
 
 	p.nextToken()
 
-	expression := []token.Token{}
-	for p.currentToken.Type != token.SEMICOLON {
-		expression = append(expression, p.currentToken)
+	stmt.ReturnValue = p.parseExpression(LOWEST)
+	if stmt.ReturnValue == nil {
+		return nil
+	}
+
+	if p.peekToken.Type == token.SEMICOLON {
 		p.nextToken()
+		stmt.Semicolon = p.currentToken
 	}
 
 	return stmt
 }
 
+func (p *Parser) parseThrowStatement() ast.Statement {
+	stmt := &ast.ThrowStatement{Token: p.currentToken}
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+	if stmt.Value == nil {
+		return nil
+	}
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+		stmt.Semicolon = p.currentToken
+	}
+	return stmt
+}
+
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefixParser := p.prefixParsers[p.currentToken.Type]
 	if prefixParser == nil {
-		p.errors = append(p.errors, fmt.Sprintf("no prefix parse function for %s found", p.currentToken.Type))
+		p.noPrefixParserError(p.currentToken)
 		return nil
 	}
 	leftExpression := prefixParser()
+
+	for p.peekToken.Type != token.SEMICOLON && precedence < p.peekPrecedence() {
+		infixParser := p.infixParsers[p.peekToken.Type]
+		if infixParser == nil || leftExpression == nil {
+			return leftExpression
+		}
+		p.nextToken()
+		leftExpression = infixParser(leftExpression)
+	}
+
 	return leftExpression
 }
 
+// Precedence reports the binding power of tok when used as an infix
+// operator, or LOWEST if it is not one.
+func Precedence(tok token.TokenType) int {
+	if precedence, ok := precedences[tok]; ok {
+		return precedence
+	}
+	return LOWEST
+}
+
+func (p *Parser) peekPrecedence() int {
+	return Precedence(p.peekToken.Type)
+}
+
+func (p *Parser) currentPrecedence() int {
+	return Precedence(p.currentToken.Type)
+}
+
 func (p *Parser) expectToken(tok token.TokenType) bool {
 
 	if p.peekToken.Type == tok {
@@ -192,6 +1032,19 @@ func (p *Parser) expectToken(tok token.TokenType) bool {
 }
 
 func (p *Parser) peekError(tok token.TokenType, token token.Token, file string) {
-	p.errors = append(p.errors, fmt.Sprintf("%s: unexpected token %s at: line %d column %d. expected %s instead.",
-		p.lex.FileName, p.currentToken.Type, p.currentToken.Line, p.currentToken.Column, tok))
+	p.report(token, fmt.Sprintf("unexpected token %s, expected %s", token.Type, tok),
+		fmt.Sprintf("%s: unexpected token %s at: line %d column %d. expected %s instead.",
+			file, token.Type, token.Line, token.Column, tok))
+}
+
+func (p *Parser) noPrefixParserError(tok token.Token) {
+	if tok.Type == token.ILLEGAL {
+		p.report(tok, fmt.Sprintf("illegal token %q", tok.Literal),
+			fmt.Sprintf("%s: illegal token %q at: line %d column %d.",
+				p.lex.FileName, tok.Literal, tok.Line, tok.Column))
+		return
+	}
+	p.report(tok, fmt.Sprintf("unexpected token %s", tok.Type),
+		fmt.Sprintf("%s: unexpected token %s at: line %d column %d. no prefix parse function found.",
+			p.lex.FileName, tok.Type, tok.Line, tok.Column))
 }
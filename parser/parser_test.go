@@ -6,6 +6,7 @@ import (
 	"testing"
 	"turatti/ast"
 	"turatti/lexer"
+	"turatti/token"
 )
 
 func TestDefStatement(t *testing.T) {
@@ -48,8 +49,9 @@ func TestDefStatement(t *testing.T) {
 			return
 		}
 
-		if defStmt.Name.Value != test.expectedIdentifier {
-			t.Errorf("expected %s for stmt identifier, got %s\n", test.expectedIdentifier, defStmt.Name.Value)
+		name, ok := defStmt.Name.(*ast.Identifier)
+		if !ok || name.Value != test.expectedIdentifier {
+			t.Errorf("expected %s for stmt identifier, got %s\n", test.expectedIdentifier, defStmt.Name)
 			return
 		}
 
@@ -63,9 +65,9 @@ func TestDefStatement(t *testing.T) {
 
 func TestReturnStatement(t *testing.T) {
 
-	f, err := os.Open("../test_files/test_def_stmt.trt")
+	f, err := os.Open("../test_files/test_return_stmt.trt")
 	if err != nil {
-		t.Error("couldn't open def statement test file")
+		t.Error("couldn't open return statement test file")
 		return
 	}
 
@@ -180,7 +182,7 @@ func TestParsingPrefixExpressions(t *testing.T) {
 			t.Fatalf("wrong operator. expected '%s' got '%s'", tt.operator, exp.Operator)
 		}
 
-		if !testIntegerLiteral(t, exp, tt.integerValue) {
+		if !testIntegerLiteral(t, exp.Right, tt.integerValue) {
 			return
 		}
 
@@ -217,3 +219,278 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	}
 	t.FailNow()
 }
+
+func TestOperatorPrecedenceParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"-a * b", "((-a) * b)"},
+		{"!-a", "(!(-a))"},
+		{"a + b - c", "((a + b) - c)"},
+		{"a + b * c", "(a + (b * c))"},
+		{"(10 / 4) > 6", "((10 / 4) > 6)"},
+		{"5 != 4 == true", "((5 != 4) == true)"},
+		{"a + add(b * c) + d", "((a + add((b * c))) + d)"},
+		{"add(a, b, 1, 2 * 3)", "add(a, b, 1, (2 * 3))"},
+		{"a * [1, 2.5, 3][b * c] * d", "((a * ([1, 2.5, 3][(b * c)])) * d)"},
+		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+		{`{"one": 1, 2: [], true: {}}["one"]`, `({"one": 1, 2: [], true: {}}["one"])`},
+		{"matrix[0][1] + 1", "(((matrix[0])[1]) + 1)"},
+		{"util.max(a, b) + 1", "((util.max)(a, b) + 1)"},
+		{"-m.x[0]", "(-((m.x)[0]))"},
+		{"fun() { -f(x)?[0] + 1 }", "fun() {((-((f(x)?)[0])) + 1)}"},
+		{"fun() { r?.a? }", "fun() {(((r?).a)?)}"},
+	}
+
+	for _, tt := range tests {
+		parser := New(lexer.New(tt.input))
+		program := parser.Parse()
+		checkParserErrors(t, parser)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := "def sum = fun(x, y) {\n    x + y;\n};\nsum(1, 2)"
+	parser := New(lexer.New(input))
+	program := parser.Parse()
+	checkParserErrors(t, parser)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("expected 2 statements, got %d\n", len(program.Statements))
+	}
+
+	def := program.Statements[0].(*ast.DefStatement)
+	function := def.Value.(*ast.FunctionLiteral)
+	body := function.Body.Statements[0].(*ast.ExpressionStatement)
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression
+
+	tests := []struct {
+		node          ast.Node
+		expectedStart token.Position
+		expectedEnd   token.Position
+	}{
+		{program, token.Position{Line: 1, Column: 1}, token.Position{Line: 4, Column: 10}},
+		{def, token.Position{Line: 1, Column: 1}, token.Position{Line: 3, Column: 3}},
+		{def.Name, token.Position{Line: 1, Column: 5}, token.Position{Line: 1, Column: 8}},
+		{function, token.Position{Line: 1, Column: 11}, token.Position{Line: 3, Column: 2}},
+		{function.Parameters[1], token.Position{Line: 1, Column: 18}, token.Position{Line: 1, Column: 19}},
+		{body, token.Position{Line: 2, Column: 5}, token.Position{Line: 2, Column: 11}},
+		{body.Expression, token.Position{Line: 2, Column: 5}, token.Position{Line: 2, Column: 10}},
+		{call, token.Position{Line: 4, Column: 1}, token.Position{Line: 4, Column: 10}},
+	}
+
+	for i, tt := range tests {
+		if tt.node.Pos() != tt.expectedStart {
+			t.Errorf("tests[%d] %T - wrong start. expected %s, got %s", i, tt.node, tt.expectedStart, tt.node.Pos())
+		}
+		if tt.node.End() != tt.expectedEnd {
+			t.Errorf("tests[%d] %T - wrong end. expected %s, got %s", i, tt.node, tt.expectedEnd, tt.node.End())
+		}
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"def x: int = 5;", "def x: int = 5;"},
+		{"def xs: [[float]] = [];", "def xs: [[float]] = [];"},
+		{"def h: {string: [int]} = {};", "def h: {string: [int]} = {};"},
+		{"def f: fun(int, string): bool = g;", "def f: fun(int, string): bool = g;"},
+		{"def k: fun(): fun(int): int = g;", "def k: fun(): fun(int): int = g;"},
+		{"fun(a: int, b: int): int { a + b }", "fun(a: int, b: int): int {(a + b)}"},
+		{"fun(a, b: string) { b }", "fun(a, b: string) {b}"},
+		{"fun(): {string: int} { {} }", "fun(): {string: int} {{}}"},
+	}
+
+	for _, tt := range tests {
+		parser := New(lexer.New(tt.input))
+		program := parser.Parse()
+		checkParserErrors(t, parser)
+		if program.String() != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, program.String())
+		}
+	}
+
+	parser := New(lexer.New("fun(a, b: [int]): int { 1 }"))
+	program := parser.Parse()
+	checkParserErrors(t, parser)
+	function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(function.ParameterTypes) != 2 || function.ParameterTypes[0] != nil || function.ParameterType(1).String() != "[int]" {
+		t.Errorf("unexpected parameter types %v", function.ParameterTypes)
+	}
+	if end := function.ParameterType(1).End(); end != (token.Position{Line: 1, Column: 16}) {
+		t.Errorf("expected the array type to end at 1:16, got %s", end)
+	}
+
+	parser = New(lexer.New("fun(a, b) { 1 }"))
+	program = parser.Parse()
+	checkParserErrors(t, parser)
+	function = program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if function.ParameterTypes != nil || function.ReturnType != nil {
+		t.Errorf("expected no annotations, got %v and %v", function.ParameterTypes, function.ReturnType)
+	}
+}
+
+func TestModules(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "lib/util.trt" as util;`, `import "lib/util.trt" as util;`},
+		{"export def answer = 42;", "export def answer = 42;"},
+		{"export def f: fun(int): int = g;", "export def f: fun(int): int = g;"},
+		{"util.answer", "(util.answer)"},
+	}
+
+	for _, tt := range tests {
+		parser := New(lexer.New(tt.input))
+		program := parser.Parse()
+		checkParserErrors(t, parser)
+		if program.String() != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, program.String())
+		}
+	}
+
+	parser := New(lexer.New("export def x = 1;"))
+	program := parser.Parse()
+	checkParserErrors(t, parser)
+	def := program.Statements[0].(*ast.DefStatement)
+	if !def.Exported() || def.Pos() != (token.Position{Line: 1, Column: 1}) {
+		t.Errorf("expected an exported def starting at 1:1, got %v at %s", def.Exported(), def.Pos())
+	}
+}
+
+func TestExceptions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`throw "boom";`, `throw "boom";`},
+		{"throw {\"kind\": k}", `throw {"kind": k};`},
+		{"try { f() } catch (e) { e }", "try {f()} catch (e) {e}"},
+		{"try { f() } finally { g() }", "try {f()} finally {g()}"},
+		{"def x = try { f() } catch (e) { 0 } finally { g() };", "def x = try {f()} catch (e) {0} finally {g()};"},
+	}
+
+	for _, tt := range tests {
+		parser := New(lexer.New(tt.input))
+		program := parser.Parse()
+		checkParserErrors(t, parser)
+		if program.String() != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match x { 0 => a, _ => b }", "match x {0 => a, _ => b}"},
+		{"match x { -1 => a, 2.5 => b, \"s\" => c, true => d, }", `match x {(-1) => a, 2.5 => b, "s" => c, true => d}`},
+		{"match xs { [] => 0, [first, ...rest] => first, [_, [y]] => y }", "match xs {[] => 0, [first, ...rest] => first, [_, [y]] => y}"},
+		{`match h { {"k": v, 1: [_]} => v }`, `match h {{"k": v, 1: [_]} => v}`},
+		{"match n { x if x > 1 => x + 1, n => n }", "match n {x if (x > 1) => (x + 1), n => n}"},
+		{"def y = match f(x) { [a, ..._] => a };", "def y = match f(x) {[a, ..._] => a};"},
+	}
+
+	for _, tt := range tests {
+		parser := New(lexer.New(tt.input))
+		program := parser.Parse()
+		checkParserErrors(t, parser)
+		if program.String() != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"def [a, b] = pair;", "def [a, b] = pair;"},
+		{"def [h, ...t]: [int] = xs;", "def [h, ...t]: [int] = xs;"},
+		{"def {name, age} = person;", "def {name, age} = person;"},
+		{`def {"n": [x, _], m} = h;`, `def {"n": [x, _], m} = h;`},
+		{"def f = fun([x, y], {z}, w) { x };", "def f = fun([x, y], {z}, w) {x};"},
+		{"match h { {k} => k }", "match h {{k} => k}"},
+	}
+
+	for _, tt := range tests {
+		parser := New(lexer.New(tt.input))
+		program := parser.Parse()
+		checkParserErrors(t, parser)
+		if program.String() != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	parser := New(lexer.New("def = 5; def x = 1;"))
+	program := parser.Parse()
+
+	if len(parser.Errors()) != 1 {
+		t.Errorf("expected 1 error, got %d: %v", len(parser.Errors()), parser.Errors())
+	}
+	if len(program.Statements) != 1 || program.String() != "def x = 1;" {
+		t.Errorf("expected the statement after the error to be parsed, got %q", program.String())
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"def = 5;", "1:5: unexpected token =, expected IDENT"},
+		{"x + ;", "1:5: unexpected token ;"},
+		{"def x = 1 @ 2;", `1:11: illegal token "@"`},
+		{"fun() {\n  x", "1:7: unterminated block"},
+		{"99999999999999999999", `1:1: couldnt parse "99999999999999999999" as integer`},
+		{"def x: = 1;", "1:8: unexpected token =, expected a type"},
+		{"def f: fun(int) = 1;", "1:17: unexpected token =, expected :"},
+		{"def h: {string} = {};", "1:15: unexpected token }, expected :"},
+		{"import util;", "1:8: unexpected token IDENT, expected STRING"},
+		{`import "u.trt";`, "1:15: unexpected token ;, expected AS"},
+		{`fun() { import "u.trt" as u; }`, "1:9: import is only allowed at the top level"},
+		{"if (a) { export def x = 1; }", "1:10: export is only allowed at the top level"},
+		{"export x;", "1:8: unexpected token IDENT, expected DEF"},
+		{"a.1", "1:3: unexpected token INT, expected IDENT"},
+		{"try { f() }", "1:12: expected catch or finally after try block"},
+		{"def x = f()?;", "1:12: ? is only allowed inside a function"},
+		{"if (a) { b? }", "1:11: ? is only allowed inside a function"},
+		{"try { f() } catch { g() }", "1:19: unexpected token {, expected ("},
+		{"throw;", "1:6: unexpected token ;"},
+		{"match x { f() => 1 }", "1:12: unexpected token (, expected =>"},
+		{"match x { 1 + 2 => 1 }", "1:13: unexpected token +, expected =>"},
+		{"match x { [...] => 1 }", "1:15: unexpected token ], expected IDENT"},
+		{"match x { [...r, a] => 1 }", "1:16: unexpected token ,, expected ]"},
+		{"match x { (a) => 1 }", "1:11: unexpected token (, expected a pattern"},
+		{"match x { 1 => 2 3 => 4 }", "1:18: unexpected token INT, expected }"},
+		{"def [a, 1] = xs;", "1:9: literal patterns are only allowed in match arms"},
+		{"fun({k: v}) {}", "1:6: unexpected token IDENT, expected a pattern"},
+		{"def [a, b;", "1:10: unexpected token ;, expected ]"},
+	}
+
+	for _, tt := range tests {
+		parser := New(lexer.New(tt.input))
+		parser.Parse()
+		errors := parser.SyntaxErrors()
+		if len(errors) == 0 || len(errors) != len(parser.Errors()) {
+			t.Fatalf("%q: expected as many syntax errors as errors %v, got %v", tt.input, parser.Errors(), errors)
+		}
+		if errors[0].Error() != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, errors[0].Error())
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"turatti/builtins"
+	"turatti/lexer"
+	"turatti/object"
+	"turatti/parser"
+)
+
+// Command is a colon-prefixed REPL command such as ":load file.trt".
+type Command struct {
+	Name string
+	Args string
+	Help string
+	Run  func(s *Session, args string) error
+}
+
+var defaultCommands = []Command{
+	{Name: "help", Args: "[name]", Help: "list the available commands, or describe a command or builtin", Run: helpCommand},
+	{Name: "env", Help: "list the bindings of the session", Run: envCommand},
+	{Name: "type", Args: "expr", Help: "show the runtime type of an expression", Run: typeCommand},
+	{Name: "load", Args: "file.trt", Help: "evaluate a file into the session", Run: loadCommand},
+	{Name: "save", Args: "file.trt", Help: "write the accepted inputs of the session to a file", Run: saveCommand},
+	{Name: "reset", Help: "drop every binding of the session", Run: resetCommand},
+	{Name: "time", Args: "expr", Help: "evaluate an expression and report how long it took", Run: timeCommand},
+	{Name: "tokens", Args: "[input]", Help: "print the tokens of input, or toggle printing them for each input", Run: tokensCommand},
+	{Name: "ast", Args: "[input]", Help: "print the syntax tree of input, or toggle printing it for each input", Run: astCommand},
+}
+
+// Register adds command to the session, replacing any command of the
+// same name.
+func (s *Session) Register(command Command) {
+	s.commands[command.Name] = command
+}
+
+func (s *Session) command(line string) {
+	name, args, _ := strings.Cut(strings.TrimPrefix(line, ":"), " ")
+	command, ok := s.commands[name]
+	if !ok {
+		fmt.Fprintf(s.out, "unknown command :%s, type :help for a list of commands\n", name)
+		return
+	}
+	if err := command.Run(s, strings.TrimSpace(args)); err != nil {
+		fmt.Fprintf(s.out, "%s\n", err)
+	}
+}
+
+func helpCommand(s *Session, args string) error {
+	if args != "" {
+		if command, ok := s.commands[args]; ok {
+			fmt.Fprintf(s.out, "%s\n", usage(command))
+			fmt.Fprintf(s.out, "    %s\n", command.Help)
+			return nil
+		}
+		if doc, ok := builtins.Doc(args); ok {
+			fmt.Fprintln(s.out, doc)
+			return nil
+		}
+		return fmt.Errorf("no command or builtin named %s", args)
+	}
+
+	names := []string{}
+	for name := range s.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		command := s.commands[name]
+		fmt.Fprintf(s.out, "%-16s %s\n", usage(command), command.Help)
+	}
+	return nil
+}
+
+func usage(command Command) string {
+	return strings.TrimSpace(":" + command.Name + " " + command.Args)
+}
+
+func envCommand(s *Session, args string) error {
+	for _, name := range s.env.Names() {
+		if s.env.IsProtected(name) {
+			continue
+		}
+		value, _ := s.env.Get(name)
+		fmt.Fprintf(s.out, "%s = %s\n", name, value.Inspect())
+	}
+	return nil
+}
+
+func typeCommand(s *Session, args string) error {
+	if args == "" {
+		return fmt.Errorf("usage: :type expr")
+	}
+	// The expression runs in a scratch scope, as it is not recorded.
+	value, err := s.evaluate("repl", args, object.NewEnclosedEnvironment(s.env))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(s.out, value.Type())
+	return nil
+}
+
+func loadCommand(s *Session, args string) error {
+	if args == "" {
+		return fmt.Errorf("usage: :load file.trt")
+	}
+	src, err := os.ReadFile(args)
+	if err != nil {
+		return err
+	}
+	_, err = s.Eval(args, string(src))
+	return err
+}
+
+func saveCommand(s *Session, args string) error {
+	if args == "" {
+		return fmt.Errorf("usage: :save file.trt")
+	}
+	content := strings.Join(s.accepted, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	return os.WriteFile(args, []byte(content), 0644)
+}
+
+func resetCommand(s *Session, args string) error {
+	s.Reset()
+	return nil
+}
+
+func timeCommand(s *Session, args string) error {
+	if args == "" {
+		return fmt.Errorf("usage: :time expr")
+	}
+	start := time.Now()
+	s.input(args)
+	fmt.Fprintf(s.out, "time: %s\n", time.Since(start))
+	return nil
+}
+
+func tokensCommand(s *Session, args string) error {
+	if args != "" {
+		s.printTokens(args)
+		return nil
+	}
+	s.showTokens = !s.showTokens
+	fmt.Fprintf(s.out, "token dump %s\n", onOff(s.showTokens))
+	return nil
+}
+
+func astCommand(s *Session, args string) error {
+	if args != "" {
+		p := parser.New(lexer.New(args))
+		program := p.Parse()
+		if len(p.Errors()) > 0 {
+			return errors.New(strings.Join(p.Errors(), "\n"))
+		}
+		fmt.Fprintln(s.out, program.String())
+		return nil
+	}
+	s.showAST = !s.showAST
+	fmt.Fprintf(s.out, "AST dump %s\n", onOff(s.showAST))
+	return nil
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
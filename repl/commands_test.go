@@ -0,0 +1,118 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runSession(s *Session, input string) string {
+	var out bytes.Buffer
+	s.out = &out
+	s.Run(strings.NewReader(input))
+	return strings.NewReplacer(prompt, "", continuationPrompt, "").Replace(out.String())
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"def b = 2;\ndef a = \"x\";\n:env\n", "a = x\nb = 2\n"},
+		{":type 1 + 2\n:type \"s\"\n:type fun(x) { x }\n", "INTEGER\nSTRING\nFUNCTION\n"},
+		{":type nope\n", "1:1: runtime error: identifier not found: nope\n"},
+		{":type\n", "usage: :type expr\n"},
+		{":help pop\n", "pop(array): a copy of array without its last element, which last(array) returns\n"},
+		{":help save\n", ":save file.trt\n    write the accepted inputs of the session to a file\n"},
+		{":help nope\n", "no command or builtin named nope\n"},
+		{":tokens 1+2\n", "{Type:INT Literal:1 Line:1 Column:1}\n{Type:+ Literal:+ Line:1 Column:2}\n{Type:INT Literal:2 Line:1 Column:3}\n"},
+		{":ast 1 + 2 * x\n:ast def\nx\n", "(1 + (2 * x))\nrepl: unexpected token EOF at: line 1 column 4. expected IDENT instead.\n1:1: runtime error: identifier not found: x\n"},
+		{":tokens\n1\n:tokens\n", "token dump on\n{Type:INT Literal:1 Line:1 Column:1}\n1\ntoken dump off\n"},
+		{"def a = 1;\n:reset\na\n", "1:1: runtime error: identifier not found: a\n"},
+		{":load missing.trt\n", "open missing.trt: no such file or directory\n"},
+	}
+
+	for _, tt := range tests {
+		if got := runSession(New(nil), tt.input); got != tt.expected {
+			t.Errorf("input %q.\nexpected %q\ngot      %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestTimeCommand(t *testing.T) {
+	got := runSession(New(nil), ":time 6 * 7\n")
+	if !strings.HasPrefix(got, "42\ntime: ") {
+		t.Errorf("unexpected output %q", got)
+	}
+}
+
+func TestHelpListsEveryCommand(t *testing.T) {
+	got := runSession(New(nil), ":help\n")
+	for _, command := range defaultCommands {
+		if !strings.Contains(got, ":"+command.Name) {
+			t.Errorf("expected :help to list :%s, got %q", command.Name, got)
+		}
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.trt")
+
+	got := runSession(New(nil), "def a = 20;\nbroken +;\nundefined\ndef double = fun(x) {\n  x * 2\n};\n:save "+path+"\n")
+	if strings.Contains(got, "save") {
+		t.Fatalf("unexpected output %q", got)
+	}
+
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("couldn't read saved session: %v", err)
+	}
+	expected := "def a = 20;\ndef double = fun(x) {\n  x * 2\n};\n"
+	if string(saved) != expected {
+		t.Errorf("expected saved session %q, got %q", expected, saved)
+	}
+
+	if got := runSession(New(nil), ":load "+path+"\ndouble(a) + 2\n"); got != "42\n" {
+		t.Errorf("expected loaded session to define a and double, got %q", got)
+	}
+}
+
+// TestSavedSessionsMatchBindings checks that :save records exactly the
+// inputs that changed the bindings of the session.
+func TestSavedSessionsMatchBindings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.trt")
+
+	got := runSession(New(nil), "def a = 1;\n:type def b = 2\n:time def c = 3;\n:save "+path+"\nb\n")
+	if !strings.HasSuffix(got, "1:1: runtime error: identifier not found: b\n") {
+		t.Errorf("expected :type to leave b undefined, got %q", got)
+	}
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("couldn't read saved session: %v", err)
+	}
+	if expected := "def a = 1;\ndef c = 3;\n"; string(saved) != expected {
+		t.Errorf("expected saved session %q, got %q", expected, saved)
+	}
+}
+
+func TestRegisterCommand(t *testing.T) {
+	s := New(nil)
+	s.Register(Command{
+		Name: "greet",
+		Args: "name",
+		Help: "say hello",
+		Run: func(s *Session, args string) error {
+			_, err := s.Out().Write([]byte("hello " + args + "\n"))
+			return err
+		},
+	})
+
+	if got := runSession(s, ":greet turatti\n"); got != "hello turatti\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+	if got := runSession(s, ":help\n"); !strings.Contains(got, ":greet name") {
+		t.Errorf("expected :help to list registered commands, got %q", got)
+	}
+}
@@ -0,0 +1,294 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+const maxHistory = 1000
+
+var errInterrupted = errors.New("interrupted")
+
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// scannerReader reads plain lines, for input that is not a terminal.
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *scannerReader) ReadLine(prompt string) (string, error) {
+	io.WriteString(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// editor is an emacs-style line editor with history and tab completion.
+// It expects its input in raw mode, with rawMode switching it on and
+// returning the function that restores the previous mode.
+type editor struct {
+	in          *bufio.Reader
+	out         io.Writer
+	rawMode     func() (restore func())
+	complete    func(prefix string) []string
+	history     []string
+	historyFile string
+
+	line []rune
+	pos  int
+}
+
+func newLineReader(in io.Reader, out io.Writer, complete func(string) []string) lineReader {
+	if file, ok := in.(*os.File); ok && isTerminal(file.Fd()) {
+		e := &editor{
+			in:       bufio.NewReader(in),
+			out:      out,
+			complete: complete,
+			rawMode: func() func() {
+				restore, err := makeRaw(file.Fd())
+				if err != nil {
+					return func() {}
+				}
+				return restore
+			},
+		}
+		if home, err := os.UserHomeDir(); err == nil {
+			e.loadHistory(filepath.Join(home, ".turatti_history"))
+		}
+		return e
+	}
+	return &scannerReader{scanner: bufio.NewScanner(in), out: out}
+}
+
+func (e *editor) loadHistory(path string) {
+	e.historyFile = path
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+}
+
+func (e *editor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[1:]
+	}
+	if e.historyFile == "" {
+		return
+	}
+	file, err := os.OpenFile(e.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	fmt.Fprintln(file, line)
+}
+
+func (e *editor) ReadLine(prompt string) (string, error) {
+	if e.rawMode != nil {
+		defer e.rawMode()()
+	}
+
+	e.line, e.pos = []rune{}, 0
+	historyIndex := len(e.history)
+	draft := ""
+	e.refresh(prompt)
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			io.WriteString(e.out, "\r\n")
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			io.WriteString(e.out, "\r\n")
+			line := string(e.line)
+			e.addHistory(line)
+			return line, nil
+		case 3: // Ctrl-C
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupted
+		case 4: // Ctrl-D
+			if len(e.line) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.deleteAt(e.pos)
+		case 127, 8: // Backspace
+			if e.pos > 0 {
+				e.pos--
+				e.deleteAt(e.pos)
+			}
+		case 1: // Ctrl-A
+			e.pos = 0
+		case 5: // Ctrl-E
+			e.pos = len(e.line)
+		case 2: // Ctrl-B
+			e.moveCursor(-1)
+		case 6: // Ctrl-F
+			e.moveCursor(1)
+		case 11: // Ctrl-K
+			e.line = e.line[:e.pos]
+		case 21: // Ctrl-U
+			e.line = append([]rune{}, e.line[e.pos:]...)
+			e.pos = 0
+		case 16: // Ctrl-P
+			historyIndex, draft = e.browseHistory(historyIndex, -1, draft)
+		case 14: // Ctrl-N
+			historyIndex, draft = e.browseHistory(historyIndex, 1, draft)
+		case '\t':
+			e.completeWord(prompt)
+		case 27: // escape sequence
+			switch e.readEscape() {
+			case 'A':
+				historyIndex, draft = e.browseHistory(historyIndex, -1, draft)
+			case 'B':
+				historyIndex, draft = e.browseHistory(historyIndex, 1, draft)
+			case 'C':
+				e.moveCursor(1)
+			case 'D':
+				e.moveCursor(-1)
+			case 'H':
+				e.pos = 0
+			case 'F':
+				e.pos = len(e.line)
+			case '3':
+				e.deleteAt(e.pos)
+			}
+		default:
+			if unicode.IsPrint(r) {
+				e.line = append(e.line[:e.pos], append([]rune{r}, e.line[e.pos:]...)...)
+				e.pos++
+			}
+		}
+		e.refresh(prompt)
+	}
+}
+
+// readEscape consumes the rest of an ANSI escape sequence and returns the
+// key it stands for: the final letter of arrow, home and end keys, or the
+// leading digit of "ESC [ n ~" sequences, normalized so home is 'H',
+// end is 'F' and delete is '3'.
+func (e *editor) readEscape() rune {
+	first, _, err := e.in.ReadRune()
+	if err != nil || (first != '[' && first != 'O') {
+		return 0
+	}
+	key, _, err := e.in.ReadRune()
+	if err != nil {
+		return 0
+	}
+	if key < '0' || key > '9' {
+		return key
+	}
+	for next := key; next != '~'; {
+		if next, _, err = e.in.ReadRune(); err != nil {
+			return 0
+		}
+	}
+	switch key {
+	case '1', '7':
+		return 'H'
+	case '4', '8':
+		return 'F'
+	}
+	return key
+}
+
+func (e *editor) moveCursor(delta int) {
+	if pos := e.pos + delta; pos >= 0 && pos <= len(e.line) {
+		e.pos = pos
+	}
+}
+
+func (e *editor) deleteAt(pos int) {
+	if pos < len(e.line) {
+		e.line = append(e.line[:pos], e.line[pos+1:]...)
+	}
+}
+
+func (e *editor) browseHistory(index, delta int, draft string) (int, string) {
+	next := index + delta
+	if next < 0 || next > len(e.history) {
+		return index, draft
+	}
+	if index == len(e.history) {
+		draft = string(e.line)
+	}
+	if next == len(e.history) {
+		e.line = []rune(draft)
+	} else {
+		e.line = []rune(e.history[next])
+	}
+	e.pos = len(e.line)
+	return next, draft
+}
+
+func (e *editor) completeWord(prompt string) {
+	if e.complete == nil {
+		return
+	}
+	start := e.pos
+	for start > 0 && isWordRune(e.line[start-1]) {
+		start--
+	}
+	prefix := string(e.line[start:e.pos])
+	candidates := e.complete(prefix)
+	if len(candidates) == 0 {
+		return
+	}
+
+	common := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, common) {
+			common = common[:len(common)-1]
+		}
+	}
+
+	if len(common) > len(prefix) {
+		insert := []rune(common[len(prefix):])
+		e.line = append(e.line[:e.pos], append(insert, e.line[e.pos:]...)...)
+		e.pos += len(insert)
+		return
+	}
+	if len(candidates) > 1 {
+		io.WriteString(e.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+	}
+}
+
+func (e *editor) refresh(prompt string) {
+	fmt.Fprintf(e.out, "\r\x1b[K%s%s\r", prompt, string(e.line))
+	if column := len([]rune(prompt)) + e.pos; column > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dC", column)
+	}
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
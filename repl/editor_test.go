@@ -0,0 +1,95 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func newTestEditor(input string, history ...string) *editor {
+	return &editor{
+		in:      bufio.NewReader(strings.NewReader(input)),
+		out:     &bytes.Buffer{},
+		history: history,
+		complete: func(prefix string) []string {
+			candidates := []string{}
+			for _, name := range []string{"def", "delta", "fun"} {
+				if strings.HasPrefix(name, prefix) {
+					candidates = append(candidates, name)
+				}
+			}
+			return candidates
+		},
+	}
+}
+
+func TestEditorReadLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		history  []string
+		expected string
+	}{
+		{"plain", "def x = 1;\r", nil, "def x = 1;"},
+		{"left arrow insert", "ac\x1b[Db\r", nil, "abc"},
+		{"right arrow", "ab\x1b[D\x1b[D\x1b[Cx\r", nil, "axb"},
+		{"home and end", "b\x1b[Ha\x1b[Fc\r", nil, "abc"},
+		{"ctrl-a and ctrl-e", "b\x01a\x05c\r", nil, "abc"},
+		{"backspace", "abd\x7fc\r", nil, "abc"},
+		{"delete key", "abxc\x1b[D\x1b[D\x1b[3~\r", nil, "abc"},
+		{"ctrl-k", "abcdef\x1b[D\x1b[D\x1b[D\x0b\r", nil, "abc"},
+		{"ctrl-u", "xyzabc\x1b[D\x1b[D\x1b[D\x15\r", nil, "abc"},
+		{"history up", "\x1b[A\r", []string{"first", "second"}, "second"},
+		{"history up twice", "\x1b[A\x1b[A\r", []string{"first", "second"}, "first"},
+		{"history keeps draft", "dr\x1b[A\x1b[B\r", []string{"first"}, "dr"},
+		{"tab completes unique", "fu\t(\r", nil, "fun("},
+		{"tab completes common prefix", "d\t\r", nil, "de"},
+	}
+
+	for _, tt := range tests {
+		e := newTestEditor(tt.input, tt.history...)
+		line, err := e.ReadLine(">> ")
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if line != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, line)
+		}
+	}
+}
+
+func TestEditorControlKeys(t *testing.T) {
+	e := newTestEditor("abc\x03\x04")
+	if _, err := e.ReadLine(">> "); err != errInterrupted {
+		t.Errorf("expected ctrl-c to interrupt the line, got %v", err)
+	}
+	if _, err := e.ReadLine(">> "); err != io.EOF {
+		t.Errorf("expected ctrl-d on an empty line to end input, got %v", err)
+	}
+
+	e = newTestEditor("ab\x1b[D\x04\r")
+	if line, _ := e.ReadLine(">> "); line != "a" {
+		t.Errorf("expected ctrl-d to delete under the cursor, got %q", line)
+	}
+}
+
+func TestEditorHistory(t *testing.T) {
+	e := newTestEditor("one\rone\r\rtwo\r")
+	for i := 0; i < 4; i++ {
+		e.ReadLine(">> ")
+	}
+	if strings.Join(e.history, ",") != "one,two" {
+		t.Errorf("expected duplicate and empty lines to be skipped, got %v", e.history)
+	}
+}
+
+func TestEditorListsCandidates(t *testing.T) {
+	e := newTestEditor("de\t\r")
+	e.ReadLine(">> ")
+	if !strings.Contains(e.out.(*bytes.Buffer).String(), "def  delta") {
+		t.Errorf("expected ambiguous completion to list candidates, got %q", e.out.(*bytes.Buffer).String())
+	}
+}
@@ -1,28 +1,234 @@
 package repl
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"sort"
+	"strings"
+	"turatti/ast"
+	"turatti/evaluator"
 	"turatti/lexer"
+	"turatti/modules"
+	"turatti/object"
+	"turatti/parser"
 	"turatti/token"
 )
 
+const (
+	prompt             = ">> "
+	continuationPrompt = ".. "
+)
+
+// Session is an interactive evaluation session whose bindings persist
+// across inputs.
+type Session struct {
+	out        io.Writer
+	env        *object.Environment
+	commands   map[string]Command
+	accepted   []string
+	showTokens bool
+	showAST    bool
+}
+
+func New(out io.Writer) *Session {
+	s := &Session{out: out, commands: map[string]Command{}}
+	s.Reset()
+	for _, command := range defaultCommands {
+		s.Register(command)
+	}
+	return s
+}
+
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	for {
+	New(out).Run(in)
+}
+
+func (s *Session) Out() io.Writer {
+	return s.out
+}
+
+func (s *Session) Env() *object.Environment {
+	return s.env
+}
+
+// Reset drops every binding and accepted input of the session.
+func (s *Session) Reset() {
+	opts := evaluator.Options{Stdout: s.out, File: "<stdin>"}
+	opts.Importer = modules.NewLoader(modules.SearchPath(os.Getenv(modules.PathVariable)), opts).Importer("-")
+	s.env = evaluator.NewGlobalEnvironment(opts)
+	s.accepted = nil
+}
 
-		fmt.Printf(">> ")
+// Accepted returns the inputs that parsed and ran without errors, in order.
+func (s *Session) Accepted() []string {
+	return s.accepted
+}
+
+func (s *Session) Run(in io.Reader) {
+	reader := newLineReader(in, s.out, s.completions)
+	input := []string{}
+	for {
+		currentPrompt := prompt
+		if len(input) > 0 {
+			currentPrompt = continuationPrompt
+		}
 
-		if !scanner.Scan() {
+		text, err := reader.ReadLine(currentPrompt)
+		if err == errInterrupted {
+			input = input[:0]
+			continue
+		}
+		if err != nil {
 			return
 		}
 
-		text := scanner.Text()
-		l := lexer.New(text)
+		if len(input) == 0 && strings.HasPrefix(strings.TrimSpace(text), ":") {
+			s.command(strings.TrimSpace(text))
+			continue
+		}
 
-		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-			fmt.Printf("%+v\n", tok)
+		// An empty line forces evaluation of whatever was typed so far,
+		// letting the parser report what is missing.
+		input = append(input, text)
+		source := strings.Join(input, "\n")
+		if text != "" && isIncomplete(source) {
+			continue
 		}
+		input = input[:0]
+		if strings.TrimSpace(source) != "" {
+			s.input(source)
+		}
+	}
+}
+
+// Eval parses and evaluates source in the session environment, returning
+// parse and runtime errors as an error.
+func (s *Session) Eval(name, source string) (object.Object, error) {
+	evaluated, err := s.evaluate(name, source, s.env)
+	if err != nil {
+		return nil, err
+	}
+	s.accepted = append(s.accepted, source)
+	return evaluated, nil
+}
+
+// evaluate is Eval in env, without recording source among the accepted
+// inputs.
+func (s *Session) evaluate(name, source string, env *object.Environment) (object.Object, error) {
+	lex := lexer.New(source)
+	lex.FileName = name
+	p := parser.New(lex)
+	program := p.Parse()
+	if len(p.Errors()) > 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	evaluated := evaluator.Eval(program, env)
+	if err, ok := evaluated.(*object.Error); ok {
+		return nil, errors.New(err.Inspect())
+	}
+	return evaluated, nil
+}
+
+func (s *Session) printTokens(text string) {
+	l := lexer.New(text)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(s.out, "%+v\n", tok)
+	}
+}
+
+func (s *Session) completions(prefix string) []string {
+	seen := map[string]bool{}
+	candidates := []string{}
+	for _, name := range append(token.Keywords(), s.env.Names()...) {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// isIncomplete reports whether source ends inside an unclosed brace,
+// bracket, parenthesis or string, or right after an operator expecting an
+// operand.
+func isIncomplete(source string) bool {
+	depth := 0
+	last := token.Token{}
+	l := lexer.New(source)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LBRACE, token.LPAREN, token.LBRACKET:
+			depth++
+		case token.RBRACE, token.RPAREN, token.RBRACKET:
+			depth--
+		case token.ILLEGAL:
+			if strings.HasPrefix(tok.Literal, "\"") {
+				return true
+			}
+		case token.COMMENT:
+			continue
+		}
+		last = tok
+	}
+
+	if depth > 0 {
+		return true
+	}
+	switch last.Type {
+	case token.ASSIGN, token.COMMA, token.PLUS, token.MINUS, token.ASTERISK, token.SLASH, token.BANG,
+		token.EQ, token.NOT_EQ, token.LESSTHAN, token.GREATERTHAN, token.LESSEQTHAN, token.GREATEREQTHAN,
+		token.LBRACKET, token.COLON, token.ARROW:
+		return true
+	}
+	return false
+}
+
+// input evaluates text as typed at the prompt, recording it for :save when
+// it parses and runs without errors, so that saved sessions rebuild the
+// bindings the session holds.
+func (s *Session) input(text string) {
+	if s.eval(text) {
+		s.accepted = append(s.accepted, text)
+	}
+}
+
+// eval evaluates text and prints its value or error, reporting whether it
+// parsed and ran without errors.
+func (s *Session) eval(text string) bool {
+	if s.showTokens {
+		s.printTokens(text)
+	}
+
+	p := parser.New(lexer.New(text))
+	program := p.Parse()
+	if len(p.Errors()) > 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintln(s.out, msg)
+		}
+		return false
+	}
+
+	if s.showAST {
+		fmt.Fprintln(s.out, program.String())
+	}
+
+	evaluated := evaluator.Eval(program, s.env)
+	if evaluated == nil || len(program.Statements) == 0 {
+		return false
+	}
+	accepted := evaluated.Type() != object.ERROR_OBJ
+	if _, isDef := program.Statements[len(program.Statements)-1].(*ast.DefStatement); isDef && accepted {
+		return true
+	}
+	// errors raised inside calls show where they were called from.
+	if err, ok := evaluated.(*object.Error); ok && len(err.Frames) > 1 {
+		fmt.Fprint(s.out, err.Traceback(false))
+		return false
 	}
+	fmt.Fprintln(s.out, evaluated.Inspect())
+	return accepted
 }
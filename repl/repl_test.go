@@ -0,0 +1,104 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"turatti/object"
+)
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"def x = 5;\nx * 2\n", "10\n"},
+		{"def add = fun(a, b) { a + b };\nadd(1, 2)\nadd(3, 4)\n", "3\n7\n"},
+		{"y\n", "1:1: runtime error: identifier not found: y\n"},
+		{"def = 5;\n", "repl: unexpected token = at: line 1 column 5. expected IDENT instead.\n"},
+		{":ast\n1 + 2 * 3\n", "AST dump on\n(1 + (2 * 3))\n7\n"},
+		{":tokens\n-1\n", "token dump on\n{Type:- Literal:- Line:1 Column:1}\n{Type:INT Literal:1 Line:1 Column:2}\n-1\n"},
+		{":nope\n", "unknown command :nope, type :help for a list of commands\n"},
+		{"def sum = fun(x, y) {\n  x + y;\n};\nsum(1,\n 2)\n", "3\n"},
+		{"1 +\n\n2\n", "repl: unexpected token EOF at: line 2 column 1. no prefix parse function found.\n2\n"},
+		{"\"multi\nline\"\n", "multi\nline\n"},
+		{"def f = fun() {\n\nf\n", "repl: unterminated block opened at: line 1 column 15.\n1:1: runtime error: identifier not found: f\n"},
+		{
+			"def f = fun(x) { x[1] };\nf([0])\n",
+			"Traceback (most recent call last):\n  File \"<stdin>\", line 1, column 1, in <main>\n" +
+				"  File \"<stdin>\", line 1, column 18, in f\nIndexError: index out of range: 1 with length 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out)
+		got := strings.NewReplacer(prompt, "", continuationPrompt, "").Replace(out.String())
+		if got != tt.expected {
+			t.Errorf("input %q.\nexpected %q\ngot      %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestIsIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"def x = 5;", false},
+		{"def sum = fun(x, y) {", true},
+		{"def sum = fun(x, y) { x + y }", false},
+		{"sum(1,", true},
+		{"sum(1, 2", true},
+		{"1 +", true},
+		{"def x =", true},
+		{"1 + // more to come", true},
+		{"\"unclosed", true},
+		{"\"closed\"", false},
+		{"def xs = [", true},
+		{"def xs = [1, 2", true},
+		{"def xs = [1, 2]", false},
+		{`def h = {"a":`, true},
+		{"match x { 1 =>", true},
+		{"xs[0]", false},
+		{")", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isIncomplete(tt.input); got != tt.expected {
+			t.Errorf("isIncomplete(%q): expected %t, got %t", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestPromptsGoToOut(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader("def f = fun() {\n1 };\nf()\n"), &out)
+	if out.String() != ">> .. >> 1\n>> " {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestCompletions(t *testing.T) {
+	s := New(nil)
+	s.env.Set("delta", &object.Integer{Value: 1})
+	s.env.Set("result", &object.Integer{Value: 2})
+
+	tests := []struct {
+		prefix   string
+		expected []string
+	}{
+		{"d", []string{"def", "delta"}},
+		{"re", []string{"rest", "result", "return"}},
+		{"fu", []string{"fun"}},
+		{"zz", []string{}},
+	}
+
+	for _, tt := range tests {
+		got := s.completions(tt.prefix)
+		if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("completions(%q): expected %v, got %v", tt.prefix, tt.expected, got)
+		}
+	}
+}
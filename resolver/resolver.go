@@ -0,0 +1,378 @@
+package resolver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"turatti/ast"
+	"turatti/token"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+func (s Severity) String() string {
+	if s == Warning {
+		return "warning"
+	}
+	return "error"
+}
+
+type Diagnostic struct {
+	Severity Severity
+	Pos      token.Position
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Pos, d.Severity, d.Message)
+}
+
+type BindingKind int
+
+const (
+	Def BindingKind = iota
+	Parameter
+	Predeclared
+	Import
+	Catch
+	Match
+)
+
+// Binding is a name introduced by a def statement, a function parameter,
+// an import statement, a catch clause, a match pattern or the host before
+// the program runs.
+type Binding struct {
+	Name string
+	Kind BindingKind
+	// Node is the *ast.DefStatement, *ast.ImportStatement or parameter
+	// *ast.Identifier that introduced the binding, nil for predeclared
+	// names.
+	Node ast.Node
+	Uses []*ast.Identifier
+
+	// def is the identifier in the pattern of a def statement that the
+	// binding is for, as the pattern can bind several names.
+	def *ast.Identifier
+}
+
+func (b *Binding) Pos() token.Position {
+	if declaration := b.Declaration(); declaration != nil {
+		return declaration.Pos()
+	}
+	return token.Position{}
+}
+
+// Declaration returns the identifier that introduced the binding, nil for
+// predeclared names.
+func (b *Binding) Declaration() *ast.Identifier {
+	switch n := b.Node.(type) {
+	case *ast.DefStatement:
+		return b.def
+	case *ast.ImportStatement:
+		return n.Alias
+	case *ast.Identifier:
+		return n
+	}
+	return nil
+}
+
+type Result struct {
+	Diagnostics []Diagnostic
+	// Bindings maps every resolved identifier use to its binding.
+	Bindings map[*ast.Identifier]*Binding
+	// Declarations maps the names in every def statement and every
+	// parameter to the binding it introduces.
+	Declarations map[*ast.Identifier]*Binding
+	// Depths maps every resolved identifier use to the number of function
+	// scopes between the use and its binding, 0 being the innermost.
+	Depths map[*ast.Identifier]int
+}
+
+func (r *Result) HasErrors() bool {
+	for _, d := range r.Diagnostics {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Result) Errors() []Diagnostic {
+	return r.filter(Error)
+}
+
+func (r *Result) Warnings() []Diagnostic {
+	return r.filter(Warning)
+}
+
+func (r *Result) filter(severity Severity) []Diagnostic {
+	result := []Diagnostic{}
+	for _, d := range r.Diagnostics {
+		if d.Severity == severity {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+type scope struct {
+	parent *scope
+	// block is set for the scope of a match arm or catch clause, which
+	// holds the names its pattern or parameter binds while the defs in its
+	// body belong to the enclosing function scope.
+	block    bool
+	bindings map[string]*Binding
+	defined  map[*Binding]bool
+	order    []*Binding
+}
+
+type resolver struct {
+	scope  *scope
+	result *Result
+}
+
+// Resolve binds every identifier in program to the def statement or
+// parameter it refers to. Names in predeclared are treated as already
+// defined in the global scope, as happens across REPL inputs.
+func Resolve(program *ast.Program, predeclared ...string) *Result {
+	r := &resolver{result: &Result{
+		Diagnostics:  []Diagnostic{},
+		Bindings:     map[*ast.Identifier]*Binding{},
+		Declarations: map[*ast.Identifier]*Binding{},
+		Depths:       map[*ast.Identifier]int{},
+	}}
+
+	r.openScope()
+	for _, name := range predeclared {
+		binding := &Binding{Name: name, Kind: Predeclared}
+		r.scope.bindings[name] = binding
+		r.scope.defined[binding] = true
+	}
+	r.hoist(program.Statements)
+	for _, stmt := range program.Statements {
+		r.resolve(stmt)
+	}
+	r.closeScope()
+
+	sort.SliceStable(r.result.Diagnostics, func(i, j int) bool {
+		return r.result.Diagnostics[i].Pos.Before(r.result.Diagnostics[j].Pos)
+	})
+	return r.result
+}
+
+func (r *resolver) report(severity Severity, pos token.Position, format string, args ...any) {
+	r.result.Diagnostics = append(r.result.Diagnostics, Diagnostic{
+		Severity: severity,
+		Pos:      pos,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (r *resolver) openScope() {
+	r.scope = &scope{parent: r.scope, bindings: map[string]*Binding{}, defined: map[*Binding]bool{}}
+}
+
+func (r *resolver) openBlock() {
+	r.openScope()
+	r.scope.block = true
+}
+
+// hoisted returns the innermost function scope, which the defs and
+// imports of the current scope are hoisted to.
+func (r *resolver) hoisted() *scope {
+	s := r.scope
+	for s.block {
+		s = s.parent
+	}
+	return s
+}
+
+func (r *resolver) closeScope() {
+	for _, binding := range r.scope.order {
+		if len(binding.Uses) == 0 && !strings.HasPrefix(binding.Name, "_") {
+			r.report(Warning, binding.Pos(), "%s declared and not used", binding.Name)
+		}
+	}
+	r.scope = r.scope.parent
+}
+
+func (r *resolver) declare(binding *Binding) {
+	if previous, ok := r.scope.bindings[binding.Name]; ok {
+		if previous.Kind == Predeclared {
+			r.report(Warning, binding.Pos(), "%s redefines a predeclared name", binding.Name)
+		} else {
+			r.report(Error, binding.Pos(), "%s redeclared in this scope, previous declaration at %s", binding.Name, previous.Pos())
+			return
+		}
+	}
+
+	for outer := r.scope.parent; outer != nil; outer = outer.parent {
+		if shadowed, ok := outer.bindings[binding.Name]; ok {
+			if shadowed.Kind == Predeclared {
+				r.report(Warning, binding.Pos(), "%s shadows a predeclared name", binding.Name)
+			} else {
+				r.report(Warning, binding.Pos(), "%s shadows declaration at %s", binding.Name, shadowed.Pos())
+			}
+			break
+		}
+	}
+
+	r.scope.bindings[binding.Name] = binding
+	r.scope.order = append(r.scope.order, binding)
+	if declaration := binding.Declaration(); declaration != nil {
+		r.result.Declarations[declaration] = binding
+	}
+}
+
+// hoist declares every def and import of a scope up front, including the
+// ones nested in blocks, so function bodies can refer to names defined
+// after them.
+func (r *resolver) hoist(statements []ast.Statement) {
+	for _, stmt := range statements {
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.DefStatement:
+				for _, name := range ast.Bindings(n.Name) {
+					r.declare(&Binding{Name: name.Value, Kind: Def, Node: n, def: name})
+				}
+			case *ast.ImportStatement:
+				r.declare(&Binding{Name: n.Alias.Value, Kind: Import, Node: n})
+			case *ast.FunctionLiteral:
+				return false
+			}
+			return true
+		})
+	}
+}
+
+func (r *resolver) resolve(node ast.Node) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.DefStatement:
+			r.resolve(n.Value)
+			scope := r.hoisted()
+			for _, name := range ast.Bindings(n.Name) {
+				if binding, ok := scope.bindings[name.Value]; ok && binding.Node == n {
+					scope.defined[binding] = true
+				}
+			}
+			return false
+		case *ast.ImportStatement:
+			scope := r.hoisted()
+			if binding, ok := scope.bindings[n.Alias.Value]; ok && binding.Node == n {
+				scope.defined[binding] = true
+			}
+			return false
+		case *ast.TryExpression:
+			r.resolve(n.Block)
+			if n.Catch != nil {
+				// The parameter is only visible in the catch block.
+				r.openBlock()
+				binding := &Binding{Name: n.Parameter.Value, Kind: Catch, Node: n.Parameter}
+				r.declare(binding)
+				r.scope.defined[binding] = true
+				r.resolve(n.Catch)
+				r.closeScope()
+			}
+			if n.Finally != nil {
+				r.resolve(n.Finally)
+			}
+			return false
+		case *ast.MatchExpression:
+			r.resolveMatch(n)
+			return false
+		case *ast.MemberExpression:
+			// The member is looked up in the module, not in scope.
+			r.resolve(n.Left)
+			return false
+		case *ast.FunctionLiteral:
+			r.resolveFunction(n)
+			return false
+		case *ast.Identifier:
+			r.use(n)
+			return false
+		}
+		return true
+	})
+}
+
+func (r *resolver) resolveMatch(match *ast.MatchExpression) {
+	r.resolve(match.Value)
+	for _, arm := range match.Arms {
+		// The names an arm binds are only visible in it, and shadow the
+		// ones of enclosing scopes, builtins included.
+		r.openBlock()
+		for _, name := range ast.Bindings(arm.Pattern) {
+			binding := &Binding{Name: name.Value, Kind: Match, Node: name}
+			r.declare(binding)
+			r.scope.defined[binding] = true
+		}
+		if arm.Guard != nil {
+			r.resolve(arm.Guard)
+		}
+		r.resolve(arm.Body)
+		r.closeScope()
+	}
+	if !match.CatchesAll() {
+		r.report(Warning, match.Pos(), "match has no _ arm: unmatched values give null")
+	}
+}
+
+func (r *resolver) resolveFunction(function *ast.FunctionLiteral) {
+	r.openScope()
+	for _, param := range function.Parameters {
+		for _, name := range ast.Bindings(param) {
+			binding := &Binding{Name: name.Value, Kind: Parameter, Node: name}
+			r.declare(binding)
+			r.scope.defined[binding] = true
+		}
+	}
+	if function.Body != nil {
+		r.hoist(function.Body.Statements)
+		for _, stmt := range function.Body.Statements {
+			r.resolve(stmt)
+		}
+	}
+	r.closeScope()
+}
+
+func (r *resolver) use(identifier *ast.Identifier) {
+	var pending *Binding
+	pendingDepth := 0
+
+	depth := 0
+	for s := r.scope; s != nil; s = s.parent {
+		if binding, ok := s.bindings[identifier.Value]; ok {
+			// A use nested in a function only runs when the function is
+			// called, so a binding defined later in an outer scope counts.
+			if s.defined[binding] || depth > 0 {
+				r.bind(identifier, binding, depth)
+				return
+			}
+			if pending == nil {
+				pending, pendingDepth = binding, depth
+			}
+		}
+		if !s.block {
+			depth++
+		}
+	}
+
+	if pending != nil {
+		r.report(Error, identifier.Pos(), "%s used before its definition at %s", identifier.Value, pending.Pos())
+		r.bind(identifier, pending, pendingDepth)
+		return
+	}
+	r.report(Error, identifier.Pos(), "undefined: %s", identifier.Value)
+}
+
+func (r *resolver) bind(identifier *ast.Identifier, binding *Binding, depth int) {
+	binding.Uses = append(binding.Uses, identifier)
+	r.result.Bindings[identifier] = binding
+	r.result.Depths[identifier] = depth
+}
@@ -0,0 +1,164 @@
+package resolver
+
+import (
+	"strings"
+	"testing"
+	"turatti/ast"
+	"turatti/lexer"
+	"turatti/parser"
+	"turatti/token"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	psr := parser.New(lexer.New(input))
+	program := psr.Parse()
+	if len(psr.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", psr.Errors())
+	}
+	return program
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"def x = 1; x;", []string{}},
+		{"y;", []string{"1:1: error: undefined: y"}},
+		{"x; def x = 1;", []string{"1:1: error: x used before its definition at 1:8"}},
+		{"def x = x;", []string{"1:9: error: x used before its definition at 1:5"}},
+		{"def x = 1; def x = 2; x;", []string{"1:16: error: x redeclared in this scope, previous declaration at 1:5"}},
+		{"def f = fun(a, a) { a; }; f;", []string{"1:16: error: a redeclared in this scope, previous declaration at 1:13"}},
+		{"def x = 1;", []string{"1:5: warning: x declared and not used"}},
+		{"def _x = 1;", []string{}},
+		{"def f = fun(a, b) { a; }; f;", []string{"1:16: warning: b declared and not used"}},
+		{
+			"def x = 1; def f = fun(x) { x; }; f(x);",
+			[]string{"1:24: warning: x shadows declaration at 1:5"},
+		},
+		{
+			"def f = fun() { if (true) { def y = 1; } y; }; f();",
+			[]string{},
+		},
+		{
+			"def f = fun() { g(); }; def g = fun() { f(); }; f();",
+			[]string{},
+		},
+		{
+			"def fib = fun(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2); }; fib(10);",
+			[]string{},
+		},
+		{"try { 1 } catch (e) { e; }", []string{}},
+		{"try { 1 } catch (e) { 2 }", []string{"1:18: warning: e declared and not used"}},
+		{"try { e } catch (e) { e; }", []string{"1:7: error: undefined: e"}},
+		{"try { 1 } catch (e) { e; }; e", []string{"1:29: error: undefined: e"}},
+		{"try { 1 } catch (e) { e; } try { 2 } catch (e) { e; }", []string{}},
+		{"def e = 1; try { e } catch (e) { e; }", []string{"1:29: warning: e shadows declaration at 1:5"}},
+		{"match 1 { [x, ...xs] if x => xs, x => x, _ => 0 }", []string{}},
+		{"match 1 { 0 => 1, {\"k\": v} => v }", []string{"1:1: warning: match has no _ arm: unmatched values give null"}},
+		{"match 1 { n if n > 0 => n }", []string{"1:1: warning: match has no _ arm: unmatched values give null"}},
+		{"match 1 { [a, b] => a, _ => 0 }", []string{"1:15: warning: b declared and not used"}},
+		{"match y { y => 1 }", []string{"1:7: error: undefined: y", "1:11: warning: y declared and not used"}},
+		{"def f = fun(x) { match x { [x] => x, _ => x } }; f;", []string{"1:29: warning: x shadows declaration at 1:13"}},
+		{"match [1] { [x] if x > 5 => 0, _ => x }", []string{"1:37: error: undefined: x"}},
+		{"match 1 { n => if (n) { def y = n; } }; y;", []string{}},
+		{"match 1 { _ => y }; def y = 1;", []string{"1:16: error: y used before its definition at 1:25"}},
+		{"def x = 1; def f = fun() { match x { [x] => x, _ => 0 } }; f;", []string{"1:39: warning: x shadows declaration at 1:5"}},
+		{"def [a, b] = [1, 2]; a;", []string{"1:9: warning: b declared and not used"}},
+		{"def [x] = [x];", []string{"1:12: error: x used before its definition at 1:6"}},
+		{`def {a, "k": a} = {}; a;`, []string{"1:14: error: a redeclared in this scope, previous declaration at 1:6"}},
+		{"def f = fun([x, y], {z}) { x + z; }; f;", []string{"1:17: warning: y declared and not used"}},
+		{"def f = fun(a) { def [a] = [1]; a; }; f;", []string{"1:23: error: a redeclared in this scope, previous declaration at 1:13"}},
+	}
+
+	for _, tt := range tests {
+		result := Resolve(parse(t, tt.input))
+		got := []string{}
+		for _, d := range result.Diagnostics {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("resolving %q.\nexpected %q\ngot      %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestPredeclared(t *testing.T) {
+	result := Resolve(parse(t, "x + 1; def f = fun(print) { print; }; f;"), "x", "print")
+
+	if len(result.Errors()) != 0 {
+		t.Errorf("expected no errors, got %v", result.Errors())
+	}
+	warnings := result.Warnings()
+	if len(warnings) != 1 || warnings[0].Message != "print shadows a predeclared name" {
+		t.Errorf("expected a single shadowing warning, got %v", warnings)
+	}
+
+	result = Resolve(parse(t, "match [1] { [first, ...rest] => rest, _ => 0 }"), "first", "rest")
+	if len(result.Errors()) != 0 || len(result.Warnings()) != 3 {
+		t.Errorf("expected match bindings to shadow predeclared names, got %v", result.Diagnostics)
+	}
+}
+
+func TestBindingsAndDepths(t *testing.T) {
+	program := parse(t, `
+def a = 1;
+def outer = fun(b) {
+    def inner = fun(c) {
+        a + b + c;
+    };
+    inner;
+};
+outer;
+`)
+	result := Resolve(program)
+	if result.HasErrors() {
+		t.Fatalf("unexpected errors %v", result.Errors())
+	}
+
+	expected := map[string]struct {
+		depth int
+		kind  BindingKind
+		pos   token.Position
+	}{
+		"a":     {2, Def, token.Position{Line: 2, Column: 5}},
+		"b":     {1, Parameter, token.Position{Line: 3, Column: 17}},
+		"c":     {0, Parameter, token.Position{Line: 4, Column: 21}},
+		"inner": {0, Def, token.Position{Line: 4, Column: 9}},
+		"outer": {0, Def, token.Position{Line: 3, Column: 5}},
+	}
+
+	seen := 0
+	ast.Inspect(program, func(node ast.Node) bool {
+		identifier, ok := node.(*ast.Identifier)
+		if !ok {
+			return true
+		}
+		binding, ok := result.Bindings[identifier]
+		if !ok {
+			return true
+		}
+		seen++
+		want := expected[identifier.Value]
+		if depth := result.Depths[identifier]; depth != want.depth {
+			t.Errorf("%s: expected depth %d, got %d", identifier.Value, want.depth, depth)
+		}
+		if binding.Kind != want.kind || binding.Pos() != want.pos {
+			t.Errorf("%s: expected binding %v at %s, got %v at %s", identifier.Value, want.kind, want.pos, binding.Kind, binding.Pos())
+		}
+		return true
+	})
+
+	if seen != len(expected) {
+		t.Errorf("expected %d resolved uses, got %d", len(expected), seen)
+	}
+
+	if len(result.Declarations) != len(expected) {
+		t.Errorf("expected %d declarations, got %d", len(expected), len(result.Declarations))
+	}
+	for identifier, binding := range result.Declarations {
+		if want := expected[identifier.Value]; binding.Pos() != identifier.Pos() || binding.Pos() != want.pos {
+			t.Errorf("%s: expected declaration at %s, got %s", identifier.Value, want.pos, identifier.Pos())
+		}
+	}
+}
@@ -1,11 +1,18 @@
 package token
 
+import (
+	"fmt"
+	"sort"
+)
+
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
 	IDENT   = "IDENT"
 	INT     = "INT"
+	FLOAT   = "FLOAT"
 	STRING  = "STRING"
+	COMMENT = "COMMENT"
 
 	COMMA     = ","
 	SEMICOLON = ";"
@@ -13,6 +20,13 @@ const (
 	RPAREN    = ")"
 	LBRACE    = "{"
 	RBRACE    = "}"
+	LBRACKET  = "["
+	RBRACKET  = "]"
+	COLON     = ":"
+	DOT       = "."
+	QUESTION  = "?"
+	ARROW     = "=>"
+	ELLIPSIS  = "..."
 
 	ASSIGN      = "="
 	PLUS        = "+"
@@ -41,25 +55,41 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
+	AS       = "AS"
+	THROW    = "THROW"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	MATCH    = "MATCH"
 )
 
 var keywords = map[string]TokenType{
-	"fun":    FUNCTION,
-	"def":    DEF,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
-	"true":   TRUE,
-	"false":  FALSE,
+	"fun":     FUNCTION,
+	"def":     DEF,
+	"if":      IF,
+	"else":    ELSE,
+	"return":  RETURN,
+	"true":    TRUE,
+	"false":   FALSE,
+	"import":  IMPORT,
+	"export":  EXPORT,
+	"as":      AS,
+	"throw":   THROW,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
+	"match":   MATCH,
 }
 
 type TokenType string
 
 type Token struct {
-	Type    TokenType
-	Literal string
-	Line    int
-	Column  int
+	Type    TokenType `json:"type"`
+	Literal string    `json:"literal"`
+	Line    int       `json:"line"`
+	Column  int       `json:"column"`
 }
 
 func NewToken(tokenType TokenType, ch rune, line, column int) Token {
@@ -86,3 +116,52 @@ func FindKeywordOrIdent(literal string) TokenType {
 	}
 	return IDENT
 }
+
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) Before(other Position) bool {
+	return p.Line < other.Line || (p.Line == other.Line && p.Column < other.Column)
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+func (t Token) Pos() Position {
+	return Position{Line: t.Line, Column: t.Column}
+}
+
+// End returns the position immediately after the last rune of the token.
+func (t Token) End() Position {
+	literal := t.Literal
+	if t.Type == STRING {
+		literal = "\"" + literal + "\""
+	}
+	end := t.Pos()
+	for _, ch := range literal {
+		if ch == '\n' {
+			end.Line++
+			end.Column = 1
+			continue
+		}
+		end.Column++
+	}
+	return end
+}
+
+// Keywords returns the reserved words of the language in alphabetical order.
+func Keywords() []string {
+	names := make([]string, 0, len(keywords))
+	for name := range keywords {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,532 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"turatti/ast"
+	"turatti/builtins"
+	"turatti/resolver"
+	"turatti/token"
+)
+
+// Error is a type error, with a message that leaves the position out.
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+type Result struct {
+	Errors []Error
+	types  map[ast.Node]Type
+}
+
+// TypeOf returns the type inferred for an expression, or for the name in a
+// def statement or a parameter, and nil for any other node.
+func (r *Result) TypeOf(node ast.Node) Type {
+	if t, ok := r.types[node]; ok {
+		return prune(t)
+	}
+	return nil
+}
+
+// signatures holds the types of the builtins and of args. Builtins taking a
+// variable number of arguments are any.
+var signatures = map[string]*scheme{
+	"len":     monomorphic(fn(Int, Any)),
+	"print":   monomorphic(Any),
+	"println": monomorphic(Any),
+	"puts":    monomorphic(Any),
+	"type":    monomorphic(fn(String, Any)),
+	"str":     monomorphic(fn(String, Any)),
+	"int":     monomorphic(fn(Int, Any)),
+	"float":   monomorphic(fn(Float, Any)),
+	"bool":    monomorphic(fn(Bool, Any)),
+	"push":    generic(func(a, _ Type) Type { return fn(&Array{a}, &Array{a}, a) }),
+	"pop":     generic(func(a, _ Type) Type { return fn(&Array{a}, &Array{a}) }),
+	"first":   generic(func(a, _ Type) Type { return fn(a, &Array{a}) }),
+	"last":    generic(func(a, _ Type) Type { return fn(a, &Array{a}) }),
+	"rest":    generic(func(a, _ Type) Type { return fn(&Array{a}, &Array{a}) }),
+	"keys":    generic(func(k, v Type) Type { return fn(&Array{k}, &Hash{k, v}) }),
+	"values":  generic(func(k, v Type) Type { return fn(&Array{v}, &Hash{k, v}) }),
+	"range":   monomorphic(Any),
+	"min":     monomorphic(Any),
+	"max":     monomorphic(Any),
+	"abs":     generic(func(a, _ Type) Type { return fn(a, a) }),
+	"assert":  monomorphic(Any),
+	"error":   monomorphic(fn(Any, Any)),
+	"ok":      monomorphic(fn(Any, Any)),
+	"err":     monomorphic(fn(Any, Any)),
+	"args":    monomorphic(&Array{String}),
+}
+
+func fn(result Type, params ...Type) *Function {
+	return &Function{Parameters: params, Result: result}
+}
+
+// generic builds a scheme over two variables, which build need not use.
+func generic(build func(a, b Type) Type) *scheme {
+	a, b := &Variable{level: 1}, &Variable{level: 1}
+	return generalize(build(a, b), 0)
+}
+
+type function struct {
+	// result is the annotated result type, or the type every return has
+	// so far when there is no annotation.
+	result    Type
+	annotated bool
+}
+
+type checker struct {
+	unifier
+	resolution *resolver.Result
+	env        map[*resolver.Binding]*scheme
+	level      int
+	functions  []*function
+	result     *Result
+}
+
+// Check infers the type of every expression in program and reports the
+// ones that do not fit where they are used. Builtins and args are
+// predeclared, as when programs run; names that do not resolve have type
+// any.
+func Check(program *ast.Program) *Result {
+	predeclared := append(builtins.Names(), "args")
+	c := &checker{
+		resolution: resolver.Resolve(program, predeclared...),
+		env:        map[*resolver.Binding]*scheme{},
+		result:     &Result{Errors: []Error{}, types: map[ast.Node]Type{}},
+	}
+
+	c.hoist(program.Statements)
+	for _, stmt := range program.Statements {
+		c.statement(stmt)
+	}
+
+	sort.SliceStable(c.result.Errors, func(i, j int) bool {
+		return c.result.Errors[i].Pos.Before(c.result.Errors[j].Pos)
+	})
+	return c.result
+}
+
+func (c *checker) report(pos token.Position, format string, args ...any) {
+	c.result.Errors = append(c.result.Errors, Error{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+// expect unifies actual with expected, reporting where actual was used if
+// they do not fit.
+func (c *checker) expect(expected, actual Type, pos token.Position, where string) {
+	if !c.unify(expected, actual) {
+		c.report(pos, "cannot use %s as %s in %s", actual, expected, where)
+	}
+}
+
+// join returns the type that both a and b have, or any if they have none.
+func (c *checker) join(a, b Type) Type {
+	if a == nil {
+		return b
+	}
+	if c.unify(a, b) {
+		return a
+	}
+	return Any
+}
+
+// hoist gives every def of a scope a type before any of them is checked,
+// so functions can use names defined after them. Defs without annotation
+// get a variable one level deeper than the scope, which their value is
+// inferred at.
+func (c *checker) hoist(statements []ast.Statement) {
+	for _, stmt := range statements {
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.DefStatement:
+				name, ok := n.Name.(*ast.Identifier)
+				if !ok {
+					return true
+				}
+				binding := c.resolution.Declarations[name]
+				if binding == nil {
+					return true
+				}
+				if n.Type != nil {
+					c.env[binding] = monomorphic(c.annotation(n.Type))
+				} else {
+					c.env[binding] = monomorphic(c.fresh(c.level + 1))
+				}
+			case *ast.FunctionLiteral:
+				return false
+			}
+			return true
+		})
+	}
+}
+
+// statement returns the type of the value a statement leaves, which is
+// any for def and return statements.
+func (c *checker) statement(stmt ast.Statement) Type {
+	switch s := stmt.(type) {
+	case *ast.DefStatement:
+		c.def(s)
+	case *ast.ReturnStatement:
+		c.ret(s)
+	case *ast.ThrowStatement:
+		c.expression(s.Value)
+	case *ast.ExpressionStatement:
+		return c.expression(s.Expression)
+	case *ast.BlockStatement:
+		return c.block(s)
+	}
+	return Any
+}
+
+func (c *checker) block(block *ast.BlockStatement) Type {
+	var t Type = Any
+	if block == nil {
+		return t
+	}
+	for _, stmt := range block.Statements {
+		t = c.statement(stmt)
+	}
+	return t
+}
+
+func (c *checker) def(s *ast.DefStatement) {
+	c.level++
+	t := c.expression(s.Value)
+	c.level--
+
+	name, ok := s.Name.(*ast.Identifier)
+	if !ok {
+		// The names a pattern binds are any, like those of match arms.
+		if s.Type != nil {
+			c.expect(c.annotation(s.Type), t, s.Value.Pos(), "definition of "+s.Name.String())
+		}
+		c.result.types[s.Name] = t
+		return
+	}
+	binding := c.resolution.Declarations[name]
+	declared, ok := c.env[binding]
+	if binding == nil || !ok {
+		c.result.types[name] = t
+		return
+	}
+	if s.Type != nil {
+		c.expect(declared.t, t, s.Value.Pos(), "definition of "+name.Value)
+		c.result.types[name] = declared.t
+		return
+	}
+	if !c.unify(declared.t, t) {
+		// Only uses before the definition can have constrained the
+		// variable, so they are where the mismatch lies.
+		c.report(s.Value.Pos(), "cannot use %s as %s in definition of %s", t, declared.t, name.Value)
+	}
+	c.env[binding] = generalize(declared.t, c.level)
+	c.result.types[name] = declared.t
+}
+
+func (c *checker) ret(s *ast.ReturnStatement) {
+	var t Type = Any
+	pos := s.Pos()
+	if s.ReturnValue != nil {
+		t = c.expression(s.ReturnValue)
+		pos = s.ReturnValue.Pos()
+	}
+	if len(c.functions) == 0 {
+		return
+	}
+	c.returns(t, pos)
+}
+
+// returns adds t to the types the innermost function returns.
+func (c *checker) returns(t Type, pos token.Position) {
+	f := c.functions[len(c.functions)-1]
+	if f.annotated {
+		c.expect(f.result, t, pos, "return")
+		return
+	}
+	f.result = c.join(f.result, t)
+}
+
+func (c *checker) expression(e ast.Expression) Type {
+	t := c.infer(e)
+	if e != nil {
+		c.result.types[e] = t
+	}
+	return t
+}
+
+func (c *checker) infer(e ast.Expression) Type {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.FloatLiteral:
+		return Float
+	case *ast.StringLiteral:
+		return String
+	case *ast.Boolean:
+		return Bool
+	case *ast.Identifier:
+		return c.identifier(e)
+	case *ast.PrefixExpression:
+		return c.prefix(e)
+	case *ast.InfixExpression:
+		return c.infix(e)
+	case *ast.IfExpression:
+		c.expression(e.Condition)
+		consequence := c.block(e.Consequence)
+		if e.Alternative == nil {
+			return Any
+		}
+		return c.join(consequence, c.block(e.Alternative))
+	case *ast.TryExpression:
+		t := c.block(e.Block)
+		if e.Catch != nil {
+			t = c.join(t, c.block(e.Catch))
+		}
+		// The value of a finally block is discarded.
+		c.block(e.Finally)
+		return t
+	case *ast.MatchExpression:
+		// The names patterns bind are any, like catch parameters.
+		c.expression(e.Value)
+		var t Type
+		for _, arm := range e.Arms {
+			if arm.Guard != nil {
+				c.expression(arm.Guard)
+			}
+			t = c.join(t, c.expression(arm.Body))
+		}
+		if t == nil || !e.CatchesAll() {
+			return Any
+		}
+		return t
+	case *ast.FunctionLiteral:
+		return c.function(e)
+	case *ast.CallExpression:
+		return c.call(e)
+	case *ast.ArrayLiteral:
+		var element Type
+		for _, el := range e.Elements {
+			element = c.join(element, c.expression(el))
+		}
+		if element == nil {
+			element = c.fresh(c.level)
+		}
+		return &Array{Element: element}
+	case *ast.HashLiteral:
+		var key, value Type
+		for _, pair := range e.Pairs {
+			key = c.join(key, c.expression(pair.Key))
+			value = c.join(value, c.expression(pair.Value))
+		}
+		if key == nil {
+			key, value = c.fresh(c.level), c.fresh(c.level)
+		}
+		return &Hash{Key: key, Value: value}
+	case *ast.IndexExpression:
+		return c.index(e)
+	case *ast.MemberExpression:
+		// Modules are checked on their own, so their exports are any, as
+		// are the methods of results.
+		c.expression(e.Left)
+	case *ast.PropagateExpression:
+		c.expression(e.Value)
+	}
+	return Any
+}
+
+func (c *checker) identifier(identifier *ast.Identifier) Type {
+	binding := c.resolution.Bindings[identifier]
+	if binding == nil {
+		return Any
+	}
+	if s, ok := c.env[binding]; ok {
+		return c.instantiate(s, c.level)
+	}
+	if s, ok := signatures[binding.Name]; ok && binding.Kind == resolver.Predeclared {
+		return c.instantiate(s, c.level)
+	}
+	return Any
+}
+
+func (c *checker) prefix(e *ast.PrefixExpression) Type {
+	right := prune(c.expression(e.Right))
+	if e.Operator == "!" {
+		return Bool
+	}
+	if _, ok := right.(*Variable); ok || right == Any || numeric(right) {
+		return right
+	}
+	c.report(e.Pos(), "invalid operation: %s%s", e.Operator, right)
+	return Any
+}
+
+func (c *checker) infix(e *ast.InfixExpression) Type {
+	left, right := prune(c.expression(e.Left)), prune(c.expression(e.Right))
+
+	var result Type
+	switch e.Operator {
+	case "==", "!=":
+		return Bool
+	case "<", ">", "<=", ">=":
+		result = Bool
+	}
+
+	// operand reports whether a value of type t may be used with the
+	// operator.
+	operand := func(t Type) bool {
+		return numeric(t) || (e.Operator == "+" && t == String)
+	}
+	_, leftVariable := left.(*Variable)
+	_, rightVariable := right.(*Variable)
+	switch {
+	case left == Any || right == Any:
+		if result == nil {
+			result = Any
+		}
+	case numeric(left) && numeric(right):
+		if result == nil {
+			result = Float
+			if left == Int && right == Int {
+				result = Int
+			}
+		}
+	case leftVariable && (rightVariable || operand(right)):
+		c.unify(left, right)
+	case rightVariable && operand(left):
+		c.unify(right, left)
+	case left == right && operand(left):
+	default:
+		c.report(e.Token.Pos(), "invalid operation: %s %s %s", left, e.Operator, right)
+		return Any
+	}
+	if result == nil {
+		result = prune(left)
+	}
+	return result
+}
+
+func (c *checker) function(f *ast.FunctionLiteral) Type {
+	t := &Function{Parameters: []Type{}}
+	for i, param := range f.Parameters {
+		var p Type
+		if annotation := f.ParameterType(i); annotation != nil {
+			p = c.annotation(annotation)
+		} else {
+			p = c.fresh(c.level)
+		}
+		// The names a pattern binds are any, like those of match arms.
+		if name, ok := param.(*ast.Identifier); ok {
+			if binding := c.resolution.Declarations[name]; binding != nil {
+				c.env[binding] = monomorphic(p)
+			}
+		}
+		c.result.types[param] = p
+		t.Parameters = append(t.Parameters, p)
+	}
+
+	scope := &function{}
+	if f.ReturnType != nil {
+		scope.result, scope.annotated = c.annotation(f.ReturnType), true
+	}
+	c.functions = append(c.functions, scope)
+	if f.Body != nil {
+		c.hoist(f.Body.Statements)
+		value := c.block(f.Body)
+		if n := len(f.Body.Statements); n > 0 {
+			if last, ok := f.Body.Statements[n-1].(*ast.ExpressionStatement); ok {
+				c.returns(value, last.Pos())
+			}
+		}
+	}
+	c.functions = c.functions[:len(c.functions)-1]
+
+	t.Result = scope.result
+	if t.Result == nil {
+		t.Result = Any
+	}
+	return t
+}
+
+func (c *checker) call(e *ast.CallExpression) Type {
+	callee := prune(c.expression(e.Function))
+	args := []Type{}
+	for _, arg := range e.Arguments {
+		args = append(args, c.expression(arg))
+	}
+
+	name := "function"
+	if identifier, ok := e.Function.(*ast.Identifier); ok {
+		name = identifier.Value
+	}
+
+	switch callee := callee.(type) {
+	case *Function:
+		if len(args) != len(callee.Parameters) {
+			c.report(e.Pos(), "wrong number of arguments to %s: expected %d, got %d", name, len(callee.Parameters), len(args))
+			return callee.Result
+		}
+		for i, arg := range args {
+			c.expect(callee.Parameters[i], arg, e.Arguments[i].Pos(), fmt.Sprintf("argument %d to %s", i+1, name))
+		}
+		return callee.Result
+	case *Variable:
+		result := c.fresh(c.level)
+		c.unify(callee, &Function{Parameters: args, Result: result})
+		return result
+	}
+	if callee != Any {
+		c.report(e.Pos(), "cannot call %s", callee)
+	}
+	return Any
+}
+
+func (c *checker) index(e *ast.IndexExpression) Type {
+	left := prune(c.expression(e.Left))
+	index := c.expression(e.Index)
+
+	switch left := left.(type) {
+	case *Array:
+		c.expect(Int, index, e.Index.Pos(), "index")
+		return left.Element
+	case *Hash:
+		c.expect(left.Key, index, e.Index.Pos(), "index")
+		return left.Value
+	case *Variable:
+		return Any
+	}
+	switch left {
+	case String:
+		c.expect(Int, index, e.Index.Pos(), "index")
+		return String
+	case Any:
+		return Any
+	}
+	c.report(e.Left.Pos(), "cannot index %s", left)
+	return Any
+}
+
+// annotation returns the type an annotation denotes.
+func (c *checker) annotation(te *ast.TypeExpression) Type {
+	elements := []Type{}
+	for _, element := range te.Elements {
+		elements = append(elements, c.annotation(element))
+	}
+	switch te.Token.Type {
+	case token.LBRACKET:
+		return &Array{Element: elements[0]}
+	case token.LBRACE:
+		return &Hash{Key: elements[0], Value: elements[1]}
+	case token.FUNCTION:
+		return &Function{Parameters: elements, Result: c.annotation(te.Result)}
+	}
+	if t, ok := basics[te.Name]; ok {
+		return t
+	}
+	c.report(te.Pos(), "unknown type %s", te.Name)
+	return Any
+}
@@ -0,0 +1,280 @@
+// Package types checks Turatti programs statically. Annotations such as
+// def x: int = 5; declare types, and everything else is inferred in the
+// style of Hindley and Milner: a function is as general as its body
+// allows, and every def is generalized so it can be used at several types.
+//
+// The checker is lenient where the language is dynamic. Values of type any
+// fit everywhere, arrays and hashes mixing elements of different types
+// hold any, and so does an if whose branches disagree.
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Type is a type of Turatti values. Variables stand for types still being
+// inferred; String prints the types they stand for.
+type Type interface {
+	String() string
+}
+
+type Basic struct {
+	Name string
+}
+
+var (
+	Int    = &Basic{Name: "int"}
+	Float  = &Basic{Name: "float"}
+	String = &Basic{Name: "string"}
+	Bool   = &Basic{Name: "bool"}
+	// Any is the type of values the checker knows nothing about, such as
+	// null or the results of variadic builtins.
+	Any = &Basic{Name: "any"}
+)
+
+var basics = map[string]*Basic{"int": Int, "float": Float, "string": String, "bool": Bool, "any": Any}
+
+type Array struct {
+	Element Type
+}
+
+type Hash struct {
+	Key, Value Type
+}
+
+type Function struct {
+	Parameters []Type
+	Result     Type
+}
+
+type Variable struct {
+	level    int
+	instance Type
+}
+
+func (b *Basic) String() string    { return b.Name }
+func (a *Array) String() string    { return format(a, names{}) }
+func (h *Hash) String() string     { return format(h, names{}) }
+func (f *Function) String() string { return format(f, names{}) }
+func (v *Variable) String() string { return format(v, names{}) }
+
+// names names the unbound variables of a type a, b, c and so on in the
+// order they appear.
+type names map[*Variable]string
+
+func (n names) of(v *Variable) string {
+	if name, ok := n[v]; ok {
+		return name
+	}
+	name := string(rune('a' + len(n)%26))
+	if len(n) >= 26 {
+		name += fmt.Sprint(len(n) / 26)
+	}
+	n[v] = name
+	return name
+}
+
+func format(t Type, n names) string {
+	switch t := prune(t).(type) {
+	case *Array:
+		return "[" + format(t.Element, n) + "]"
+	case *Hash:
+		return "{" + format(t.Key, n) + ": " + format(t.Value, n) + "}"
+	case *Function:
+		params := []string{}
+		for _, p := range t.Parameters {
+			params = append(params, format(p, n))
+		}
+		return "fun(" + strings.Join(params, ", ") + "): " + format(t.Result, n)
+	case *Variable:
+		return n.of(t)
+	case *Basic:
+		return t.Name
+	}
+	return "?"
+}
+
+// prune follows bound variables to the type they stand for.
+func prune(t Type) Type {
+	for {
+		v, ok := t.(*Variable)
+		if !ok || v.instance == nil {
+			return t
+		}
+		t = v.instance
+	}
+}
+
+func numeric(t Type) bool {
+	return t == Int || t == Float
+}
+
+// scheme is a type generalized over some of its variables, each of which
+// is replaced by a fresh one whenever the scheme is used.
+type scheme struct {
+	variables []*Variable
+	t         Type
+}
+
+func monomorphic(t Type) *scheme {
+	return &scheme{t: t}
+}
+
+// unifier binds variables so that types become equal, recording every
+// binding on a trail so that a failed attempt can be undone.
+type unifier struct {
+	trail []*Variable
+}
+
+func (u *unifier) fresh(level int) *Variable {
+	return &Variable{level: level}
+}
+
+// unify reports whether a and b can be made equal, and makes them equal if
+// they can. Nothing is bound when they cannot.
+func (u *unifier) unify(a, b Type) bool {
+	mark := len(u.trail)
+	if u.unifyTypes(a, b) {
+		return true
+	}
+	for _, v := range u.trail[mark:] {
+		v.instance = nil
+	}
+	u.trail = u.trail[:mark]
+	return false
+}
+
+func (u *unifier) unifyTypes(a, b Type) bool {
+	a, b = prune(a), prune(b)
+	if a == b {
+		return true
+	}
+	if v, ok := a.(*Variable); ok {
+		return u.bind(v, b)
+	}
+	if v, ok := b.(*Variable); ok {
+		return u.bind(v, a)
+	}
+	if a == Any || b == Any {
+		return true
+	}
+
+	switch a := a.(type) {
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && u.unifyTypes(a.Element, b.Element)
+	case *Hash:
+		b, ok := b.(*Hash)
+		return ok && u.unifyTypes(a.Key, b.Key) && u.unifyTypes(a.Value, b.Value)
+	case *Function:
+		b, ok := b.(*Function)
+		if !ok || len(a.Parameters) != len(b.Parameters) {
+			return false
+		}
+		for i := range a.Parameters {
+			if !u.unifyTypes(a.Parameters[i], b.Parameters[i]) {
+				return false
+			}
+		}
+		return u.unifyTypes(a.Result, b.Result)
+	}
+	return false
+}
+
+// bind binds v to t, unless t contains v. The variables of t are lowered
+// to the level of v, so they are not generalized before v is.
+func (u *unifier) bind(v *Variable, t Type) bool {
+	if !u.adjust(v, t) {
+		return false
+	}
+	v.instance = t
+	u.trail = append(u.trail, v)
+	return true
+}
+
+func (u *unifier) adjust(v *Variable, t Type) bool {
+	switch t := prune(t).(type) {
+	case *Variable:
+		if t == v {
+			return false
+		}
+		if t.level > v.level {
+			t.level = v.level
+		}
+	case *Array:
+		return u.adjust(v, t.Element)
+	case *Hash:
+		return u.adjust(v, t.Key) && u.adjust(v, t.Value)
+	case *Function:
+		for _, p := range t.Parameters {
+			if !u.adjust(v, p) {
+				return false
+			}
+		}
+		return u.adjust(v, t.Result)
+	}
+	return true
+}
+
+// generalize turns t into a scheme over its unbound variables deeper than
+// level.
+func generalize(t Type, level int) *scheme {
+	s := &scheme{t: t}
+	seen := map[*Variable]bool{}
+	var collect func(t Type)
+	collect = func(t Type) {
+		switch t := prune(t).(type) {
+		case *Variable:
+			if t.level > level && !seen[t] {
+				seen[t] = true
+				s.variables = append(s.variables, t)
+			}
+		case *Array:
+			collect(t.Element)
+		case *Hash:
+			collect(t.Key)
+			collect(t.Value)
+		case *Function:
+			for _, p := range t.Parameters {
+				collect(p)
+			}
+			collect(t.Result)
+		}
+	}
+	collect(t)
+	return s
+}
+
+func (u *unifier) instantiate(s *scheme, level int) Type {
+	if len(s.variables) == 0 {
+		return s.t
+	}
+	fresh := map[*Variable]Type{}
+	for _, v := range s.variables {
+		fresh[v] = u.fresh(level)
+	}
+	return substitute(s.t, fresh)
+}
+
+func substitute(t Type, fresh map[*Variable]Type) Type {
+	switch t := prune(t).(type) {
+	case *Variable:
+		if replacement, ok := fresh[t]; ok {
+			return replacement
+		}
+		return t
+	case *Array:
+		return &Array{Element: substitute(t.Element, fresh)}
+	case *Hash:
+		return &Hash{Key: substitute(t.Key, fresh), Value: substitute(t.Value, fresh)}
+	case *Function:
+		params := make([]Type, len(t.Parameters))
+		for i, p := range t.Parameters {
+			params[i] = substitute(p, fresh)
+		}
+		return &Function{Parameters: params, Result: substitute(t.Result, fresh)}
+	default:
+		return t
+	}
+}
@@ -0,0 +1,164 @@
+package types
+
+import (
+	"testing"
+	"turatti/ast"
+	"turatti/builtins"
+	"turatti/lexer"
+	"turatti/parser"
+)
+
+func check(t *testing.T, input string) (*ast.Program, *Result) {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.Parse()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program, Check(program)
+}
+
+func TestInference(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"def x = 5;", "int"},
+		{"def x = 1 + 2.5;", "float"},
+		{`def x = "a" + "b";`, "string"},
+		{"def x = 1 < 2;", "bool"},
+		{"def x = [1, 2];", "[int]"},
+		{`def x = [1, "a"];`, "[any]"},
+		{"def x = [];", "[a]"},
+		{`def x = {"a": [1.5]};`, "{string: [float]}"},
+		{"def x = fun(a) { a };", "fun(a): a"},
+		{"def x = fun(a, b) { a + b };", "fun(a, a): a"},
+		{"def x = fun(a) { a + 1 };", "fun(int): int"},
+		{"def x = fun(f, v) { f(v) };", "fun(fun(a): b, a): b"},
+		{"def x = fun(xs) { push(xs, 1) };", "fun([int]): [int]"},
+		{"def x = fun(h) { keys(h) };", "fun({a: b}): [a]"},
+		{"def x = fun(n) { if (n < 1) { return 0; } n * 2 };", "fun(int): int"},
+		{`def x = fun(n) { if (n) { "yes" } else { 0 } };`, "fun(a): any"},
+		{"def x = fun(a: int, b) { b };", "fun(int, a): a"},
+		{"def x = fun(): float { 1.5 };", "fun(): float"},
+		{"def x = fun(s: [string]) { s[0] };", "fun([string]): string"},
+		{`def x = "abc"[1];`, "string"},
+		{"def x = len(args);", "int"},
+		{"def x = puts(1, 2);", "any"},
+		{"def x: fun(int): int = fun(n) { n };", "fun(int): int"},
+		{"def x = try { 1 } catch (e) { 2 } finally { \"a\" };", "int"},
+		{"def x = try { 1 } catch (e) { \"a\" };", "any"},
+		{"def e = \"a\"; try { 1 } catch (e) { e; }; def x = e;", "string"},
+		{"def x = fun(s) { ok(s)?.unwrap() };", "fun(any): any"},
+		{"def x = fun(n) { match n { 0 => 1, [m] if m => 2, _ => n * 3 } };", "fun(int): int"},
+		{"def x = match 1 { 0 => 1, n => \"a\" };", "any"},
+		{"def x = match 1 { 0 => 1, [n] => n };", "any"},
+		{"def [a, b] = [1, 2];", "[int]"},
+		{"def x = fun([a], b: int) { b };", "fun(a, int): int"},
+		{"def x = fun({k}) { k };", "fun(a): any"},
+		{
+			"def x = fun(n) { if (n == 0) { 1 } else { n * x(n - 1) } };",
+			"fun(int): int",
+		},
+		{
+			"def x = fun() { even(10) }; def even = fun(n) { n == 0 };",
+			"fun(): bool",
+		},
+	}
+
+	for _, tt := range tests {
+		program, result := check(t, tt.input)
+		if len(result.Errors) != 0 {
+			t.Errorf("%q: unexpected errors %v", tt.input, result.Errors)
+			continue
+		}
+		def := program.Statements[0].(*ast.DefStatement)
+		if got := result.TypeOf(def.Name); got == nil || got.String() != tt.expected {
+			t.Errorf("%q: expected %s, got %v", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestPolymorphism(t *testing.T) {
+	input := `
+def id = fun(a) { a };
+def n = id(1) + 2;
+def s = id("a") + "b";
+def pair = fun(a, b) { [a, b] };
+def p = pair(1, 2);
+`
+	program, result := check(t, input)
+	if len(result.Errors) != 0 {
+		t.Fatalf("unexpected errors %v", result.Errors)
+	}
+	expected := []string{"fun(a): a", "int", "string", "fun(a, a): [a]", "[int]"}
+	for i, stmt := range program.Statements {
+		def := stmt.(*ast.DefStatement)
+		if got := result.TypeOf(def.Name).String(); got != expected[i] {
+			t.Errorf("%s: expected %s, got %s", def.Name, expected[i], got)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`1 + "a";`, []string{"1:3: invalid operation: int + string"}},
+		{`"a" < "b";`, []string{"1:5: invalid operation: string < string"}},
+		{`-"a";`, []string{"1:1: invalid operation: -string"}},
+		{"def x: int = 5.5;", []string{"1:14: cannot use float as int in definition of x"}},
+		{"def x: [int] = [\"a\"];", []string{"1:16: cannot use [string] as [int] in definition of x"}},
+		{"def x: list = 1;", []string{"1:8: unknown type list"}},
+		{"def [a]: [int] = [\"a\"];", []string{"1:18: cannot use [string] as [int] in definition of [a]"}},
+		{
+			"def f = fun(a: int, b: int): int { a + b };\nf(1, \"2\");",
+			[]string{`2:6: cannot use string as int in argument 2 to f`},
+		},
+		{
+			"def f = fun(a) { a + 1 };\nf(true);",
+			[]string{"2:3: cannot use bool as int in argument 1 to f"},
+		},
+		{
+			"def f = fun(a, b) { a };\nf(1);",
+			[]string{"2:1: wrong number of arguments to f: expected 2, got 1"},
+		},
+		{
+			"def f = fun(): string {\n    if (true) { return 1; }\n    \"a\"\n};",
+			[]string{"2:24: cannot use int as string in return"},
+		},
+		{"def f = fun(): string { 1 };", []string{"1:25: cannot use int as string in return"}},
+		{"def x = 1; x(2);", []string{"1:12: cannot call int"}},
+		{"def x = [1]; x[\"a\"];", []string{"1:16: cannot use string as int in index"}},
+		{"def x = true; x[0];", []string{"1:15: cannot index bool"}},
+		{`throw 1 + "a";`, []string{"1:9: invalid operation: int + string"}},
+		{`def f = fun() { (1 + "a")? };`, []string{"1:20: invalid operation: int + string"}},
+		{"def f = fun(h: {string: int}) { h[1] };", []string{"1:35: cannot use int as string in index"}},
+		{
+			"def a = 1 + true;\ndef b: bool = 2;",
+			[]string{"1:11: invalid operation: int + bool", "2:15: cannot use int as bool in definition of b"},
+		},
+	}
+
+	for _, tt := range tests {
+		_, result := check(t, tt.input)
+		if len(result.Errors) != len(tt.expected) {
+			t.Errorf("%q: expected errors %v, got %v", tt.input, tt.expected, result.Errors)
+			continue
+		}
+		for i, err := range result.Errors {
+			if err.Error() != tt.expected[i] {
+				t.Errorf("%q: expected %q, got %q", tt.input, tt.expected[i], err.Error())
+			}
+		}
+	}
+}
+
+func TestSignatures(t *testing.T) {
+	for _, name := range append(builtins.Names(), "args") {
+		if _, ok := signatures[name]; !ok {
+			t.Errorf("no signature for %s", name)
+		}
+	}
+}
@@ -0,0 +1,463 @@
+// Package vm executes the bytecode produced by the compiler.
+package vm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"turatti/builtins"
+	"turatti/code"
+	"turatti/compiler"
+	"turatti/object"
+)
+
+const (
+	initialStackSize = 256
+	// MaxFrames bounds the depth of nested calls, as it does on the
+	// evaluator.
+	MaxFrames = object.MaxFrames
+)
+
+type Options struct {
+	// Stdout receives the output of print, println and puts; nil means
+	// os.Stdout.
+	Stdout io.Writer
+	// File names the program in the frames of runtime errors.
+	File string
+}
+
+type frame struct {
+	closure     *object.Closure
+	scope       *object.Scope
+	ip          int
+	basePointer int
+}
+
+type VM struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+	builtins    []*object.Builtin
+	main        *object.Closure
+	file        string
+
+	stack []object.Object
+	sp    int // stack[sp-1] is the top of the stack
+
+	frames   []frame
+	handlers []handler
+}
+
+// handler is where an OpTry sends the errors raised before its OpEndTry:
+// an offset in the frame at the given depth, with the stack cut back to sp.
+type handler struct {
+	frame int
+	ip    int
+	sp    int
+}
+
+func New(bytecode *compiler.Bytecode, opts Options) *VM {
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     make([]object.Object, len(bytecode.Globals)),
+		globalNames: bytecode.Globals,
+		builtins:    builtins.New(opts.Stdout),
+		main:        &object.Closure{Fn: bytecode.Main},
+		file:        opts.File,
+		stack:       make([]object.Object, initialStackSize),
+	}
+}
+
+// SetGlobal binds a global declared through compiler.Options, reporting
+// false if the program has no global called name.
+func (vm *VM) SetGlobal(name string, value object.Object) bool {
+	for i, global := range vm.globalNames {
+		if global == name {
+			vm.globals[i] = value
+			return true
+		}
+	}
+	return false
+}
+
+// Run executes the program and returns the value of its last statement,
+// or the runtime error that stopped it.
+func (vm *VM) Run() object.Object {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext runs the program like Run, aborting with an error once ctx
+// is done.
+func (vm *VM) RunContext(ctx context.Context) object.Object {
+	vm.sp = 0
+	vm.frames = append(vm.frames[:0], frame{closure: vm.main, basePointer: 0})
+	vm.handlers = vm.handlers[:0]
+	for {
+		result, err := vm.run(ctx)
+		if err == nil {
+			return result
+		}
+		if !vm.recover(ctx, err) {
+			return err
+		}
+	}
+}
+
+// recover unwinds the stack to the innermost handler and passes it err,
+// reporting false if there is none. Cancellation cannot be recovered from.
+func (vm *VM) recover(ctx context.Context, err *object.Error) bool {
+	if len(vm.handlers) == 0 || ctx.Err() != nil {
+		return false
+	}
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	vm.frames = vm.frames[:h.frame+1]
+	vm.frames[h.frame].ip = h.ip
+	vm.sp = h.sp
+	vm.push(err)
+	return true
+}
+
+func (vm *VM) run(ctx context.Context) (object.Object, *object.Error) {
+	f := &vm.frames[len(vm.frames)-1]
+	ins := f.closure.Fn.Instructions
+
+	for {
+		start := f.ip
+		op := code.Opcode(ins[f.ip])
+		f.ip++
+
+		switch op {
+		case code.OpConstant:
+			index := code.ReadUint16(ins[f.ip:])
+			f.ip += 2
+			vm.push(vm.constants[index])
+
+		case code.OpPop:
+			vm.sp--
+
+		case code.OpNull:
+			vm.push(object.NULL)
+		case code.OpTrue:
+			vm.push(object.TRUE)
+		case code.OpFalse:
+			vm.push(object.FALSE)
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpEqual, code.OpNotEqual,
+			code.OpLessThan, code.OpGreaterThan, code.OpLessEqual, code.OpGreaterEqual:
+			right := vm.stack[vm.sp-1]
+			left := vm.stack[vm.sp-2]
+			vm.sp -= 2
+			result, err := binaryOperation(op, left, right)
+			if err != nil {
+				return nil, vm.error(f, start, err)
+			}
+			vm.push(result)
+
+		case code.OpMinus, code.OpBang:
+			operator := "-"
+			if op == code.OpBang {
+				operator = "!"
+			}
+			result, err := object.Prefix(operator, vm.stack[vm.sp-1])
+			if err != nil {
+				return nil, vm.error(f, start, err)
+			}
+			vm.stack[vm.sp-1] = result
+
+		case code.OpJump:
+			f.ip = int(code.ReadUint16(ins[f.ip:]))
+
+		case code.OpJumpNotTruthy:
+			target := int(code.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			vm.sp--
+			if !object.IsTruthy(vm.stack[vm.sp]) {
+				f.ip = target
+			}
+
+		case code.OpSetGlobal:
+			index := code.ReadUint16(ins[f.ip:])
+			f.ip += 2
+			vm.sp--
+			vm.globals[index] = vm.stack[vm.sp]
+
+		case code.OpGetGlobal:
+			index := code.ReadUint16(ins[f.ip:])
+			f.ip += 2
+			value := vm.globals[index]
+			if value == nil {
+				return nil, vm.error(f, start, object.Errorf(object.NameError, "identifier not found: %s", vm.globalNames[index]))
+			}
+			vm.push(value)
+
+		case code.OpSetLocal:
+			index := code.ReadUint16(ins[f.ip:])
+			f.ip += 2
+			vm.sp--
+			f.scope.Locals[index] = vm.stack[vm.sp]
+
+		case code.OpGetLocal:
+			index := code.ReadUint16(ins[f.ip:])
+			f.ip += 2
+			value := f.scope.Locals[index]
+			if value == nil {
+				return nil, vm.error(f, start, object.Errorf(object.NameError, "identifier not found: %s", f.scope.Fn.Locals[index]))
+			}
+			vm.push(value)
+
+		case code.OpGetFree:
+			depth := int(code.ReadUint8(ins[f.ip:]))
+			index := code.ReadUint16(ins[f.ip+1:])
+			f.ip += 3
+			scope := f.scope
+			for i := 0; i < depth; i++ {
+				scope = scope.Outer
+			}
+			value := scope.Locals[index]
+			if value == nil {
+				return nil, vm.error(f, start, object.Errorf(object.NameError, "identifier not found: %s", scope.Fn.Locals[index]))
+			}
+			vm.push(value)
+
+		case code.OpGetBuiltin:
+			index := code.ReadUint8(ins[f.ip:])
+			f.ip++
+			vm.push(vm.builtins[index])
+
+		case code.OpArray:
+			count := int(code.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			elements := make([]object.Object, count)
+			copy(elements, vm.stack[vm.sp-count:vm.sp])
+			vm.sp -= count
+			vm.push(&object.Array{Elements: elements})
+
+		case code.OpHash:
+			count := int(code.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			hash := object.NewHash()
+			for i := vm.sp - count; i < vm.sp; i += 2 {
+				if !hash.Set(vm.stack[i], vm.stack[i+1]) {
+					return nil, vm.error(f, start, object.Errorf(object.TypeError, "unusable as hash key: %s", vm.stack[i].Type()))
+				}
+			}
+			vm.sp -= count
+			vm.push(hash)
+
+		case code.OpIndex:
+			index := vm.stack[vm.sp-1]
+			left := vm.stack[vm.sp-2]
+			vm.sp -= 2
+			result, err := object.Index(left, index)
+			if err != nil {
+				return nil, vm.error(f, start, err)
+			}
+			vm.push(result)
+
+		case code.OpClosure:
+			index := code.ReadUint16(ins[f.ip:])
+			f.ip += 2
+			fn := vm.constants[index].(*object.CompiledFunction)
+			vm.push(&object.Closure{Fn: fn, Scope: f.scope})
+
+		case code.OpCall:
+			numArgs := int(code.ReadUint8(ins[f.ip:]))
+			f.ip++
+			if err := ctx.Err(); err != nil {
+				return nil, vm.error(f, start, err)
+			}
+			callee := vm.stack[vm.sp-1-numArgs]
+			switch callee := callee.(type) {
+			case *object.Closure:
+				if numArgs != callee.Fn.NumParameters {
+					return nil, vm.error(f, start, object.Errorf(object.ArgumentError, "wrong number of arguments: expected %d, got %d",
+						callee.Fn.NumParameters, numArgs))
+				}
+				if len(vm.frames) >= MaxFrames {
+					return nil, vm.error(f, start, fmt.Errorf("stack overflow"))
+				}
+				scope := &object.Scope{Fn: callee.Fn, Locals: make([]object.Object, len(callee.Fn.Locals)), Outer: callee.Scope}
+				copy(scope.Locals, vm.stack[vm.sp-numArgs:vm.sp])
+				vm.sp -= numArgs + 1
+				vm.frames = append(vm.frames, frame{closure: callee, scope: scope, basePointer: vm.sp})
+				f = &vm.frames[len(vm.frames)-1]
+				ins = callee.Fn.Instructions
+			case *object.Builtin:
+				result, err := callee.Fn(vm.stack[vm.sp-numArgs : vm.sp]...)
+				if err != nil {
+					return nil, vm.error(f, start, err)
+				}
+				if result == nil {
+					result = object.NULL
+				}
+				vm.sp -= numArgs + 1
+				vm.push(result)
+			default:
+				return nil, vm.error(f, start, object.Errorf(object.TypeError, "not a function: %s", callee.Type()))
+			}
+
+		case code.OpReturnValue:
+			result := vm.stack[vm.sp-1]
+			if len(vm.frames) == 1 {
+				vm.sp = 0
+				return result, nil
+			}
+			// the handlers of the frame go with it.
+			for n := len(vm.handlers); n > 0 && vm.handlers[n-1].frame == len(vm.frames)-1; n-- {
+				vm.handlers = vm.handlers[:n-1]
+			}
+			vm.sp = f.basePointer
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			f = &vm.frames[len(vm.frames)-1]
+			ins = f.closure.Fn.Instructions
+			vm.push(result)
+
+		case code.OpMember:
+			index := code.ReadUint16(ins[f.ip:])
+			f.ip += 2
+			name := vm.constants[index].(*object.String).Value
+			result, err := object.Member(vm.stack[vm.sp-1], name)
+			if err != nil {
+				return nil, vm.error(f, start, err)
+			}
+			vm.stack[vm.sp-1] = result
+
+		case code.OpPropagate:
+			target := int(code.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			value, ok, err := object.Propagate(vm.stack[vm.sp-1])
+			if err != nil {
+				return nil, vm.error(f, start, err)
+			}
+			if ok {
+				vm.stack[vm.sp-1] = value
+				f.ip = target
+			}
+
+		case code.OpDup:
+			vm.push(vm.stack[vm.sp-1])
+
+		case code.OpMatchArray:
+			length := int(code.ReadUint16(ins[f.ip:]))
+			rest := code.ReadUint8(ins[f.ip+2:]) == 1
+			f.ip += 3
+			vm.stack[vm.sp-1] = object.NativeBool(object.MatchArray(vm.stack[vm.sp-1], length, rest) == nil)
+
+		case code.OpMatchHash:
+			count := int(code.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			keys := vm.stack[vm.sp-count : vm.sp]
+			vm.sp -= count
+			vm.stack[vm.sp-1] = object.NativeBool(object.MatchHash(vm.stack[vm.sp-1], keys) == nil)
+
+		case code.OpRest:
+			from := int(code.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			vm.stack[vm.sp-1] = object.Rest(vm.stack[vm.sp-1], from)
+
+		case code.OpDestructureArray:
+			length := int(code.ReadUint16(ins[f.ip:]))
+			rest := code.ReadUint8(ins[f.ip+2:]) == 1
+			f.ip += 3
+			vm.sp--
+			if err := object.MatchArray(vm.stack[vm.sp], length, rest); err != nil {
+				return nil, vm.error(f, start, err)
+			}
+
+		case code.OpDestructureHash:
+			count := int(code.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			keys := vm.stack[vm.sp-count : vm.sp]
+			vm.sp -= count + 1
+			if err := object.MatchHash(vm.stack[vm.sp], keys); err != nil {
+				return nil, vm.error(f, start, err)
+			}
+
+		case code.OpTry:
+			target := int(code.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			vm.handlers = append(vm.handlers, handler{frame: len(vm.frames) - 1, ip: target, sp: vm.sp})
+
+		case code.OpEndTry:
+			if n := len(vm.handlers); n > 0 && vm.handlers[n-1].frame == len(vm.frames)-1 {
+				vm.handlers = vm.handlers[:n-1]
+			}
+
+		case code.OpCaught:
+			if err, ok := vm.stack[vm.sp-1].(*object.Error); ok {
+				vm.stack[vm.sp-1] = err.Caught()
+			}
+
+		case code.OpThrow:
+			vm.sp--
+			return nil, vm.error(f, start, object.Throw(vm.stack[vm.sp]))
+
+		case code.OpRethrow:
+			vm.sp--
+			if err, ok := vm.stack[vm.sp].(*object.Error); ok {
+				return nil, err
+			}
+			return nil, vm.error(f, start, object.Throw(vm.stack[vm.sp]))
+
+		default:
+			return nil, vm.error(f, start, fmt.Errorf("unknown opcode %d", op))
+		}
+	}
+}
+
+func binaryOperation(op code.Opcode, left, right object.Object) (object.Object, error) {
+	// Integer arithmetic dominates most programs, so it skips the generic
+	// path; the results are the same.
+	if l, ok := left.(*object.Integer); ok {
+		if r, ok := right.(*object.Integer); ok {
+			switch op {
+			case code.OpAdd:
+				return &object.Integer{Value: l.Value + r.Value}, nil
+			case code.OpSub:
+				return &object.Integer{Value: l.Value - r.Value}, nil
+			case code.OpLessThan:
+				return object.NativeBool(l.Value < r.Value), nil
+			}
+		}
+	}
+	return object.Infix(code.Operators[op], left, right)
+}
+
+func (vm *VM) push(obj object.Object) {
+	if vm.sp >= len(vm.stack) {
+		vm.stack = append(vm.stack, make([]object.Object, len(vm.stack))...)
+	}
+	vm.stack[vm.sp] = obj
+	vm.sp++
+}
+
+// error builds a runtime error positioned at the instruction of f starting
+// at offset, with a frame for every call in progress. Errors that are
+// runtime errors already, as thrown ones are, keep their value.
+func (vm *VM) error(f *frame, offset int, err error) *object.Error {
+	e, ok := err.(*object.Error)
+	if !ok {
+		e = &object.Error{Message: err.Error(), Kind: object.KindOf(err)}
+	}
+	e.Pos = f.closure.Fn.SourceMap.Lookup(offset)
+	for i := len(vm.frames) - 1; i > 0; i-- {
+		fn := vm.frames[i].closure.Fn
+		frame := object.Frame{
+			Function:   fn.Name,
+			File:       vm.file,
+			Parameters: fn.Locals[:fn.NumParameters],
+			Args:       append([]object.Object{}, vm.frames[i].scope.Locals[:fn.NumParameters]...),
+		}
+		if frame.Function == "" {
+			frame.Function = object.AnonymousFunction
+		}
+		e.AddFrame(frame)
+
+		// the caller is past the operand of its OpCall.
+		caller := &vm.frames[i-1]
+		e.CalledFrom(caller.closure.Fn.SourceMap.Lookup(caller.ip - 2))
+	}
+	e.AddFrame(object.Frame{Function: object.MainFunction, File: vm.file})
+	return e
+}
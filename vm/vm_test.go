@@ -0,0 +1,348 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"turatti/ast"
+	"turatti/compiler"
+	"turatti/evaluator"
+	"turatti/lexer"
+	"turatti/object"
+	"turatti/parser"
+)
+
+func parse(t testing.TB, input string) *ast.Program {
+	psr := parser.New(lexer.New(input))
+	program := psr.Parse()
+	if len(psr.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, psr.Errors())
+	}
+	return program
+}
+
+func run(t testing.TB, input string) (object.Object, string) {
+	bytecode, err := compiler.Compile(parse(t, input), compiler.Options{})
+	if err != nil {
+		t.Fatalf("compiler error for %q: %v", input, err)
+	}
+	var out bytes.Buffer
+	return New(bytecode, Options{Stdout: &out}).Run(), out.String()
+}
+
+// TestMatchesEvaluator runs every program through both engines, which
+// must agree on the result, on what gets printed and on runtime errors.
+func TestMatchesEvaluator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", "null"},
+		{"5", "5"},
+		{"-5 + 10 * 2", "15"},
+		{"(5 + 10) / 3", "5"},
+		{"1.5 * 2 - 1", "2.0"},
+		{"7 / 2.0 > 3", "true"},
+		{`"hello" + " " + "world"`, "hello world"},
+		{"!true == false", "true"},
+		{"!!5", "true"},
+		{"1 <= 1 == (2 >= 3)", "false"},
+		{"if (1 > 2) { 10 } else { 20 }", "20"},
+		{"if (false) { 10 }", "null"},
+		{"if (true) {}", "null"},
+		{"def a = 5; def b = a * 2; b;", "10"},
+		{"def a = 5;", "null"},
+		{"9; return 2 * 5; 9;", "10"},
+		{"if (true) { if (true) { return 10; } return 1; }", "10"},
+		{"def f = fun() { return; }; f()", "null"},
+		{"def f = fun() { def x = 1; }; f()", "null"},
+		{"def sum = fun(x, y) { x + y; }; sum(5, 10);", "15"},
+		{"def add = fun(x) { fun(y) { x + y } }; add(2)(3);", "5"},
+		{"def fib = fun(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2); }; fib(15);", "610"},
+		{"def f = fun() { g() }; def g = fun() { 7 }; f()", "7"},
+		{`def outer = fun() {
+    def even = fun(n) { if (n == 0) { true } else { odd(n - 1) } };
+    def odd = fun(n) { if (n == 0) { false } else { even(n - 1) } };
+    even(10)
+};
+outer()`, "true"},
+		{`def counter = fun(start) {
+    fun(step) { fun() { start + step } }
+};
+counter(1)(2)()`, "3"},
+		{"def f = fun(x) { if (x) { def y = 1; } y }; f(true)", "1"},
+		{`[1, 2 * 3, "a"][1]`, "6"},
+		{`{"a": 1, true: [2], 3: {}}[true]`, "[2]"},
+		{`{"a": 1}["b"]`, "null"},
+		{`"héllo"[1]`, "é"},
+		{"[1, [2, 3]] == [1, [2, 3]]", "true"},
+		{`1 == "1"`, "false"},
+		{"def f = fun(x) { x }; f", "fun(x) {x}"},
+		{"type(fun() {})", "FUNCTION"},
+		{`len(push([1], 2)) + first([4, 5])`, "6"},
+		{`println("a", 1.5); print(str([1]))`, "null"},
+		{`def xs = range(3); max(xs) + min(xs)`, "2"},
+		{"try { 1 } catch (e) { 2 }", "1"},
+		{"def x = try { throw 5; } catch (e) { e + 1 }; x", "6"},
+		{`try { 1 / 0 } catch (e) { e }`, "{kind: ZeroDivisionError, message: division by zero}"},
+		{`try { puts(1) } finally { puts(2) }`, "null"},
+		{`try { throw 1; } catch (e) { puts(e) } finally { puts("done") }; 3`, "3"},
+		{"def f = fun(n) { if (n == 0) { throw \"bottom\"; } f(n - 1) }; try { f(5) } catch (e) { e }", "bottom"},
+		{"def f = fun() { try { return 1; } finally { puts(2); } }; f() + f()", "2"},
+		{"def f = fun() { try { return 1; } finally { return 2; } }; f()", "2"},
+		{"def f = fun() { try { throw 1; } finally { return 2; } }; f()", "2"},
+		{"def f = fun() { try { try { return 1; } catch (e) { 0 } } catch (e) { 0 } }; [f(), f()]", "[1, 1]"},
+		{"def f = fun() { try { return 1; } finally { puts(2); } }; try { f() } finally { puts(3) }", "1"},
+		{"def f = fun(x) { try { x() } catch (e) { -1 } }; [f(fun() { 1 }), f(fun() { missing })]", "[1, -1]"},
+		{"try { try { throw 1; } finally { puts(2) } } catch (e) { e }", "1"},
+		{"def f = fun() { try { throw 1; return 0; } catch (e) { return 2; } finally { puts(\"fin\"); try {} catch (e) {} } }; f()", "2"},
+		{"try { throw 1; } catch (e) { try { throw e + 1; } catch (e) { e } }", "2"},
+		{"def e = 5; [try { throw 1; } catch (e) { e }, e]", "[1, 5]"},
+		{"def f = try { throw 3; } catch (e) { fun() { e } }; f()", "3"},
+		{"def f = fun() { try { throw 1; } catch (e) { def x = e + 1; }; x }; f()", "2"},
+		{"[ok(1), err(2)]", "[ok(1), err(2)]"},
+		{"ok(4).unwrap() + err(1).unwrap_or(2)", "6"},
+		{"def f = fun(r) { r? + 1 }; [f(ok(1)), f(err(0))]", "[2, err(0)]"},
+		{"def f = fun(a, b) { ok([a?, b?]) }; [f(ok(1), ok(2)), f(ok(1), err(3)), f(err(4), err(5))]", "[ok([1, 2]), err(3), err(4)]"},
+		{"def f = fun(r) { puts(r?); 0 }; f(err(1))", "err(1)"},
+		{"def f = fun(r) { try { r? } finally { puts(\"finally\") } }; f(err(1))", "err(1)"},
+		{"def f = fun(r) { def x = if (true) { r? }; x }; f(err(1))", "err(1)"},
+		{"match 2 { 1 => 10, 2 => 20, _ => 30 }", "20"},
+		{"match 3 { 1 => 10 }", "null"},
+		{`def f = fun(v) { match v { -1 => "neg", 2.5 => "float", "s" => "str", true => "yes", _ => "other" } }; [f(-1), f(2.5), f("s"), f(true), f(1)]`, "[neg, float, str, yes, other]"},
+		{"def f = fun(xs) { match xs { [] => [], [h, ...t] => push(f(t), h) } }; f([1, 2, 3])", "[3, 2, 1]"},
+		{"match [1, [2, 3]] { [a, [b]] => 0, [a, [b, c]] => a + b + c }", "6"},
+		{`match {"k": [4], "x": 1} { {"k": [_, v]} => v, {"x": x, "k": [v]} => x + v }`, "5"},
+		{`[match {} { {} => 1 }, match [] { {} => 1, [] => 2 }, match 5 { {} => 1, [..._] => 2 }]`, "[1, 2, null]"},
+		{"def f = fun(n) { match n { n if n > 9 => 1, n if n > 4 => 2, _ => 3 } }; [f(10), f(5), f(0)]", "[1, 2, 3]"},
+		{"def f = fun(r) { match r? { 0 => puts(0), n => n } }; [f(ok(0)), f(ok(1)), f(err(2))]", "[null, 1, err(2)]"},
+		{"def x = match [1] { [a] => a }; x", "1"},
+		{`match [1, 2] { [first, ...rest] => rest, _ => "other" }`, "[2]"},
+		{`def f = fun(v) { match v { [first, ...rest] => [rest, first], _ => first([v]) } }; [f([1, 2]), f("ab")]`, "[[[2], 1], ab]"},
+		{"def f = fun(v) { match v { [len] => fun() { len }, _ => len } }; [f([3])(), f(1)(\"ab\")]", "[3, 2]"},
+		{"def n = 5; [match 1 { n => n }, n]", "[1, 5]"},
+		{"match 1 { n => if (n) { def y = n + 1; } }; y", "2"},
+		{"def f = fun(x) { fun() { match x { [a, ...b] => b } } }; f([1, 2])()", "[2]"},
+		{"try { match 1 { n if n / 0 => 1 } } catch (e) { e[\"kind\"] }", "ZeroDivisionError"},
+		{"def [a, [b, ...c]] = [1, [2, 3, 4]]; [a, b, c]", "[1, 2, [3, 4]]"},
+		{`def {name, "age": years} = {"name": "ada", "age": 36}; [name, years]`, "[ada, 36]"},
+		{"def f = fun([x, y], {z}, w) { [x, y, z, w] }; f([1, 2], {\"z\": 3}, 4)", "[1, 2, 3, 4]"},
+		{"def f = fun() { def [a, ...t] = [1, 2]; fun([_], [_]) { a + t[0] } }; f()([0], [0])", "3"},
+		{"def f = fun([x]) { fun() { x } }; f([5])()", "5"},
+		{"try { def [a, b] = [1]; } catch (e) { e[\"kind\"] }", "ValueError"},
+
+		{"5 + true;", "1:1: runtime error: type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "1:1: runtime error: unknown operator: -BOOLEAN"},
+		{`"a" - "b"`, "1:1: runtime error: unknown operator: STRING - STRING"},
+		{"if (true) {\n  foobar;\n}", "2:3: runtime error: identifier not found: foobar"},
+		{"if (false) { foobar }", "null"},
+		{"10 / (5 - 5)", "1:1: runtime error: division by zero"},
+		{"def f = fun(x) { x }; f(1, 2)", "1:23: runtime error: wrong number of arguments: expected 1, got 2"},
+		{"5(1)", "1:1: runtime error: not a function: INTEGER"},
+		{"[1, 2][2]", "1:1: runtime error: index out of range: 2 with length 2"},
+		{"{[1]: 2}", "1:1: runtime error: unusable as hash key: ARRAY"},
+		{`len(1)`, "1:1: runtime error: argument to len not supported, got INTEGER"},
+		{"def f = fun() {\n    error(\"deep\");\n};\nf()", "2:5: runtime error: deep"},
+		{"def f = fun() {\n    def g = fun() { missing };\n    g()\n};\nf()", "2:21: runtime error: identifier not found: missing"},
+		{`throw "boom";`, "1:1: runtime error: boom"},
+		{"try {\n  missing\n} finally { puts(1) }", "2:3: runtime error: identifier not found: missing"},
+		{"try { 1 } finally { throw 2; }", "1:21: runtime error: 2"},
+		{"try { throw 1; } catch (e) { throw [e]; }", "1:30: runtime error: [1]"},
+		{"try { throw 1; } catch (e) {}; e", "1:32: runtime error: identifier not found: e"},
+		{"def f = fun() { try { throw 1; return 0; } catch (e) { return 2; } finally { missing; try {} catch (e) {} } }; f()", "1:78: runtime error: identifier not found: missing"},
+		{"def f = fun() { 1? }; f()", "1:17: runtime error: ? operator not supported: INTEGER"},
+		{"err(1).unwrap()", "1:1: runtime error: unwrap called on err(1)"},
+		{"ok(1).missing", "1:7: runtime error: RESULT has no method missing"},
+		{"[1].length", "1:5: runtime error: member access not supported: ARRAY"},
+		{"match [1] { [a] if a + true => 1 }", "1:20: runtime error: type mismatch: INTEGER + BOOLEAN"},
+		{"match [1] { [x] if x > 5 => 0, _ => x }", "1:37: runtime error: identifier not found: x"},
+		{"def x = match [1] { [a] => a }; [x, a]", "1:37: runtime error: identifier not found: a"},
+		{"def [a, b] = 5;", "1:5: runtime error: cannot destructure INTEGER as ARRAY"},
+		{"def [a, [b]] = [1, [2, 3]];", "1:9: runtime error: cannot destructure ARRAY of length 2 into 1 elements"},
+		{`def {"k": {j}} = {"k": {}};`, "1:11: runtime error: cannot destructure HASH without key j"},
+		{"def f = fun(a, {k}) { k };\nf(1, [])", "1:16: runtime error: cannot destructure ARRAY as HASH"},
+	}
+
+	for _, tt := range tests {
+		var evalOut bytes.Buffer
+		env := evaluator.NewGlobalEnvironment(evaluator.Options{Stdout: &evalOut})
+		evaluated := evaluator.Eval(parse(t, tt.input), env)
+		if evaluated.Inspect() != tt.expected {
+			t.Fatalf("%q: the evaluator disagrees with the test: expected %q, got %q", tt.input, tt.expected, evaluated.Inspect())
+		}
+
+		result, out := run(t, tt.input)
+		if result.Inspect() != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, result.Inspect())
+		}
+		if out != evalOut.String() {
+			t.Errorf("%q: expected output %q, got %q", tt.input, evalOut.String(), out)
+		}
+	}
+}
+
+func TestTracebacksMatchEvaluator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + true", "Traceback (most recent call last):\n" +
+			"  File \"t.trt\", line 1, column 1, in <main>\n" +
+			"TypeError: type mismatch: INTEGER + BOOLEAN\n"},
+		{"def f = fun(xs, i) {\n    xs[i]\n};\ndef g = fun() { f([1], 3) };\ng();", "Traceback (most recent call last):\n" +
+			"  File \"t.trt\", line 5, column 1, in <main>\n" +
+			"  File \"t.trt\", line 4, column 17, in g\n" +
+			"  File \"t.trt\", line 2, column 5, in f\n" +
+			"    xs = [1]\n    i = 3\n" +
+			"IndexError: index out of range: 3 with length 1\n"},
+		{"fun(n) { n / 0 }(4)", "Traceback (most recent call last):\n" +
+			"  File \"t.trt\", line 1, column 1, in <main>\n" +
+			"  File \"t.trt\", line 1, column 10, in <anonymous>\n" +
+			"    n = 4\n" +
+			"ZeroDivisionError: division by zero\n"},
+		{"def f = fun() { len(1, 2) }; f()", "Traceback (most recent call last):\n" +
+			"  File \"t.trt\", line 1, column 30, in <main>\n" +
+			"  File \"t.trt\", line 1, column 17, in f\n" +
+			"ArgumentError: wrong number of arguments to len: expected 1, got 2\n"},
+		{"def f = fun() {\n    try { [][0] } finally { 1 }\n};\nf()", "Traceback (most recent call last):\n" +
+			"  File \"t.trt\", line 4, column 1, in <main>\n" +
+			"  File \"t.trt\", line 2, column 11, in f\n" +
+			"IndexError: index out of range: 0 with length 0\n"},
+		{"def f = fun(x) { throw {\"kind\": \"ValueError\", \"message\": x}; };\nf(\"bad\")", "Traceback (most recent call last):\n" +
+			"  File \"t.trt\", line 2, column 1, in <main>\n" +
+			"  File \"t.trt\", line 1, column 18, in f\n" +
+			"    x = \"bad\"\n" +
+			"ValueError: bad\n"},
+		{"def f = fun(a, b) { a + b };\nf(1, \"1\")", "Traceback (most recent call last):\n" +
+			"  File \"t.trt\", line 2, column 1, in <main>\n" +
+			"  File \"t.trt\", line 1, column 21, in f\n" +
+			"    a = 1\n    b = \"1\"\n" +
+			"TypeError: type mismatch: INTEGER + STRING\n"},
+		{"def f = fun(n, [a, b]) { a + b };\nf(1, [2]);", "Traceback (most recent call last):\n" +
+			"  File \"t.trt\", line 2, column 1, in <main>\n" +
+			"  File \"t.trt\", line 1, column 16, in f\n" +
+			"    n = 1\n    [a, b] = [2]\n" +
+			"ValueError: cannot destructure ARRAY of length 1 into 2 elements\n"},
+	}
+
+	for _, tt := range tests {
+		env := evaluator.NewGlobalEnvironment(evaluator.Options{File: "t.trt"})
+		evaluated, ok := evaluator.Eval(parse(t, tt.input), env).(*object.Error)
+		if !ok || evaluated.Traceback(true) != tt.expected {
+			t.Fatalf("%q: the evaluator disagrees with the test: expected\n%s\ngot\n%s", tt.input, tt.expected, evaluated.Traceback(true))
+		}
+
+		bytecode, err := compiler.Compile(parse(t, tt.input), compiler.Options{})
+		if err != nil {
+			t.Fatalf("compiler error for %q: %v", tt.input, err)
+		}
+		result, ok := New(bytecode, Options{File: "t.trt"}).Run().(*object.Error)
+		if !ok || result.Traceback(true) != tt.expected {
+			t.Errorf("%q: expected\n%s\ngot\n%s", tt.input, tt.expected, result.Traceback(true))
+		}
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	bytecode, err := compiler.Compile(parse(t, "args[0] + 1"), compiler.Options{Globals: []string{"args"}})
+	if err != nil {
+		t.Fatalf("compiler error: %v", err)
+	}
+	machine := New(bytecode, Options{})
+	if !machine.SetGlobal("args", &object.Array{Elements: []object.Object{&object.Integer{Value: 41}}}) {
+		t.Fatalf("expected args to be a global")
+	}
+	if machine.SetGlobal("missing", object.NULL) {
+		t.Errorf("expected unknown globals to be rejected")
+	}
+	if result := machine.Run(); result.Inspect() != "42" {
+		t.Errorf("expected 42, got %s", result.Inspect())
+	}
+}
+
+func TestDeepRecursion(t *testing.T) {
+	result, _ := run(t, "def down = fun(n) { if (n == 0) { 0 } else { down(n - 1) } }; down(5000)")
+	if result.Inspect() != "0" {
+		t.Errorf("expected deep recursion to work, got %s", result.Inspect())
+	}
+
+	result, _ = run(t, "def forever = fun(n) { forever(n + 1) }; forever(0)")
+	if result.Inspect() != "1:24: runtime error: stack overflow" {
+		t.Errorf("expected a stack overflow, got %s", result.Inspect())
+	}
+	lines := strings.Split(result.(*object.Error).Traceback(false), "\n")
+	if len(lines) != 8 || lines[5] != fmt.Sprintf("  [Previous frame repeated %d more times]", MaxFrames-4) {
+		t.Errorf("expected the repeated frames to be cut short, got %q", lines)
+	}
+
+	env := evaluator.NewGlobalEnvironment(evaluator.Options{})
+	evaluated := evaluator.Eval(parse(t, "def forever = fun(n) { forever(n + 1) }; forever(0)"), env)
+	if evaluated.Inspect() != result.Inspect() || evaluated.(*object.Error).Traceback(false) != result.(*object.Error).Traceback(false) {
+		t.Errorf("expected the evaluator to overflow like the VM, got %s", evaluated.Inspect())
+	}
+}
+
+func TestRunHonoursContext(t *testing.T) {
+	bytecode, err := compiler.Compile(parse(t, "def f = fun() { 1 }; f()"), compiler.Options{})
+	if err != nil {
+		t.Fatalf("compiler error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result := New(bytecode, Options{}).RunContext(ctx)
+	if result.Inspect() != "1:22: runtime error: context canceled" {
+		t.Errorf("expected the run to be canceled, got %s", result.Inspect())
+	}
+}
+
+func TestRunDecodedBytecode(t *testing.T) {
+	bytecode, err := compiler.Compile(parse(t, "def fib = fun(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10) + 0.5"), compiler.Options{})
+	if err != nil {
+		t.Fatalf("compiler error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := compiler.Encode(&buf, bytecode); err != nil {
+		t.Fatalf("encoding failed: %v", err)
+	}
+	decoded, err := compiler.Decode(&buf)
+	if err != nil {
+		t.Fatalf("decoding failed: %v", err)
+	}
+	if result := New(decoded, Options{}).Run(); result.Inspect() != "55.5" {
+		t.Errorf("expected 55.5, got %s", result.Inspect())
+	}
+}
+
+const fibonacci = `
+def fib = fun(n) {
+    if (n < 2) {
+        return n;
+    }
+    fib(n - 1) + fib(n - 2)
+};
+fib(20);
+`
+
+func BenchmarkFibonacciEvaluator(b *testing.B) {
+	program := parse(b, fibonacci)
+	for i := 0; i < b.N; i++ {
+		env := evaluator.NewGlobalEnvironment(evaluator.Options{})
+		if result := evaluator.Eval(program, env); result.Inspect() != "6765" {
+			b.Fatalf("unexpected result %s", result.Inspect())
+		}
+	}
+}
+
+func BenchmarkFibonacciVM(b *testing.B) {
+	bytecode, err := compiler.Compile(parse(b, fibonacci), compiler.Options{})
+	if err != nil {
+		b.Fatalf("compiler error: %v", err)
+	}
+	for i := 0; i < b.N; i++ {
+		if result := New(bytecode, Options{}).Run(); result.Inspect() != "6765" {
+			b.Fatalf("unexpected result %s", result.Inspect())
+		}
+	}
+}